@@ -0,0 +1,67 @@
+// Package coaptest provides utilities for testing of CoAP handlers, similar to net/http/httptest.
+package coaptest
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/plgd-dev/go-coap/v2/mux"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/udp"
+	"github.com/plgd-dev/go-coap/v2/udp/client"
+)
+
+// Server is a CoAP server listening on a random UDP port of the loopback with a client dialed to it.
+type Server struct {
+	// Addr is the address of the server in form host:port.
+	Addr string
+
+	listener *coapNet.UDPConn
+	server   *udp.Server
+	client   *client.ClientConn
+	wg       sync.WaitGroup
+	closed   sync.Once
+}
+
+// NewServer starts the server which serves requests by the handler and dials the client to it.
+// The options are applied after the handler. It panics on failure, the caller should call Close when finished.
+func NewServer(handler mux.Handler, opts ...udp.ServerOption) *Server {
+	l, err := coapNet.NewListenUDP("udp4", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("coaptest: cannot listen: %v", err))
+	}
+	s := &Server{
+		Addr:     l.LocalAddr().String(),
+		listener: l,
+		server:   udp.NewServer(append([]udp.ServerOption{udp.WithMux(handler)}, opts...)...),
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		_ = s.server.Serve(l)
+	}()
+	cc, err := udp.Dial(s.Addr)
+	if err != nil {
+		s.Close()
+		panic(fmt.Sprintf("coaptest: cannot dial %v: %v", s.Addr, err))
+	}
+	s.client = cc
+	return s
+}
+
+// Client returns the client connected to the server.
+func (s *Server) Client() *client.ClientConn {
+	return s.client
+}
+
+// Close closes the client, stops the server and waits until it's finished.
+func (s *Server) Close() {
+	s.closed.Do(func() {
+		if s.client != nil {
+			_ = s.client.Close()
+		}
+		s.server.Stop()
+		s.wg.Wait()
+		_ = s.listener.Close()
+	})
+}
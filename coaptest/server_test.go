@@ -0,0 +1,43 @@
+package coaptest_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/coaptest"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	r := mux.NewRouter()
+	err := r.Handle("/x", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")))
+		require.NoError(t, err)
+	}))
+	require.NoError(t, err)
+
+	srv := coaptest.NewServer(r)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := srv.Client().Get(ctx, "/x")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	b, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), b)
+
+	resp, err = srv.Client().Get(ctx, "/y")
+	require.NoError(t, err)
+	require.Equal(t, codes.NotFound, resp.Code())
+
+	srv.Close()
+	// Close is idempotent
+	srv.Close()
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/pion/dtls/v2"
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+	"github.com/plgd-dev/go-coap/v2/net/clock"
 	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
 
 	"github.com/plgd-dev/go-coap/v2/message/codes"
@@ -20,6 +21,9 @@ import (
 	kitSync "github.com/plgd-dev/kit/sync"
 )
 
+// defaultHandshakeTimeout is same as the pion/dtls uses when the ConnectContextMaker isn't set.
+const defaultHandshakeTimeout = 30 * time.Second
+
 var defaultDialOptions = dialOptions{
 	ctx:            context.Background(),
 	maxMessageSize: 64 * 1024,
@@ -48,6 +52,7 @@ var defaultDialOptions = dialOptions{
 	transmissionAcknowledgeTimeout: time.Second * 2,
 	transmissionMaxRetransmit:      4,
 	getMID:                         udpMessage.GetMID,
+	getToken:                       message.GetToken,
 	createInactivityMonitor: func() inactivity.Monitor {
 		return inactivity.NewNilMonitor()
 	},
@@ -68,9 +73,17 @@ type dialOptions struct {
 	transmissionNStart             time.Duration
 	transmissionAcknowledgeTimeout time.Duration
 	transmissionMaxRetransmit      int
+	newCongestionControl           client.NewCongestionControlFunc
+	clock                          clock.Clock
+	onSend                         MessageFunc
+	onReceive                      MessageFunc
+	onStats                        StatsFunc
+	statsInterval                  time.Duration
 	getMID                         GetMIDFunc
+	getToken                       GetTokenFunc
 	closeSocket                    bool
 	createInactivityMonitor        func() inactivity.Monitor
+	idleTimeout                    time.Duration
 }
 
 // A DialOption sets options such as credentials, keepalive parameters, etc.
@@ -78,7 +91,9 @@ type DialOption interface {
 	applyDial(*dialOptions)
 }
 
-// Dial creates a client connection to the given target.
+// Dial creates a client connection to the given target. It performs the DTLS handshake and returns
+// the connection ready for requests, with the blockwise transfers and observations set up same as for the server.
+// The context set by WithContext bounds the handshake too, when it fails the socket is closed.
 func Dial(target string, dtlsCfg *dtls.Config, opts ...DialOption) (*client.ClientConn, error) {
 	cfg := defaultDialOptions
 	for _, o := range opts {
@@ -90,14 +105,38 @@ func Dial(target string, dtlsCfg *dtls.Config, opts ...DialOption) (*client.Clie
 		return nil, err
 	}
 
-	conn, err := dtls.Client(c, dtlsCfg)
+	ctx, cancel := handshakeContext(cfg.ctx, dtlsCfg)
+	conn, err := dtls.ClientWithContext(ctx, c, dtlsCfg)
+	cancel()
 	if err != nil {
-		return nil, err
+		_ = c.Close()
+		return nil, fmt.Errorf("cannot establish dtls connection: %w", err)
 	}
 	opts = append(opts, WithCloseSocket())
 	return Client(conn, opts...), nil
 }
 
+// handshakeContext bounds the handshake by ctx and by the context of dtlsCfg.ConnectContextMaker,
+// or by the default timeout of the pion/dtls when it isn't set.
+func handshakeContext(ctx context.Context, dtlsCfg *dtls.Config) (context.Context, context.CancelFunc) {
+	if dtlsCfg.ConnectContextMaker == nil {
+		return context.WithTimeout(ctx, defaultHandshakeTimeout)
+	}
+	connectCtx, connectCancel := dtlsCfg.ConnectContextMaker()
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-connectCtx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		cancel()
+		connectCancel()
+	}
+}
+
 func bwAcquireMessage(ctx context.Context) blockwise.Message {
 	return pool.AcquireMessage(ctx)
 }
@@ -125,8 +164,9 @@ func bwCreateHandlerFunc(observatioRequests *kitSync.Map) func(token message.Tok
 	}
 }
 
-// Client creates client over dtls connection.
-func Client(conn *dtls.Conn, opts ...DialOption) *client.ClientConn {
+// Client creates client over dtls connection. Any connection which preserves boundaries of datagrams
+// can be used, eg. memtransport.Conn.
+func Client(conn net.Conn, opts ...DialOption) *client.ClientConn {
 	cfg := defaultDialOptions
 	for _, o := range opts {
 		o.applyDial(&cfg)
@@ -162,7 +202,7 @@ func Client(conn *dtls.Conn, opts ...DialOption) *client.ClientConn {
 	}
 
 	observationTokenHandler := client.NewHandlerContainer()
-	monitor := cfg.createInactivityMonitor()
+	monitor := withIdleTimeout(cfg.createInactivityMonitor(), cfg.idleTimeout)
 	var cc *client.ClientConn
 	l := coapNet.NewConn(conn, coapNet.WithHeartBeat(cfg.heartBeat), coapNet.WithOnReadTimeout(func() error {
 		monitor.CheckInactivity(cc)
@@ -173,17 +213,33 @@ func Client(conn *dtls.Conn, opts ...DialOption) *client.ClientConn {
 		cfg.maxMessageSize,
 		cfg.closeSocket,
 	)
-	cc = client.NewClientConn(session,
-		observationTokenHandler, observatioRequests, cfg.transmissionNStart, cfg.transmissionAcknowledgeTimeout, cfg.transmissionMaxRetransmit,
-		client.NewObservationHandler(observationTokenHandler, cfg.handler),
-		cfg.blockwiseSZX,
-		blockWise,
-		cfg.goPool,
-		cfg.errors,
-		cfg.getMID,
+	var congestionControl client.CongestionControl
+	if cfg.newCongestionControl != nil {
+		congestionControl = cfg.newCongestionControl()
+	}
+	cc = client.New(client.ConnConfig{
+		Session:                        session,
+		ObservationTokenHandler:        observationTokenHandler,
+		ObservationRequests:            observatioRequests,
+		TransmissionNStart:             cfg.transmissionNStart,
+		TransmissionAcknowledgeTimeout: cfg.transmissionAcknowledgeTimeout,
+		TransmissionMaxRetransmit:      cfg.transmissionMaxRetransmit,
+		Handler:                        client.NewObservationHandler(observationTokenHandler, client.NewResetUnknownResponseHandler(cfg.handler)),
+		BlockwiseSZX:                   cfg.blockwiseSZX,
+		BlockWise:                      blockWise,
+		GoPool:                         cfg.goPool,
+		Errors:                         cfg.errors,
+		GetMID:                         cfg.getMID,
+		GetToken:                       cfg.getToken,
 		// The client does not support activity monitoring yet
-		monitor,
-	)
+		ActivityMonitor:   monitor,
+		CongestionControl: congestionControl,
+		Clock:             cfg.clock,
+		OnSend:            cfg.onSend,
+		OnReceive:         cfg.onReceive,
+		OnStats:           cfg.onStats,
+		StatsInterval:     cfg.statsInterval,
+	})
 
 	go func() {
 		err := cc.Run()
@@ -10,9 +10,10 @@ import (
 	piondtls "github.com/pion/dtls/v2"
 	"github.com/plgd-dev/go-coap/v2/dtls"
 	"github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
 )
 
-func ExampleGet() {
+func ExampleDial() {
 	dtlsCfg := &piondtls.Config{
 		PSK: func(hint []byte) ([]byte, error) {
 			fmt.Printf("Hint: %s \n", hint)
@@ -28,10 +29,12 @@ func ExampleGet() {
 	defer conn.Close()
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
+	// Get blocks until the response arrives, retransmissions and block-wise transfer are handled by the connection.
 	res, err := conn.Get(ctx, "/oic/res")
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer pool.ReleaseMessage(res)
 	data, err := ioutil.ReadAll(res.Body())
 	if err != nil {
 		log.Fatal(err)
@@ -39,7 +42,7 @@ func ExampleGet() {
 	fmt.Printf("%v", data)
 }
 
-func ExampleServe() {
+func ExampleServer_Serve() {
 	dtlsCfg := &piondtls.Config{
 		PSK: func(hint []byte) ([]byte, error) {
 			fmt.Printf("Hint: %s \n", hint)
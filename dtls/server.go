@@ -13,11 +13,12 @@ import (
 	"github.com/plgd-dev/go-coap/v2/message/codes"
 	coapNet "github.com/plgd-dev/go-coap/v2/net"
 	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+	"github.com/plgd-dev/go-coap/v2/net/clock"
 	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/net/ratelimit"
 	"github.com/plgd-dev/go-coap/v2/udp/client"
 	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
 	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
-	kitSync "github.com/plgd-dev/kit/sync"
 )
 
 // A ServerOption sets options such as credentials, codec and keepalive parameters, etc.
@@ -38,15 +39,31 @@ type BlockwiseFactoryFunc = func(getSendedRequest func(token message.Token) (blo
 // OnNewClientConnFunc is the callback for new connections.
 //
 // Note: Calling `dtlsConn.Close()` is forbidden, and `dtlsConn` should be treated as a
-// "read-only" parameter, mainly used to get the peer certificate from the underlining connection
+// "read-only" parameter, mainly used to get the peer certificate from the underlining connection.
+// It's nil when the listener doesn't accept dtls connections, eg. memtransport.Listener.
 type OnNewClientConnFunc = func(cc *client.ClientConn, dtlsConn *dtls.Conn)
 
+// OnRejectedConnFunc is the callback for connections which were rejected due to the limit of concurrent connections.
+type OnRejectedConnFunc = func(remoteAddr net.Addr)
+
 type GetMIDFunc = func() uint16
+type GetTokenFunc = func() (message.Token, error)
+
+type MessageFunc = func(*pool.Message)
+type StatsFunc = client.StatsFunc
 
 func closeClientConn(cc *client.ClientConn) {
 	cc.Close()
 }
 
+// withIdleTimeout extends the monitor to close the connection when no message was received for the idleTimeout.
+func withIdleTimeout(monitor inactivity.Monitor, idleTimeout time.Duration) inactivity.Monitor {
+	if idleTimeout <= 0 {
+		return monitor
+	}
+	return inactivity.NewMultiMonitor(monitor, inactivity.NewInactivityMonitor(idleTimeout, inactivity.CloseClientConn))
+}
+
 var defaultServerOptions = serverOptions{
 	ctx:            context.Background(),
 	maxMessageSize: 64 * 1024,
@@ -74,6 +91,7 @@ var defaultServerOptions = serverOptions{
 	transmissionAcknowledgeTimeout: time.Second * 2,
 	transmissionMaxRetransmit:      4,
 	getMID:                         udpMessage.GetMID,
+	getToken:                       message.GetToken,
 }
 
 type serverOptions struct {
@@ -87,12 +105,29 @@ type serverOptions struct {
 	blockwiseSZX                   blockwise.SZX
 	blockwiseEnable                bool
 	blockwiseTransferTimeout       time.Duration
+	blockwiseCache                 *blockwise.BlockCache
+	blockwiseUploadStreaming       bool
+	separateResponse               bool
 	onNewClientConn                OnNewClientConnFunc
 	heartBeat                      time.Duration
 	transmissionNStart             time.Duration
 	transmissionAcknowledgeTimeout time.Duration
 	transmissionMaxRetransmit      int
+	newCongestionControl           client.NewCongestionControlFunc
+	clock                          clock.Clock
+	onSend                         MessageFunc
+	onReceive                      MessageFunc
+	onStats                        StatsFunc
+	statsInterval                  time.Duration
 	getMID                         GetMIDFunc
+	getToken                       GetTokenFunc
+	idleTimeout                    time.Duration
+	maxConnections                 int
+	blockAcceptOnMaxConnections    bool
+	onRejectedConn                 OnRejectedConnFunc
+	rateLimiter                    *ratelimit.Limiter
+	authorize                      client.AuthorizeFunc
+	dedupStore                     client.DedupStore
 }
 
 // Listener defined used by coap
@@ -110,18 +145,38 @@ type Server struct {
 	blockwiseSZX                   blockwise.SZX
 	blockwiseEnable                bool
 	blockwiseTransferTimeout       time.Duration
+	blockwiseCache                 *blockwise.BlockCache
+	blockwiseUploadStreaming       bool
+	separateResponse               bool
+	authorize                      client.AuthorizeFunc
 	onNewClientConn                OnNewClientConnFunc
 	heartBeat                      time.Duration
 	transmissionNStart             time.Duration
 	transmissionAcknowledgeTimeout time.Duration
 	transmissionMaxRetransmit      int
+	newCongestionControl           client.NewCongestionControlFunc
+	clock                          clock.Clock
+	onSend                         MessageFunc
+	onReceive                      MessageFunc
+	onStats                        StatsFunc
+	statsInterval                  time.Duration
 	getMID                         GetMIDFunc
+	getToken                       GetTokenFunc
+	idleTimeout                    time.Duration
+	blockAcceptOnMaxConnections    bool
+	onRejectedConn                 OnRejectedConnFunc
+	dedupStore                     client.DedupStore
+	// connSlots limits the number of concurrent connections, nil means unlimited
+	connSlots chan struct{}
 
 	ctx    context.Context
 	cancel context.CancelFunc
 
 	listen      Listener
 	listenMutex sync.Mutex
+
+	conns      map[*client.ClientConn]struct{}
+	connsMutex sync.Mutex
 }
 
 func NewServer(opt ...ServerOption) *Server {
@@ -130,6 +185,10 @@ func NewServer(opt ...ServerOption) *Server {
 		o.apply(&opts)
 	}
 
+	if opts.rateLimiter != nil {
+		opts.handler = client.NewRateLimitHandler(opts.rateLimiter, opts.handler)
+	}
+
 	ctx, cancel := context.WithCancel(opts.ctx)
 	if opts.errors == nil {
 		opts.errors = func(error) {}
@@ -139,14 +198,28 @@ func NewServer(opt ...ServerOption) *Server {
 		opts.getMID = udpMessage.GetMID
 	}
 
+	if opts.getToken == nil {
+		opts.getToken = message.GetToken
+	}
+
 	if opts.createInactivityMonitor == nil {
 		opts.createInactivityMonitor = func() inactivity.Monitor {
 			return inactivity.NewNilMonitor()
 		}
 	}
 
+	if opts.clock == nil {
+		opts.clock = clock.Real
+	}
+
+	var connSlots chan struct{}
+	if opts.maxConnections > 0 {
+		connSlots = make(chan struct{}, opts.maxConnections)
+	}
+
 	return &Server{
 		ctx:            ctx,
+		conns:          make(map[*client.ClientConn]struct{}),
 		cancel:         cancel,
 		handler:        opts.handler,
 		maxMessageSize: opts.maxMessageSize,
@@ -162,12 +235,28 @@ func NewServer(opt ...ServerOption) *Server {
 		blockwiseSZX:                   opts.blockwiseSZX,
 		blockwiseEnable:                opts.blockwiseEnable,
 		blockwiseTransferTimeout:       opts.blockwiseTransferTimeout,
+		blockwiseCache:                 opts.blockwiseCache,
+		blockwiseUploadStreaming:       opts.blockwiseUploadStreaming,
+		separateResponse:               opts.separateResponse,
+		authorize:                      opts.authorize,
 		onNewClientConn:                opts.onNewClientConn,
 		heartBeat:                      opts.heartBeat,
 		transmissionNStart:             opts.transmissionNStart,
 		transmissionAcknowledgeTimeout: opts.transmissionAcknowledgeTimeout,
 		transmissionMaxRetransmit:      opts.transmissionMaxRetransmit,
+		newCongestionControl:           opts.newCongestionControl,
+		clock:                          opts.clock,
+		onSend:                         opts.onSend,
+		onReceive:                      opts.onReceive,
+		onStats:                        opts.onStats,
+		statsInterval:                  opts.statsInterval,
 		getMID:                         opts.getMID,
+		getToken:                       opts.getToken,
+		idleTimeout:                    opts.idleTimeout,
+		blockAcceptOnMaxConnections:    opts.blockAcceptOnMaxConnections,
+		onRejectedConn:                 opts.onRejectedConn,
+		dedupStore:                     opts.dedupStore,
+		connSlots:                      connSlots,
 	}
 }
 
@@ -198,6 +287,11 @@ func (s *Server) checkAcceptError(err error) (bool, error) {
 		}
 		return false, nil
 	default:
+		if coapNet.IsFatalAcceptError(err) {
+			s.Stop()
+			return false, err
+		}
+		s.errors(fmt.Errorf("cannot accept connection: %w", err))
 		return true, nil
 	}
 }
@@ -218,42 +312,127 @@ func (s *Server) Serve(l Listener) error {
 
 	var wg sync.WaitGroup
 	defer wg.Wait()
+	var backoff coapNet.AcceptBackoff
 	for {
+		if s.blockAcceptOnMaxConnections && !s.waitForConnSlot() {
+			return nil
+		}
 		rw, err := l.AcceptWithContext(s.ctx)
 		ok, err := s.checkAcceptError(err)
 		if err != nil {
+			s.releaseConnSlot(s.blockAcceptOnMaxConnections)
 			return err
 		}
 		if !ok {
+			s.releaseConnSlot(s.blockAcceptOnMaxConnections)
 			return nil
 		}
-		if rw != nil {
-			wg.Add(1)
-			var cc *client.ClientConn
-			monitor := s.createInactivityMonitor()
-			opts := []coapNet.ConnOption{
-				coapNet.WithHeartBeat(s.heartBeat),
-				coapNet.WithOnReadTimeout(func() error {
-					monitor.CheckInactivity(cc)
-					return nil
-				}),
+		if rw == nil {
+			s.releaseConnSlot(s.blockAcceptOnMaxConnections)
+			if !backoff.Wait(s.ctx) {
+				return nil
 			}
-			cc = s.createClientConn(coapNet.NewConn(rw, opts...), monitor)
-			if s.onNewClientConn != nil {
-				dtlsConn := rw.(*dtls.Conn)
-				s.onNewClientConn(cc, dtlsConn)
+			continue
+		}
+		backoff.Reset()
+		if !s.blockAcceptOnMaxConnections && !s.tryConnSlot() {
+			rw.Close()
+			if s.onRejectedConn != nil {
+				s.onRejectedConn(rw.RemoteAddr())
 			}
-			go func() {
-				defer wg.Done()
-				err := cc.Run()
-				if err != nil {
-					s.errors(fmt.Errorf("%v: %w", cc.RemoteAddr(), err))
-				}
-			}()
+			continue
 		}
+		wg.Add(1)
+		var cc *client.ClientConn
+		monitor := withIdleTimeout(s.createInactivityMonitor(), s.idleTimeout)
+		opts := []coapNet.ConnOption{
+			coapNet.WithHeartBeat(s.heartBeat),
+			coapNet.WithOnReadTimeout(func() error {
+				monitor.CheckInactivity(cc)
+				return nil
+			}),
+		}
+		cc = s.createClientConn(coapNet.NewConn(rw, opts...), monitor)
+		if s.onNewClientConn != nil {
+			dtlsConn, _ := rw.(*dtls.Conn)
+			s.onNewClientConn(cc, dtlsConn)
+		}
+		s.addConn(cc)
+		go func() {
+			defer wg.Done()
+			defer s.releaseConnSlot(true)
+			defer s.removeConn(cc)
+			err := cc.Run()
+			if err != nil {
+				s.errors(fmt.Errorf("%v: %w", cc.RemoteAddr(), err))
+			}
+		}()
 	}
 }
 
+// waitForConnSlot blocks until the number of connections is under the limit. It returns false when the server was stopped.
+func (s *Server) waitForConnSlot() bool {
+	if s.connSlots == nil {
+		return true
+	}
+	select {
+	case s.connSlots <- struct{}{}:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+// tryConnSlot reserves a connection slot without blocking. It returns false when the limit was reached.
+func (s *Server) tryConnSlot() bool {
+	if s.connSlots == nil {
+		return true
+	}
+	select {
+	case s.connSlots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Server) releaseConnSlot(reserved bool) {
+	if s.connSlots == nil || !reserved {
+		return
+	}
+	<-s.connSlots
+}
+
+// Connections returns the connections of the server which are alive, eg. to inspect the peers by RemoteAddr
+// and Stats.
+func (s *Server) Connections() []*client.ClientConn {
+	s.connsMutex.Lock()
+	defer s.connsMutex.Unlock()
+	conns := make([]*client.ClientConn, 0, len(s.conns))
+	for cc := range s.conns {
+		conns = append(conns, cc)
+	}
+	return conns
+}
+
+func (s *Server) addConn(cc *client.ClientConn) {
+	s.connsMutex.Lock()
+	defer s.connsMutex.Unlock()
+	s.conns[cc] = struct{}{}
+}
+
+func (s *Server) removeConn(cc *client.ClientConn) {
+	s.connsMutex.Lock()
+	defer s.connsMutex.Unlock()
+	delete(s.conns, cc)
+}
+
+// Broadcast writes the message created by buildMsg to all connections of the server concurrently,
+// eg. a non-confirmable notification of a configuration change. See client.Broadcast.
+func (s *Server) Broadcast(ctx context.Context, buildMsg func() *pool.Message) error {
+	return client.Broadcast(ctx, s.Connections(), buildMsg)
+}
+
 // Stop stops server without wait of ends Serve function.
 func (s *Server) Stop() {
 	s.cancel()
@@ -271,6 +450,9 @@ func (s *Server) createClientConn(connection *coapNet.Conn, monitor inactivity.M
 			func(token message.Token) (blockwise.Message, bool) {
 				return nil, false
 			},
+			blockwise.WithBlockCache(s.blockwiseCache),
+			blockwise.WithUploadStreaming(s.blockwiseUploadStreaming),
+			blockwise.WithClock(s.clock),
 		)
 	}
 	obsHandler := client.NewHandlerContainer()
@@ -280,21 +462,34 @@ func (s *Server) createClientConn(connection *coapNet.Conn, monitor inactivity.M
 		s.maxMessageSize,
 		true,
 	)
-	cc := client.NewClientConn(
-		session,
-		obsHandler,
-		kitSync.NewMap(),
-		s.transmissionNStart,
-		s.transmissionAcknowledgeTimeout,
-		s.transmissionMaxRetransmit,
-		client.NewObservationHandler(obsHandler, s.handler),
-		s.blockwiseSZX,
-		blockWise,
-		s.goPool,
-		s.errors,
-		s.getMID,
-		monitor,
-	)
+	var congestionControl client.CongestionControl
+	if s.newCongestionControl != nil {
+		congestionControl = s.newCongestionControl()
+	}
+	cc := client.New(client.ConnConfig{
+		Session:                        session,
+		ObservationTokenHandler:        obsHandler,
+		TransmissionNStart:             s.transmissionNStart,
+		TransmissionAcknowledgeTimeout: s.transmissionAcknowledgeTimeout,
+		TransmissionMaxRetransmit:      s.transmissionMaxRetransmit,
+		Handler:                        client.NewObservationHandler(obsHandler, client.NewResetUnknownResponseHandler(s.handler)),
+		BlockwiseSZX:                   s.blockwiseSZX,
+		BlockWise:                      blockWise,
+		GoPool:                         s.goPool,
+		Errors:                         s.errors,
+		GetMID:                         s.getMID,
+		GetToken:                       s.getToken,
+		ActivityMonitor:                monitor,
+		CongestionControl:              congestionControl,
+		Clock:                          s.clock,
+		OnSend:                         s.onSend,
+		OnReceive:                      s.onReceive,
+		OnStats:                        s.onStats,
+		StatsInterval:                  s.statsInterval,
+		SeparateResponse:               s.separateResponse,
+		Authorize:                      s.authorize,
+		DedupStore:                     s.dedupStore,
+	})
 
 	return cc
 }
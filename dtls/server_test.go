@@ -7,7 +7,9 @@ import (
 	"crypto/x509"
 	"fmt"
 	"math/big"
+	"net"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -287,3 +289,356 @@ func TestServer_KeepAliveMonitor(t *testing.T) {
 	checkCloseWg.Wait()
 	require.True(t, inactivityDetected)
 }
+
+func TestServer_IdleTimeout(t *testing.T) {
+	srvCtx, srvCancel := context.WithTimeout(context.Background(), time.Second*3600)
+	defer srvCancel()
+	serverCgf, clientCgf, _, err := createDTLSConfig(srvCtx)
+	require.NoError(t, err)
+
+	ld, err := coapNet.NewDTLSListener("udp4", "", serverCgf)
+	require.NoError(t, err)
+	defer ld.Close()
+
+	closed := make(chan struct{})
+	sd := dtls.NewServer(
+		dtls.WithOnNewClientConn(func(cc *client.ClientConn, dtlsConn *piondtls.Conn) {
+			cc.AddOnClose(func() {
+				close(closed)
+			})
+		}),
+		dtls.WithIdleTimeout(200*time.Millisecond),
+	)
+
+	var serverWg sync.WaitGroup
+	defer func() {
+		sd.Stop()
+		serverWg.Wait()
+	}()
+	serverWg.Add(1)
+	go func() {
+		defer serverWg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	cc, err := dtls.Dial(ld.Addr().String(), clientCgf)
+	require.NoError(t, err)
+	defer cc.Close()
+
+	// send ping to create serverside connection
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = cc.Ping(ctx)
+	require.NoError(t, err)
+	start := time.Now()
+
+	select {
+	case <-closed:
+		require.GreaterOrEqual(t, int64(time.Since(start)), int64(100*time.Millisecond))
+	case <-time.After(time.Second * 2):
+		require.FailNow(t, "idle connection was not closed")
+	}
+}
+
+func TestServer_MaxConnections(t *testing.T) {
+	srvCtx, srvCancel := context.WithTimeout(context.Background(), time.Second*3600)
+	defer srvCancel()
+	serverCgf, clientCgf, _, err := createDTLSConfig(srvCtx)
+	require.NoError(t, err)
+
+	ld, err := coapNet.NewDTLSListener("udp4", "", serverCgf)
+	require.NoError(t, err)
+	defer ld.Close()
+
+	rejected := make(chan net.Addr, 1)
+	sd := dtls.NewServer(
+		dtls.WithMaxConnections(1, false, func(remoteAddr net.Addr) {
+			rejected <- remoteAddr
+		}),
+	)
+
+	var serverWg sync.WaitGroup
+	defer func() {
+		sd.Stop()
+		serverWg.Wait()
+	}()
+	serverWg.Add(1)
+	go func() {
+		defer serverWg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+
+	cc1, err := dtls.Dial(ld.Addr().String(), clientCgf)
+	require.NoError(t, err)
+	defer cc1.Close()
+	err = cc1.Ping(ctx)
+	require.NoError(t, err)
+
+	cc2, err := dtls.Dial(ld.Addr().String(), clientCgf)
+	require.NoError(t, err)
+	defer cc2.Close()
+	select {
+	case addr := <-rejected:
+		require.NotNil(t, addr)
+	case <-ctx.Done():
+		require.FailNow(t, "connection over limit was not rejected")
+	}
+
+	err = cc1.Ping(ctx)
+	require.NoError(t, err)
+}
+
+func TestServer_SecurityIdentity(t *testing.T) {
+	psk := func(hint []byte) ([]byte, error) {
+		return []byte{0xAB, 0xC1, 0x23}, nil
+	}
+	serverCfg := &piondtls.Config{
+		PSK:             psk,
+		PSKIdentityHint: []byte("Pion DTLS Server"),
+		CipherSuites:    []piondtls.CipherSuiteID{piondtls.TLS_PSK_WITH_AES_128_CCM_8},
+	}
+	clientCfg := &piondtls.Config{
+		PSK:             psk,
+		PSKIdentityHint: []byte("device-1"),
+		CipherSuites:    []piondtls.CipherSuiteID{piondtls.TLS_PSK_WITH_AES_128_CCM_8},
+	}
+	ld, err := coapNet.NewDTLSListener("udp4", "", serverCfg)
+	require.NoError(t, err)
+	defer ld.Close()
+
+	sd := dtls.NewServer(dtls.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte(w.ClientConn().SecurityIdentity())))
+		require.NoError(t, err)
+	}))
+	var serverWg sync.WaitGroup
+	defer func() {
+		sd.Stop()
+		serverWg.Wait()
+	}()
+	serverWg.Add(1)
+	go func() {
+		defer serverWg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	cc, err := dtls.Dial(ld.Addr().String(), clientCfg)
+	require.NoError(t, err)
+	defer cc.Close()
+	require.Equal(t, "Pion DTLS Server", cc.SecurityIdentity())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/")
+	require.NoError(t, err)
+	b, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, "device-1", string(b))
+}
+
+func TestServer_Connections(t *testing.T) {
+	dtlsCfg := &piondtls.Config{
+		PSK: func(hint []byte) ([]byte, error) {
+			return []byte{0xAB, 0xC1, 0x23}, nil
+		},
+		PSKIdentityHint: []byte("Pion DTLS Server"),
+		CipherSuites:    []piondtls.CipherSuiteID{piondtls.TLS_PSK_WITH_AES_128_CCM_8},
+	}
+	ld, err := coapNet.NewDTLSListener("udp4", "", dtlsCfg)
+	require.NoError(t, err)
+	defer ld.Close()
+
+	sd := dtls.NewServer()
+	var serverWg sync.WaitGroup
+	defer func() {
+		sd.Stop()
+		serverWg.Wait()
+	}()
+	serverWg.Add(1)
+	go func() {
+		defer serverWg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+	require.Empty(t, sd.Connections())
+
+	cc, err := dtls.Dial(ld.Addr().String(), dtlsCfg)
+	require.NoError(t, err)
+	defer cc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	err = cc.Ping(ctx)
+	require.NoError(t, err)
+
+	conns := sd.Connections()
+	require.Len(t, conns, 1)
+	require.NotNil(t, conns[0].RemoteAddr())
+	require.False(t, conns[0].Stats().LastReceived.Before(start))
+
+	err = cc.Close()
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return len(sd.Connections()) == 0
+	}, time.Second*5, time.Millisecond*10)
+}
+
+func TestServer_Authorizer(t *testing.T) {
+	psk := func(hint []byte) ([]byte, error) {
+		return []byte{0xAB, 0xC1, 0x23}, nil
+	}
+	serverCfg := &piondtls.Config{
+		PSK:             psk,
+		PSKIdentityHint: []byte("Pion DTLS Server"),
+		CipherSuites:    []piondtls.CipherSuiteID{piondtls.TLS_PSK_WITH_AES_128_CCM_8},
+	}
+	newClientCfg := func(identity string) *piondtls.Config {
+		return &piondtls.Config{
+			PSK:             psk,
+			PSKIdentityHint: []byte(identity),
+			CipherSuites:    []piondtls.CipherSuiteID{piondtls.TLS_PSK_WITH_AES_128_CCM_8},
+		}
+	}
+	ld, err := coapNet.NewDTLSListener("udp4", "", serverCfg)
+	require.NoError(t, err)
+	defer ld.Close()
+
+	// the body is uploaded in blocks
+	payload := make([]byte, 5000)
+	var handled, blocks int32
+	sd := dtls.NewServer(dtls.WithAuthorizer(func(identity string, code codes.Code, path string) bool {
+		return code == codes.GET || (identity == "admin" && path == "/config")
+	}), dtls.WithOnReceive(func(r *pool.Message) {
+		if r.HasOption(message.Block1) {
+			atomic.AddInt32(&blocks, 1)
+		}
+	}), dtls.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		atomic.AddInt32(&handled, 1)
+		if r.Code() == codes.PUT {
+			body, err := r.ReadBody()
+			require.NoError(t, err)
+			require.Equal(t, payload, body)
+		}
+		err := w.SetResponse(codes.Changed, message.TextPlain, nil)
+		require.NoError(t, err)
+	}))
+	var serverWg sync.WaitGroup
+	defer func() {
+		sd.Stop()
+		serverWg.Wait()
+	}()
+	serverWg.Add(1)
+	go func() {
+		defer serverWg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	cc, err := dtls.Dial(ld.Addr().String(), newClientCfg("device-1"))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	resp, err := cc.Put(ctx, "/config", message.TextPlain, bytes.NewReader(payload))
+	require.NoError(t, err)
+	require.Equal(t, codes.Forbidden, resp.Code())
+	require.Equal(t, int32(0), atomic.LoadInt32(&handled))
+	// the upload is rejected by the first block
+	require.Equal(t, int32(1), atomic.LoadInt32(&blocks))
+
+	resp, err = cc.Get(ctx, "/config")
+	require.NoError(t, err)
+	require.Equal(t, codes.Changed, resp.Code())
+	require.Equal(t, int32(1), atomic.LoadInt32(&handled))
+
+	admin, err := dtls.Dial(ld.Addr().String(), newClientCfg("admin"))
+	require.NoError(t, err)
+	defer admin.Close()
+
+	resp, err = admin.Put(ctx, "/config", message.TextPlain, bytes.NewReader(payload))
+	require.NoError(t, err)
+	require.Equal(t, codes.Changed, resp.Code())
+	require.Equal(t, int32(2), atomic.LoadInt32(&handled))
+}
+
+type failingListener struct {
+	err     error
+	accepts uint32
+}
+
+func (l *failingListener) AcceptWithContext(ctx context.Context) (net.Conn, error) {
+	atomic.AddUint32(&l.accepts, 1)
+	return nil, l.err
+}
+
+func (l *failingListener) Close() error {
+	return nil
+}
+
+func TestServer_AcceptErrors(t *testing.T) {
+	t.Run("transient", func(t *testing.T) {
+		l := &failingListener{err: fmt.Errorf("handshake error: bad finished message")}
+		sd := dtls.NewServer(dtls.WithErrors(func(err error) {}))
+		served := make(chan error, 1)
+		go func() {
+			served <- sd.Serve(l)
+		}()
+		time.Sleep(time.Millisecond * 300)
+		sd.Stop()
+		select {
+		case err := <-served:
+			require.NoError(t, err)
+		case <-time.After(time.Second * 5):
+			require.FailNow(t, "serve wasn't stopped")
+		}
+		accepts := atomic.LoadUint32(&l.accepts)
+		require.Greater(t, accepts, uint32(1))
+		require.Less(t, accepts, uint32(10))
+	})
+	t.Run("fatal", func(t *testing.T) {
+		l := &failingListener{err: fmt.Errorf("cannot accept connection: %w", &net.OpError{Op: "accept", Net: "udp", Err: fmt.Errorf("use of closed network connection")})}
+		sd := dtls.NewServer()
+		served := make(chan error, 1)
+		go func() {
+			served <- sd.Serve(l)
+		}()
+		select {
+		case err := <-served:
+			require.Error(t, err)
+		case <-time.After(time.Second * 5):
+			require.FailNow(t, "serve wasn't stopped by the broken listener")
+		}
+		require.Equal(t, uint32(1), atomic.LoadUint32(&l.accepts))
+	})
+	t.Run("closed", func(t *testing.T) {
+		ld, err := coapNet.NewDTLSListener("udp4", "", &piondtls.Config{
+			PSK: func(hint []byte) ([]byte, error) {
+				return []byte{0xAB, 0xC1, 0x23}, nil
+			},
+			PSKIdentityHint: []byte("Pion DTLS Server"),
+			CipherSuites:    []piondtls.CipherSuiteID{piondtls.TLS_PSK_WITH_AES_128_CCM_8},
+		})
+		require.NoError(t, err)
+		sd := dtls.NewServer()
+		defer sd.Stop()
+		served := make(chan error, 1)
+		go func() {
+			served <- sd.Serve(ld)
+		}()
+		time.Sleep(time.Millisecond * 100)
+		err = ld.Close()
+		require.NoError(t, err)
+		select {
+		case err := <-served:
+			require.NoError(t, err)
+		case <-time.After(time.Second * 5):
+			require.FailNow(t, "serve wasn't stopped by the closed listener")
+		}
+	})
+}
@@ -2,28 +2,24 @@ package dtls
 
 import (
 	"context"
-	"fmt"
-	"net"
+	"crypto/x509"
 	"sync"
-	"sync/atomic"
 
+	"github.com/pion/dtls/v2"
 	coapNet "github.com/plgd-dev/go-coap/v2/net"
 	"github.com/plgd-dev/go-coap/v2/udp/client"
-	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
 )
 
 type EventFunc = func()
 
+// Session is the session of the DTLS connection, the handling of the messages is shared
+// with the other transports by client.TransportSession.
 type Session struct {
-	connection     *coapNet.Conn
-	maxMessageSize int
-	closeSocket    bool
+	*client.TransportSession
+	connection *coapNet.Conn
 
-	mutex   sync.Mutex
-	onClose []EventFunc
-
-	cancel context.CancelFunc
-	ctx    atomic.Value
+	securityIdentityOnce sync.Once
+	securityIdentity     string
 }
 
 func NewSession(
@@ -32,105 +28,35 @@ func NewSession(
 	maxMessageSize int,
 	closeSocket bool,
 ) *Session {
-	ctx, cancel := context.WithCancel(ctx)
-	s := &Session{
-		cancel:         cancel,
-		connection:     connection,
-		maxMessageSize: maxMessageSize,
-		closeSocket:    closeSocket,
-	}
-	s.ctx.Store(&ctx)
-	return s
-}
-
-func (s *Session) Done() <-chan struct{} {
-	return s.Context().Done()
-}
-
-func (s *Session) AddOnClose(f EventFunc) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-	s.onClose = append(s.onClose, f)
-}
-
-func (s *Session) popOnClose() []EventFunc {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-	tmp := s.onClose
-	s.onClose = nil
-	return tmp
-}
-
-func (s *Session) close() error {
-	for _, f := range s.popOnClose() {
-		f()
-	}
-	if s.closeSocket {
-		return s.connection.Close()
+	return &Session{
+		TransportSession: client.NewTransportSession(ctx, connection, maxMessageSize, closeSocket),
+		connection:       connection,
 	}
-	return nil
 }
 
-func (s *Session) Close() error {
-	s.cancel()
-	return nil
-}
-
-func (s *Session) Context() context.Context {
-	return *s.ctx.Load().(*context.Context)
-}
-
-// SetContextValue stores the value associated with key to context of connection.
-func (s *Session) SetContextValue(key interface{}, val interface{}) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-	ctx := context.WithValue(s.Context(), key, val)
-	s.ctx.Store(&ctx)
-}
-
-func (s *Session) WriteMessage(req *pool.Message) error {
-	data, err := req.Marshal()
-	if err != nil {
-		return fmt.Errorf("cannot marshal: %w", err)
-	}
-	err = s.connection.WriteWithContext(req.Context(), data)
-	if err != nil {
-		return fmt.Errorf("cannot write to connection: %w", err)
-	}
-	return err
-}
-
-func (s *Session) MaxMessageSize() int {
-	return s.maxMessageSize
-}
-
-func (s *Session) RemoteAddr() net.Addr {
-	return s.connection.RemoteAddr()
+// SecurityIdentity returns the PSK identity of the peer or the common name of the peer certificate.
+// When the certificate has no common name, its subject is returned.
+func (s *Session) SecurityIdentity() string {
+	s.securityIdentityOnce.Do(func() {
+		dtlsConn, ok := s.connection.Connection().(*dtls.Conn)
+		if !ok {
+			return
+		}
+		s.securityIdentity = securityIdentity(dtlsConn.ConnectionState())
+	})
+	return s.securityIdentity
 }
 
-// Run reads and process requests from a connection, until the connection is not closed.
-func (s *Session) Run(cc *client.ClientConn) (err error) {
-	defer func() {
-		err1 := s.Close()
-		if err == nil {
-			err = err1
-		}
-		err1 = s.close()
-		if err == nil {
-			err = err1
-		}
-	}()
-	m := make([]byte, s.maxMessageSize)
-	for {
-		readBuf := m
-		readLen, err := s.connection.ReadWithContext(s.Context(), readBuf)
+func securityIdentity(state dtls.State) string {
+	if len(state.PeerCertificates) > 0 {
+		cert, err := x509.ParseCertificate(state.PeerCertificates[0])
 		if err != nil {
-			return fmt.Errorf("cannot read from connection: %w", err)
+			return ""
 		}
-		readBuf = readBuf[:readLen]
-		err = cc.Process(readBuf)
-		if err != nil {
-			return err
+		if cert.Subject.CommonName != "" {
+			return cert.Subject.CommonName
 		}
+		return cert.Subject.String()
 	}
+	return string(state.IdentityHint)
 }
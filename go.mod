@@ -8,6 +8,7 @@ require (
 	github.com/stretchr/testify v1.7.0
 	go.uber.org/atomic v1.6.0
 	golang.org/x/net v0.0.0-20210502030024-e5908800b52b
+	golang.org/x/sys v0.0.0-20210423082822-04245dca01da
 )
 
 go 1.13
@@ -0,0 +1,45 @@
+package message
+
+// MaxBlockNum is the highest block number, NUM of Block1 and Block2 options has 20 bits.
+const MaxBlockNum = 1<<20 - 1
+
+// MaxBlockSZX is the highest block size exponent, SZX 7 is reserved by RFC 7959.
+const MaxBlockSZX = 6
+
+// Block is the value of Block1 and Block2 options (RFC 7959 2.2).
+type Block struct {
+	// Num is the relative number of the block within the sequence of blocks.
+	Num uint32
+	// More is set when more blocks are following.
+	More bool
+	// SZX is the size exponent of the block, the size is 2**(SZX+4) bytes.
+	SZX uint8
+}
+
+// Size returns the size of the block in bytes.
+func (b Block) Size() int {
+	return 1 << (b.SZX + 4)
+}
+
+// Encode returns the value of the option, which is encoded by EncodeUint32 to 0-3 bytes.
+func (b Block) Encode() (uint32, error) {
+	if b.Num > MaxBlockNum || b.SZX > MaxBlockSZX {
+		return 0, ErrInvalidBlock
+	}
+	v := b.Num<<4 | uint32(b.SZX)
+	if b.More {
+		v |= 0x8
+	}
+	return v, nil
+}
+
+// Decode decodes the value of Block1 or Block2 option to b.
+func (b *Block) Decode(v uint32) error {
+	if v > MaxBlockNum<<4|0xf || v&0x7 > MaxBlockSZX {
+		return ErrInvalidBlock
+	}
+	b.Num = v >> 4
+	b.More = v&0x8 != 0
+	b.SZX = uint8(v & 0x7)
+	return nil
+}
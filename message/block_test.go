@@ -0,0 +1,45 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlock(t *testing.T) {
+	tests := []struct {
+		name    string
+		block   Block
+		want    []byte
+		wantErr bool
+	}{
+		{name: "first", block: Block{SZX: 2}, want: []byte{0x02}},
+		{name: "more", block: Block{Num: 1, More: true, SZX: 6}, want: []byte{0x1e}},
+		{name: "2 bytes", block: Block{Num: 16, SZX: 4}, want: []byte{0x01, 0x04}},
+		{name: "max", block: Block{Num: MaxBlockNum, More: true, SZX: 6}, want: []byte{0xff, 0xff, 0xfe}},
+		{name: "num overflow", block: Block{Num: MaxBlockNum + 1}, wantErr: true},
+		{name: "reserved szx", block: Block{SZX: 7}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := make([]byte, 8)
+			opts, _, err := Options{}.SetBlock2(buf, tt.block)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, opts[0].Value)
+			block, err := opts.Block2()
+			require.NoError(t, err)
+			require.Equal(t, tt.block, block)
+		})
+	}
+
+	var b Block
+	require.Error(t, b.Decode(0x7))
+	require.Error(t, b.Decode(0x1000000))
+	require.NoError(t, b.Decode(0x1e))
+	require.Equal(t, Block{Num: 1, More: true, SZX: 6}, b)
+	require.Equal(t, 1024, b.Size())
+}
@@ -0,0 +1,121 @@
+package message
+
+import (
+	"context"
+	"io"
+
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+)
+
+// RequestBuilder builds a request message and manages the buffer of encoded option values,
+// eg. NewRequest(codes.GET).Path("/a/b").Query("k=v").Build().
+// The first error stops building and it is returned by Build.
+type RequestBuilder struct {
+	msg Message
+	buf []byte
+	err error
+}
+
+// NewRequest creates a builder of the request with the code.
+func NewRequest(code codes.Code) *RequestBuilder {
+	return &RequestBuilder{
+		msg: Message{
+			Context: context.Background(),
+			Code:    code,
+			Options: make(Options, 0, 8),
+		},
+		buf: make([]byte, 256),
+	}
+}
+
+// setOptions applies f to the options with the free part of the buffer, which is grown when it's too small.
+func (b *RequestBuilder) setOptions(f func(options Options, buf []byte) (Options, int, error)) *RequestBuilder {
+	if b.err != nil {
+		return b
+	}
+	opts, used, err := f(b.msg.Options, b.buf)
+	for size := 2 * cap(b.buf); err == ErrTooSmall; size *= 2 {
+		// already encoded values stay in the previous buffer
+		if size < used {
+			size = used
+		}
+		b.buf = make([]byte, size)
+		opts, used, err = f(b.msg.Options, b.buf)
+	}
+	if err != nil {
+		b.err = err
+		return b
+	}
+	b.msg.Options = opts
+	b.buf = b.buf[used:]
+	return b
+}
+
+// Context sets the context of the request.
+func (b *RequestBuilder) Context(ctx context.Context) *RequestBuilder {
+	b.msg.Context = ctx
+	return b
+}
+
+// Token sets the token of the request.
+func (b *RequestBuilder) Token(token Token) *RequestBuilder {
+	b.msg.Token = token
+	return b
+}
+
+// Path sets URIPath options.
+func (b *RequestBuilder) Path(path string) *RequestBuilder {
+	return b.setOptions(func(options Options, buf []byte) (Options, int, error) {
+		return options.SetPath(buf, path)
+	})
+}
+
+// Query adds URIQuery option, eg. "k=v".
+func (b *RequestBuilder) Query(query string) *RequestBuilder {
+	return b.setOptions(func(options Options, buf []byte) (Options, int, error) {
+		return options.AddString(buf, URIQuery, query)
+	})
+}
+
+// ContentFormat sets ContentFormat option.
+func (b *RequestBuilder) ContentFormat(contentFormat MediaType) *RequestBuilder {
+	return b.setOptions(func(options Options, buf []byte) (Options, int, error) {
+		return options.SetContentFormat(buf, contentFormat)
+	})
+}
+
+// Accept sets Accept option.
+func (b *RequestBuilder) Accept(contentFormat MediaType) *RequestBuilder {
+	return b.setOptions(func(options Options, buf []byte) (Options, int, error) {
+		return options.SetAccept(buf, contentFormat)
+	})
+}
+
+// Observe sets Observe option.
+func (b *RequestBuilder) Observe(observe uint32) *RequestBuilder {
+	return b.setOptions(func(options Options, buf []byte) (Options, int, error) {
+		return options.SetObserve(buf, observe)
+	})
+}
+
+// Option adds the option with the value.
+func (b *RequestBuilder) Option(id OptionID, value []byte) *RequestBuilder {
+	return b.setOptions(func(options Options, buf []byte) (Options, int, error) {
+		return options.AddBytes(buf, id, value)
+	})
+}
+
+// Body sets the body of the request.
+func (b *RequestBuilder) Body(body io.ReadSeeker) *RequestBuilder {
+	b.msg.Body = body
+	return b
+}
+
+// Build returns the request or the first error which occurred during building.
+func (b *RequestBuilder) Build() (*Message, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	msg := b.msg
+	return &msg, nil
+}
@@ -0,0 +1,53 @@
+package message
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestBuilder(t *testing.T) {
+	body := bytes.NewReader([]byte("data"))
+	req, err := NewRequest(codes.POST).
+		Path("/a/b").
+		Query("k=v").
+		Query("x=y").
+		ContentFormat(TextPlain).
+		Body(body).
+		Build()
+	require.NoError(t, err)
+	require.Equal(t, codes.POST, req.Code)
+	path, err := req.Options.Path()
+	require.NoError(t, err)
+	require.Equal(t, "a/b", path)
+	queries, err := req.Options.Queries()
+	require.NoError(t, err)
+	require.Equal(t, []string{"k=v", "x=y"}, queries)
+	cf, err := req.Options.ContentFormat()
+	require.NoError(t, err)
+	require.Equal(t, TextPlain, cf)
+	require.Equal(t, body, req.Body)
+}
+
+func TestRequestBuilderGrowsBuffer(t *testing.T) {
+	b := NewRequest(codes.GET).Path("/" + strings.Repeat("a", 200) + "/" + strings.Repeat("b", 200))
+	for i := 0; i < 50; i++ {
+		b.Query(strings.Repeat("q", 100))
+	}
+	req, err := b.Build()
+	require.NoError(t, err)
+	queries, err := req.Options.Queries()
+	require.NoError(t, err)
+	require.Len(t, queries, 50)
+	path, err := req.Options.Path()
+	require.NoError(t, err)
+	require.Equal(t, strings.Repeat("a", 200)+"/"+strings.Repeat("b", 200), path)
+}
+
+func TestRequestBuilderError(t *testing.T) {
+	_, err := NewRequest(codes.GET).Path("/" + strings.Repeat("a", maxPathValue+1)).Query("k=v").Build()
+	require.ErrorIs(t, err, ErrInvalidValueLength)
+}
@@ -0,0 +1,46 @@
+package codes
+
+// Class returns the class of the code, the upper 3 bits: 0 for requests, 2 for success, 4 for client error,
+// 5 for server error and 7 for signaling codes.
+func (c Code) Class() int {
+	return int(c>>5) & 0x7
+}
+
+// Detail returns the detail of the code, the lower 5 bits.
+func (c Code) Detail() int {
+	return int(c & 0x1f)
+}
+
+// IsRequest reports whether the code is a method code, eg. GET.
+func (c Code) IsRequest() bool {
+	return c.Class() == 0 && c != Empty && c <= _maxCode
+}
+
+// IsResponse reports whether the code is a response code of class 2, 4 or 5.
+func (c Code) IsResponse() bool {
+	switch c.Class() {
+	case 2, 4, 5:
+		return c <= _maxCode
+	}
+	return false
+}
+
+// IsSuccess reports whether the code is a response code of class 2.
+func (c Code) IsSuccess() bool {
+	return c.Class() == 2 && c <= _maxCode
+}
+
+// IsClientError reports whether the code is a response code of class 4.
+func (c Code) IsClientError() bool {
+	return c.Class() == 4 && c <= _maxCode
+}
+
+// IsServerError reports whether the code is a response code of class 5.
+func (c Code) IsServerError() bool {
+	return c.Class() == 5 && c <= _maxCode
+}
+
+// IsSignaling reports whether the code is a signaling code of class 7, which is used by reliable transports.
+func (c Code) IsSignaling() bool {
+	return c.Class() == 7 && c <= _maxCode
+}
@@ -6,37 +6,41 @@ import (
 )
 
 var codeToString = map[Code]string{
-	Empty:                 "Empty",
-	GET:                   "GET",
-	POST:                  "POST",
-	PUT:                   "PUT",
-	DELETE:                "DELETE",
-	Created:               "Created",
-	Deleted:               "Deleted",
-	Valid:                 "Valid",
-	Changed:               "Changed",
-	Content:               "Content",
-	BadRequest:            "BadRequest",
-	Unauthorized:          "Unauthorized",
-	BadOption:             "BadOption",
-	Forbidden:             "Forbidden",
-	NotFound:              "NotFound",
-	MethodNotAllowed:      "MethodNotAllowed",
-	NotAcceptable:         "NotAcceptable",
-	PreconditionFailed:    "PreconditionFailed",
-	RequestEntityTooLarge: "RequestEntityTooLarge",
-	UnsupportedMediaType:  "UnsupportedMediaType",
-	InternalServerError:   "InternalServerError",
-	NotImplemented:        "NotImplemented",
-	BadGateway:            "BadGateway",
-	ServiceUnavailable:    "ServiceUnavailable",
-	GatewayTimeout:        "GatewayTimeout",
-	ProxyingNotSupported:  "ProxyingNotSupported",
-	CSM:                   "Capabilities and Settings Messages",
-	Ping:                  "Ping",
-	Pong:                  "Pong",
-	Release:               "Release",
-	Abort:                 "Abort",
+	Empty:                   "Empty",
+	GET:                     "GET",
+	POST:                    "POST",
+	PUT:                     "PUT",
+	DELETE:                  "DELETE",
+	Created:                 "Created",
+	Deleted:                 "Deleted",
+	Valid:                   "Valid",
+	Changed:                 "Changed",
+	Content:                 "Content",
+	Continue:                "Continue",
+	BadRequest:              "BadRequest",
+	Unauthorized:            "Unauthorized",
+	BadOption:               "BadOption",
+	Forbidden:               "Forbidden",
+	NotFound:                "NotFound",
+	MethodNotAllowed:        "MethodNotAllowed",
+	NotAcceptable:           "NotAcceptable",
+	RequestEntityIncomplete: "RequestEntityIncomplete",
+	PreconditionFailed:      "PreconditionFailed",
+	RequestEntityTooLarge:   "RequestEntityTooLarge",
+	UnsupportedMediaType:    "UnsupportedMediaType",
+	TooManyRequests:         "TooManyRequests",
+	InternalServerError:     "InternalServerError",
+	NotImplemented:          "NotImplemented",
+	BadGateway:              "BadGateway",
+	ServiceUnavailable:      "ServiceUnavailable",
+	GatewayTimeout:          "GatewayTimeout",
+	ProxyingNotSupported:    "ProxyingNotSupported",
+	HopLimitReached:         "HopLimitReached",
+	CSM:                     "Capabilities and Settings Messages",
+	Ping:                    "Ping",
+	Pong:                    "Pong",
+	Release:                 "Release",
+	Abort:                   "Abort",
 }
 
 func (c Code) String() string {
@@ -47,6 +51,11 @@ func (c Code) String() string {
 	return "Code(" + strconv.FormatInt(int64(c), 10) + ")"
 }
 
+// Dotted returns the code in the "c.dd" form of the CoAP registry, eg. "2.05" for Content.
+func (c Code) Dotted() string {
+	return fmt.Sprintf("%d.%02d", c.Class(), c.Detail())
+}
+
 func ToCode(v string) (Code, error) {
 	for key, val := range codeToString {
 		if v == val {
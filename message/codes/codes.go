@@ -36,12 +36,14 @@ const (
 	PreconditionFailed      Code = 140
 	RequestEntityTooLarge   Code = 141
 	UnsupportedMediaType    Code = 143
+	TooManyRequests         Code = 157
 	InternalServerError     Code = 160
 	NotImplemented          Code = 161
 	BadGateway              Code = 162
 	ServiceUnavailable      Code = 163
 	GatewayTimeout          Code = 164
 	ProxyingNotSupported    Code = 165
+	HopLimitReached         Code = 168
 )
 
 //Signaling Codes for TCP
@@ -65,6 +67,7 @@ var strToCode = map[string]Code{
 	`"Valid"`:                              Valid,
 	`"Changed"`:                            Changed,
 	`"Content"`:                            Content,
+	`"Continue"`:                           Continue,
 	`"BadRequest"`:                         BadRequest,
 	`"Unauthorized"`:                       Unauthorized,
 	`"BadOption"`:                          BadOption,
@@ -72,15 +75,18 @@ var strToCode = map[string]Code{
 	`"NotFound"`:                           NotFound,
 	`"MethodNotAllowed"`:                   MethodNotAllowed,
 	`"NotAcceptable"`:                      NotAcceptable,
+	`"RequestEntityIncomplete"`:            RequestEntityIncomplete,
 	`"PreconditionFailed"`:                 PreconditionFailed,
 	`"RequestEntityTooLarge"`:              RequestEntityTooLarge,
 	`"UnsupportedMediaType"`:               UnsupportedMediaType,
+	`"TooManyRequests"`:                    TooManyRequests,
 	`"InternalServerError"`:                InternalServerError,
 	`"NotImplemented"`:                     NotImplemented,
 	`"BadGateway"`:                         BadGateway,
 	`"ServiceUnavailable"`:                 ServiceUnavailable,
 	`"GatewayTimeout"`:                     GatewayTimeout,
 	`"ProxyingNotSupported"`:               ProxyingNotSupported,
+	`"HopLimitReached"`:                    HopLimitReached,
 	`"Capabilities and Settings Messages"`: CSM,
 	`"Ping"`:                               Ping,
 	`"Pong"`:                               Pong,
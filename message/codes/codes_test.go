@@ -45,3 +45,44 @@ func TestUnmarshalJSON_MarshalUnmarshal(t *testing.T) {
 		require.Equal(t, c, cUnMarshaled)
 	}
 }
+
+func TestCodeClass(t *testing.T) {
+	tests := []struct {
+		code       Code
+		class      int
+		detail     int
+		dotted     string
+		str        string
+		request    bool
+		response   bool
+		signaling  bool
+		clientErr  bool
+		serverErr  bool
+		successful bool
+	}{
+		{code: Empty, dotted: "0.00", str: "Empty"},
+		{code: GET, detail: 1, dotted: "0.01", str: "GET", request: true},
+		{code: Content, class: 2, detail: 5, dotted: "2.05", str: "Content", response: true, successful: true},
+		{code: Continue, class: 2, detail: 31, dotted: "2.31", str: "Continue", response: true, successful: true},
+		{code: NotFound, class: 4, detail: 4, dotted: "4.04", str: "NotFound", response: true, clientErr: true},
+		{code: RequestEntityIncomplete, class: 4, detail: 8, dotted: "4.08", str: "RequestEntityIncomplete", response: true, clientErr: true},
+		{code: InternalServerError, class: 5, dotted: "5.00", str: "InternalServerError", response: true, serverErr: true},
+		{code: Pong, class: 7, detail: 3, dotted: "7.03", str: "Pong", signaling: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.str, func(t *testing.T) {
+			require.Equal(t, tt.class, tt.code.Class())
+			require.Equal(t, tt.detail, tt.code.Detail())
+			require.Equal(t, tt.dotted, tt.code.Dotted())
+			require.Equal(t, tt.str, tt.code.String())
+			require.Equal(t, tt.request, tt.code.IsRequest())
+			require.Equal(t, tt.response, tt.code.IsResponse())
+			require.Equal(t, tt.signaling, tt.code.IsSignaling())
+			require.Equal(t, tt.clientErr, tt.code.IsClientError())
+			require.Equal(t, tt.serverErr, tt.code.IsServerError())
+			require.Equal(t, tt.successful, tt.code.IsSuccess())
+		})
+	}
+	require.False(t, Code(256+69).IsResponse())
+	require.False(t, Code(256+1).IsRequest())
+}
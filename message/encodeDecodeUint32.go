@@ -4,6 +4,10 @@ import (
 	"encoding/binary"
 )
 
+// EncodeUint32 encodes value to the minimal number of bytes as defined in https://tools.ietf.org/html/rfc7252#section-3.2,
+// value 0 is encoded as zero-length value.
+//
+// Return's number of used buf bytes or ErrTooSmall with the required size.
 func EncodeUint32(buf []byte, value uint32) (int, error) {
 	switch {
 	case value == 0:
@@ -24,9 +28,8 @@ func EncodeUint32(buf []byte, value uint32) (int, error) {
 		if len(buf) < 3 {
 			return 3, ErrTooSmall
 		}
-		rv := make([]byte, 4)
-		binary.BigEndian.PutUint32(rv[:], value)
-		copy(buf, rv[1:])
+		buf[0] = byte(value >> 16)
+		binary.BigEndian.PutUint16(buf[1:], uint16(value))
 		return 3, nil
 	default:
 		if len(buf) < 4 {
@@ -37,12 +40,16 @@ func EncodeUint32(buf []byte, value uint32) (int, error) {
 	}
 }
 
+// DecodeUint32 decodes value encoded by EncodeUint32. Leading zero bytes are accepted.
+//
+// Return's value, number of used buf bytes or ErrInvalidValueLength when buf is longer than 4 bytes.
 func DecodeUint32(buf []byte) (uint32, int, error) {
 	if len(buf) > 4 {
-		buf = buf[:4]
+		return 0, -1, ErrInvalidValueLength
+	}
+	var value uint32
+	for _, b := range buf {
+		value = value<<8 | uint32(b)
 	}
-	tmp := []byte{0, 0, 0, 0}
-	copy(tmp[4-len(buf):], buf)
-	value := binary.BigEndian.Uint32(tmp)
 	return value, len(buf), nil
 }
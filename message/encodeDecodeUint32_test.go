@@ -20,11 +20,31 @@ func TestEncodeUint32(t *testing.T) {
 			name: "0",
 			args: args{0},
 		},
+		{
+			name: "1",
+			args: args{1},
+			want: 1,
+		},
+		{
+			name: "255",
+			args: args{255},
+			want: 1,
+		},
 		{
 			name: "256",
 			args: args{256},
 			want: 2,
 		},
+		{
+			name: "65535",
+			args: args{65535},
+			want: 2,
+		},
+		{
+			name: "65536",
+			args: args{65536},
+			want: 3,
+		},
 		{
 			name: "16384",
 			args: args{16384},
@@ -35,11 +55,26 @@ func TestEncodeUint32(t *testing.T) {
 			args: args{5000000},
 			want: 3,
 		},
+		{
+			name: "16000000",
+			args: args{16000000},
+			want: 3,
+		},
+		{
+			name: "16777215",
+			args: args{16777215},
+			want: 3,
+		},
 		{
 			name: "20000000",
 			args: args{20000000},
 			want: 4,
 		},
+		{
+			name: "4294967295",
+			args: args{4294967295},
+			want: 4,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -59,3 +94,35 @@ func TestEncodeUint32(t *testing.T) {
 		})
 	}
 }
+
+func TestEncodeUint32TooSmall(t *testing.T) {
+	n, err := EncodeUint32(make([]byte, 2), 16777215)
+	require.Equal(t, ErrTooSmall, err)
+	require.Equal(t, 3, n)
+}
+
+func TestDecodeUint32(t *testing.T) {
+	val, n, err := DecodeUint32([]byte{0, 0, 1})
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	require.Equal(t, uint32(1), val)
+
+	_, _, err = DecodeUint32([]byte{1, 2, 3, 4, 5})
+	require.Equal(t, ErrInvalidValueLength, err)
+}
+
+func TestGetUint32s(t *testing.T) {
+	buf := make([]byte, 16)
+	var opts Options
+	opts, used, err := opts.AddUint32(buf, Accept, 50)
+	require.NoError(t, err)
+	opts, _, err = opts.AddUint32(buf[used:], Accept, 60)
+	require.NoError(t, err)
+	opts, _, err = opts.SetUint32(buf[used+1:], Size1, 1024)
+	require.NoError(t, err)
+
+	r := make([]uint32, 2)
+	n, err := opts.GetUint32s(Accept, r)
+	require.NoError(t, err)
+	require.Equal(t, []uint32{50, 60}, r[:n])
+}
@@ -14,4 +14,7 @@ var (
 	ErrInvalidEncoding              = errors.New("invalid encoding")
 	ErrOptionNotFound               = errors.New("option not found")
 	ErrOptionDuplicate              = errors.New("duplicated option")
+	ErrInvalidPayloadMarker         = errors.New("payload marker is not followed by payload")
+	ErrInvalidBlock                 = errors.New("invalid block option")
+	ErrMediaTypePredefined          = errors.New("media type is predefined")
 )
@@ -6,7 +6,10 @@ import (
 	"io"
 )
 
-// GetETag calculate ETag from payload via CRC64
+// MaxETagSize is the max length of ETag option: https://tools.ietf.org/html/rfc7252#section-5.10.6.
+const MaxETagSize = 8
+
+// GetETag calculate ETag from payload via CRC64, so identical payloads have the same ETag.
 func GetETag(r io.ReadSeeker) ([]byte, error) {
 	if r == nil {
 		return make([]byte, 8), nil
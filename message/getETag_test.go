@@ -12,3 +12,15 @@ func TestGetETag(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, []byte{0x54, 0x4e, 0x28, 0x79, 0x1c, 0x23, 0x17, 0x24}, got)
 }
+
+func TestGetETagStable(t *testing.T) {
+	a, err := GetETag(bytes.NewReader([]byte("payload")))
+	require.NoError(t, err)
+	require.Len(t, a, MaxETagSize)
+	b, err := GetETag(bytes.NewReader([]byte("payload")))
+	require.NoError(t, err)
+	require.Equal(t, a, b)
+	c, err := GetETag(bytes.NewReader([]byte("payloaD")))
+	require.NoError(t, err)
+	require.NotEqual(t, a, c)
+}
@@ -3,6 +3,8 @@ package message
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"io"
+	"sync"
 )
 
 type Token []byte
@@ -22,3 +24,35 @@ func GetToken() (Token, error) {
 
 	return b, nil
 }
+
+// NewGetToken creates the generator of tokens which reads them from r instead of crypto/rand,
+// eg. from a deterministic reader in tests. The reads from r are serialized by the generator.
+func NewGetToken(r io.Reader) func() (Token, error) {
+	var lock sync.Mutex
+	return func() (Token, error) {
+		b := make(Token, 8)
+		lock.Lock()
+		defer lock.Unlock()
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+}
+
+type lockedReader struct {
+	lock sync.Mutex
+	r    io.Reader
+}
+
+// NewLockedReader returns the reader which fills the whole buffer from r under one lock by every Read, so r can be
+// shared by generators, eg. by NewGetToken and the generator of message IDs, without interleaving their values.
+func NewLockedReader(r io.Reader) io.Reader {
+	return &lockedReader{r: r}
+}
+
+func (r *lockedReader) Read(b []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return io.ReadFull(r.r, b)
+}
@@ -1,6 +1,9 @@
 package message
 
 import (
+	"bytes"
+	"io"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -13,3 +16,48 @@ func TestGetToken(t *testing.T) {
 	require.NotEmpty(t, token.String())
 
 }
+
+func TestNewGetToken(t *testing.T) {
+	getToken := NewGetToken(bytes.NewReader([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9}))
+	token, err := getToken()
+	require.NoError(t, err)
+	require.Equal(t, Token{1, 2, 3, 4, 5, 6, 7, 8}, token)
+	_, err = getToken()
+	require.Error(t, err)
+}
+
+func TestNewLockedReader(t *testing.T) {
+	// the generators sharing the reader never get interleaved bytes
+	data := make([]byte, 0, 8*100)
+	for i := 0; i < 100; i++ {
+		data = append(data, bytes.Repeat([]byte{byte(i)}, 8)...)
+	}
+	r := NewLockedReader(&oneByteReader{r: bytes.NewReader(data)})
+	generators := []func() (Token, error){NewGetToken(r), NewGetToken(r)}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		getToken := generators[i%len(generators)]
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				token, err := getToken()
+				require.NoError(t, err)
+				require.Equal(t, bytes.Repeat(token[:1], 8), []byte(token))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// oneByteReader returns at most one byte by every Read.
+type oneByteReader struct {
+	r io.Reader
+}
+
+func (r *oneByteReader) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	return r.r.Read(b[:1])
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/plgd-dev/go-coap/v2/message/codes"
 )
@@ -21,20 +24,82 @@ type Message struct {
 	Body io.ReadSeeker
 }
 
+// String returns human readable representation of the message, eg. `GET Token=a1b2 URIPath=/temp`.
+// Beginning of the payload is formatted as text for textual content formats, otherwise as hex.
 func (r *Message) String() string {
-	buf := fmt.Sprintf("Code: %v, Token: %v", r.Code, r.Token)
-	path, err := r.Options.Path()
-	if err == nil {
-		buf = fmt.Sprintf("%s, Path: %v", buf, path)
+	if r == nil {
+		return "nil"
 	}
-	cf, err := r.Options.ContentFormat()
-	if err == nil {
-		mt := MediaType(cf)
-		buf = fmt.Sprintf("%s, ContentFormat: %v", buf, mt)
+	buf := fmt.Sprintf("%v Token=%v", r.Code, r.Token)
+	if len(r.Options) > 0 {
+		buf += " " + r.Options.String()
 	}
-	queries, err := r.Options.Queries()
-	if err == nil {
-		buf = fmt.Sprintf("%s, Queries: %+v", buf, queries)
+	if r.Body != nil {
+		buf += " " + payloadString(r.Options, r.Body)
 	}
 	return buf
 }
+
+// maxPayloadPreview is the number of payload bytes formatted by String.
+const maxPayloadPreview = 64
+
+func isTextMediaType(mt MediaType) bool {
+	if name, ok := RegisteredMediaType(mt); ok {
+		name = strings.TrimSpace(strings.SplitN(name, ";", 2)[0])
+		return strings.HasPrefix(name, "text/") || strings.HasSuffix(name, "+json") || strings.HasSuffix(name, "+xml")
+	}
+	switch mt {
+	case TextPlain, AppLinkFormat, AppXML, AppJSON, AppJSONPatch, AppJSONMergePatch, AppSenmlJSON:
+		return true
+	}
+	return false
+}
+
+func isPrintable(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, r := range string(data) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// payloadString formats the beginning of the body and restores the position of the body.
+func payloadString(options Options, body io.ReadSeeker) string {
+	pos, err := body.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "Payload=?"
+	}
+	defer body.Seek(pos, io.SeekStart)
+	size, err := body.Seek(0, io.SeekEnd)
+	if err != nil {
+		return "Payload=?"
+	}
+	if _, err = body.Seek(0, io.SeekStart); err != nil {
+		return "Payload=?"
+	}
+	preview := size
+	if preview > maxPayloadPreview {
+		preview = maxPayloadPreview
+	}
+	data := make([]byte, preview)
+	n, _ := io.ReadFull(body, data)
+	data = data[:n]
+	var text bool
+	if cf, err := options.ContentFormat(); err == nil {
+		text = isTextMediaType(cf)
+	} else {
+		text = isPrintable(data)
+	}
+	suffix := ""
+	if int64(n) < size {
+		suffix = "..."
+	}
+	if text {
+		return fmt.Sprintf("Payload(%v)=%q%v", size, data, suffix)
+	}
+	return fmt.Sprintf("Payload(%v)=%x%v", size, data, suffix)
+}
@@ -0,0 +1,77 @@
+package message
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageString(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  *Message
+		want string
+	}{
+		{
+			name: "request",
+			msg: &Message{
+				Code:  codes.GET,
+				Token: []byte{0xa1, 0xb2},
+				Options: Options{
+					{ID: URIPath, Value: []byte("a")},
+					{ID: URIPath, Value: []byte("temp")},
+					{ID: URIQuery, Value: []byte("x=1")},
+					{ID: Accept, Value: []byte{byte(AppJSON)}},
+				},
+			},
+			want: "GET Token=a1b2 URIPath=/a/temp URIQuery=x=1 Accept=application/json",
+		},
+		{
+			name: "textPayload",
+			msg: &Message{
+				Code:    codes.Content,
+				Options: Options{{ID: ContentFormat, Value: []byte{}}, {ID: MaxAge, Value: []byte{30}}},
+				Body:    bytes.NewReader([]byte("hello")),
+			},
+			want: `Content Token= ContentFormat=text/plain;charset=utf-8 MaxAge=30 Payload(5)="hello"`,
+		},
+		{
+			name: "binaryPayload",
+			msg: &Message{
+				Code:    codes.Content,
+				Options: Options{{ID: ContentFormat, Value: []byte{byte(AppCBOR)}}, {ID: ETag, Value: []byte{1, 2}}, {ID: IfNoneMatch}},
+				Body:    bytes.NewReader([]byte{0xa1, 0x01}),
+			},
+			want: "Content Token= ContentFormat=application/cbor (RFC 7049) ETag=0102 IfNoneMatch Payload(2)=a101",
+		},
+		{
+			name: "longPayload",
+			msg: &Message{
+				Code: codes.POST,
+				Body: bytes.NewReader([]byte(strings.Repeat("a", maxPayloadPreview+1))),
+			},
+			want: `POST Token= Payload(65)="` + strings.Repeat("a", maxPayloadPreview) + `"...`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.msg.String())
+		})
+	}
+}
+
+func TestMessageStringKeepsBodyPosition(t *testing.T) {
+	body := bytes.NewReader([]byte("hello"))
+	_, err := body.Seek(2, io.SeekStart)
+	require.NoError(t, err)
+	msg := Message{Code: codes.Content, Body: body}
+	require.Equal(t, `Content Token= Payload(5)="hello"`, msg.String())
+	rest, err := ioutil.ReadAll(body)
+	require.NoError(t, err)
+	require.Equal(t, "llo", string(rest))
+}
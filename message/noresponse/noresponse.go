@@ -7,7 +7,7 @@ import (
 var (
 	resp2XXCodes       = []codes.Code{codes.Created, codes.Deleted, codes.Valid, codes.Changed, codes.Content}
 	resp4XXCodes       = []codes.Code{codes.BadRequest, codes.Unauthorized, codes.BadOption, codes.Forbidden, codes.NotFound, codes.MethodNotAllowed, codes.NotAcceptable, codes.PreconditionFailed, codes.RequestEntityTooLarge, codes.UnsupportedMediaType}
-	resp5XXCodes       = []codes.Code{codes.InternalServerError, codes.NotImplemented, codes.BadGateway, codes.ServiceUnavailable, codes.GatewayTimeout, codes.ProxyingNotSupported}
+	resp5XXCodes       = []codes.Code{codes.InternalServerError, codes.NotImplemented, codes.BadGateway, codes.ServiceUnavailable, codes.GatewayTimeout, codes.ProxyingNotSupported, codes.HopLimitReached}
 	noResponseValueMap = map[uint32][]codes.Code{
 		2:  resp2XXCodes,
 		8:  resp4XXCodes,
@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"strconv"
+	"sync"
 )
 
 const (
@@ -64,6 +65,7 @@ const (
 	ContentFormat OptionID = 12
 	MaxAge        OptionID = 14
 	URIQuery      OptionID = 15
+	HopLimit      OptionID = 16
 	Accept        OptionID = 17
 	LocationQuery OptionID = 20
 	Block2        OptionID = 23
@@ -73,6 +75,9 @@ const (
 	ProxyScheme   OptionID = 39
 	Size1         OptionID = 60
 	NoResponse    OptionID = 258
+	// TraceParent carries TraceContext. Its number is from the experimental range 65000-65535, it's elective,
+	// safe to forward and not part of the cache key, so proxies pass it through.
+	TraceParent OptionID = 65020
 )
 
 var optionIDToString = map[OptionID]string{
@@ -87,6 +92,7 @@ var optionIDToString = map[OptionID]string{
 	ContentFormat: "ContentFormat",
 	MaxAge:        "MaxAge",
 	URIQuery:      "URIQuery",
+	HopLimit:      "HopLimit",
 	Accept:        "Accept",
 	LocationQuery: "LocationQuery",
 	Block2:        "Block2",
@@ -96,6 +102,7 @@ var optionIDToString = map[OptionID]string{
 	ProxyScheme:   "ProxyScheme",
 	Size1:         "Size1",
 	NoResponse:    "NoResponse",
+	TraceParent:   "TraceParent",
 }
 
 func (o OptionID) String() string {
@@ -144,6 +151,7 @@ var CoapOptionDefs = map[OptionID]OptionDef{
 	ContentFormat: {ValueFormat: ValueUint, MinLen: 0, MaxLen: 2},
 	MaxAge:        {ValueFormat: ValueUint, MinLen: 0, MaxLen: 4},
 	URIQuery:      {ValueFormat: ValueString, MinLen: 0, MaxLen: 255},
+	HopLimit:      {ValueFormat: ValueUint, MinLen: 1, MaxLen: 1},
 	Accept:        {ValueFormat: ValueUint, MinLen: 0, MaxLen: 2},
 	LocationQuery: {ValueFormat: ValueString, MinLen: 0, MaxLen: 255},
 	Block2:        {ValueFormat: ValueUint, MinLen: 0, MaxLen: 3},
@@ -153,6 +161,7 @@ var CoapOptionDefs = map[OptionID]OptionDef{
 	ProxyScheme:   {ValueFormat: ValueString, MinLen: 1, MaxLen: 255},
 	Size1:         {ValueFormat: ValueUint, MinLen: 0, MaxLen: 4},
 	NoResponse:    {ValueFormat: ValueUint, MinLen: 0, MaxLen: 1},
+	TraceParent:   {ValueFormat: ValueOpaque, MinLen: traceContextLen, MaxLen: traceContextLen},
 }
 
 // MediaType specifies the content format of a message.
@@ -178,6 +187,8 @@ var (
 	AppCoseSign       MediaType = 98    //application/cose; cose-type="cose-sign" (RFC 8152)
 	AppCoseKey        MediaType = 101   //application/cose-key (RFC 8152)
 	AppCoseKeySet     MediaType = 102   //application/cose-key-set (RFC 8152)
+	AppSenmlJSON      MediaType = 110   //application/senml+json (RFC 8428)
+	AppSenmlCbor      MediaType = 112   //application/senml+cbor (RFC 8428)
 	AppCoapGroup      MediaType = 256   //coap-group+json (RFC 7390)
 	AppOcfCbor        MediaType = 10000 //application/vnd.ocf+cbor
 	AppLwm2mTLV       MediaType = 11542 //application/vnd.oma.lwm2m+tlv
@@ -203,13 +214,51 @@ var mediaTypeToString = map[MediaType]string{
 	AppCoseSign:       "application/cose; cose-type=\"cose-sign\" (RFC 8152)",
 	AppCoseKey:        "application/cose-key (RFC 8152)",
 	AppCoseKeySet:     "application/cose-key-set (RFC 8152)",
+	AppSenmlJSON:      "application/senml+json (RFC 8428)",
+	AppSenmlCbor:      "application/senml+cbor (RFC 8428)",
 	AppCoapGroup:      "coap-group+json (RFC 7390)",
 	AppOcfCbor:        "application/vnd.ocf+cbor",
 	AppLwm2mTLV:       "application/vnd.oma.lwm2m+tlv",
 	AppLwm2mJSON:      "application/vnd.oma.lwm2m+json",
 }
 
+var (
+	registeredMediaTypesLock sync.RWMutex
+	registeredMediaTypes     = make(map[MediaType]string)
+)
+
+// RegisterMediaType registers name of the content format id, eg. a vendor one or one from the experimental range 65000-65535.
+// The name, eg. `application/vnd.acme+cbor`, is used by MediaType.String, ToMediaType and the content negotiation of the proxy.
+// Predefined media types cannot be overridden - ErrMediaTypePredefined is returned for them.
+func RegisterMediaType(id uint16, name string) error {
+	if _, ok := mediaTypeToString[MediaType(id)]; ok {
+		return ErrMediaTypePredefined
+	}
+	registeredMediaTypesLock.Lock()
+	defer registeredMediaTypesLock.Unlock()
+	registeredMediaTypes[MediaType(id)] = name
+	return nil
+}
+
+// UnregisterMediaType removes the name registered by RegisterMediaType.
+func UnregisterMediaType(id uint16) {
+	registeredMediaTypesLock.Lock()
+	defer registeredMediaTypesLock.Unlock()
+	delete(registeredMediaTypes, MediaType(id))
+}
+
+// RegisteredMediaType returns name of the content format registered by RegisterMediaType.
+func RegisteredMediaType(c MediaType) (string, bool) {
+	registeredMediaTypesLock.RLock()
+	defer registeredMediaTypesLock.RUnlock()
+	str, ok := registeredMediaTypes[c]
+	return str, ok
+}
+
 func (c MediaType) String() string {
+	if str, ok := RegisteredMediaType(c); ok {
+		return str
+	}
 	str, ok := mediaTypeToString[c]
 	if !ok {
 		return "MediaType(" + strconv.FormatInt(int64(c), 10) + ")"
@@ -218,6 +267,14 @@ func (c MediaType) String() string {
 }
 
 func ToMediaType(v string) (MediaType, error) {
+	registeredMediaTypesLock.RLock()
+	for key, val := range registeredMediaTypes {
+		if val == v {
+			registeredMediaTypesLock.RUnlock()
+			return key, nil
+		}
+	}
+	registeredMediaTypesLock.RUnlock()
 	for key, val := range mediaTypeToString {
 		if val == v {
 			return key, nil
@@ -391,6 +448,42 @@ func (o Option) Marshal(buf []byte, previousID OptionID) (int, error) {
 	return length, nil
 }
 
+func optionHeaderExtSize(opt int) int {
+	switch opt {
+	case ExtendOptionByteCode:
+		return 1
+	case ExtendOptionWordCode:
+		return 2
+	}
+	return 0
+}
+
+// marshaledSize returns the size of the marshaled option, it equals to the length returned by Marshal.
+func (o Option) marshaledSize(previousID OptionID) int {
+	d, _ := extendOpt(int(o.ID) - int(previousID))
+	l, _ := extendOpt(len(o.Value))
+	return 1 + optionHeaderExtSize(d) + optionHeaderExtSize(l) + len(o.Value)
+}
+
+// marshalTo writes the option as Marshal, buf must have at least marshaledSize bytes.
+func (o Option) marshalTo(buf []byte, previousID OptionID) int {
+	d, dx := extendOpt(int(o.ID) - int(previousID))
+	l, lx := extendOpt(len(o.Value))
+	buf[0] = byte(d<<4) | byte(l)
+	n := 1
+	for _, ext := range [2][2]int{{d, dx}, {l, lx}} {
+		switch ext[0] {
+		case ExtendOptionByteCode:
+			buf[n] = byte(ext[1])
+			n++
+		case ExtendOptionWordCode:
+			binary.BigEndian.PutUint16(buf[n:], uint16(ext[1]))
+			n += 2
+		}
+	}
+	return n + copy(buf[n:], o.Value)
+}
+
 func parseExtOpt(data []byte, opt int) (int, int, error) {
 	processed := 0
 	switch opt {
@@ -1,7 +1,11 @@
 package message
 
 import (
+	"bytes"
 	"testing"
+
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMediaType_String(t *testing.T) {
@@ -17,3 +21,40 @@ func TestOptionID_String(t *testing.T) {
 		}(OptionID(i).String())
 	}
 }
+
+func TestRegisterMediaType(t *testing.T) {
+	const acmeCbor = 65000
+	err := RegisterMediaType(acmeCbor, "application/vnd.acme+cbor")
+	require.NoError(t, err)
+	defer UnregisterMediaType(acmeCbor)
+	err = RegisterMediaType(65001, "application/vnd.acme+json")
+	require.NoError(t, err)
+	defer UnregisterMediaType(65001)
+	err = RegisterMediaType(uint16(AppLwm2mTLV), "application/vnd.acme+tlv")
+	require.ErrorIs(t, err, ErrMediaTypePredefined)
+	require.Equal(t, "application/vnd.oma.lwm2m+tlv", AppLwm2mTLV.String())
+	require.Equal(t, "application/vnd.acme+cbor", MediaType(acmeCbor).String())
+	mt, err := ToMediaType("application/vnd.acme+cbor")
+	require.NoError(t, err)
+	require.Equal(t, MediaType(acmeCbor), mt)
+	name, ok := RegisteredMediaType(acmeCbor)
+	require.True(t, ok)
+	require.Equal(t, "application/vnd.acme+cbor", name)
+	_, ok = RegisteredMediaType(AppJSON)
+	require.False(t, ok)
+
+	buf := make([]byte, 16)
+	opts, _, err := Options{}.SetContentFormat(buf, acmeCbor)
+	require.NoError(t, err)
+	m := Message{Code: codes.Content, Options: opts, Body: bytes.NewReader([]byte("{}"))}
+	require.Equal(t, "Content Token= ContentFormat=application/vnd.acme+cbor Payload(2)=7b7d", m.String())
+	opts, _, err = Options{}.SetContentFormat(buf, 65001)
+	require.NoError(t, err)
+	m.Options = opts
+	require.Equal(t, "Content Token= ContentFormat=application/vnd.acme+json Payload(2)=\"{}\"", m.String())
+
+	UnregisterMediaType(acmeCbor)
+	_, ok = RegisteredMediaType(acmeCbor)
+	require.False(t, ok)
+	require.Equal(t, "MediaType(65000)", MediaType(acmeCbor).String())
+}
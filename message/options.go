@@ -1,7 +1,13 @@
 package message
 
 import (
+	"bytes"
+	"encoding/hex"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Options Container of COAP Options, It must be always sort'ed after modification.
@@ -9,45 +15,84 @@ type Options []Option
 
 const maxPathValue = 255
 
+// DefaultMaxAge is freshness lifetime of response without Max-Age option: https://tools.ietf.org/html/rfc7252#section-5.10.5.
+const DefaultMaxAge = 60 * time.Second
+
 // SetPath splits path by '/' to URIPath options and copy it to buffer.
 //
 // Return's modified options, number of used buf bytes and error if occurs.
 func (options Options) SetPath(buf []byte, path string) (Options, int, error) {
+	return options.setPath(buf, URIPath, path, false)
+}
+
+// SetEscapedPath splits percent-encoded path by '/' to URIPath options and copy the unescaped segments to buffer,
+// eg. "a%2Fb" is stored as the single segment "a/b".
+//
+// Return's modified options, number of used buf bytes and error if occurs.
+func (options Options) SetEscapedPath(buf []byte, path string) (Options, int, error) {
+	return options.setPath(buf, URIPath, path, true)
+}
+
+func (options Options) setPath(buf []byte, id OptionID, path string, escaped bool) (Options, int, error) {
 	if len(path) == 0 {
 		return options, 0, nil
 	}
-	o := options.Remove(URIPath)
 	if path[0] == '/' {
 		path = path[1:]
 	}
-	encoded := 0
+	segments := make([]string, 0, 8)
+	needed := 0
 	for start := 0; start < len(path); {
 		subPath := path[start:]
 		end := strings.Index(subPath, "/")
 		if end <= 0 {
 			end = len(subPath)
 		}
-		data := buf[encoded:]
+		segment := subPath[:end]
+		if escaped {
+			unescaped, err := url.PathUnescape(segment)
+			if err != nil {
+				return options, -1, ErrInvalidEncoding
+			}
+			segment = unescaped
+		}
+		if id == URIPath && len(segment) > maxPathValue {
+			return options, -1, ErrInvalidValueLength
+		}
+		segments = append(segments, segment)
+		needed += len(segment)
+		start = start + end + 1
+	}
+	// options are modified in place, so they must be checked before
+	if len(buf) < needed {
+		return options, needed, ErrTooSmall
+	}
+	o := options.Remove(id)
+	encoded := 0
+	for _, segment := range segments {
 		var enc int
 		var err error
-		o, enc, err = o.AddString(data, URIPath, subPath[:end])
+		o, enc, err = o.AddString(buf[encoded:], id, segment)
 		if err != nil {
 			return o, -1, err
 		}
 		encoded += enc
-		start = start + end + 1
 	}
 	return o, encoded, nil
 }
 
-func (options Options) path(buf []byte) (int, error) {
-	firstIdx, lastIdx, err := options.Find(URIPath)
+func (options Options) path(buf []byte, id OptionID, escaped bool) (int, error) {
+	firstIdx, lastIdx, err := options.Find(id)
 	if err != nil {
 		return -1, err
 	}
 	var needed int
 	for i := firstIdx; i < lastIdx; i++ {
-		needed += len(options[i].Value)
+		if escaped {
+			needed += escapedSegmentLen(options[i].Value)
+		} else {
+			needed += len(options[i].Value)
+		}
 		needed++
 	}
 	needed--
@@ -59,21 +104,67 @@ func (options Options) path(buf []byte) (int, error) {
 			buf[0] = '/'
 			buf = buf[1:]
 		}
+		if escaped {
+			buf = buf[escapeSegment(buf, options[i].Value):]
+			continue
+		}
 		copy(buf, options[i].Value)
 		buf = buf[len(options[i].Value):]
 	}
 	return needed, nil
 }
 
+func shouldEscapeSegment(c byte) bool {
+	return c == '/' || c == '%'
+}
+
+func escapedSegmentLen(v []byte) int {
+	n := len(v)
+	for _, c := range v {
+		if shouldEscapeSegment(c) {
+			n += 2
+		}
+	}
+	return n
+}
+
+// escapeSegment percent-encodes '/' and '%' of the URIPath value, so the joined path can be split again.
+func escapeSegment(buf, v []byte) int {
+	const upperhex = "0123456789ABCDEF"
+	var n int
+	for _, c := range v {
+		if shouldEscapeSegment(c) {
+			buf[n] = '%'
+			buf[n+1] = upperhex[c>>4]
+			buf[n+2] = upperhex[c&15]
+			n += 3
+			continue
+		}
+		buf[n] = c
+		n++
+	}
+	return n
+}
+
 // Path joins URIPath options by '/' to the buf.
 //
 // Return's number of used buf bytes or error when occurs.
 func (options Options) Path() (string, error) {
+	return options.joinPath(URIPath, false)
+}
+
+// EscapedPath joins URIPath options by '/', '/' and '%' within the options are percent-encoded,
+// so the path can be split again by SetEscapedPath.
+func (options Options) EscapedPath() (string, error) {
+	return options.joinPath(URIPath, true)
+}
+
+func (options Options) joinPath(id OptionID, escaped bool) (string, error) {
 	buf := make([]byte, 32)
-	m, err := options.path(buf)
+	m, err := options.path(buf, id, escaped)
 	if err == ErrTooSmall {
 		buf = append(buf, make([]byte, m)...)
-		m, err = options.path(buf)
+		m, err = options.path(buf, id, escaped)
 	}
 	if err != nil {
 		return "", err
@@ -82,6 +173,18 @@ func (options Options) Path() (string, error) {
 	return string(buf), nil
 }
 
+// SetLocationPath splits path by '/' to LocationPath options and copy it to buffer, it's used by 2.01 Created response.
+//
+// Return's modified options, number of used buf bytes and error if occurs.
+func (options Options) SetLocationPath(buf []byte, path string) (Options, int, error) {
+	return options.setPath(buf, LocationPath, path, false)
+}
+
+// LocationPath joins LocationPath options by '/'.
+func (options Options) LocationPath() (string, error) {
+	return options.joinPath(LocationPath, false)
+}
+
 // SetString replace's/store's string option to options.
 //
 // Return's modified options, number of used buf bytes and error if occurs.
@@ -114,7 +217,7 @@ func (options Options) GetUint32s(id OptionID, r []uint32) (int, error) {
 		return lastIdx - firstIdx, ErrTooSmall
 	}
 	var idx int
-	for i := firstIdx; i <= lastIdx; i++ {
+	for i := firstIdx; i < lastIdx; i++ {
 		val, _, err := DecodeUint32(options[i].Value)
 		if err == nil {
 			r[idx] = val
@@ -207,11 +310,34 @@ func (options Options) GetStrings(id OptionID, r []string) (int, error) {
 
 // Queries get's URIQuery parameters.
 func (options Options) Queries() ([]string, error) {
+	return options.getStrings(URIQuery)
+}
+
+// Query parses URIQuery options to values, each option is `key=value` or a bare `key` which gets the empty value,
+// eg. `?a=1&a=2&flag` is {a: [1 2], flag: [""]}. The values of the options aren't percent-encoded.
+// It returns empty values when there is no URIQuery option.
+func (options Options) Query() (url.Values, error) {
+	queries, err := options.Queries()
+	if err != nil && err != ErrOptionNotFound {
+		return nil, err
+	}
+	values := make(url.Values, len(queries))
+	for _, q := range queries {
+		key, value := q, ""
+		if i := strings.IndexByte(q, '='); i >= 0 {
+			key, value = q[:i], q[i+1:]
+		}
+		values[key] = append(values[key], value)
+	}
+	return values, nil
+}
+
+func (options Options) getStrings(id OptionID) ([]string, error) {
 	q := make([]string, 4)
-	n, err := options.GetStrings(URIQuery, q)
+	n, err := options.GetStrings(id, q)
 	if err == ErrTooSmall {
 		q = append(q, make([]string, n-len(q))...)
-		n, err = options.GetStrings(URIQuery, q)
+		n, err = options.GetStrings(id, q)
 	}
 	if err != nil {
 		return nil, err
@@ -219,6 +345,24 @@ func (options Options) Queries() ([]string, error) {
 	return q[:n], nil
 }
 
+// GetValues get's values of all options with same id, eg. each URIPath segment, or nil when the option is not set.
+func (options Options) GetValues(id OptionID) [][]byte {
+	firstIdx, lastIdx, err := options.Find(id)
+	if err != nil {
+		return nil
+	}
+	values := make([][]byte, 0, lastIdx-firstIdx)
+	for i := firstIdx; i < lastIdx; i++ {
+		values = append(values, options[i].Value)
+	}
+	return values
+}
+
+// LocationQueries get's LocationQuery parameters.
+func (options Options) LocationQueries() ([]string, error) {
+	return options.getStrings(LocationQuery)
+}
+
 // GetBytess get's all options with same id.
 func (options Options) GetBytess(id OptionID, r [][]byte) (int, error) {
 	firstIdx, lastIdx, err := options.Find(id)
@@ -266,9 +410,20 @@ func (options Options) SetContentFormat(buf []byte, contentFormat MediaType) (Op
 	return options.SetUint32(buf, ContentFormat, uint32(contentFormat))
 }
 
-// SetObserve set's ContentFormat option.
+// Values of Observe option: https://tools.ietf.org/html/rfc7641#section-2.
+const (
+	// ObserveRegister is the value of the request which registers the observation.
+	ObserveRegister uint32 = 0
+	// ObserveDeregister is the value of the request which cancels the observation.
+	ObserveDeregister uint32 = 1
+	// MaxObserveValue is the max value of the 24-bit sequence number of notifications.
+	MaxObserveValue uint32 = 1<<24 - 1
+)
+
+// SetObserve set's Observe option with the minimal-length encoding, 0 is encoded as the empty value.
+// The value is truncated to 24 bits, so the sequence number of notifications wraps around.
 func (options Options) SetObserve(buf []byte, observe uint32) (Options, int, error) {
-	return options.SetUint32(buf, Observe, observe)
+	return options.SetUint32(buf, Observe, observe&MaxObserveValue)
 }
 
 // Observe get's observe option.
@@ -276,17 +431,193 @@ func (options Options) Observe() (uint32, error) {
 	return options.GetUint32(Observe)
 }
 
+// SetBlock1 set's Block1 option, it describes the block of the request payload.
+func (options Options) SetBlock1(buf []byte, block Block) (Options, int, error) {
+	return options.setBlock(buf, Block1, block)
+}
+
+// Block1 get's Block1 option.
+func (options Options) Block1() (Block, error) {
+	return options.block(Block1)
+}
+
+// SetBlock2 set's Block2 option, it describes the block of the response payload.
+func (options Options) SetBlock2(buf []byte, block Block) (Options, int, error) {
+	return options.setBlock(buf, Block2, block)
+}
+
+// Block2 get's Block2 option.
+func (options Options) Block2() (Block, error) {
+	return options.block(Block2)
+}
+
+func (options Options) setBlock(buf []byte, id OptionID, block Block) (Options, int, error) {
+	v, err := block.Encode()
+	if err != nil {
+		return options, -1, err
+	}
+	return options.SetUint32(buf, id, v)
+}
+
+func (options Options) block(id OptionID) (Block, error) {
+	v, err := options.GetUint32(id)
+	if err != nil {
+		return Block{}, err
+	}
+	var block Block
+	err = block.Decode(v)
+	return block, err
+}
+
 // SetAccept set's accept option.
 func (options Options) SetAccept(buf []byte, contentFormat MediaType) (Options, int, error) {
 	return options.SetUint32(buf, Accept, uint32(contentFormat))
 }
 
-// Accept get's accept option.
+// Accept get's accept option, the media type of the response requested by the client.
+// Unlike ContentFormat it doesn't describe the payload of the message.
 func (options Options) Accept() (MediaType, error) {
 	v, err := options.GetUint32(Accept)
 	return MediaType(v), err
 }
 
+// DefaultHopLimit is the Hop-Limit inserted by a proxy to the request without the option.
+const DefaultHopLimit = 16
+
+// SetHopLimit set's HopLimit option (RFC 8768), the number of proxies the request may still pass.
+func (options Options) SetHopLimit(buf []byte, hopLimit uint8) (Options, int, error) {
+	return options.SetUint32(buf, HopLimit, uint32(hopLimit))
+}
+
+// HopLimit get's HopLimit option.
+func (options Options) HopLimit() (uint8, error) {
+	v, err := options.GetUint32(HopLimit)
+	return uint8(v), err
+}
+
+// SetMaxAge set's MaxAge option in seconds.
+func (options Options) SetMaxAge(buf []byte, maxAge uint32) (Options, int, error) {
+	return options.SetUint32(buf, MaxAge, maxAge)
+}
+
+// MaxAge get's MaxAge option in seconds.
+func (options Options) MaxAge() (uint32, error) {
+	return options.GetUint32(MaxAge)
+}
+
+// Freshness returns how long the response stays fresh, DefaultMaxAge is used when MaxAge option is absent.
+func (options Options) Freshness() time.Duration {
+	maxAge, err := options.MaxAge()
+	if err != nil {
+		return DefaultMaxAge
+	}
+	return time.Duration(maxAge) * time.Second
+}
+
+// SetProxyURI set's ProxyURI option.
+func (options Options) SetProxyURI(buf []byte, uri string) (Options, int, error) {
+	return options.SetString(buf, ProxyURI, uri)
+}
+
+// ProxyURI get's ProxyURI option.
+func (options Options) ProxyURI() (string, error) {
+	return options.GetString(ProxyURI)
+}
+
+// SetProxyScheme set's ProxyScheme option.
+func (options Options) SetProxyScheme(buf []byte, scheme string) (Options, int, error) {
+	return options.SetString(buf, ProxyScheme, scheme)
+}
+
+// ProxyScheme get's ProxyScheme option.
+func (options Options) ProxyScheme() (string, error) {
+	return options.GetString(ProxyScheme)
+}
+
+// SetURIHost set's URIHost option, it's needed only when the host differs from the destination IP address, eg. for virtual hosting.
+func (options Options) SetURIHost(buf []byte, host string) (Options, int, error) {
+	return options.SetString(buf, URIHost, host)
+}
+
+// URIHost get's URIHost option.
+func (options Options) URIHost() (string, error) {
+	return options.GetString(URIHost)
+}
+
+// SetURIPort set's URIPort option, it's needed only when the port differs from the destination port.
+func (options Options) SetURIPort(buf []byte, port uint16) (Options, int, error) {
+	return options.SetUint32(buf, URIPort, uint32(port))
+}
+
+// URIPort get's URIPort option.
+func (options Options) URIPort() (uint16, error) {
+	v, err := options.GetUint32(URIPort)
+	return uint16(v), err
+}
+
+// SetETag replace's/store's ETag option, the etag must have 1 to MaxETagSize bytes.
+//
+// Return's modified options, number of used buf bytes and error if occurs.
+func (options Options) SetETag(buf []byte, etag []byte) (Options, int, error) {
+	if len(etag) == 0 || len(etag) > MaxETagSize {
+		return options, -1, ErrInvalidValueLength
+	}
+	return options.SetBytes(buf, ETag, etag)
+}
+
+// AddETag append's ETag option, a request can carry more ETags to validate the cached responses.
+//
+// Return's modified options, number of used buf bytes and error if occurs.
+func (options Options) AddETag(buf []byte, etag []byte) (Options, int, error) {
+	if len(etag) == 0 || len(etag) > MaxETagSize {
+		return options, -1, ErrInvalidValueLength
+	}
+	return options.AddBytes(buf, ETag, etag)
+}
+
+// ETag get's first ETag option.
+func (options Options) ETag() ([]byte, error) {
+	return options.GetBytes(ETag)
+}
+
+// ETags get's all ETag options or nil when the option is not set.
+func (options Options) ETags() [][]byte {
+	return options.GetValues(ETag)
+}
+
+// AddIfMatch append's IfMatch option, an empty etag makes the request conditional on the existence of the resource.
+func (options Options) AddIfMatch(buf []byte, etag []byte) (Options, int, error) {
+	return options.AddBytes(buf, IfMatch, etag)
+}
+
+// SetIfNoneMatch set's IfNoneMatch option, so the request is performed only when the resource doesn't exist.
+func (options Options) SetIfNoneMatch() Options {
+	return options.Set(Option{ID: IfNoneMatch})
+}
+
+// PreconditionsHold evaluates IfMatch and IfNoneMatch options of the request against the target resource
+// according to https://tools.ietf.org/html/rfc7252#section-5.10.8. The etag is the ETag of the current
+// representation and exists reports whether the resource exists. A request whose preconditions don't hold
+// is answered by 4.12 (Precondition Failed).
+func (options Options) PreconditionsHold(exists bool, etag []byte) bool {
+	if options.HasOption(IfNoneMatch) && exists {
+		return false
+	}
+	ifMatch := options.GetValues(IfMatch)
+	if len(ifMatch) == 0 {
+		return true
+	}
+	if !exists {
+		return false
+	}
+	for _, v := range ifMatch {
+		if len(v) == 0 || bytes.Equal(v, etag) {
+			return true
+		}
+	}
+	return false
+}
+
 // Find return's range of type options. First number is index and second number is index of next option type.
 func (options Options) Find(ID OptionID) (int, int, error) {
 	idxPre, idxPost := options.findPositon(ID)
@@ -429,80 +760,77 @@ func (options Options) Remove(ID OptionID) Options {
 	return options
 }
 
-// Marshal marshal's options to buf.
+// Marshal marshal's options to buf. Options are serialized in ascending order of ID even when
+// they are not sorted, repeated options keeps their order.
 //
-// Return's number of used buf byte's.
+// Return's number of used buf byte's. When buf is nil or too small, it returns the required size with ErrTooSmall.
 func (options Options) Marshal(buf []byte) (int, error) {
+	if !options.sorted() {
+		sorted := make(Options, len(options))
+		copy(sorted, options)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].ID < sorted[j].ID
+		})
+		options = sorted
+	}
+	// the size is computed up front, so the options are written in a single pass without bounds checks per option
+	size := 0
 	previousID := OptionID(0)
+	for _, o := range options {
+		size += o.marshaledSize(previousID)
+		previousID = o.ID
+	}
+	if buf == nil || len(buf) < size {
+		return size, ErrTooSmall
+	}
 	length := 0
-
+	previousID = OptionID(0)
 	for _, o := range options {
-
-		//return coap.error but calculate length
-		if length > len(buf) {
-			buf = nil
-		}
-
-		var optionLength int
-		var err error
-
-		if buf != nil {
-			optionLength, err = o.Marshal(buf[length:], previousID)
-		} else {
-			optionLength, err = o.Marshal(nil, previousID)
-		}
+		length += o.marshalTo(buf[length:], previousID)
 		previousID = o.ID
+	}
+	return length, nil
+}
 
-		switch err {
-		case nil:
-		case ErrTooSmall:
-			buf = nil
-		default:
-			return -1, err
+func (options Options) sorted() bool {
+	for i := 1; i < len(options); i++ {
+		if options[i].ID < options[i-1].ID {
+			return false
 		}
-		length = length + optionLength
 	}
-	if buf == nil {
-		return length, ErrTooSmall
-	}
-	return length, nil
+	return true
 }
 
 // Unmarshal unmarshal's data bytes to options and returns number of consumned byte's.
 func (options *Options) Unmarshal(data []byte, optionDefs map[OptionID]OptionDef) (int, error) {
+	return options.unmarshal(data, optionDefs, false)
+}
+
+// UnmarshalStrict unmarshal's data bytes to options as Unmarshal, but payload marker must be followed by payload.
+func (options *Options) UnmarshalStrict(data []byte, optionDefs map[OptionID]OptionDef) (int, error) {
+	return options.unmarshal(data, optionDefs, true)
+}
+
+func (options *Options) unmarshal(data []byte, optionDefs map[OptionID]OptionDef, strict bool) (int, error) {
 	prev := 0
 	processed := 0
 	for len(data) > 0 {
 		if data[0] == 0xff {
+			if strict && len(data) == 1 {
+				return -1, ErrInvalidPayloadMarker
+			}
 			processed++
 			break
 		}
 
-		delta := int(data[0] >> 4)
-		length := int(data[0] & 0x0f)
-
-		if delta == ExtendOptionError || length == ExtendOptionError {
-			return -1, ErrOptionUnexpectedExtendMarker
-		}
-
-		data = data[1:]
-		processed++
-
-		proc, delta, err := parseExtOpt(data, delta)
+		proc, delta, length, err := parseOptionHeader(data)
 		if err != nil {
 			return -1, err
 		}
 		processed += proc
 		data = data[proc:]
-		proc, length, err = parseExtOpt(data, length)
-		if err != nil {
-			return -1, err
-		}
-		processed += proc
-		data = data[proc:]
-
-		if len(data) < length {
-			return -1, ErrOptionTruncated
+		if prev+delta > maxOptionID {
+			return -1, ErrInvalidOptionHeaderExt
 		}
 
 		option := Option{}
@@ -527,6 +855,60 @@ func (options *Options) Unmarshal(data []byte, optionDefs map[OptionID]OptionDef
 	return processed, nil
 }
 
+// parseOptionHeader decodes the delta and the length of the option at the start of data and returns
+// the size of the header. The value of the option follows the header, it's checked to be in data.
+// maxOptionID is the largest option number encodable by the option header: https://tools.ietf.org/html/rfc7252#section-3.1.
+const maxOptionID = 65535
+
+func parseOptionHeader(data []byte) (processed int, delta int, length int, err error) {
+	delta = int(data[0] >> 4)
+	length = int(data[0] & 0x0f)
+	if delta == ExtendOptionError || length == ExtendOptionError {
+		return -1, -1, -1, ErrOptionUnexpectedExtendMarker
+	}
+	processed = 1
+	proc, delta, err := parseExtOpt(data[processed:], delta)
+	if err != nil {
+		return -1, -1, -1, err
+	}
+	processed += proc
+	proc, length, err = parseExtOpt(data[processed:], length)
+	if err != nil {
+		return -1, -1, -1, err
+	}
+	processed += proc
+	if len(data)-processed < length {
+		return -1, -1, -1, ErrOptionTruncated
+	}
+	return processed, delta, length, nil
+}
+
+// RangeOptions calls f for every option encoded in data, the options which follow the header of a message,
+// until f returns false or the payload marker is reached. The value passed to f aliases data.
+// Unlike Unmarshal it doesn't decode the options to a slice, so reading a few options of a raw datagram,
+// eg. by a custom transport before the message is unmarshalled, doesn't allocate. The handlers get already
+// decoded messages, they use RangeOptions of the pool message.
+// The options are passed as they are encoded, without skipping unknown options or values with illegal length.
+func RangeOptions(data []byte, f func(id OptionID, value []byte) bool) error {
+	prev := 0
+	for len(data) > 0 && data[0] != 0xff {
+		proc, delta, length, err := parseOptionHeader(data)
+		if err != nil {
+			return err
+		}
+		data = data[proc:]
+		prev += delta
+		if prev > maxOptionID {
+			return ErrInvalidOptionHeaderExt
+		}
+		if !f(OptionID(prev), data[:length]) {
+			return nil
+		}
+		data = data[length:]
+	}
+	return nil
+}
+
 // ResetOptionsTo reset's options to in options.
 //
 // Return's modified options, number of used buf bytes and error if occurs.
@@ -565,3 +947,55 @@ func (options Options) Clone() (Options, error) {
 	}
 	return opts, nil
 }
+
+// String returns human readable representation of the options, eg. `URIPath=/a/b URIQuery=x=1 ContentFormat=text/plain;charset=utf-8`.
+// URIPath options are joined to a single path.
+func (options Options) String() string {
+	var path []string
+	for _, o := range options {
+		if o.ID == URIPath {
+			path = append(path, string(o.Value))
+		}
+	}
+	var b strings.Builder
+	pathWritten := false
+	for _, o := range options {
+		if o.ID == URIPath {
+			if pathWritten {
+				continue
+			}
+			pathWritten = true
+		}
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(o.ID.String())
+		switch {
+		case o.ID == URIPath:
+			b.WriteString("=/" + strings.Join(path, "/"))
+		case o.ID == ContentFormat || o.ID == Accept:
+			v, _, err := DecodeUint32(o.Value)
+			if err != nil {
+				b.WriteString("=" + hex.EncodeToString(o.Value))
+				continue
+			}
+			b.WriteString("=" + MediaType(v).String())
+		default:
+			switch CoapOptionDefs[o.ID].ValueFormat {
+			case ValueEmpty:
+			case ValueUint:
+				v, _, err := DecodeUint32(o.Value)
+				if err != nil {
+					b.WriteString("=" + hex.EncodeToString(o.Value))
+					continue
+				}
+				b.WriteString("=" + strconv.FormatUint(uint64(v), 10))
+			case ValueString:
+				b.WriteString("=" + string(o.Value))
+			default:
+				b.WriteString("=" + hex.EncodeToString(o.Value))
+			}
+		}
+	}
+	return b.String()
+}
@@ -1,7 +1,11 @@
 package message
 
 import (
+	"bytes"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -241,6 +245,165 @@ func TestPathOption(t *testing.T) {
 	}
 }
 
+func TestPathOptionEscaping(t *testing.T) {
+	buf := make([]byte, 256)
+	options, _, err := make(Options, 0, 10).SetEscapedPath(buf, "/a%2Fb/c%25d/e")
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("a/b"), []byte("c%d"), []byte("e")}, options.GetValues(URIPath))
+	path, err := options.EscapedPath()
+	require.NoError(t, err)
+	require.Equal(t, "a%2Fb/c%25d/e", path)
+	path, err = options.Path()
+	require.NoError(t, err)
+	require.Equal(t, "a/b/c%d/e", path)
+
+	// raw segments are kept as they are
+	options, _, err = options.SetPath(buf, "/a%zz/b%2F")
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("a%zz"), []byte("b%2F")}, options.GetValues(URIPath))
+	path, err = options.Path()
+	require.NoError(t, err)
+	require.Equal(t, "a%zz/b%2F", path)
+	path, err = options.EscapedPath()
+	require.NoError(t, err)
+	require.Equal(t, "a%25zz/b%252F", path)
+	escaped, _, err := make(Options, 0, 10).SetEscapedPath(buf[128:], path)
+	require.NoError(t, err)
+	require.Equal(t, options.GetValues(URIPath), escaped.GetValues(URIPath))
+
+	_, _, err = make(Options, 0, 10).SetEscapedPath(buf, "/a%zz")
+	require.ErrorIs(t, err, ErrInvalidEncoding)
+
+	options, _, err = options.SetPath(buf, "/a/b")
+	require.NoError(t, err)
+	path, err = options.Path()
+	require.NoError(t, err)
+	require.Equal(t, "a/b", path)
+}
+
+func TestLocationOptions(t *testing.T) {
+	buf := make([]byte, 256)
+	opts, n, err := Options{}.SetLocationPath(buf, "/devices/42")
+	require.NoError(t, err)
+	opts, m, err := opts.AddString(buf[n:], LocationQuery, "k=v")
+	require.NoError(t, err)
+	opts, _, err = opts.AddString(buf[n+m:], LocationQuery, "x=y")
+	require.NoError(t, err)
+	require.False(t, opts.HasOption(URIPath))
+	location, err := opts.LocationPath()
+	require.NoError(t, err)
+	require.Equal(t, "devices/42", location)
+	queries, err := opts.LocationQueries()
+	require.NoError(t, err)
+	require.Equal(t, []string{"k=v", "x=y"}, queries)
+}
+
+func TestPreconditionsHold(t *testing.T) {
+	etag := []byte{1, 2}
+	tests := []struct {
+		name    string
+		options Options
+		exists  bool
+		want    bool
+	}{
+		{name: "unconditional", exists: true, want: true},
+		{name: "ifMatch", options: Options{{ID: IfMatch, Value: []byte{3}}, {ID: IfMatch, Value: etag}}, exists: true, want: true},
+		{name: "ifMatchStale", options: Options{{ID: IfMatch, Value: []byte{3}}}, exists: true, want: false},
+		{name: "ifMatchEmpty", options: Options{{ID: IfMatch}}, exists: true, want: true},
+		{name: "ifMatchMissing", options: Options{{ID: IfMatch}}, exists: false, want: false},
+		{name: "ifNoneMatch", options: Options{}.SetIfNoneMatch(), exists: false, want: true},
+		{name: "ifNoneMatchExists", options: Options{}.SetIfNoneMatch(), exists: true, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.options.PreconditionsHold(tt.exists, etag))
+		})
+	}
+}
+
+func TestETagOptions(t *testing.T) {
+	buf := make([]byte, 256)
+	var opts Options
+	_, _, err := opts.SetETag(buf, nil)
+	require.ErrorIs(t, err, ErrInvalidValueLength)
+	_, _, err = opts.AddETag(buf, make([]byte, MaxETagSize+1))
+	require.ErrorIs(t, err, ErrInvalidValueLength)
+
+	opts, n, err := opts.SetETag(buf, []byte{1})
+	require.NoError(t, err)
+	opts, _, err = opts.AddETag(buf[n:], []byte{2, 3})
+	require.NoError(t, err)
+	etag, err := opts.ETag()
+	require.NoError(t, err)
+	require.Equal(t, []byte{1}, etag)
+	require.Equal(t, [][]byte{{1}, {2, 3}}, opts.ETags())
+}
+
+func TestObserveOption(t *testing.T) {
+	buf := make([]byte, 4)
+	tests := []struct {
+		name      string
+		observe   uint32
+		want      uint32
+		wantValue []byte
+	}{
+		{name: "register", observe: ObserveRegister, want: 0, wantValue: []byte{}},
+		{name: "deregister", observe: ObserveDeregister, want: 1, wantValue: []byte{1}},
+		{name: "max", observe: MaxObserveValue, want: 0xFFFFFF, wantValue: []byte{0xff, 0xff, 0xff}},
+		{name: "wrap", observe: MaxObserveValue + 2, want: 1, wantValue: []byte{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, _, err := Options{}.SetObserve(buf, tt.observe)
+			require.NoError(t, err)
+			value, err := opts.GetBytes(Observe)
+			require.NoError(t, err)
+			require.Equal(t, tt.wantValue, value)
+			got, err := opts.Observe()
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestGetValues(t *testing.T) {
+	var opts Options
+	require.Nil(t, opts.GetValues(URIQuery))
+	buf := make([]byte, 256)
+	opts, n, err := opts.AddString(buf, URIQuery, "k=v")
+	require.NoError(t, err)
+	opts, _, err = opts.AddString(buf[n:], URIQuery, "x=y")
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("k=v"), []byte("x=y")}, opts.GetValues(URIQuery))
+	queries, err := opts.Queries()
+	require.NoError(t, err)
+	require.Equal(t, "k=v&x=y", strings.Join(queries, "&"))
+}
+
+func TestQuery(t *testing.T) {
+	var opts Options
+	values, err := opts.Query()
+	require.NoError(t, err)
+	require.Empty(t, values)
+
+	buf := make([]byte, 256)
+	var n int
+	for _, q := range []string{"a=1", "a=2", "flag", "b=x=y", "c="} {
+		var m int
+		opts, m, err = opts.AddString(buf[n:], URIQuery, q)
+		require.NoError(t, err)
+		n += m
+	}
+	values, err = opts.Query()
+	require.NoError(t, err)
+	require.Equal(t, url.Values{
+		"a":    {"1", "2"},
+		"flag": {""},
+		"b":    {"x=y"},
+		"c":    {""},
+	}, values)
+}
+
 func TestQueryOption(t *testing.T) {
 	v := "if=oic.if.baseline"
 	buf := make([]byte, len(v))
@@ -250,6 +413,150 @@ func TestQueryOption(t *testing.T) {
 	require.True(t, opts.HasOption(URIQuery))
 }
 
+func TestMaxAgeOption(t *testing.T) {
+	var opts Options
+	require.Equal(t, DefaultMaxAge, opts.Freshness())
+	buf := make([]byte, 4)
+	opts, _, err := opts.SetMaxAge(buf, 5)
+	require.NoError(t, err)
+	maxAge, err := opts.MaxAge()
+	require.NoError(t, err)
+	require.Equal(t, uint32(5), maxAge)
+	require.Equal(t, time.Second*5, opts.Freshness())
+}
+
+func TestHopLimitOption(t *testing.T) {
+	var opts Options
+	_, err := opts.HopLimit()
+	require.ErrorIs(t, err, ErrOptionNotFound)
+	opts, _, err = opts.SetHopLimit(make([]byte, 1), DefaultHopLimit)
+	require.NoError(t, err)
+	hopLimit, err := opts.HopLimit()
+	require.NoError(t, err)
+	require.Equal(t, uint8(DefaultHopLimit), hopLimit)
+}
+
+func TestMarshalUnsortedOptions(t *testing.T) {
+	options := Options{
+		{ID: 2048},
+		{ID: 258, Value: []byte{1}},
+		{ID: URIPath, Value: []byte("a")},
+		{ID: ProxyURI, Value: []byte("b")},
+		{ID: URIPath, Value: []byte("abcdefghijklmnopqrst")},
+	}
+	buf := make([]byte, 64)
+	n, err := options.Marshal(buf)
+	require.NoError(t, err)
+	require.Equal(t, []byte{
+		0xb1, 'a', // URIPath: delta 11
+		0x0d, 0x07, 'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h', 'i', 'j', 'k', 'l', 'm', 'n', 'o', 'p', 'q', 'r', 's', 't', // URIPath: delta 0, extended length 20
+		0xd1, 0x0b, 'b', // ProxyURI: extended delta 24
+		0xd1, 0xd2, 0x01, // 258: extended delta 223
+		0xe0, 0x05, 0xf1, // 2048: extended word delta 1790
+	}, buf[:n])
+	require.Equal(t, OptionID(2048), options[0].ID, "marshal must not reorder options")
+
+	got := make(Options, 0, 8)
+	_, err = got.Unmarshal(buf[:n], CoapOptionDefs)
+	require.NoError(t, err)
+	path, err := got.Path()
+	require.NoError(t, err)
+	require.Equal(t, "a/abcdefghijklmnopqrst", path)
+	proxyURI, err := got.ProxyURI()
+	require.NoError(t, err)
+	require.Equal(t, "b", proxyURI)
+}
+
+func TestOptionsMarshalExtended(t *testing.T) {
+	// deltas and lengths around the boundaries of the 1 and 2 bytes extensions
+	var opts Options
+	for _, o := range []struct {
+		id     OptionID
+		length int
+	}{{1, 0}, {1, 12}, {13, 13}, {26, 268}, {295, 269}, {564, 1000}, {1500, 1}} {
+		opts = append(opts, Option{ID: o.id, Value: bytes.Repeat([]byte{byte(o.length)}, o.length)})
+	}
+	var want []byte
+	previousID := OptionID(0)
+	for _, o := range opts {
+		buf := make([]byte, 2048)
+		n, err := o.Marshal(buf, previousID)
+		require.NoError(t, err)
+		want = append(want, buf[:n]...)
+		previousID = o.ID
+	}
+
+	size, err := opts.Marshal(nil)
+	require.ErrorIs(t, err, ErrTooSmall)
+	require.Equal(t, len(want), size)
+	_, err = opts.Marshal(make([]byte, size-1))
+	require.ErrorIs(t, err, ErrTooSmall)
+	buf := make([]byte, size)
+	n, err := opts.Marshal(buf)
+	require.NoError(t, err)
+	require.Equal(t, want, buf[:n])
+
+	got := make(Options, 0, len(opts))
+	_, err = got.Unmarshal(buf, map[OptionID]OptionDef{})
+	require.NoError(t, err)
+	require.Equal(t, opts, got)
+}
+
+func TestRangeOptions(t *testing.T) {
+	var opts Options
+	buf := make([]byte, 256)
+	opts, n, err := opts.SetPath(buf, "/a/bc/d")
+	require.NoError(t, err)
+	opts, _, err = opts.SetContentFormat(buf[n:], TextPlain)
+	require.NoError(t, err)
+	opts = opts.Add(Option{ID: URIQuery, Value: []byte("x=1")})
+	data := make([]byte, 256)
+	n, err = opts.Marshal(data)
+	require.NoError(t, err)
+	data = append(data[:n], 0xff, 'p')
+
+	var got Options
+	err = RangeOptions(data, func(id OptionID, value []byte) bool {
+		got = append(got, Option{ID: id, Value: value})
+		return true
+	})
+	require.NoError(t, err)
+	require.Equal(t, opts, got)
+
+	// the handler reads only Uri-Path, it stops at the first option after the path
+	var path [8][]byte
+	var segments int
+	readPath := func(id OptionID, value []byte) bool {
+		if id > URIPath {
+			return false
+		}
+		if id == URIPath && segments < len(path) {
+			path[segments] = value
+			segments++
+		}
+		return true
+	}
+	err = RangeOptions(data, readPath)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("a"), []byte("bc"), []byte("d")}, path[:segments])
+	allocs := testing.AllocsPerRun(100, func() {
+		segments = 0
+		_ = RangeOptions(data, readPath)
+	})
+	require.Equal(t, float64(0), allocs)
+
+	err = RangeOptions(data[:3], func(id OptionID, value []byte) bool { return true })
+	require.ErrorIs(t, err, ErrOptionTruncated)
+
+	// two empty options with delta 65000 exceed the largest option number
+	overflow := []byte{0xe0, 0xfc, 0xdb, 0xe0, 0xfc, 0xdb}
+	err = RangeOptions(overflow, func(id OptionID, value []byte) bool { return true })
+	require.ErrorIs(t, err, ErrInvalidOptionHeaderExt)
+	overflowOpts := make(Options, 0, 2)
+	_, err = overflowOpts.Unmarshal(overflow, CoapOptionDefs)
+	require.ErrorIs(t, err, ErrInvalidOptionHeaderExt)
+}
+
 func BenchmarkPathOption(b *testing.B) {
 	buf := make([]byte, 256)
 	b.ResetTimer()
@@ -275,3 +582,29 @@ func BenchmarkPathOption(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkRangeOptions(b *testing.B) {
+	var opts Options
+	opts, _, err := opts.SetPath(make([]byte, 256), "/a/b/c/d/e")
+	require.NoError(b, err)
+	opts = opts.Add(Option{ID: URIQuery, Value: []byte("x=1")})
+	data := make([]byte, 256)
+	n, err := opts.Marshal(data)
+	require.NoError(b, err)
+	data = data[:n]
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		segments := 0
+		err := RangeOptions(data, func(id OptionID, value []byte) bool {
+			if id == URIPath {
+				segments++
+			}
+			return id <= URIPath
+		})
+		if err != nil || segments != 5 {
+			b.Fatalf("cannot range options: %v", err)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package pool
+
+import (
+	"fmt"
+
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+)
+
+// ResponseError is reported when the peer answered by a response code other than the expected one, eg. 4.04.
+type ResponseError struct {
+	Code codes.Code
+	// Message is the response, it is set only when the response is still owned by the caller.
+	Message *Message
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("unexpected response code(%v)", e.Code)
+}
+
+// CheckResponse returns *ResponseError when the code of the response isn't a success (2.xx) one.
+func CheckResponse(resp *Message) error {
+	if resp.Code().IsSuccess() {
+		return nil
+	}
+	return &ResponseError{
+		Code:    resp.Code(),
+		Message: resp,
+	}
+}
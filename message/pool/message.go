@@ -1,22 +1,31 @@
 package pool
 
 import (
+	"bytes"
+	"fmt"
 	"io"
 	"sync"
 	"sync/atomic"
 
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/message/senml"
 )
 
 var (
 	messagePool sync.Pool
 )
 
+// Message is a pooled message. The options are safe for concurrent reads with a single writer, eg. a handler
+// reading the options of the request while blockwise sets Block2 option: the options returned by Options are
+// copied before they are modified again (copy-on-write), so their readers never observe the modification.
+// Other setters must not be called concurrently.
 type Message struct {
 	msg             message.Message
 	valueBuffer     []byte
 	origValueBuffer []byte
+	optionsLock     sync.RWMutex
+	optionsShared   uint32
 
 	payload    io.ReadSeeker
 	sequence   uint64
@@ -39,14 +48,19 @@ func NewMessage() *Message {
 func (r *Message) Reset() {
 	r.msg.Token = nil
 	r.msg.Code = codes.Empty
+	r.optionsLock.Lock()
 	r.msg.Options = r.msg.Options[:0]
 	r.valueBuffer = r.origValueBuffer
+	atomic.StoreUint32(&r.optionsShared, 0)
+	r.optionsLock.Unlock()
 	r.payload = nil
 	r.isModified = false
 }
 
 func (r *Message) Remove(opt message.OptionID) {
-	r.msg.Options = r.msg.Options.Remove(opt)
+	r.optionsLock.Lock()
+	defer r.optionsLock.Unlock()
+	r.msg.Options = r.ownOptions().Remove(opt)
 	r.isModified = true
 }
 
@@ -67,35 +81,107 @@ func (r *Message) SetToken(token message.Token) {
 	r.msg.Token = append(r.msg.Token[:0], token...)
 }
 
-func (r *Message) ResetOptionsTo(in message.Options) {
-	opts, used, err := r.msg.Options.ResetOptionsTo(r.valueBuffer, in)
-	if err == message.ErrTooSmall {
-		r.valueBuffer = append(r.valueBuffer, make([]byte, used)...)
-		opts, used, err = r.msg.Options.ResetOptionsTo(r.valueBuffer, in)
+// ownOptions returns the options which can be modified in place. The options handed out by Options
+// are copied first. It must be called with the write lock of the options.
+func (r *Message) ownOptions() message.Options {
+	if atomic.LoadUint32(&r.optionsShared) == 1 {
+		opts := make(message.Options, len(r.msg.Options), cap(r.msg.Options))
+		copy(opts, r.msg.Options)
+		r.msg.Options = opts
+		atomic.StoreUint32(&r.optionsShared, 0)
+	}
+	return r.msg.Options
+}
+
+// setOptions applies f to the options with the free part of the value buffer, the buffer is grown
+// until the values fit, so the setters never fail for the capacity reasons.
+func (r *Message) setOptions(f func(options message.Options, buf []byte) (message.Options, int, error)) {
+	r.optionsLock.Lock()
+	defer r.optionsLock.Unlock()
+	opts, used, err := f(r.ownOptions(), r.valueBuffer)
+	for size := 2 * cap(r.valueBuffer); err == message.ErrTooSmall; size *= 2 {
+		if size < used {
+			size = used
+		}
+		if size < len(r.origValueBuffer) {
+			size = len(r.origValueBuffer)
+		}
+		// values of the current options stay in the previous buffer
+		r.valueBuffer = make([]byte, size)
+		opts, used, err = f(r.msg.Options, r.valueBuffer)
+	}
+	if err != nil {
+		return
 	}
 	r.msg.Options = opts
 	r.valueBuffer = r.valueBuffer[used:]
+}
+
+func (r *Message) ResetOptionsTo(in message.Options) {
+	r.setOptions(func(options message.Options, buf []byte) (message.Options, int, error) {
+		return options.ResetOptionsTo(buf, in)
+	})
 	if len(in) > 0 {
 		r.isModified = true
 	}
 }
 
+// Options returns the options of the message, they aren't modified by the setters of the message.
 func (r *Message) Options() message.Options {
+	r.optionsLock.RLock()
+	defer r.optionsLock.RUnlock()
+	atomic.StoreUint32(&r.optionsShared, 1)
 	return r.msg.Options
 }
 
+// RangeOptions calls f for every option of the message in the order of their IDs until f returns false,
+// eg. a handler which reads only Uri-Path doesn't copy the options. Unlike Options it doesn't share the options,
+// so the next modification of the message doesn't copy them. The f must not modify the message, the value
+// passed to f is valid until the message is modified.
+func (r *Message) RangeOptions(f func(id message.OptionID, value []byte) bool) {
+	r.optionsLock.RLock()
+	defer r.optionsLock.RUnlock()
+	for _, o := range r.msg.Options {
+		if !f(o.ID, o.Value) {
+			return
+		}
+	}
+}
+
 func (r *Message) SetPath(p string) {
-	opts, used, err := r.msg.Options.SetPath(r.valueBuffer, p)
+	r.setOptions(func(options message.Options, buf []byte) (message.Options, int, error) {
+		return options.SetPath(buf, p)
+	})
+	r.isModified = true
+}
 
-	if err == message.ErrTooSmall {
-		r.valueBuffer = append(r.valueBuffer, make([]byte, used)...)
-		opts, used, err = r.msg.Options.SetPath(r.valueBuffer, p)
-	}
-	r.msg.Options = opts
-	r.valueBuffer = r.valueBuffer[used:]
+// SetLocationPath set's LocationPath options, it's used by 2.01 Created response.
+func (r *Message) SetLocationPath(p string) {
+	r.setOptions(func(options message.Options, buf []byte) (message.Options, int, error) {
+		return options.SetLocationPath(buf, p)
+	})
 	r.isModified = true
 }
 
+// LocationPath get's LocationPath options joined by '/'.
+func (r *Message) LocationPath() (string, error) {
+	r.optionsLock.RLock()
+	defer r.optionsLock.RUnlock()
+	return r.msg.Options.LocationPath()
+}
+
+// AddLocationQuery append's LocationQuery option.
+func (r *Message) AddLocationQuery(query string) {
+	r.AddOptionString(message.LocationQuery, query)
+}
+
+// LocationQueries get's LocationQuery options.
+func (r *Message) LocationQueries() ([]string, error) {
+	r.optionsLock.RLock()
+	defer r.optionsLock.RUnlock()
+	return r.msg.Options.LocationQueries()
+}
+
 func (r *Message) Code() codes.Code {
 	return r.msg.Code
 }
@@ -113,81 +199,85 @@ func (r *Message) GetETag() ([]byte, error) {
 	return r.GetOptionBytes(message.ETag)
 }
 
+// AddETag append's ETag option, a request can carry more ETags to validate the cached responses.
+func (r *Message) AddETag(value []byte) {
+	r.AddOptionBytes(message.ETag, value)
+}
+
+// ETags get's all ETag options.
+func (r *Message) ETags() [][]byte {
+	r.optionsLock.RLock()
+	defer r.optionsLock.RUnlock()
+	return r.msg.Options.ETags()
+}
+
 func (r *Message) AddQuery(query string) {
 	r.AddOptionString(message.URIQuery, query)
 }
 
 func (r *Message) GetOptionUint32(id message.OptionID) (uint32, error) {
+	r.optionsLock.RLock()
+	defer r.optionsLock.RUnlock()
 	return r.msg.Options.GetUint32(id)
 }
 
 func (r *Message) SetOptionString(opt message.OptionID, value string) {
-	opts, used, err := r.msg.Options.SetString(r.valueBuffer, opt, value)
-	if err == message.ErrTooSmall {
-		r.valueBuffer = append(r.valueBuffer, make([]byte, used)...)
-		opts, used, err = r.msg.Options.SetString(r.valueBuffer, opt, value)
-	}
-	r.msg.Options = opts
-	r.valueBuffer = r.valueBuffer[used:]
+	r.setOptions(func(options message.Options, buf []byte) (message.Options, int, error) {
+		return options.SetString(buf, opt, value)
+	})
 	r.isModified = true
 }
 
 func (r *Message) AddOptionString(opt message.OptionID, value string) {
-	opts, used, err := r.msg.Options.AddString(r.valueBuffer, opt, value)
-	if err == message.ErrTooSmall {
-		r.valueBuffer = append(r.valueBuffer, make([]byte, used)...)
-		opts, used, err = r.msg.Options.AddString(r.valueBuffer, opt, value)
-	}
-	r.msg.Options = opts
-	r.valueBuffer = r.valueBuffer[used:]
+	r.setOptions(func(options message.Options, buf []byte) (message.Options, int, error) {
+		return options.AddString(buf, opt, value)
+	})
 	r.isModified = true
 }
 
 func (r *Message) AddOptionBytes(opt message.OptionID, value []byte) {
+	r.optionsLock.Lock()
+	defer r.optionsLock.Unlock()
 	if len(r.valueBuffer) < len(value) {
 		r.valueBuffer = append(r.valueBuffer, make([]byte, len(value)-len(r.valueBuffer))...)
 	}
 	n := copy(r.valueBuffer, value)
 	v := r.valueBuffer[:n]
-	r.msg.Options = r.msg.Options.Add(message.Option{opt, v})
+	r.msg.Options = r.ownOptions().Add(message.Option{opt, v})
 	r.valueBuffer = r.valueBuffer[n:]
 	r.isModified = true
 }
 
 func (r *Message) SetOptionBytes(opt message.OptionID, value []byte) {
+	r.optionsLock.Lock()
+	defer r.optionsLock.Unlock()
 	if len(r.valueBuffer) < len(value) {
 		r.valueBuffer = append(r.valueBuffer, make([]byte, len(value)-len(r.valueBuffer))...)
 	}
 	n := copy(r.valueBuffer, value)
 	v := r.valueBuffer[:n]
-	r.msg.Options = r.msg.Options.Set(message.Option{opt, v})
+	r.msg.Options = r.ownOptions().Set(message.Option{opt, v})
 	r.valueBuffer = r.valueBuffer[n:]
 	r.isModified = true
 }
 
 func (r *Message) GetOptionBytes(id message.OptionID) ([]byte, error) {
+	r.optionsLock.RLock()
+	defer r.optionsLock.RUnlock()
 	return r.msg.Options.GetBytes(id)
 }
 
 func (r *Message) SetOptionUint32(opt message.OptionID, value uint32) {
-	opts, used, err := r.msg.Options.SetUint32(r.valueBuffer, opt, value)
-	if err == message.ErrTooSmall {
-		r.valueBuffer = append(r.valueBuffer, make([]byte, used)...)
-		opts, used, err = r.msg.Options.SetUint32(r.valueBuffer, opt, value)
-	}
-	r.msg.Options = opts
-	r.valueBuffer = r.valueBuffer[used:]
+	r.setOptions(func(options message.Options, buf []byte) (message.Options, int, error) {
+		return options.SetUint32(buf, opt, value)
+	})
 	r.isModified = true
 }
 
 func (r *Message) AddOptionUint32(opt message.OptionID, value uint32) {
-	opts, used, err := r.msg.Options.AddUint32(r.valueBuffer, opt, value)
-	if err == message.ErrTooSmall {
-		r.valueBuffer = append(r.valueBuffer, make([]byte, used)...)
-		opts, used, err = r.msg.Options.AddUint32(r.valueBuffer, opt, value)
-	}
-	r.msg.Options = opts
-	r.valueBuffer = r.valueBuffer[used:]
+	r.setOptions(func(options message.Options, buf []byte) (message.Options, int, error) {
+		return options.AddUint32(buf, opt, value)
+	})
 	r.isModified = true
 }
 
@@ -197,6 +287,8 @@ func (r *Message) ContentFormat() (message.MediaType, error) {
 }
 
 func (r *Message) HasOption(id message.OptionID) bool {
+	r.optionsLock.RLock()
+	defer r.optionsLock.RUnlock()
 	return r.msg.Options.HasOption(id)
 }
 
@@ -204,14 +296,29 @@ func (r *Message) SetContentFormat(contentFormat message.MediaType) {
 	r.SetOptionUint32(message.ContentFormat, uint32(contentFormat))
 }
 
+// SetObserve set's Observe option, the value is truncated to 24 bits.
 func (r *Message) SetObserve(observe uint32) {
-	r.SetOptionUint32(message.Observe, observe)
+	r.SetOptionUint32(message.Observe, observe&message.MaxObserveValue)
 }
 
 func (r *Message) Observe() (uint32, error) {
 	return r.GetOptionUint32(message.Observe)
 }
 
+// SetTraceContext set's TraceParent option, an invalid tc removes it.
+func (r *Message) SetTraceContext(tc message.TraceContext) {
+	if !tc.IsValid() {
+		r.Remove(message.TraceParent)
+		return
+	}
+	r.SetOptionBytes(message.TraceParent, tc.Bytes())
+}
+
+// TraceContext get's TraceParent option.
+func (r *Message) TraceContext() (message.TraceContext, error) {
+	return r.Options().GetTraceContext()
+}
+
 // SetAccept set's accept option.
 func (r *Message) SetAccept(contentFormat message.MediaType) {
 	r.SetOptionUint32(message.Accept, uint32(contentFormat))
@@ -223,10 +330,81 @@ func (r *Message) Accept() (message.MediaType, error) {
 	return message.MediaType(v), err
 }
 
+// SetMaxAge set's MaxAge option in seconds.
+func (r *Message) SetMaxAge(maxAge uint32) {
+	r.SetOptionUint32(message.MaxAge, maxAge)
+}
+
+// MaxAge get's MaxAge option in seconds.
+func (r *Message) MaxAge() (uint32, error) {
+	return r.GetOptionUint32(message.MaxAge)
+}
+
+// SetProxyURI set's ProxyURI option.
+func (r *Message) SetProxyURI(uri string) {
+	r.SetOptionString(message.ProxyURI, uri)
+}
+
+// ProxyURI get's ProxyURI option.
+func (r *Message) ProxyURI() (string, error) {
+	r.optionsLock.RLock()
+	defer r.optionsLock.RUnlock()
+	return r.msg.Options.ProxyURI()
+}
+
+// SetProxyScheme set's ProxyScheme option.
+func (r *Message) SetProxyScheme(scheme string) {
+	r.SetOptionString(message.ProxyScheme, scheme)
+}
+
+// ProxyScheme get's ProxyScheme option.
+func (r *Message) ProxyScheme() (string, error) {
+	r.optionsLock.RLock()
+	defer r.optionsLock.RUnlock()
+	return r.msg.Options.ProxyScheme()
+}
+
+// SetURIHost set's URIHost option.
+func (r *Message) SetURIHost(host string) {
+	r.SetOptionString(message.URIHost, host)
+}
+
+// URIHost get's URIHost option.
+func (r *Message) URIHost() (string, error) {
+	r.optionsLock.RLock()
+	defer r.optionsLock.RUnlock()
+	return r.msg.Options.URIHost()
+}
+
+// SetURIPort set's URIPort option.
+func (r *Message) SetURIPort(port uint16) {
+	r.SetOptionUint32(message.URIPort, uint32(port))
+}
+
+// URIPort get's URIPort option.
+func (r *Message) URIPort() (uint16, error) {
+	r.optionsLock.RLock()
+	defer r.optionsLock.RUnlock()
+	return r.msg.Options.URIPort()
+}
+
 func (r *Message) ETag() ([]byte, error) {
 	return r.GetOptionBytes(message.ETag)
 }
 
+// AddIfMatch append's IfMatch option, an empty etag makes the request conditional on the existence of the resource.
+func (r *Message) AddIfMatch(etag []byte) {
+	r.AddOptionBytes(message.IfMatch, etag)
+}
+
+// SetIfNoneMatch set's IfNoneMatch option, so the request is performed only when the resource doesn't exist.
+func (r *Message) SetIfNoneMatch() {
+	r.optionsLock.Lock()
+	defer r.optionsLock.Unlock()
+	r.msg.Options = r.ownOptions().SetIfNoneMatch()
+	r.isModified = true
+}
+
 func (r *Message) BodySize() (int64, error) {
 	if r.payload == nil {
 		return 0, nil
@@ -284,7 +462,30 @@ func (r *Message) SetModified(b bool) {
 }
 
 func (r *Message) String() string {
-	return r.msg.String()
+	r.optionsLock.RLock()
+	msg := r.msg
+	r.optionsLock.RUnlock()
+	msg.Body = r.payload
+	return msg.String()
+}
+
+// CopyTo deep copies code, token, options, payload and sequence of the message to dst,
+// so dst doesn't share any buffer with the message.
+func (r *Message) CopyTo(dst *Message) error {
+	payload, err := r.ReadBody()
+	if err != nil {
+		return fmt.Errorf("cannot read payload: %w", err)
+	}
+	dst.Reset()
+	dst.SetCode(r.Code())
+	dst.SetToken(r.Token())
+	dst.ResetOptionsTo(r.Options())
+	if payload != nil {
+		dst.SetBody(bytes.NewReader(payload))
+	}
+	dst.SetSequence(r.Sequence())
+	dst.SetModified(r.IsModified())
+	return nil
 }
 
 func (r *Message) ReadBody() ([]byte, error) {
@@ -314,3 +515,21 @@ func (r *Message) ReadBody() ([]byte, error) {
 	}
 	return payload[:n], nil
 }
+
+// ReadSenML decodes the SenML body by the content format application/senml+json or application/senml+cbor
+// and returns the normalized records, so names, units, values and absolute times are resolved.
+func (r *Message) ReadSenML() ([]senml.Record, error) {
+	cf, err := r.ContentFormat()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get content format: %w", err)
+	}
+	payload, err := r.ReadBody()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read payload: %w", err)
+	}
+	records, err := senml.Unpack(payload, cf)
+	if err != nil {
+		return nil, err
+	}
+	return senml.Normalize(records)
+}
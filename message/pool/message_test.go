@@ -0,0 +1,126 @@
+package pool
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/senml"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageOptionSettersGrowBuffer(t *testing.T) {
+	m := NewMessage()
+	m.SetContentFormat(message.TextPlain)
+	for i := 0; i < 50; i++ {
+		m.AddQuery(strings.Repeat("q", 100))
+	}
+	path := strings.Repeat("a/", 100) + strings.Repeat("b", 250)
+	m.SetPath("/" + path)
+	m.SetPath("/" + path)
+	m.SetOptionUint32(message.Observe, 5)
+
+	queries, err := m.Options().Queries()
+	require.NoError(t, err)
+	require.Len(t, queries, 50)
+	for _, q := range queries {
+		require.Equal(t, strings.Repeat("q", 100), q)
+	}
+	gotPath, err := m.Options().Path()
+	require.NoError(t, err)
+	require.Equal(t, path, gotPath)
+	cf, err := m.ContentFormat()
+	require.NoError(t, err)
+	require.Equal(t, message.TextPlain, cf)
+	obs, err := m.Observe()
+	require.NoError(t, err)
+	require.Equal(t, uint32(5), obs)
+
+	m.Reset()
+	require.Empty(t, m.Options())
+	m.SetPath("/c")
+	gotPath, err = m.Options().Path()
+	require.NoError(t, err)
+	require.Equal(t, "c", gotPath)
+}
+
+func TestMessageResetOptionsToPooledOptions(t *testing.T) {
+	raw := []byte("abc")
+	opts := AcquireOptions()
+	*opts = append(*opts, message.Option{ID: message.URIPath, Value: raw})
+	m := NewMessage()
+	m.ResetOptionsTo(*opts)
+	ReleaseOptions(opts)
+
+	// the message owns copies of the values, so reuse of the options and of the raw data doesn't change it
+	raw[0] = 'x'
+	opts = AcquireOptions()
+	require.Empty(t, *opts)
+	require.Nil(t, (*opts)[:1][0].Value)
+	ReleaseOptions(opts)
+	path, err := m.Options().Path()
+	require.NoError(t, err)
+	require.Equal(t, "abc", path)
+}
+
+func TestMessageOptionsCopyOnWrite(t *testing.T) {
+	m := NewMessage()
+	m.SetPath("/a/b")
+	m.SetContentFormat(message.AppJSON)
+
+	// a handler reads the options of the request while blockwise sets and removes Block2 option
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				opts := m.Options()
+				path, err := opts.Path()
+				require.NoError(t, err)
+				require.Equal(t, "a/b", path)
+				cf, err := m.ContentFormat()
+				require.NoError(t, err)
+				require.Equal(t, message.AppJSON, cf)
+				_ = m.HasOption(message.Block2)
+			}
+		}()
+	}
+	for j := 0; j < 1000; j++ {
+		m.SetOptionUint32(message.Block2, uint32(j))
+		m.Remove(message.Block2)
+	}
+	wg.Wait()
+
+	// the options handed out are not modified by the setters
+	opts := m.Options()
+	m.SetOptionUint32(message.Block2, 1)
+	m.SetPath("/c")
+	path, err := opts.Path()
+	require.NoError(t, err)
+	require.Equal(t, "a/b", path)
+	require.False(t, opts.HasOption(message.Block2))
+	path, err = m.Options().Path()
+	require.NoError(t, err)
+	require.Equal(t, "c", path)
+}
+
+func TestMessageReadSenML(t *testing.T) {
+	m := NewMessage()
+	m.SetContentFormat(message.AppSenmlJSON)
+	m.SetBody(bytes.NewReader([]byte(`[{"bn":"urn:dev:ow:10e2073a01080063:","bt":1.320067464e+09,"bu":"Cel","n":"temp","v":23.5},{"n":"temp","t":60,"v":23.6}]`)))
+	records, err := m.ReadSenML()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, "urn:dev:ow:10e2073a01080063:temp", records[1].Name)
+	require.Equal(t, "Cel", records[1].Unit)
+	require.Equal(t, 23.6, *records[1].Value)
+	require.Equal(t, float64(1320067524), records[1].Time)
+
+	m.SetContentFormat(message.TextPlain)
+	_, err = m.ReadSenML()
+	require.True(t, errors.Is(err, senml.ErrUnsupportedFormat))
+}
@@ -0,0 +1,41 @@
+package pool
+
+import (
+	"sync"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+)
+
+// maxPooledOptions bounds the capacity of the options returned to the pool, so a message with lots of options
+// doesn't keep the big slice alive.
+const maxPooledOptions = 64
+
+var optionsPool = sync.Pool{
+	New: func() interface{} {
+		opts := make(message.Options, 0, 16)
+		return &opts
+	},
+}
+
+// AcquireOptions returns empty options from the pool, eg. for decoding of the message whose options are
+// copied to the Message by ResetOptionsTo.
+//
+// The returned options must be passed to ReleaseOptions when they are no longer needed,
+// values of the options must not be retained after that.
+func AcquireOptions() *message.Options {
+	return optionsPool.Get().(*message.Options)
+}
+
+// ReleaseOptions returns opts acquired via AcquireOptions to the pool.
+func ReleaseOptions(opts *message.Options) {
+	if cap(*opts) > maxPooledOptions {
+		return
+	}
+	// drop references to the values, they are owned by somebody else
+	*opts = (*opts)[:cap(*opts)]
+	for i := range *opts {
+		(*opts)[i] = message.Option{}
+	}
+	*opts = (*opts)[:0]
+	optionsPool.Put(opts)
+}
@@ -0,0 +1,425 @@
+package senml
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// CBOR labels of the record fields: https://tools.ietf.org/html/rfc8428#section-6
+const (
+	labelBaseVersion = -1
+	labelBaseName    = -2
+	labelBaseTime    = -3
+	labelBaseUnit    = -4
+	labelBaseValue   = -5
+	labelBaseSum     = -6
+	labelName        = 0
+	labelUnit        = 1
+	labelValue       = 2
+	labelStringValue = 3
+	labelBoolValue   = 4
+	labelSum         = 5
+	labelTime        = 6
+	labelUpdateTime  = 7
+	labelDataValue   = 8
+)
+
+// CBOR major types: https://tools.ietf.org/html/rfc7049#section-2.1
+const (
+	majorUint   = 0
+	majorNint   = 1
+	majorBytes  = 2
+	majorText   = 3
+	majorArray  = 4
+	majorMap    = 5
+	majorTag    = 6
+	majorSimple = 7
+)
+
+const (
+	cborFalse     = 20
+	cborTrue      = 21
+	cborNull      = 22
+	cborUndefined = 23
+	cborFloat16   = 25
+	cborFloat32   = 26
+	cborFloat64   = 27
+	cborBreak     = 31
+	cborIndefLen  = 31
+	maxCBORDepth  = 16
+	maxExactFloat = 1 << 53
+)
+
+func marshalCBOR(records []Record) []byte {
+	buf := appendHead(nil, majorArray, uint64(len(records)))
+	for _, r := range records {
+		var fields []byte
+		var n uint64
+		appendField := func(label int, value func([]byte) []byte) {
+			fields = value(appendInt(fields, int64(label)))
+			n++
+		}
+		if r.BaseName != "" {
+			appendField(labelBaseName, func(b []byte) []byte { return appendText(b, r.BaseName) })
+		}
+		if r.BaseTime != 0 {
+			appendField(labelBaseTime, func(b []byte) []byte { return appendNumber(b, r.BaseTime) })
+		}
+		if r.BaseUnit != "" {
+			appendField(labelBaseUnit, func(b []byte) []byte { return appendText(b, r.BaseUnit) })
+		}
+		if r.BaseValue != 0 {
+			appendField(labelBaseValue, func(b []byte) []byte { return appendNumber(b, r.BaseValue) })
+		}
+		if r.BaseSum != 0 {
+			appendField(labelBaseSum, func(b []byte) []byte { return appendNumber(b, r.BaseSum) })
+		}
+		if r.Name != "" {
+			appendField(labelName, func(b []byte) []byte { return appendText(b, r.Name) })
+		}
+		if r.Unit != "" {
+			appendField(labelUnit, func(b []byte) []byte { return appendText(b, r.Unit) })
+		}
+		if r.Value != nil {
+			appendField(labelValue, func(b []byte) []byte { return appendNumber(b, *r.Value) })
+		}
+		if r.StringValue != nil {
+			appendField(labelStringValue, func(b []byte) []byte { return appendText(b, *r.StringValue) })
+		}
+		if r.BoolValue != nil {
+			appendField(labelBoolValue, func(b []byte) []byte { return appendBool(b, *r.BoolValue) })
+		}
+		if r.Sum != nil {
+			appendField(labelSum, func(b []byte) []byte { return appendNumber(b, *r.Sum) })
+		}
+		if r.Time != 0 {
+			appendField(labelTime, func(b []byte) []byte { return appendNumber(b, r.Time) })
+		}
+		if r.UpdateTime != 0 {
+			appendField(labelUpdateTime, func(b []byte) []byte { return appendNumber(b, r.UpdateTime) })
+		}
+		buf = appendHead(buf, majorMap, n)
+		buf = append(buf, fields...)
+	}
+	return buf
+}
+
+func appendHead(buf []byte, major byte, arg uint64) []byte {
+	m := major << 5
+	switch {
+	case arg < 24:
+		return append(buf, m|byte(arg))
+	case arg <= math.MaxUint8:
+		return append(buf, m|24, byte(arg))
+	case arg <= math.MaxUint16:
+		buf = append(buf, m|25, 0, 0)
+		binary.BigEndian.PutUint16(buf[len(buf)-2:], uint16(arg))
+		return buf
+	case arg <= math.MaxUint32:
+		buf = append(buf, m|26, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(buf[len(buf)-4:], uint32(arg))
+		return buf
+	}
+	buf = append(buf, m|27, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint64(buf[len(buf)-8:], arg)
+	return buf
+}
+
+func appendInt(buf []byte, v int64) []byte {
+	if v < 0 {
+		return appendHead(buf, majorNint, uint64(-(v + 1)))
+	}
+	return appendHead(buf, majorUint, uint64(v))
+}
+
+func appendText(buf []byte, v string) []byte {
+	buf = appendHead(buf, majorText, uint64(len(v)))
+	return append(buf, v...)
+}
+
+func appendBool(buf []byte, v bool) []byte {
+	if v {
+		return append(buf, majorSimple<<5|cborTrue)
+	}
+	return append(buf, majorSimple<<5|cborFalse)
+}
+
+// appendNumber encodes v by the shortest of integer, single or double precision float which keeps its value.
+func appendNumber(buf []byte, v float64) []byte {
+	if v == math.Trunc(v) && math.Abs(v) < maxExactFloat {
+		return appendInt(buf, int64(v))
+	}
+	if float64(float32(v)) == v {
+		buf = append(buf, majorSimple<<5|cborFloat32, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(buf[len(buf)-4:], math.Float32bits(float32(v)))
+		return buf
+	}
+	buf = append(buf, majorSimple<<5|cborFloat64, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint64(buf[len(buf)-8:], math.Float64bits(v))
+	return buf
+}
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+// cborBreakValue marks the end of an indefinite length array or map.
+type cborBreakValue struct{}
+
+func unmarshalCBOR(data []byte) ([]Record, error) {
+	d := cborDecoder{data: data}
+	v, err := d.item(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(data) {
+		return nil, fmt.Errorf("%w: unexpected data after the pack", ErrInvalidCBOR)
+	}
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: pack is not an array", ErrInvalidCBOR)
+	}
+	records := make([]Record, 0, len(items))
+	for i, item := range items {
+		fields, ok := item.(map[int64]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%w: record %v is not a map", ErrInvalidCBOR, i)
+		}
+		r, err := recordFromCBOR(fields)
+		if err != nil {
+			return nil, fmt.Errorf("%w: record %v: %v", ErrInvalidCBOR, i, err)
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+func recordFromCBOR(fields map[int64]interface{}) (Record, error) {
+	var r Record
+	for label, value := range fields {
+		var err error
+		switch label {
+		case labelBaseName:
+			r.BaseName, err = toText(value)
+		case labelBaseTime:
+			r.BaseTime, err = toNumber(value)
+		case labelBaseUnit:
+			r.BaseUnit, err = toText(value)
+		case labelBaseValue:
+			r.BaseValue, err = toNumber(value)
+		case labelBaseSum:
+			r.BaseSum, err = toNumber(value)
+		case labelName:
+			r.Name, err = toText(value)
+		case labelUnit:
+			r.Unit, err = toText(value)
+		case labelValue:
+			var v float64
+			v, err = toNumber(value)
+			r.Value = &v
+		case labelStringValue:
+			var v string
+			v, err = toText(value)
+			r.StringValue = &v
+		case labelBoolValue:
+			v, ok := value.(bool)
+			if !ok {
+				err = fmt.Errorf("label %v is not a bool", label)
+			}
+			r.BoolValue = &v
+		case labelSum:
+			var v float64
+			v, err = toNumber(value)
+			r.Sum = &v
+		case labelTime:
+			r.Time, err = toNumber(value)
+		case labelUpdateTime:
+			r.UpdateTime, err = toNumber(value)
+		case labelBaseVersion, labelDataValue:
+			// version and data values aren't supported, they are skipped
+		}
+		if err != nil {
+			return Record{}, fmt.Errorf("label %v: %w", label, err)
+		}
+	}
+	return r, nil
+}
+
+func toText(v interface{}) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%T is not a text", v)
+	}
+	return s, nil
+}
+
+func toNumber(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), nil
+	case float64:
+		return n, nil
+	}
+	return 0, fmt.Errorf("%T is not a number", v)
+}
+
+func (d *cborDecoder) next(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, fmt.Errorf("%w: unexpected end of data", ErrInvalidCBOR)
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+func (d *cborDecoder) head() (major byte, info byte, arg uint64, err error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info = b[0]>>5, b[0]&0x1f
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info <= 27:
+		v, err := d.next(1 << (info - 24))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		for _, c := range v {
+			arg = arg<<8 | uint64(c)
+		}
+		return major, info, arg, nil
+	case info == cborIndefLen:
+		return major, info, 0, nil
+	}
+	return 0, 0, 0, fmt.Errorf("%w: reserved additional information %v", ErrInvalidCBOR, info)
+}
+
+func (d *cborDecoder) item(depth int) (interface{}, error) {
+	if depth > maxCBORDepth {
+		return nil, fmt.Errorf("%w: nesting is too deep", ErrInvalidCBOR)
+	}
+	major, info, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	indefinite := info == cborIndefLen
+	if indefinite && (major == majorUint || major == majorNint || major == majorTag) {
+		return nil, fmt.Errorf("%w: invalid indefinite length of major type %v", ErrInvalidCBOR, major)
+	}
+	switch major {
+	case majorUint:
+		if arg > math.MaxInt64 {
+			return float64(arg), nil
+		}
+		return int64(arg), nil
+	case majorNint:
+		if arg > math.MaxInt64 {
+			return -1 - float64(arg), nil
+		}
+		return -1 - int64(arg), nil
+	case majorBytes, majorText:
+		if indefinite {
+			return nil, fmt.Errorf("%w: indefinite length strings aren't supported", ErrInvalidCBOR)
+		}
+		b, err := d.next(arg)
+		if err != nil {
+			return nil, err
+		}
+		if major == majorText {
+			return string(b), nil
+		}
+		return append([]byte(nil), b...), nil
+	case majorArray:
+		var items []interface{}
+		for i := uint64(0); indefinite || i < arg; i++ {
+			v, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := v.(cborBreakValue); ok {
+				if !indefinite {
+					return nil, fmt.Errorf("%w: unexpected break", ErrInvalidCBOR)
+				}
+				break
+			}
+			items = append(items, v)
+		}
+		return items, nil
+	case majorMap:
+		fields := make(map[int64]interface{})
+		for i := uint64(0); indefinite || i < arg; i++ {
+			k, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := k.(cborBreakValue); ok {
+				if !indefinite {
+					return nil, fmt.Errorf("%w: unexpected break", ErrInvalidCBOR)
+				}
+				break
+			}
+			v, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := v.(cborBreakValue); ok {
+				return nil, fmt.Errorf("%w: map key without value", ErrInvalidCBOR)
+			}
+			// only the integer labels are defined for the cbor representation
+			if label, ok := k.(int64); ok {
+				fields[label] = v
+			}
+		}
+		return fields, nil
+	case majorTag:
+		return d.item(depth + 1)
+	}
+	return simpleValue(info, arg)
+}
+
+func simpleValue(info byte, arg uint64) (interface{}, error) {
+	switch info {
+	case cborFalse:
+		return false, nil
+	case cborTrue:
+		return true, nil
+	case cborNull, cborUndefined:
+		return nil, nil
+	case cborFloat16:
+		return halfToFloat(uint16(arg)), nil
+	case cborFloat32:
+		return float64(math.Float32frombits(uint32(arg))), nil
+	case cborFloat64:
+		return math.Float64frombits(arg), nil
+	case cborBreak:
+		return cborBreakValue{}, nil
+	}
+	return nil, fmt.Errorf("%w: unsupported simple value %v", ErrInvalidCBOR, arg)
+}
+
+// halfToFloat converts IEEE 754 half precision float: https://tools.ietf.org/html/rfc7049#appendix-D
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var v float64
+	switch exp {
+	case 0:
+		v = math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			v = math.Inf(1)
+		} else {
+			v = math.NaN()
+		}
+	default:
+		v = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -v
+	}
+	return v
+}
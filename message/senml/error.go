@@ -0,0 +1,12 @@
+package senml
+
+import "errors"
+
+var (
+	// ErrUnsupportedFormat the content format is neither application/senml+json nor application/senml+cbor.
+	ErrUnsupportedFormat = errors.New("unsupported senml content format")
+	// ErrInvalidCBOR the data aren't well-formed CBOR or they don't encode an array of maps.
+	ErrInvalidCBOR = errors.New("invalid senml cbor")
+	// ErrInvalidRecord the resolved record has no name or it carries more than one value.
+	ErrInvalidRecord = errors.New("invalid senml record")
+)
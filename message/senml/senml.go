@@ -0,0 +1,138 @@
+// Package senml encodes and decodes Sensor Measurement Lists (SenML) defined in https://tools.ietf.org/html/rfc8428
+// in the JSON and the CBOR representation.
+package senml
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+)
+
+// relativeTimeLimit is 2**28, the resolved times below it are relative to the current time:
+// https://tools.ietf.org/html/rfc8428#section-4.5.3
+const relativeTimeLimit = 1 << 28
+
+// Record is one SenML record. The base fields apply to the record and all the following ones of the pack,
+// Normalize resolves them. Time and UpdateTime are seconds, Time is since the unix epoch when it's absolute.
+type Record struct {
+	BaseName  string  `json:"bn,omitempty"`
+	BaseTime  float64 `json:"bt,omitempty"`
+	BaseUnit  string  `json:"bu,omitempty"`
+	BaseValue float64 `json:"bv,omitempty"`
+	BaseSum   float64 `json:"bs,omitempty"`
+
+	Name        string   `json:"n,omitempty"`
+	Unit        string   `json:"u,omitempty"`
+	Value       *float64 `json:"v,omitempty"`
+	StringValue *string  `json:"vs,omitempty"`
+	BoolValue   *bool    `json:"vb,omitempty"`
+	Sum         *float64 `json:"s,omitempty"`
+	Time        float64  `json:"t,omitempty"`
+	UpdateTime  float64  `json:"ut,omitempty"`
+}
+
+// TimeValue returns Time of the normalized record as time.Time.
+func (r Record) TimeValue() time.Time {
+	sec, frac := math.Modf(r.Time)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+// Pack encodes the records by the content format message.AppSenmlJSON or message.AppSenmlCbor.
+func Pack(records []Record, format message.MediaType) ([]byte, error) {
+	switch format {
+	case message.AppSenmlJSON:
+		if records == nil {
+			records = []Record{}
+		}
+		return json.Marshal(records)
+	case message.AppSenmlCbor:
+		return marshalCBOR(records), nil
+	}
+	return nil, fmt.Errorf("%w: %v", ErrUnsupportedFormat, format)
+}
+
+// Unpack decodes the records encoded by the content format message.AppSenmlJSON or message.AppSenmlCbor.
+// The records are returned as they were sent, use Normalize to resolve them.
+func Unpack(data []byte, format message.MediaType) ([]Record, error) {
+	switch format {
+	case message.AppSenmlJSON:
+		var records []Record
+		if err := json.Unmarshal(data, &records); err != nil {
+			return nil, err
+		}
+		return records, nil
+	case message.AppSenmlCbor:
+		return unmarshalCBOR(data)
+	}
+	return nil, fmt.Errorf("%w: %v", ErrUnsupportedFormat, format)
+}
+
+// Normalize resolves the records to the form of https://tools.ietf.org/html/rfc8428#section-4.6:
+// base name, unit, value, sum and time are applied and removed, relative times are converted to absolute
+// ones by the current time. It returns error for a record without name or with more than one value.
+func Normalize(records []Record) ([]Record, error) {
+	return normalize(records, time.Now())
+}
+
+func normalize(records []Record, now time.Time) ([]Record, error) {
+	nowSec := float64(now.UnixNano()) / float64(time.Second)
+	var base Record
+	resolved := make([]Record, 0, len(records))
+	for i, r := range records {
+		if r.BaseName != "" {
+			base.BaseName = r.BaseName
+		}
+		if r.BaseTime != 0 {
+			base.BaseTime = r.BaseTime
+		}
+		if r.BaseUnit != "" {
+			base.BaseUnit = r.BaseUnit
+		}
+		if r.BaseValue != 0 {
+			base.BaseValue = r.BaseValue
+		}
+		if r.BaseSum != 0 {
+			base.BaseSum = r.BaseSum
+		}
+
+		n := Record{
+			Name:        base.BaseName + r.Name,
+			Unit:        r.Unit,
+			StringValue: r.StringValue,
+			BoolValue:   r.BoolValue,
+			Time:        base.BaseTime + r.Time,
+			UpdateTime:  r.UpdateTime,
+		}
+		if n.Name == "" {
+			return nil, fmt.Errorf("%w: record %v has no name", ErrInvalidRecord, i)
+		}
+		if n.Unit == "" {
+			n.Unit = base.BaseUnit
+		}
+		if r.Value != nil {
+			v := base.BaseValue + *r.Value
+			n.Value = &v
+		}
+		if r.Sum != nil {
+			s := base.BaseSum + *r.Sum
+			n.Sum = &s
+		}
+		if n.Time < relativeTimeLimit {
+			n.Time += nowSec
+		}
+		values := 0
+		for _, set := range []bool{n.Value != nil, n.StringValue != nil, n.BoolValue != nil} {
+			if set {
+				values++
+			}
+		}
+		if values > 1 {
+			return nil, fmt.Errorf("%w: record %v has more than one value", ErrInvalidRecord, i)
+		}
+		resolved = append(resolved, n)
+	}
+	return resolved, nil
+}
@@ -0,0 +1,141 @@
+package senml
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+)
+
+// temperatureCBOR is [{-2: "urn:dev:ow:10e2073a01080063:", -3: 1320067464, -4: "Cel", 0: "temp", 2: 23.5},
+// {0: "temp", 6: 60, 2: 23.6}], the first value is a half precision float and the second one a single precision.
+var temperatureCBOR = []byte{
+	0x82,
+	0xa5,
+	0x21, 0x78, 0x1c, 'u', 'r', 'n', ':', 'd', 'e', 'v', ':', 'o', 'w', ':', '1', '0', 'e', '2', '0', '7', '3', 'a', '0', '1', '0', '8', '0', '0', '6', '3', ':',
+	0x22, 0x1a, 0x4e, 0xae, 0xa1, 0x88,
+	0x23, 0x63, 'C', 'e', 'l',
+	0x00, 0x64, 't', 'e', 'm', 'p',
+	0x02, 0xf9, 0x4d, 0xe0,
+	0xa3,
+	0x00, 0x64, 't', 'e', 'm', 'p',
+	0x06, 0x18, 0x3c,
+	0x02, 0xfa, 0x41, 0xbc, 0xcc, 0xcd,
+}
+
+func TestUnpackCBORTemperature(t *testing.T) {
+	records, err := Unpack(temperatureCBOR, message.AppSenmlCbor)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, "urn:dev:ow:10e2073a01080063:", records[0].BaseName)
+	require.Equal(t, float64(1320067464), records[0].BaseTime)
+	require.Equal(t, 23.5, *records[0].Value)
+	require.Equal(t, float64(60), records[1].Time)
+
+	normalized, err := Normalize(records)
+	require.NoError(t, err)
+	require.Len(t, normalized, 2)
+	for _, r := range normalized {
+		require.Equal(t, "urn:dev:ow:10e2073a01080063:temp", r.Name)
+		require.Equal(t, "Cel", r.Unit)
+		require.Empty(t, r.BaseName)
+		require.Zero(t, r.BaseTime)
+	}
+	require.Equal(t, 23.5, *normalized[0].Value)
+	require.Equal(t, float64(1320067464), normalized[0].Time)
+	require.InDelta(t, 23.6, *normalized[1].Value, 1e-6)
+	require.Equal(t, float64(1320067524), normalized[1].Time)
+	require.Equal(t, time.Unix(1320067524, 0), normalized[1].TimeValue())
+}
+
+func TestPackUnpack(t *testing.T) {
+	v := 21.25
+	vs := "on"
+	vb := true
+	s := 1e10
+	records := []Record{
+		{BaseName: "dev/", BaseTime: 1.6e9 + 0.5, BaseUnit: "W", BaseValue: 100, Name: "power", Value: &v, Time: -1.5},
+		{Name: "state", StringValue: &vs, UpdateTime: 30},
+		{Name: "alarm", BoolValue: &vb},
+		{Name: "energy", Unit: "J", Sum: &s},
+	}
+	for _, format := range []message.MediaType{message.AppSenmlJSON, message.AppSenmlCbor} {
+		t.Run(format.String(), func(t *testing.T) {
+			data, err := Pack(records, format)
+			require.NoError(t, err)
+			got, err := Unpack(data, format)
+			require.NoError(t, err)
+			require.Equal(t, records, got)
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	v := 1.5
+	records := []Record{
+		{BaseName: "a/", BaseValue: 10, BaseUnit: "m", Name: "x", Value: &v, Time: -10},
+		{Name: "y", Unit: "s", Value: &v},
+		{BaseName: "b/", BaseTime: 1500000000, Name: "z", Value: &v, Time: 5},
+	}
+	got, err := normalize(records, now)
+	require.NoError(t, err)
+	require.Len(t, got, 3)
+	require.Equal(t, "a/x", got[0].Name)
+	require.Equal(t, "m", got[0].Unit)
+	require.Equal(t, 11.5, *got[0].Value)
+	require.Equal(t, float64(1600000000-10), got[0].Time)
+	require.Equal(t, "a/y", got[1].Name)
+	require.Equal(t, "s", got[1].Unit)
+	require.Equal(t, float64(1600000000), got[1].Time)
+	require.Equal(t, "b/z", got[2].Name)
+	require.Equal(t, 11.5, *got[2].Value)
+	require.Equal(t, float64(1500000005), got[2].Time)
+	// the records are not modified
+	require.Equal(t, 1.5, *records[0].Value)
+}
+
+func TestNormalizeInvalid(t *testing.T) {
+	v := 1.0
+	vb := true
+	_, err := Normalize([]Record{{Value: &v}})
+	require.True(t, errors.Is(err, ErrInvalidRecord))
+	_, err = Normalize([]Record{{Name: "x", Value: &v, BoolValue: &vb}})
+	require.True(t, errors.Is(err, ErrInvalidRecord))
+}
+
+func TestUnpackInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		format  message.MediaType
+		wantErr error
+	}{
+		{name: "format", data: []byte("[]"), format: message.AppJSON, wantErr: ErrUnsupportedFormat},
+		{name: "truncated", data: temperatureCBOR[:len(temperatureCBOR)-1], format: message.AppSenmlCbor, wantErr: ErrInvalidCBOR},
+		{name: "trailingData", data: append(append([]byte(nil), temperatureCBOR...), 0), format: message.AppSenmlCbor, wantErr: ErrInvalidCBOR},
+		{name: "notArray", data: []byte{0xa0}, format: message.AppSenmlCbor, wantErr: ErrInvalidCBOR},
+		{name: "recordNotMap", data: []byte{0x81, 0x01}, format: message.AppSenmlCbor, wantErr: ErrInvalidCBOR},
+		{name: "nameNotText", data: []byte{0x81, 0xa1, 0x00, 0x01}, format: message.AppSenmlCbor, wantErr: ErrInvalidCBOR},
+		{name: "tooDeep", data: []byte{0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0x80}, format: message.AppSenmlCbor, wantErr: ErrInvalidCBOR},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Unpack(tt.data, tt.format)
+			require.True(t, errors.Is(err, tt.wantErr), "unexpected error %v", err)
+		})
+	}
+}
+
+func TestUnpackCBORIndefinite(t *testing.T) {
+	// [_ {_ 0: "temp", 2: 1}]
+	data := []byte{0x9f, 0xbf, 0x00, 0x64, 't', 'e', 'm', 'p', 0x02, 0x01, 0xff, 0xff}
+	records, err := Unpack(data, message.AppSenmlCbor)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, "temp", records[0].Name)
+	require.Equal(t, float64(1), *records[0].Value)
+}
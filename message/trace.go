@@ -0,0 +1,78 @@
+package message
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+)
+
+// traceContextLen is the length of the encoded TraceContext: trace ID, span ID and flags.
+const traceContextLen = 16 + 8 + 1
+
+// TraceContext identifies the trace and the span of a request, so the request can be correlated across
+// the hops of a CoAP mesh. It follows the traceparent of https://www.w3.org/TR/trace-context/.
+type TraceContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+}
+
+// IsValid reports whether trace ID and span ID are set.
+func (t TraceContext) IsValid() bool {
+	return t.TraceID != [16]byte{} && t.SpanID != [8]byte{}
+}
+
+// String returns the traceparent representation, eg. `00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01`.
+func (t TraceContext) String() string {
+	return fmt.Sprintf("00-%s-%s-%02x", hex.EncodeToString(t.TraceID[:]), hex.EncodeToString(t.SpanID[:]), t.Flags)
+}
+
+// Bytes returns the value of TraceParent option: trace ID, span ID and flags.
+func (t TraceContext) Bytes() []byte {
+	data := make([]byte, traceContextLen)
+	copy(data[:16], t.TraceID[:])
+	copy(data[16:24], t.SpanID[:])
+	data[24] = t.Flags
+	return data
+}
+
+// SetTraceContext set's TraceParent option.
+func (options Options) SetTraceContext(buf []byte, tc TraceContext) (Options, int, error) {
+	if !tc.IsValid() {
+		return options, -1, ErrInvalidValueLength
+	}
+	return options.SetBytes(buf, TraceParent, tc.Bytes())
+}
+
+// GetTraceContext get's TraceParent option.
+func (options Options) GetTraceContext() (TraceContext, error) {
+	v, err := options.GetBytes(TraceParent)
+	if err != nil {
+		return TraceContext{}, err
+	}
+	if len(v) != traceContextLen {
+		return TraceContext{}, ErrInvalidValueLength
+	}
+	var tc TraceContext
+	copy(tc.TraceID[:], v[:16])
+	copy(tc.SpanID[:], v[16:24])
+	tc.Flags = v[24]
+	return tc, nil
+}
+
+type traceContextKey struct{}
+
+// ContextWithTraceContext returns a copy of ctx which carries tc. Requests created with the context
+// carry tc in TraceParent option.
+func ContextWithTraceContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+// TraceContextFromContext returns the trace context stored in ctx by ContextWithTraceContext.
+func TraceContextFromContext(ctx context.Context) (TraceContext, bool) {
+	if ctx == nil {
+		return TraceContext{}, false
+	}
+	tc, ok := ctx.Value(traceContextKey{}).(TraceContext)
+	return tc, ok
+}
@@ -0,0 +1,52 @@
+package message
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceContext(t *testing.T) {
+	tc := TraceContext{
+		TraceID: [16]byte{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:  [8]byte{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		Flags:   1,
+	}
+	require.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", tc.String())
+
+	buf := make([]byte, 32)
+	options, n, err := Options{}.SetTraceContext(buf, tc)
+	require.NoError(t, err)
+	require.Equal(t, traceContextLen, n)
+	got, err := options.GetTraceContext()
+	require.NoError(t, err)
+	require.Equal(t, tc, got)
+
+	// the option survives marshaling as any other option
+	data := make([]byte, 64)
+	n, err = options.Marshal(data)
+	require.NoError(t, err)
+	decoded := make(Options, 0, 1)
+	_, err = decoded.Unmarshal(data[:n], CoapOptionDefs)
+	require.NoError(t, err)
+	got, err = decoded.GetTraceContext()
+	require.NoError(t, err)
+	require.Equal(t, tc, got)
+
+	_, _, err = Options{}.SetTraceContext(buf, TraceContext{})
+	require.Error(t, err)
+	_, err = Options{}.GetTraceContext()
+	require.ErrorIs(t, err, ErrOptionNotFound)
+	_, err = Options{{ID: TraceParent, Value: []byte{1}}}.GetTraceContext()
+	require.ErrorIs(t, err, ErrInvalidValueLength)
+}
+
+func TestTraceContextFromContext(t *testing.T) {
+	_, ok := TraceContextFromContext(context.Background())
+	require.False(t, ok)
+	tc := TraceContext{TraceID: [16]byte{1}, SpanID: [8]byte{2}}
+	got, ok := TraceContextFromContext(ContextWithTraceContext(context.Background(), tc))
+	require.True(t, ok)
+	require.Equal(t, tc, got)
+}
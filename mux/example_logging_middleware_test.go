@@ -3,6 +3,8 @@ package mux_test
 import (
 	"log"
 
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
 	"github.com/plgd-dev/go-coap/v2/mux"
 )
 
@@ -21,3 +23,20 @@ func Example_authenticationMiddleware() {
 	})
 	r.Use(loggingMiddleware)
 }
+
+func Example_chainMiddlewares() {
+	authMiddleware := func(next mux.Handler) mux.Handler {
+		return mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+			if !r.Options.HasOption(message.URIQuery) {
+				w.SetResponse(codes.Unauthorized, message.TextPlain, nil)
+				return
+			}
+			next.ServeCOAP(w, r)
+		})
+	}
+	h := mux.Chain(authMiddleware, mux.LoggingMiddleware(log.Printf))(mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		// Do something here
+	}))
+	r := mux.NewRouter()
+	r.Handle("/", h)
+}
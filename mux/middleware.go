@@ -1,5 +1,21 @@
 package mux
 
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+)
+
 // MiddlewareFunc is a function which receives an Handler and returns another Handler.
 // Typically, the returned handler is a closure which does something with the ResponseWriter and Message passed
 // to it, and then calls the handler passed as parameter to the MiddlewareFunc.
@@ -21,3 +37,174 @@ func (r *Router) Use(mwf ...MiddlewareFunc) {
 		r.middlewares = append(r.middlewares, fn)
 	}
 }
+
+// Chain composes the middlewares to a single MiddlewareFunc. The first middleware is the outermost one,
+// so Chain(auth, logging)(h) calls auth, then logging and then h.
+func Chain(mwf ...MiddlewareFunc) MiddlewareFunc {
+	return func(handler Handler) Handler {
+		for i := len(mwf) - 1; i >= 0; i-- {
+			handler = mwf[i].Middleware(handler)
+		}
+		return handler
+	}
+}
+
+type loggingResponseWriter struct {
+	ResponseWriter
+	code codes.Code
+}
+
+func (w *loggingResponseWriter) SetResponse(code codes.Code, contentFormat message.MediaType, d io.ReadSeeker, opts ...message.Option) error {
+	w.code = code
+	return w.ResponseWriter.SetResponse(code, contentFormat, d, opts...)
+}
+
+// LoggingMiddleware logs the remote address, code and path of each request together with the response code
+// and the duration of the handler via the logf function, eg. log.Printf.
+func LoggingMiddleware(logf func(format string, v ...interface{})) MiddlewareFunc {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, r *Message) {
+			lw := &loggingResponseWriter{ResponseWriter: w}
+			start := time.Now()
+			next.ServeCOAP(lw, r)
+			path, _ := r.Options.Path()
+			var remoteAddr interface{}
+			if c := w.Client(); c != nil {
+				remoteAddr = c.RemoteAddr()
+			}
+			logf("%v %v /%v -> %v (%v)", remoteAddr, r.Code, path, lw.code, time.Since(start))
+		})
+	}
+}
+
+// TraceContextMiddleware stores TraceContext of the request in the context of the message, so the handler gets it
+// by message.TraceContextFromContext and the requests created with the context carry it to the next hop.
+func TraceContextMiddleware(next Handler) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Message) {
+		if tc, err := r.Options.GetTraceContext(); err == nil && r.Context != nil {
+			r.Context = message.ContextWithTraceContext(r.Context, tc)
+		}
+		next.ServeCOAP(w, r)
+	})
+}
+
+// ErrHandlerTimeout is returned by SetResponse of the handler which exceeded the timeout of TimeoutMiddleware.
+var ErrHandlerTimeout = errors.New("handler timeout")
+
+type timeoutResponseWriter struct {
+	ResponseWriter
+	ctx      context.Context
+	lock     sync.Mutex
+	returned bool
+}
+
+func (w *timeoutResponseWriter) SetResponse(code codes.Code, contentFormat message.MediaType, d io.ReadSeeker, opts ...message.Option) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.ctx.Err() != nil {
+		return ErrHandlerTimeout
+	}
+	return w.ResponseWriter.SetResponse(code, contentFormat, d, opts...)
+}
+
+// handlerReturned marks the handler which returned before its context was done.
+func (w *timeoutResponseWriter) handlerReturned() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.returned = w.ctx.Err() == nil
+}
+
+// cloneRequest copies the options, the token and the seekable body of the request, so the handler still reads them
+// when the request was released by the server. The body which isn't seekable, eg. the streamed request, is shared.
+func cloneRequest(ctx context.Context, r *message.Message) (*message.Message, error) {
+	opts, err := r.Options.Clone()
+	if err != nil {
+		return nil, err
+	}
+	body := r.Body
+	if body != nil {
+		pos, err := body.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := body.Seek(0, io.SeekEnd); err == nil {
+			if _, err := body.Seek(pos, io.SeekStart); err != nil {
+				return nil, err
+			}
+			payload, err := ioutil.ReadAll(body)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := body.Seek(pos, io.SeekStart); err != nil {
+				return nil, err
+			}
+			body = bytes.NewReader(payload)
+		}
+	}
+	return &message.Message{
+		Context: ctx,
+		Token:   append(message.Token(nil), r.Token...),
+		Code:    r.Code,
+		Options: opts,
+		Body:    body,
+	}, nil
+}
+
+// TimeoutMiddleware bounds the duration of the handler. The handler runs with the context of the request
+// limited by the timeout, when it doesn't return in time the request is answered by 5.03 (Service Unavailable)
+// with MaxAge option set to retryAfter and the context is canceled. The late SetResponse of the handler
+// returns ErrHandlerTimeout. The handler gets a copy of the request, so it can still read it after the timeout.
+// The panic of the handler is reported via onError and the request is answered by 5.00 (Internal Server Error)
+// when the timeout hasn't expired yet. When onError is nil the panic is printed to stdout.
+func TimeoutMiddleware(timeout, retryAfter time.Duration, onError func(error)) MiddlewareFunc {
+	if onError == nil {
+		onError = func(err error) {
+			fmt.Println(err)
+		}
+	}
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w ResponseWriter, r *Message) {
+			parent := r.Context
+			if parent == nil {
+				parent = context.Background()
+			}
+			ctx, cancel := context.WithTimeout(parent, timeout)
+			msg, err := cloneRequest(ctx, r.Message)
+			if err != nil {
+				cancel()
+				onError(fmt.Errorf("cannot copy request: %w", err))
+				_ = w.SetResponse(codes.InternalServerError, message.TextPlain, nil)
+				return
+			}
+			req := *r
+			req.Message = msg
+			tw := &timeoutResponseWriter{ResponseWriter: w, ctx: ctx}
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				defer cancel()
+				defer tw.handlerReturned()
+				defer func() {
+					if rec := recover(); rec != nil {
+						onError(fmt.Errorf("handler panics: %v\n%s", rec, debug.Stack()))
+						_ = tw.SetResponse(codes.InternalServerError, message.TextPlain, nil)
+					}
+				}()
+				next.ServeCOAP(tw, &req)
+			}()
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+			}
+			tw.lock.Lock()
+			defer tw.lock.Unlock()
+			if tw.returned {
+				return
+			}
+			var buf [4]byte
+			n, _ := message.EncodeUint32(buf[:], uint32(math.Ceil(retryAfter.Seconds())))
+			_ = w.SetResponse(codes.ServiceUnavailable, message.TextPlain, nil, message.Option{ID: message.MaxAge, Value: buf[:n]})
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package mux_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	"github.com/stretchr/testify/require"
+)
+
+type testResponseWriter struct {
+	code codes.Code
+}
+
+func (w *testResponseWriter) SetResponse(code codes.Code, contentFormat message.MediaType, d io.ReadSeeker, opts ...message.Option) error {
+	w.code = code
+	return nil
+}
+
+func (w *testResponseWriter) Client() mux.Client {
+	return nil
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+	mw := func(name string) mux.MiddlewareFunc {
+		return func(next mux.Handler) mux.Handler {
+			return mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+				calls = append(calls, name)
+				next.ServeCOAP(w, r)
+			})
+		}
+	}
+	h := mux.Chain(mw("auth"), mw("logging"))(mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		calls = append(calls, "handler")
+	}))
+	h.ServeCOAP(&testResponseWriter{}, &mux.Message{Message: &message.Message{}})
+	require.Equal(t, []string{"auth", "logging", "handler"}, calls)
+
+	calls = nil
+	h = mux.Chain()(mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		calls = append(calls, "handler")
+	}))
+	h.ServeCOAP(&testResponseWriter{}, &mux.Message{Message: &message.Message{}})
+	require.Equal(t, []string{"handler"}, calls)
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	var logs []string
+	logf := func(format string, v ...interface{}) {
+		logs = append(logs, fmt.Sprintf(format, v...))
+	}
+	h := mux.LoggingMiddleware(logf)(mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, nil)
+		require.NoError(t, err)
+	}))
+	w := &testResponseWriter{}
+	h.ServeCOAP(w, &mux.Message{Message: &message.Message{
+		Code:    codes.GET,
+		Options: message.Options{{ID: message.URIPath, Value: []byte("a")}},
+	}})
+	require.Equal(t, codes.Content, w.code)
+	require.Len(t, logs, 1)
+	require.True(t, strings.Contains(logs[0], "GET /a -> Content"), logs[0])
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	lateErr := make(chan error, 1)
+	h := mux.TimeoutMiddleware(time.Millisecond*50, time.Second, nil)(mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		select {
+		case <-r.Context.Done():
+		case <-time.After(time.Second):
+		}
+		lateErr <- w.SetResponse(codes.Content, message.TextPlain, nil)
+	}))
+	w := &testResponseWriter{}
+	start := time.Now()
+	h.ServeCOAP(w, &mux.Message{Message: &message.Message{Context: context.Background()}})
+	require.Less(t, int64(time.Since(start)), int64(time.Second))
+	require.Equal(t, codes.ServiceUnavailable, w.code)
+	select {
+	case err := <-lateErr:
+		require.True(t, errors.Is(err, mux.ErrHandlerTimeout))
+	case <-time.After(time.Second):
+		require.FailNow(t, "the context of the handler wasn't canceled")
+	}
+
+	h = mux.TimeoutMiddleware(time.Second, time.Second, nil)(mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, nil)
+		require.NoError(t, err)
+	}))
+	w = &testResponseWriter{}
+	h.ServeCOAP(w, &mux.Message{Message: &message.Message{}})
+	require.Equal(t, codes.Content, w.code)
+}
+
+type sentResponseWriter struct {
+	testResponseWriter
+	sent chan struct{}
+}
+
+func (w *sentResponseWriter) SetResponse(code codes.Code, contentFormat message.MediaType, d io.ReadSeeker, opts ...message.Option) error {
+	err := w.testResponseWriter.SetResponse(code, contentFormat, d, opts...)
+	close(w.sent)
+	return err
+}
+
+func TestTimeoutMiddlewareHandlerReadsReleasedRequest(t *testing.T) {
+	type result struct {
+		path string
+		body []byte
+		err  error
+	}
+	res := make(chan result, 1)
+	w := &sentResponseWriter{sent: make(chan struct{})}
+	h := mux.TimeoutMiddleware(time.Millisecond*10, time.Second, nil)(mux.HandlerFunc(func(_ mux.ResponseWriter, r *mux.Message) {
+		<-w.sent
+		var path string
+		var err error
+		for i := 0; i < 1000 && err == nil; i++ {
+			path, err = r.Options.Path()
+		}
+		var body []byte
+		if err == nil {
+			body, err = ioutil.ReadAll(r.Body)
+		}
+		res <- result{path: path, body: body, err: err}
+	}))
+	payload := []byte("hello")
+	req := &mux.Message{Message: &message.Message{
+		Context: context.Background(),
+		Token:   message.Token{1, 2},
+		Code:    codes.POST,
+		Options: message.Options{{ID: message.URIPath, Value: []byte("a")}},
+		Body:    bytes.NewReader(payload),
+	}}
+	h.ServeCOAP(w, req)
+	require.Equal(t, codes.ServiceUnavailable, w.code)
+	// the server reuses the released request while the handler still runs
+	for i := 0; i < 1000; i++ {
+		req.Options[0].Value[0] = 'b'
+		copy(payload, "xxxxx")
+	}
+	select {
+	case r := <-res:
+		require.NoError(t, r.err)
+		require.Equal(t, "a", r.path)
+		require.Equal(t, []byte("hello"), r.body)
+	case <-time.After(time.Second):
+		require.FailNow(t, "the handler didn't finish")
+	}
+}
+
+func TestTimeoutMiddlewareHandlerPanics(t *testing.T) {
+	errs := make(chan error, 1)
+	onError := func(err error) {
+		errs <- err
+	}
+	h := mux.TimeoutMiddleware(time.Second, time.Second, onError)(mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		panic("boom")
+	}))
+	w := &testResponseWriter{}
+	h.ServeCOAP(w, &mux.Message{Message: &message.Message{Context: context.Background()}})
+	require.Equal(t, codes.InternalServerError, w.code)
+	err := <-errs
+	require.True(t, strings.Contains(err.Error(), "handler panics: boom"), err.Error())
+
+	sw := &sentResponseWriter{sent: make(chan struct{})}
+	h = mux.TimeoutMiddleware(time.Millisecond*10, time.Second, onError)(mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		<-sw.sent
+		panic("late boom")
+	}))
+	h.ServeCOAP(sw, &mux.Message{Message: &message.Message{Context: context.Background()}})
+	require.Equal(t, codes.ServiceUnavailable, sw.code)
+	select {
+	case err := <-errs:
+		require.True(t, strings.Contains(err.Error(), "handler panics: late boom"), err.Error())
+	case <-time.After(time.Second):
+		require.FailNow(t, "the panic of the handler wasn't reported")
+	}
+}
@@ -0,0 +1,26 @@
+package mux
+
+import (
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+)
+
+// NegotiationHandler serves the representations of a resource by the content negotiation of
+// https://tools.ietf.org/html/rfc7252#section-5.10.4. The request is routed to the handler of the media type
+// requested by Accept option, not by Content-Format which describes the payload of the request.
+// The request without Accept option gets the representation of defaultFormat and the request accepting
+// an unavailable representation is answered by 4.06 (Not Acceptable).
+func NegotiationHandler(defaultFormat message.MediaType, representations map[message.MediaType]Handler) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Message) {
+		accept, err := r.Options.Accept()
+		if err != nil {
+			accept = defaultFormat
+		}
+		h, ok := representations[accept]
+		if !ok {
+			_ = w.SetResponse(codes.NotAcceptable, message.TextPlain, nil)
+			return
+		}
+		h.ServeCOAP(w, r)
+	})
+}
@@ -0,0 +1,61 @@
+package mux_test
+
+import (
+	"testing"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiationHandler(t *testing.T) {
+	var served message.MediaType
+	represent := func(format message.MediaType) mux.Handler {
+		return mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+			served = format
+			err := w.SetResponse(codes.Content, format, nil)
+			require.NoError(t, err)
+		})
+	}
+	h := mux.NegotiationHandler(message.AppJSON, map[message.MediaType]mux.Handler{
+		message.AppJSON: represent(message.AppJSON),
+		message.AppCBOR: represent(message.AppCBOR),
+	})
+
+	tests := []struct {
+		name          string
+		accept        *message.MediaType
+		contentFormat *message.MediaType
+		wantCode      codes.Code
+		wantFormat    message.MediaType
+	}{
+		{name: "noAccept", wantCode: codes.Content, wantFormat: message.AppJSON},
+		{name: "cbor", accept: mediaType(message.AppCBOR), wantCode: codes.Content, wantFormat: message.AppCBOR},
+		{name: "contentFormatIgnored", contentFormat: mediaType(message.AppCBOR), wantCode: codes.Content, wantFormat: message.AppJSON},
+		{name: "notAcceptable", accept: mediaType(message.AppXML), wantCode: codes.NotAcceptable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			served = 0
+			var opts message.Options
+			var err error
+			if tt.accept != nil {
+				opts, _, err = opts.SetAccept(make([]byte, 4), *tt.accept)
+				require.NoError(t, err)
+			}
+			if tt.contentFormat != nil {
+				opts, _, err = opts.SetContentFormat(make([]byte, 4), *tt.contentFormat)
+				require.NoError(t, err)
+			}
+			w := &testResponseWriter{}
+			h.ServeCOAP(w, &mux.Message{Message: &message.Message{Code: codes.GET, Options: opts}})
+			require.Equal(t, tt.wantCode, w.code)
+			require.Equal(t, tt.wantFormat, served)
+		})
+	}
+}
+
+func mediaType(m message.MediaType) *message.MediaType {
+	return &m
+}
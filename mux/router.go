@@ -3,6 +3,7 @@ package mux
 import (
 	"errors"
 	"io"
+	"strings"
 	"sync"
 
 	"github.com/plgd-dev/go-coap/v2/message"
@@ -14,6 +15,12 @@ type ResponseWriter = interface {
 	Client() Client
 }
 
+// RawResponseWriter is implemented by the ResponseWriter which sets the response without adding Content-Format
+// and ETag, eg. to relay the response of the origin server by the proxy.
+type RawResponseWriter = interface {
+	SetRawResponse(code codes.Code, d io.ReadSeeker, opts ...message.Option) error
+}
+
 type Handler interface {
 	ServeCOAP(w ResponseWriter, r *Message)
 }
@@ -39,19 +46,35 @@ type Router struct {
 	m              *sync.RWMutex
 	defaultHandler Handler
 	middlewares    []MiddlewareFunc
+	hosts          map[string]*Router
 }
 
 type muxEntry struct {
 	h       Handler
 	pattern string
+	// methods are the handlers registered by HandleMethod, h handles the other methods
+	methods map[codes.Code]Handler
+}
+
+// handler returns the handler of the method, nil when the method isn't allowed.
+func (e muxEntry) handler(method codes.Code) Handler {
+	if h, ok := e.methods[method]; ok {
+		return h
+	}
+	return e.h
 }
 
+var methodNotAllowedHandler = HandlerFunc(func(w ResponseWriter, r *Message) {
+	w.SetResponse(codes.MethodNotAllowed, message.TextPlain, nil)
+})
+
 // NewRouter allocates and returns a new Router.
 func NewRouter() *Router {
 	return &Router{
 		z:           make(map[string]muxEntry),
 		m:           new(sync.RWMutex),
 		middlewares: make([]MiddlewareFunc, 0, 2),
+		hosts:       make(map[string]*Router),
 		defaultHandler: HandlerFunc(func(w ResponseWriter, r *Message) {
 			w.SetResponse(codes.NotFound, message.TextPlain, nil)
 		}),
@@ -78,7 +101,7 @@ func pathMatch(pattern, path string) bool {
 
 // Find a handler on a handler map given a path string
 // Most-specific (longest) pattern wins
-func (r *Router) match(path string) (h Handler, pattern string) {
+func (r *Router) match(path string) (e muxEntry, ok bool) {
 	r.m.RLock()
 	defer r.m.RUnlock()
 	var n = 0
@@ -86,36 +109,96 @@ func (r *Router) match(path string) (h Handler, pattern string) {
 		if !pathMatch(k, path) {
 			continue
 		}
-		if h == nil || len(k) > n {
+		if !ok || len(k) > n {
 			n = len(k)
-			h = v.h
-			pattern = v.pattern
+			e = v
+			ok = true
 		}
 	}
 	return
 }
 
-// Handle adds a handler to the Router for pattern.
-func (r *Router) Handle(pattern string, handler Handler) error {
+// Host returns the Router for requests with URIHost option equal to host, the comparison is case-insensitive.
+// The Router is created by the first call. Requests without URIHost option or with an unknown host
+// are matched against patterns of r.
+func (r *Router) Host(host string) *Router {
+	host = strings.ToLower(host)
+	r.m.Lock()
+	defer r.m.Unlock()
+	hr, ok := r.hosts[host]
+	if !ok {
+		hr = NewRouter()
+		r.hosts[host] = hr
+	}
+	return hr
+}
+
+func (r *Router) matchHost(req *Message) *Router {
+	host, err := req.Options.URIHost()
+	if err != nil {
+		return nil
+	}
+	r.m.RLock()
+	defer r.m.RUnlock()
+	return r.hosts[strings.ToLower(host)]
+}
+
+func normalizePattern(pattern string) string {
 	switch pattern {
 	case "", "/":
-		pattern = "/"
+		return "/"
 	default:
 		if pattern[0] == '/' {
-			pattern = pattern[1:]
+			return pattern[1:]
 		}
 	}
+	return pattern
+}
 
+// Handle adds a handler to the Router for pattern.
+func (r *Router) Handle(pattern string, handler Handler) error {
+	pattern = normalizePattern(pattern)
 	if handler == nil {
 		return errors.New("nil handler")
 	}
 
 	r.m.Lock()
-	r.z[pattern] = muxEntry{h: handler, pattern: pattern}
+	e := r.z[pattern]
+	e.h = handler
+	e.pattern = pattern
+	r.z[pattern] = e
 	r.m.Unlock()
 	return nil
 }
 
+// HandleMethod adds a handler of the method, eg. codes.GET, to the Router for pattern.
+// A request with other method than the registered ones is answered by 4.05 (Method Not Allowed)
+// without calling any handler, unless a handler for all methods was added by Handle.
+func (r *Router) HandleMethod(pattern string, method codes.Code, handler Handler) error {
+	pattern = normalizePattern(pattern)
+	if handler == nil {
+		return errors.New("nil handler")
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	e := r.z[pattern]
+	e.pattern = pattern
+	methods := make(map[codes.Code]Handler, len(e.methods)+1)
+	for m, h := range e.methods {
+		methods[m] = h
+	}
+	methods[method] = handler
+	e.methods = methods
+	r.z[pattern] = e
+	return nil
+}
+
+// HandleMethodFunc adds a handler function of the method to the Router for pattern.
+func (r *Router) HandleMethodFunc(pattern string, method codes.Code, handler func(w ResponseWriter, r *Message)) error {
+	return r.HandleMethod(pattern, method, HandlerFunc(handler))
+}
+
 // DefaultHandle set default handler to the Router
 func (r *Router) DefaultHandle(handler Handler) {
 	r.m.Lock()
@@ -152,16 +235,29 @@ func (r *Router) HandleRemove(pattern string) error {
 // pattern most closely matches the request message. If DefaultServeMux
 // is used the correct thing for DS queries is done: a possible parent
 // is sought.
-// If no handler is found a standard NotFound message is returned
+// Requests with URIHost option registered by Host are dispatched to the Router of the host.
+// If no handler is found a standard NotFound message is returned and MethodNotAllowed when
+// the pattern has handlers only for other methods.
 func (r *Router) ServeCOAP(w ResponseWriter, req *Message) {
-	path, err := req.Options.Path()
-	if err != nil {
-		r.defaultHandler.ServeCOAP(w, req)
-		return
-	}
-	h, _ := r.match(path)
-	if h == nil {
-		h = r.defaultHandler
+	var h Handler
+	if hr := r.matchHost(req); hr != nil {
+		h = hr
+	} else {
+		path, err := req.Options.Path()
+		if err != nil {
+			r.defaultHandler.ServeCOAP(w, req)
+			return
+		}
+		e, ok := r.match(path)
+		switch {
+		case !ok:
+			h = r.defaultHandler
+		default:
+			h = e.handler(req.Code)
+			if h == nil {
+				h = methodNotAllowedHandler
+			}
+		}
 	}
 	if h == nil {
 		return
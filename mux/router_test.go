@@ -0,0 +1,99 @@
+package mux_test
+
+import (
+	"testing"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouter_Host(t *testing.T) {
+	r := mux.NewRouter()
+	respond := func(code codes.Code) mux.HandlerFunc {
+		return func(w mux.ResponseWriter, r *mux.Message) {
+			err := w.SetResponse(code, message.TextPlain, nil)
+			require.NoError(t, err)
+		}
+	}
+	err := r.Handle("/a", respond(codes.Content))
+	require.NoError(t, err)
+	err = r.Host("first.example").Handle("/a", respond(codes.Valid))
+	require.NoError(t, err)
+	err = r.Host("second.example").Handle("/a", respond(codes.Changed))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		host string
+		path string
+		want codes.Code
+	}{
+		{name: "noHost", path: "/a", want: codes.Content},
+		{name: "unknownHost", host: "other.example", path: "/a", want: codes.Content},
+		{name: "first", host: "first.example", path: "/a", want: codes.Valid},
+		{name: "second", host: "SECOND.example", path: "/a", want: codes.Changed},
+		{name: "notFound", host: "first.example", path: "/b", want: codes.NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := make([]byte, 256)
+			opts, n, err := message.Options{}.SetPath(buf, tt.path)
+			require.NoError(t, err)
+			if tt.host != "" {
+				opts, _, err = opts.SetURIHost(buf[n:], tt.host)
+				require.NoError(t, err)
+			}
+			w := &testResponseWriter{}
+			r.ServeCOAP(w, &mux.Message{Message: &message.Message{Options: opts}})
+			require.Equal(t, tt.want, w.code)
+		})
+	}
+}
+
+func TestRouter_HandleMethod(t *testing.T) {
+	r := mux.NewRouter()
+	var calls int
+	respond := func(code codes.Code) mux.HandlerFunc {
+		return func(w mux.ResponseWriter, r *mux.Message) {
+			calls++
+			err := w.SetResponse(code, message.TextPlain, nil)
+			require.NoError(t, err)
+		}
+	}
+	err := r.HandleMethod("/a", codes.GET, respond(codes.Content))
+	require.NoError(t, err)
+	err = r.HandleMethod("/a", codes.PUT, respond(codes.Changed))
+	require.NoError(t, err)
+	err = r.HandleMethod("/b", codes.GET, respond(codes.Content))
+	require.NoError(t, err)
+	err = r.Handle("/b", respond(codes.Valid))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		path      string
+		method    codes.Code
+		want      codes.Code
+		wantCalls int
+	}{
+		{name: "get", path: "/a", method: codes.GET, want: codes.Content, wantCalls: 1},
+		{name: "put", path: "/a", method: codes.PUT, want: codes.Changed, wantCalls: 1},
+		{name: "notAllowed", path: "/a", method: codes.POST, want: codes.MethodNotAllowed},
+		{name: "getWithHandle", path: "/b", method: codes.GET, want: codes.Content, wantCalls: 1},
+		{name: "otherWithHandle", path: "/b", method: codes.POST, want: codes.Valid, wantCalls: 1},
+		{name: "notFound", path: "/c", method: codes.GET, want: codes.NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = 0
+			opts, _, err := message.Options{}.SetPath(make([]byte, 256), tt.path)
+			require.NoError(t, err)
+			w := &testResponseWriter{}
+			r.ServeCOAP(w, &mux.Message{Message: &message.Message{Code: tt.method, Options: opts}})
+			require.Equal(t, tt.want, w.code)
+			require.Equal(t, tt.wantCalls, calls)
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	minAcceptDelay = 5 * time.Millisecond
+	maxAcceptDelay = time.Second
+)
+
+// AcceptBackoff delays the next accept after a failed one by the capped exponential backoff,
+// so a persistent accept error doesn't spin the CPU. The zero value is ready to use.
+type AcceptBackoff struct {
+	delay time.Duration
+}
+
+// Wait sleeps before the next accept, the delay doubles with every call up to one second.
+// It returns false when ctx is done.
+func (b *AcceptBackoff) Wait(ctx context.Context) bool {
+	if b.delay == 0 {
+		b.delay = minAcceptDelay
+	} else {
+		b.delay *= 2
+	}
+	if b.delay > maxAcceptDelay {
+		b.delay = maxAcceptDelay
+	}
+	timer := time.NewTimer(b.delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Reset resets the delay after the successful accept.
+func (b *AcceptBackoff) Reset() {
+	b.delay = 0
+}
+
+// closedSocketErrors are messages of the closed socket errors of the net and github.com/pion/udp packages,
+// they aren't exported in all supported go versions.
+var closedSocketErrors = []string{"use of closed network connection", "udp: listener closed"}
+
+// IsFatalAcceptError reports whether the listener can't accept connections anymore, eg. its socket was closed.
+// Other accept errors, eg. a failed DTLS handshake of one client, are transient and the accept should be retried.
+func IsFatalAcceptError(err error) bool {
+	if errors.Is(err, ErrListenerIsClosed) {
+		return true
+	}
+	for _, msg := range closedSocketErrors {
+		if strings.Contains(err.Error(), msg) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package blockwise
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/plgd-dev/go-coap/v2/message"
+)
+
+// BlockCache stores blocks sliced from an immutable body keyed by the requested resource and ETag, so a representation
+// which is downloaded by many peers at once is sliced only once. The same BlockCache
+// can be shared by multiple BlockWise instances, eg. by all connections of a server.
+//
+// A body with a changed content must be served with a new ETag, blocks of the old ETag
+// are not used anymore and they expire or can be dropped by Invalidate. Blocks are sliced
+// again when the Max-Age of the body elapses.
+type BlockCache struct {
+	cache *cache.Cache
+}
+
+type blockKey struct {
+	off  int64
+	size int64
+}
+
+type etagBlocks struct {
+	sync.Mutex
+	blocks  map[blockKey][]byte
+	expires time.Time
+}
+
+// NewBlockCache creates cache of blocks, blocks of an ETag are dropped after expiration from the last use.
+func NewBlockCache(expiration time.Duration) *BlockCache {
+	return &BlockCache{
+		cache: cache.New(expiration, expiration),
+	}
+}
+
+func (c *BlockCache) getETagBlocks(key string) *etagBlocks {
+	for {
+		v, ok := c.cache.Get(key)
+		if ok {
+			c.cache.SetDefault(key, v)
+			return v.(*etagBlocks)
+		}
+		e := &etagBlocks{
+			blocks: make(map[blockKey][]byte),
+		}
+		if c.cache.Add(key, e, cache.DefaultExpiration) == nil {
+			return e
+		}
+	}
+}
+
+// resourceKey identifies the resource of the request by Uri-Host, Uri-Port, Uri-Path and Uri-Query options,
+// the ETags are local to the resource: https://tools.ietf.org/html/rfc7252#section-5.10.6.
+func resourceKey(opts message.Options) string {
+	var b strings.Builder
+	for _, o := range opts {
+		switch o.ID {
+		case message.URIHost, message.URIPort, message.URIPath, message.URIQuery:
+			b.WriteString(strconv.Itoa(int(o.ID)))
+			b.WriteByte(':')
+			b.WriteString(hex.EncodeToString(o.Value))
+			b.WriteByte('/')
+		}
+	}
+	return b.String()
+}
+
+func etagPrefix(etag []byte) string {
+	return hex.EncodeToString(etag) + " "
+}
+
+// loadBlock returns cached block of body identified by resource and etag or stores block returned by load.
+// Cached blocks are stale when freshness of the body elapses, now is the time of the clock of the BlockWise.
+func (c *BlockCache) loadBlock(resource string, etag []byte, off, size int64, now time.Time, freshness time.Duration, load func() ([]byte, error)) ([]byte, error) {
+	e := c.getETagBlocks(etagPrefix(etag) + resource)
+	e.Lock()
+	defer e.Unlock()
+	if e.expires.IsZero() || now.After(e.expires) {
+		e.blocks = make(map[blockKey][]byte)
+		e.expires = now.Add(freshness)
+	}
+	k := blockKey{off: off, size: size}
+	if block, ok := e.blocks[k]; ok {
+		return block, nil
+	}
+	block, err := load()
+	if err != nil {
+		return nil, err
+	}
+	e.blocks[k] = block
+	return block, nil
+}
+
+// Invalidate removes all blocks cached for etag of all resources.
+func (c *BlockCache) Invalidate(etag []byte) {
+	prefix := etagPrefix(etag)
+	for key := range c.cache.Items() {
+		if strings.HasPrefix(key, prefix) {
+			c.cache.Delete(key)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package blockwise
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/net/clock"
+	"github.com/stretchr/testify/require"
+)
+
+type countingReader struct {
+	io.ReadSeeker
+	readed *int64
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadSeeker.Read(p)
+	atomic.AddInt64(r.readed, int64(n))
+	return n, err
+}
+
+func TestBlockCache(t *testing.T) {
+	const downloaders = 100
+	payload := make([]byte, 1500)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	etag := []byte{1, 2, 3, 4}
+	var readed int64
+	cache := NewBlockCache(time.Minute)
+
+	var wg sync.WaitGroup
+	wg.Add(downloaders)
+	for i := 0; i < downloaders; i++ {
+		go func(i int) {
+			defer wg.Done()
+			sender := NewBlockWise(acquireMessage, releaseMessage, time.Minute, func(err error) { t.Log(err) }, true, nil)
+			receiver := NewBlockWise(acquireMessage, releaseMessage, time.Minute, func(err error) { t.Log(err) }, true, nil, WithBlockCache(cache))
+			do := makeDo(t, sender, receiver, SZX64, int(SZX64.Size()), SZX64, int(SZX64.Size()), func(w ResponseWriter, r Message) {
+				w.SetMessage(&testmessage{
+					ctx:     context.Background(),
+					token:   r.Token(),
+					code:    codes.Content,
+					options: message.Options{message.Option{ID: message.ETag, Value: etag}},
+					payload: countingReader{ReadSeeker: bytes.NewReader(payload), readed: &readed},
+				})
+			})
+			resp, err := sender.Do(&testmessage{
+				ctx:     context.Background(),
+				token:   []byte{byte(i), 'c'},
+				options: message.Options{message.Option{ID: message.URIPath, Value: []byte("image")}},
+				code:    codes.GET,
+			}, SZX64, int(SZX64.Size()), do)
+			require.NoError(t, err)
+			body, err := ioutil.ReadAll(resp.Body())
+			require.NoError(t, err)
+			require.Equal(t, payload, body)
+		}(i)
+	}
+	wg.Wait()
+	require.Equal(t, int64(len(payload)), atomic.LoadInt64(&readed))
+
+	cache.Invalidate(etag)
+	require.Equal(t, 0, cache.cache.ItemCount())
+}
+
+func TestBlockCacheMaxAge(t *testing.T) {
+	cache := NewBlockCache(time.Minute)
+	etag := []byte{5}
+	var loads int
+	load := func() ([]byte, error) {
+		loads++
+		return []byte{byte(loads)}, nil
+	}
+	fakeClock := clock.NewFake(time.Now())
+	freshness := time.Second * 10
+	block, err := cache.loadBlock("", etag, 0, 16, fakeClock.Now(), freshness, load)
+	require.NoError(t, err)
+	require.Equal(t, []byte{1}, block)
+	fakeClock.Advance(freshness)
+	block, err = cache.loadBlock("", etag, 0, 16, fakeClock.Now(), freshness, load)
+	require.NoError(t, err)
+	require.Equal(t, []byte{1}, block)
+
+	fakeClock.Advance(time.Nanosecond)
+	block, err = cache.loadBlock("", etag, 0, 16, fakeClock.Now(), freshness, load)
+	require.NoError(t, err)
+	require.Equal(t, []byte{2}, block)
+}
+
+func TestBlockCacheETagSharedByResources(t *testing.T) {
+	etag := []byte{1, 2, 3, 4}
+	payloads := map[string][]byte{
+		"a": bytes.Repeat([]byte{'a'}, 300),
+		"b": bytes.Repeat([]byte{'b'}, 300),
+	}
+	cache := NewBlockCache(time.Minute)
+	sender := NewBlockWise(acquireMessage, releaseMessage, time.Minute, func(err error) { t.Log(err) }, true, nil)
+	receiver := NewBlockWise(acquireMessage, releaseMessage, time.Minute, func(err error) { t.Log(err) }, true, nil, WithBlockCache(cache))
+	do := makeDo(t, sender, receiver, SZX64, int(SZX64.Size()), SZX64, int(SZX64.Size()), func(w ResponseWriter, r Message) {
+		path, err := r.Options().Path()
+		require.NoError(t, err)
+		w.SetMessage(&testmessage{
+			ctx:     context.Background(),
+			token:   r.Token(),
+			code:    codes.Content,
+			options: message.Options{message.Option{ID: message.ETag, Value: etag}},
+			payload: bytes.NewReader(payloads[path]),
+		})
+	})
+	for i, path := range []string{"a", "b", "a", "b"} {
+		resp, err := sender.Do(&testmessage{
+			ctx:     context.Background(),
+			token:   []byte{byte(i), 'e'},
+			options: message.Options{message.Option{ID: message.URIPath, Value: []byte(path)}},
+			code:    codes.GET,
+		}, SZX64, int(SZX64.Size()), do)
+		require.NoError(t, err)
+		body, err := ioutil.ReadAll(resp.Body())
+		require.NoError(t, err)
+		require.Equal(t, payloads[path], body)
+	}
+	require.Equal(t, 2, cache.cache.ItemCount())
+
+	cache.Invalidate(etag)
+	require.Equal(t, 0, cache.cache.ItemCount())
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/patrickmn/go-cache"
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/net/clock"
 	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
 )
 
@@ -172,6 +173,11 @@ type BlockWise struct {
 	errors                      func(error)
 	autoCleanUpResponseCache    bool
 	getSendedRequestFromOutside func(token message.Token) (Message, bool)
+	blockCache                  *BlockCache
+	uploadStreaming             bool
+	uploadStreams               *cache.Cache
+	maxRestarts                 int
+	clock                       clock.Clock
 
 	bwSendedRequest *kitSync.Map
 }
@@ -179,6 +185,8 @@ type BlockWise struct {
 type messageGuard struct {
 	sync.Mutex
 	request Message
+	// resource identifies the requested resource for the blocks cached by BlockCache
+	resource string
 }
 
 func newRequestGuard(request Message) *messageGuard {
@@ -196,12 +204,21 @@ func NewBlockWise(
 	errors func(error),
 	autoCleanUpResponseCache bool,
 	getSendedRequestFromOutside func(token message.Token) (Message, bool),
+	opts ...Option,
 ) *BlockWise {
+	cfg := defaultOptions
+	for _, o := range opts {
+		o.apply(&cfg)
+	}
 	receivingMessagesCache := cache.New(expiration, expiration)
 	bwSendedRequest := kitSync.NewMap()
 	receivingMessagesCache.OnEvicted(func(tokenstr string, _ interface{}) {
 		bwSendedRequest.Delete(tokenstr)
 	})
+	uploadStreams := cache.New(expiration, expiration)
+	uploadStreams.OnEvicted(func(_ string, v interface{}) {
+		v.(*uploadStream).abort()
+	})
 	if getSendedRequestFromOutside == nil {
 		getSendedRequestFromOutside = func(token message.Token) (Message, bool) { return nil, false }
 	}
@@ -213,15 +230,28 @@ func NewBlockWise(
 		errors:                      errors,
 		autoCleanUpResponseCache:    autoCleanUpResponseCache,
 		getSendedRequestFromOutside: getSendedRequestFromOutside,
+		blockCache:                  cfg.blockCache,
+		uploadStreaming:             cfg.uploadStreaming,
+		uploadStreams:               uploadStreams,
+		maxRestarts:                 cfg.maxRestarts,
+		clock:                       cfg.clock,
 		bwSendedRequest:             bwSendedRequest,
 	}
 }
 
+// bertOverhead is the part of max message size which is reserved for the header and options of BERT message.
+const bertOverhead = 1024
+
 func bufferSize(szx SZX, maxMessageSize int) int64 {
 	if szx < SZXBERT {
 		return szx.Size()
 	}
-	return (int64(maxMessageSize) / szx.Size()) * szx.Size()
+	// BERT block carries multiple of 1024 bytes which fit to the message
+	size := (int64(maxMessageSize-bertOverhead) / szx.Size()) * szx.Size()
+	if size < szx.Size() {
+		return szx.Size()
+	}
+	return size
 }
 
 func setTypeFrom(to Message, from Message) {
@@ -242,6 +272,22 @@ func (b *BlockWise) newSendRequestMessage(r Message) Message {
 	return req
 }
 
+// DoWithoutSplit sends an coap message in one message and returns an coap response which can be received via
+// blockwise transfer. It is used when the peer doesn't accept the request in blocks.
+func (b *BlockWise) DoWithoutSplit(r Message, do func(req Message) (Message, error)) (Message, error) {
+	if len(r.Token()) == 0 {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	req := b.newSendRequestMessage(r)
+	defer b.releaseMessage(req)
+
+	tokenStr := r.Token().String()
+	b.bwSendedRequest.Store(tokenStr, req)
+	defer b.bwSendedRequest.Delete(tokenStr)
+	return do(r)
+}
+
 // Do sends an coap message and returns an coap response via blockwise transfer.
 func (b *BlockWise) Do(r Message, maxSzx SZX, maxMessageSize int, do func(req Message) (Message, error)) (Message, error) {
 	if maxSzx > SZXBERT {
@@ -279,7 +325,12 @@ func (b *BlockWise) Do(r Message, maxSzx SZX, maxMessageSize int, do func(req Me
 	num := int64(0)
 	buf := make([]byte, 1024)
 	szx := maxSzx
+	restarts := 0
 	for {
+		if err := r.Context().Err(); err != nil {
+			// deadline of the request is over - don't send next blocks
+			return nil, err
+		}
 		newBufLen := bufferSize(szx, maxMessageSize)
 		if int64(cap(buf)) < newBufLen {
 			buf = make([]byte, newBufLen)
@@ -316,6 +367,14 @@ func (b *BlockWise) Do(r Message, maxSzx SZX, maxMessageSize int, do func(req Me
 		if err != nil {
 			return nil, fmt.Errorf("cannot do bw request: %w", err)
 		}
+		if resp.Code() == codes.RequestEntityIncomplete && num > 0 && restarts < b.maxRestarts {
+			// https://tools.ietf.org/html/rfc7959#section-2.9.2 - the server lost the previous blocks, start again.
+			// The 4.08 to the first block can't be fixed by sending it again, so it's returned.
+			b.releaseMessage(resp)
+			restarts++
+			num = 0
+			continue
+		}
 		block, err = resp.GetOptionUint32(message.Block1)
 		if err != nil {
 			return resp, nil
@@ -340,7 +399,8 @@ func (b *BlockWise) Do(r Message, maxSzx SZX, maxMessageSize int, do func(req Me
 			return resp, fmt.Errorf("unexpected of acknowleged seqencenumber(%v != %v)", num, newNum)
 		}
 
-		num = num + newSzx.Size()/szx.Size()
+		// next block follows the acknowledged one, BERT block carries multiple of 1024 bytes
+		num = (newOff + int64(readed)) / newSzx.Size()
 		szx = newSzx
 	}
 }
@@ -357,6 +417,7 @@ func NewWriteRequestResponse(remoteAddr net.Addr, request Message, acquireMessag
 	req.SetToken(request.Token())
 	req.ResetOptionsTo(request.Options())
 	req.SetBody(request.Body())
+	setTypeFrom(req, request)
 	return &writeMessageResponse{
 		request:        req,
 		releaseMessage: releaseMessage,
@@ -388,7 +449,7 @@ func (b *BlockWise) WriteMessage(remoteAddr net.Addr, request Message, maxSZX SZ
 	}
 
 	w := NewWriteRequestResponse(remoteAddr, request, b.acquireMessage, b.releaseMessage)
-	err = b.startSendingMessage(w, maxSZX, maxMessageSize, startSendingMessageBlock)
+	err = b.startSendingMessage(w, request.Options(), maxSZX, maxMessageSize, startSendingMessageBlock)
 	if err != nil {
 		return fmt.Errorf("cannot start writing request: %w", err)
 	}
@@ -408,7 +469,29 @@ func fitSZX(r Message, blockType message.OptionID, maxSZX SZX) SZX {
 	return maxSZX
 }
 
-func (b *BlockWise) handleSendingMessage(w ResponseWriter, sendingMessage Message, maxSZX SZX, maxMessageSize int, token []byte, block uint32) (bool, error) {
+// readBlock reads block of size from offset off of body.
+func readBlock(body io.ReadSeeker, off, size, payloadSize int64) ([]byte, error) {
+	offSeek, err := body.Seek(off, io.SeekStart)
+	if err != nil {
+		return nil, fmt.Errorf("cannot seek in response: %w", err)
+	}
+	if off != offSeek {
+		return nil, fmt.Errorf("cannot seek to requested offset(%v != %v)", off, offSeek)
+	}
+	buf := make([]byte, size)
+	readed, err := io.ReadFull(body, buf)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		if offSeek+int64(readed) == payloadSize {
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read payload: %w", err)
+	}
+	return buf[:readed], nil
+}
+
+func (b *BlockWise) handleSendingMessage(w ResponseWriter, sendingMessage Message, resource string, maxSZX SZX, maxMessageSize int, token []byte, block uint32) (bool, error) {
 	blockType := message.Block2
 	sizeType := message.Size2
 	switch sendingMessage.Code() {
@@ -433,35 +516,29 @@ func (b *BlockWise) handleSendingMessage(w ResponseWriter, sendingMessage Messag
 	if err != nil {
 		return false, fmt.Errorf("cannot get size of payload: %w", err)
 	}
-	offSeek, err := sendingMessage.Body().Seek(off, io.SeekStart)
-	if err != nil {
-		return false, fmt.Errorf("cannot seek in response: %w", err)
-	}
-	if off != offSeek {
-		return false, fmt.Errorf("cannot seek to requested offset(%v != %v)", off, offSeek)
-	}
-	buf := make([]byte, 1024)
-	newBufLen := bufferSize(szx, maxMessageSize)
-	if int64(len(buf)) < newBufLen {
-		buf = make([]byte, newBufLen)
+	var buf []byte
+	bufLen := bufferSize(szx, maxMessageSize)
+	etag, errETag := sendingMessage.GetOptionBytes(message.ETag)
+	if b.blockCache != nil && errETag == nil && len(etag) > 0 {
+		// body is immutable for the etag so the block can be shared with other transfers
+		buf, err = b.blockCache.loadBlock(resource, etag, off, bufLen, b.clock.Now(), sendingMessage.Options().Freshness(), func() ([]byte, error) {
+			return readBlock(sendingMessage.Body(), off, bufLen, payloadSize)
+		})
+	} else {
+		buf, err = readBlock(sendingMessage.Body(), off, bufLen, payloadSize)
 	}
-	buf = buf[:newBufLen]
-
-	readed, err := io.ReadFull(sendingMessage.Body(), buf)
-	if err == io.ErrUnexpectedEOF {
-		if offSeek+int64(readed) == payloadSize {
-			err = nil
-		}
+	if err != nil {
+		return false, err
 	}
-
-	buf = buf[:readed]
+	offSeek := off
+	readed := int64(len(buf))
 	sendMessage.SetBody(bytes.NewReader(buf))
 	more := true
-	if offSeek+int64(readed) == payloadSize {
+	if offSeek+readed == payloadSize {
 		more = false
 	}
 	sendMessage.SetOptionUint32(sizeType, uint32(payloadSize))
-	num = (offSeek+int64(readed))/szx.Size() - (int64(readed) / szx.Size())
+	num = (offSeek+readed)/szx.Size() - (readed / szx.Size())
 	block, err = EncodeBlockOption(szx, num, more)
 	if err != nil {
 		return false, fmt.Errorf("cannot encode block option(%v,%v,%v): %w", szx, num, more, err)
@@ -547,7 +624,11 @@ func (b *BlockWise) handleReceivedMessage(w ResponseWriter, r Message, maxSZX SZ
 		}
 	case codes.POST, codes.PUT:
 		maxSZX = fitSZX(r, message.Block1, maxSZX)
-		err := b.processReceivedMessage(w, r, maxSZX, next, message.Block1, message.Size1)
+		if b.uploadStreaming {
+			err = b.processStreamedMessage(w, r, maxSZX, next)
+		} else {
+			err = b.processReceivedMessage(w, r, maxSZX, next, message.Block1, message.Size1)
+		}
 		if err != nil {
 			return err
 		}
@@ -559,7 +640,7 @@ func (b *BlockWise) handleReceivedMessage(w ResponseWriter, r Message, maxSZX SZ
 		}
 
 	}
-	return b.startSendingMessage(w, maxSZX, maxMessageSize, startSendingMessageBlock)
+	return b.startSendingMessage(w, r.Options(), maxSZX, maxMessageSize, startSendingMessageBlock)
 }
 
 func (b *BlockWise) continueSendingMessage(w ResponseWriter, r Message, maxSZX SZX, maxMessageSize int, messageGuard *messageGuard) (bool, error) {
@@ -592,7 +673,7 @@ func (b *BlockWise) continueSendingMessage(w ResponseWriter, r Message, maxSZX S
 			return false, fmt.Errorf("cannot encode %v(%v, %v, %v) option: %w", blockType, szx, num, more, err)
 		}
 	}
-	more, err := b.handleSendingMessage(w, resp, maxSZX, maxMessageSize, r.Token(), block)
+	more, err := b.handleSendingMessage(w, resp, messageGuard.resource, maxSZX, maxMessageSize, r.Token(), block)
 
 	if err != nil {
 		return false, fmt.Errorf("handleSendingMessage: %w", err)
@@ -611,7 +692,8 @@ func isObserveResponse(msg Message) bool {
 	return false
 }
 
-func (b *BlockWise) startSendingMessage(w ResponseWriter, maxSZX SZX, maxMessageSize int, block uint32) error {
+// startSendingMessage sends the first block of the message of w, requestOptions identify the requested resource.
+func (b *BlockWise) startSendingMessage(w ResponseWriter, requestOptions message.Options, maxSZX SZX, maxMessageSize int, block uint32) error {
 	payloadSize, err := w.Message().BodySize()
 	if err != nil {
 		return fmt.Errorf("cannot get size of payload: %w", err)
@@ -626,7 +708,11 @@ func (b *BlockWise) startSendingMessage(w ResponseWriter, maxSZX SZX, maxMessage
 	sendingMessage.SetCode(w.Message().Code())
 	sendingMessage.SetToken(w.Message().Token())
 
-	_, err = b.handleSendingMessage(w, sendingMessage, maxSZX, maxMessageSize, sendingMessage.Token(), block)
+	var resource string
+	if b.blockCache != nil {
+		resource = resourceKey(requestOptions)
+	}
+	_, err = b.handleSendingMessage(w, sendingMessage, resource, maxSZX, maxMessageSize, sendingMessage.Token(), block)
 	if err != nil {
 		return fmt.Errorf("handleSendingMessage: %w", err)
 	}
@@ -640,7 +726,9 @@ func (b *BlockWise) startSendingMessage(w ResponseWriter, maxSZX SZX, maxMessage
 		expire = time.Until(deadline)
 	}
 
-	err = b.sendingMessagesCache.Add(sendingMessage.Token().String(), newRequestGuard(sendingMessage), expire)
+	guard := newRequestGuard(sendingMessage)
+	guard.resource = resource
+	err = b.sendingMessagesCache.Add(sendingMessage.Token().String(), guard, expire)
 	if err != nil {
 		return fmt.Errorf("cannot add to response cache: %w", err)
 	}
@@ -712,6 +800,13 @@ func (b *BlockWise) processReceivedMessage(w ResponseWriter, r Message, maxSzx S
 	}
 
 	tokenStr := token.String()
+	if sendedRequest != nil && !isObserveResponse(r) {
+		if err := sendedRequest.Context().Err(); err != nil {
+			// the request was canceled or its deadline exceeded - stop the transfer
+			b.receivingMessagesCache.Delete(tokenStr)
+			return fmt.Errorf("cannot continue transfer: %w", err)
+		}
+	}
 	cachedReceivedMessageGuard, ok := b.receivingMessagesCache.Get(tokenStr)
 	var msgGuard *messageGuard
 	if !ok {
@@ -821,7 +916,12 @@ func (b *BlockWise) processReceivedMessage(w ResponseWriter, r Message, maxSzx S
 		szx = maxSzx
 	}
 
-	sendMessage := b.acquireMessage(r.Context())
+	ctx := r.Context()
+	if sendedRequest != nil && !isObserveResponse(r) {
+		// next block is requested within the deadline of the original request
+		ctx = sendedRequest.Context()
+	}
+	sendMessage := b.acquireMessage(ctx)
 	sendMessage.SetToken(token)
 	if blockType == message.Block2 {
 		num = payloadSize / szx.Size()
@@ -3,8 +3,10 @@ package blockwise
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"testing"
 	"time"
@@ -431,6 +433,109 @@ func TestBlockWise_Do(t *testing.T) {
 	}
 }
 
+func TestBlockWise_DoRestart(t *testing.T) {
+	payload := make([]byte, 100)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	// the server answers 4.08 to the second block the first lost times, as if it lost the first block
+	newDo := func(lost int) (func(req Message) (Message, error), *bytes.Buffer) {
+		var received bytes.Buffer
+		return func(req Message) (Message, error) {
+			block, err := req.GetOptionUint32(message.Block1)
+			require.NoError(t, err)
+			szx, num, more, err := DecodeBlockOption(block)
+			require.NoError(t, err)
+			if num == 1 && lost > 0 {
+				lost--
+				received.Reset()
+				return &testmessage{ctx: req.Context(), token: req.Token(), code: codes.RequestEntityIncomplete}, nil
+			}
+			data, err := ioutil.ReadAll(req.Body())
+			require.NoError(t, err)
+			if num == 0 {
+				received.Reset()
+			}
+			received.Write(data)
+			resp := &testmessage{ctx: req.Context(), token: req.Token(), code: codes.Continue}
+			if !more {
+				resp.code = codes.Changed
+			}
+			respBlock, err := EncodeBlockOption(szx, num, more)
+			require.NoError(t, err)
+			resp.SetOptionUint32(message.Block1, respBlock)
+			return resp, nil
+		}, &received
+	}
+	newRequest := func() Message {
+		return &testmessage{
+			ctx:     context.Background(),
+			token:   []byte{4},
+			options: message.Options{message.Option{ID: message.URIPath, Value: []byte("abc")}},
+			code:    codes.PUT,
+			payload: bytes.NewReader(payload),
+		}
+	}
+
+	sender := NewBlockWise(acquireMessage, releaseMessage, time.Second*3600, func(err error) { t.Log(err) }, true, nil)
+	do, received := newDo(2)
+	resp, err := sender.Do(newRequest(), SZX16, int(SZX16.Size()), do)
+	require.NoError(t, err)
+	require.Equal(t, codes.Changed, resp.Code())
+	require.Equal(t, payload, received.Bytes())
+
+	sender = NewBlockWise(acquireMessage, releaseMessage, time.Second*3600, func(err error) { t.Log(err) }, true, nil, WithMaxRestarts(1))
+	do, _ = newDo(2)
+	resp, err = sender.Do(newRequest(), SZX16, int(SZX16.Size()), do)
+	require.NoError(t, err)
+	require.Equal(t, codes.RequestEntityIncomplete, resp.Code())
+
+	// the 4.08 to the first block is the response, the upload isn't restarted
+	var calls int
+	resp, err = sender.Do(newRequest(), SZX16, int(SZX16.Size()), func(req Message) (Message, error) {
+		calls++
+		return &testmessage{ctx: req.Context(), token: req.Token(), code: codes.RequestEntityIncomplete}, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, codes.RequestEntityIncomplete, resp.Code())
+	require.Equal(t, 1, calls)
+}
+
+func TestBlockWise_DoWithoutSplit(t *testing.T) {
+	payload := make([]byte, 300)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	sender := NewBlockWise(acquireMessage, releaseMessage, time.Second*3600, func(err error) { t.Log(err) }, true, nil)
+	receiver := NewBlockWise(acquireMessage, releaseMessage, time.Second*3600, func(err error) { t.Log(err) }, true, nil)
+	do := makeDo(t, sender, receiver, SZX64, int(SZX64.Size()), SZX64, int(SZX64.Size()), func(w ResponseWriter, r Message) {
+		// the request is received in one message, the response is sent in blocks
+		_, err := r.GetOptionUint32(message.Block1)
+		require.ErrorIs(t, err, message.ErrOptionNotFound)
+		data, err := ioutil.ReadAll(r.Body())
+		require.NoError(t, err)
+		require.Equal(t, payload, data)
+		w.SetMessage(&testmessage{
+			ctx:     context.Background(),
+			token:   r.Token(),
+			code:    codes.Changed,
+			payload: bytes.NewReader(payload),
+		})
+	})
+	resp, err := sender.DoWithoutSplit(&testmessage{
+		ctx:     context.Background(),
+		token:   []byte{5},
+		options: message.Options{message.Option{ID: message.URIPath, Value: []byte("abc")}},
+		code:    codes.PUT,
+		payload: bytes.NewReader(payload),
+	}, do)
+	require.NoError(t, err)
+	require.Equal(t, codes.Changed, resp.Code())
+	data, err := ioutil.ReadAll(resp.Body())
+	require.NoError(t, err)
+	require.Equal(t, payload, data)
+}
+
 func TestEncodeBlockOption(t *testing.T) {
 	type args struct {
 		szx                 SZX
@@ -648,3 +753,201 @@ func TestBlockWise_Writetestmessage(t *testing.T) {
 		})
 	}
 }
+
+func TestBlockWise_ReceiveBlock2WithinRequestDeadline(t *testing.T) {
+	transferTimeout := time.Millisecond * 10
+	token := message.Token{3}
+	newBlock := func(ctx context.Context, num int64, more bool) *testmessage {
+		block, err := EncodeBlockOption(SZX16, num, more)
+		require.NoError(t, err)
+		r := &testmessage{
+			ctx:     ctx,
+			token:   token,
+			code:    codes.Content,
+			payload: bytes.NewReader(make([]byte, SZX16.Size())),
+		}
+		r.SetOptionUint32(message.Block2, block)
+		return r
+	}
+
+	tests := []struct {
+		name         string
+		ctx          func() (context.Context, context.CancelFunc)
+		cancelBefore bool
+		wantBody     bool
+	}{
+		{
+			name: "deadline",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), time.Second*30)
+			},
+			wantBody: true,
+		},
+		{
+			name: "default",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.Background())
+			},
+		},
+		{
+			name: "canceled",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), time.Second*30)
+			},
+			cancelBefore: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			b := NewBlockWise(acquireMessage, releaseMessage, transferTimeout, func(err error) { t.Log(err) }, true, nil)
+			b.bwSendedRequest.Store(token.String(), &testmessage{
+				ctx:   ctx,
+				token: token,
+				code:  codes.GET,
+			})
+			var got Message
+			next := func(w ResponseWriter, r Message) {
+				got = r
+			}
+
+			w := newResponseWriter(acquireMessage(context.Background()))
+			b.Handle(w, newBlock(context.Background(), 0, true), SZX16, int(SZX16.Size()), next)
+			require.Nil(t, got)
+			require.Equal(t, codes.GET, w.Message().Code())
+			block, err := w.Message().GetOptionUint32(message.Block2)
+			require.NoError(t, err)
+			_, num, _, err := DecodeBlockOption(block)
+			require.NoError(t, err)
+			require.Equal(t, int64(1), num)
+
+			// slow peer - next block arrives after the transfer timeout
+			time.Sleep(transferTimeout * 5)
+			if tt.cancelBefore {
+				cancel()
+			}
+			w = newResponseWriter(acquireMessage(context.Background()))
+			b.Handle(w, newBlock(context.Background(), 1, false), SZX16, int(SZX16.Size()), next)
+			if !tt.wantBody {
+				require.Nil(t, got)
+				_, ok := b.receivingMessagesCache.Get(token.String())
+				require.False(t, ok)
+				return
+			}
+			require.NotNil(t, got)
+			size, err := got.BodySize()
+			require.NoError(t, err)
+			require.Equal(t, 2*SZX16.Size(), size)
+		})
+	}
+}
+
+func TestBlockWise_UploadStreaming(t *testing.T) {
+	transferTimeout := time.Millisecond * 50
+	token := message.Token{4}
+	newBlock := func(num int64, more bool) *testmessage {
+		block, err := EncodeBlockOption(SZX16, num, more)
+		require.NoError(t, err)
+		r := &testmessage{
+			ctx:     context.Background(),
+			token:   token,
+			code:    codes.PUT,
+			payload: bytes.NewReader(bytes.Repeat([]byte{byte(num)}, int(SZX16.Size()))),
+		}
+		r.SetOptionUint32(message.Block1, block)
+		return r
+	}
+	handle := func(b *BlockWise, r Message, next func(ResponseWriter, Message)) Message {
+		w := newResponseWriter(acquireMessage(context.Background()))
+		b.Handle(w, r, SZX16, int(SZX16.Size()), next)
+		return w.Message()
+	}
+
+	t.Run("complete", func(t *testing.T) {
+		b := NewBlockWise(acquireMessage, releaseMessage, transferTimeout, func(err error) { t.Log(err) }, true, nil, WithUploadStreaming(true))
+		bodies := make(chan []byte, 1)
+		next := func(w ResponseWriter, r Message) {
+			body, err := ioutil.ReadAll(r.Body())
+			require.NoError(t, err)
+			bodies <- body
+			resp := acquireMessage(r.Context())
+			resp.SetCode(codes.Changed)
+			w.SetMessage(resp)
+		}
+		resp := handle(b, newBlock(0, true), next)
+		require.Equal(t, codes.Continue, resp.Code())
+		// duplicate of the first block is acknowledged again
+		resp = handle(b, newBlock(0, true), next)
+		require.Equal(t, codes.Continue, resp.Code())
+		resp = handle(b, newBlock(1, false), next)
+		require.Equal(t, codes.Changed, resp.Code())
+		body := <-bodies
+		require.Equal(t, append(bytes.Repeat([]byte{0}, int(SZX16.Size())), bytes.Repeat([]byte{1}, int(SZX16.Size()))...), body)
+	})
+
+	t.Run("longerThanExpiration", func(t *testing.T) {
+		b := NewBlockWise(acquireMessage, releaseMessage, transferTimeout, func(err error) { t.Log(err) }, true, nil, WithUploadStreaming(true))
+		bodies := make(chan []byte, 1)
+		next := func(w ResponseWriter, r Message) {
+			body, err := ioutil.ReadAll(r.Body())
+			require.NoError(t, err)
+			bodies <- body
+			resp := acquireMessage(r.Context())
+			resp.SetCode(codes.Changed)
+			w.SetMessage(resp)
+		}
+		const blocks = 10
+		var want []byte
+		for i := int64(0); i < blocks; i++ {
+			// every block arrives within the expiration, but the whole transfer takes longer
+			time.Sleep(transferTimeout / 2)
+			resp := handle(b, newBlock(i, i < blocks-1), next)
+			if i < blocks-1 {
+				require.Equal(t, codes.Continue, resp.Code())
+			} else {
+				require.Equal(t, codes.Changed, resp.Code())
+			}
+			want = append(want, bytes.Repeat([]byte{byte(i)}, int(SZX16.Size()))...)
+		}
+		require.Equal(t, want, <-bodies)
+	})
+
+	t.Run("handlerDoesNotRead", func(t *testing.T) {
+		b := NewBlockWise(acquireMessage, releaseMessage, transferTimeout, func(err error) { t.Log(err) }, true, nil, WithUploadStreaming(true))
+		release := make(chan struct{})
+		defer close(release)
+		next := func(w ResponseWriter, r Message) {
+			<-release
+		}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			handle(b, newBlock(0, true), next)
+		}()
+		// the block isn't read by the handler, it's dropped when the transfer expires
+		select {
+		case <-done:
+		case <-time.After(time.Second * 5):
+			require.FailNow(t, "block of streamed request is still blocked")
+		}
+	})
+
+	t.Run("aborted", func(t *testing.T) {
+		b := NewBlockWise(acquireMessage, releaseMessage, transferTimeout, func(err error) { t.Log(err) }, true, nil, WithUploadStreaming(true))
+		errs := make(chan error, 1)
+		next := func(w ResponseWriter, r Message) {
+			_, err := ioutil.ReadAll(r.Body())
+			errs <- err
+		}
+		resp := handle(b, newBlock(0, true), next)
+		require.Equal(t, codes.Continue, resp.Code())
+		// the peer doesn't send the next block until the transfer expires
+		select {
+		case err := <-errs:
+			require.True(t, errors.Is(err, ErrStreamAborted), "unexpected error %v", err)
+		case <-time.After(time.Second * 5):
+			require.FailNow(t, "body of aborted transfer is still blocked")
+		}
+	})
+}
@@ -23,4 +23,10 @@ var (
 
 	// ErrInvalidSZX invalid block-wise transfer szx
 	ErrInvalidSZX = errors.New("invalid block-wise transfer szx")
+
+	// ErrStreamAborted the streamed block-wise transfer was not completed
+	ErrStreamAborted = errors.New("streamed block-wise transfer was aborted")
+
+	// ErrStreamNotSeekable the body of the streamed block-wise transfer can't be rewound
+	ErrStreamNotSeekable = errors.New("body of streamed block-wise transfer is not seekable")
 )
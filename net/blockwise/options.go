@@ -0,0 +1,82 @@
+package blockwise
+
+import "github.com/plgd-dev/go-coap/v2/net/clock"
+
+// Option sets options of BlockWise.
+type Option interface {
+	apply(*options)
+}
+
+type options struct {
+	blockCache      *BlockCache
+	uploadStreaming bool
+	maxRestarts     int
+	clock           clock.Clock
+}
+
+var defaultOptions = options{
+	maxRestarts: 3,
+	clock:       clock.Real,
+}
+
+// BlockCacheOpt block cache option.
+type BlockCacheOpt struct {
+	blockCache *BlockCache
+}
+
+func (o BlockCacheOpt) apply(opts *options) {
+	opts.blockCache = o.blockCache
+}
+
+// WithBlockCache sets cache of blocks which are sent from bodies with ETag. The cache can be shared between BlockWise instances.
+func WithBlockCache(blockCache *BlockCache) BlockCacheOpt {
+	return BlockCacheOpt{blockCache: blockCache}
+}
+
+// UploadStreamingOpt upload streaming option.
+type UploadStreamingOpt struct {
+	enable bool
+}
+
+func (o UploadStreamingOpt) apply(opts *options) {
+	opts.uploadStreaming = o.enable
+}
+
+// WithUploadStreaming calls the handler with the first block of a POST or PUT request transferred by Block1, instead of
+// the whole reassembled request. Reading the body of the request blocks until the next block arrives and it returns
+// ErrStreamAborted when the transfer expires, so the handler can stream the body without holding it in the memory.
+// The next block isn't acknowledged until the handler reads the previous one. The response of the handler is sent
+// to the last block, or to the next block when the handler returns before it reads the whole body.
+func WithUploadStreaming(enable bool) UploadStreamingOpt {
+	return UploadStreamingOpt{enable: enable}
+}
+
+// MaxRestartsOpt max restarts option.
+type MaxRestartsOpt struct {
+	maxRestarts int
+}
+
+func (o MaxRestartsOpt) apply(opts *options) {
+	opts.maxRestarts = o.maxRestarts
+}
+
+// WithMaxRestarts sets how many times Do restarts the upload by Block1 from the first block, when the server
+// answers 4.08 (Request Entity Incomplete) to a later block because it lost the previous blocks. The 0 disables restarts,
+// the default is 3. The 4.08 is returned as the response when the restarts are exhausted or when it answers the first block.
+func WithMaxRestarts(maxRestarts int) MaxRestartsOpt {
+	return MaxRestartsOpt{maxRestarts: maxRestarts}
+}
+
+// ClockOpt clock option.
+type ClockOpt struct {
+	clock clock.Clock
+}
+
+func (o ClockOpt) apply(opts *options) {
+	opts.clock = o.clock
+}
+
+// WithClock sets the clock which measures the Max-Age of the bodies with blocks cached by the BlockCache.
+func WithClock(c clock.Clock) ClockOpt {
+	return ClockOpt{clock: c}
+}
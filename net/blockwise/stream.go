@@ -0,0 +1,236 @@
+package blockwise
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"runtime/debug"
+	"sync"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+)
+
+// uploadStream passes the blocks of a request to the handler which runs since the first block.
+type uploadStream struct {
+	sync.Mutex
+	blocks     chan []byte
+	aborted    chan struct{}
+	done       chan struct{}
+	finishOnce sync.Once
+	received   int64
+	response   Message
+}
+
+func newUploadStream() *uploadStream {
+	return &uploadStream{
+		blocks:  make(chan []byte),
+		aborted: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// complete closes the body after the last block, the reader gets io.EOF.
+func (s *uploadStream) complete() {
+	s.finishOnce.Do(func() {
+		close(s.blocks)
+	})
+}
+
+// abort unblocks the reader by ErrStreamAborted when the transfer isn't completed.
+func (s *uploadStream) abort() {
+	s.finishOnce.Do(func() {
+		close(s.aborted)
+	})
+}
+
+// streamBody is the body of the streamed request, Read blocks until the next block arrives.
+type streamBody struct {
+	stream *uploadStream
+	buf    []byte
+	off    int64
+}
+
+func (b *streamBody) Read(p []byte) (int, error) {
+	for len(b.buf) == 0 {
+		select {
+		case block, ok := <-b.stream.blocks:
+			if !ok {
+				return 0, io.EOF
+			}
+			b.buf = block
+		case <-b.stream.aborted:
+			return 0, ErrStreamAborted
+		}
+	}
+	n := copy(p, b.buf)
+	b.buf = b.buf[n:]
+	b.off += int64(n)
+	return n, nil
+}
+
+// Seek only reports the current position, the body can't be rewound.
+func (b *streamBody) Seek(offset int64, whence int) (int64, error) {
+	if (whence == io.SeekCurrent && offset == 0) || (whence == io.SeekStart && offset == b.off) {
+		return b.off, nil
+	}
+	return b.off, ErrStreamNotSeekable
+}
+
+type streamResponseWriter struct {
+	message    Message
+	remoteAddr net.Addr
+}
+
+func (w *streamResponseWriter) Message() Message {
+	return w.message
+}
+
+func (w *streamResponseWriter) SetMessage(m Message) {
+	w.message = m
+}
+
+func (w *streamResponseWriter) RemoteAddr() net.Addr {
+	return w.remoteAddr
+}
+
+func (b *BlockWise) serveUploadStream(s *uploadStream, w *streamResponseWriter, r Message, next func(w ResponseWriter, r Message)) {
+	defer close(s.done)
+	defer func() {
+		if rec := recover(); rec != nil {
+			b.errors(fmt.Errorf("handler of streamed request panics: %v\n%s", rec, debug.Stack()))
+			resp := b.acquireMessage(r.Context())
+			resp.SetCode(codes.InternalServerError)
+			resp.SetToken(r.Token())
+			s.response = resp
+		}
+	}()
+	next(w, r)
+	s.response = w.Message()
+}
+
+// processStreamedMessage calls next with the first block of the request, the body of the request yields
+// the payload of the blocks as they arrive. The response of next is sent to the last block.
+func (b *BlockWise) processStreamedMessage(w ResponseWriter, r Message, maxSzx SZX, next func(w ResponseWriter, r Message)) error {
+	token := r.Token()
+	block, err := r.GetOptionUint32(message.Block1)
+	if len(token) == 0 || err != nil {
+		next(w, r)
+		return nil
+	}
+	szx, num, more, err := DecodeBlockOption(block)
+	if err != nil {
+		return fmt.Errorf("cannot decode block option: %w", err)
+	}
+	tokenStr := token.String()
+	var s *uploadStream
+	v, ok := b.uploadStreams.Get(tokenStr)
+	if !ok {
+		// first request must have 0
+		if num != 0 {
+			return fmt.Errorf("(%v) token %v, invalid %v(%v), expected 0", w.RemoteAddr(), []byte(token), message.Block1, num)
+		}
+		// if there is no more then just forward req to next handler
+		if !more {
+			next(w, r)
+			return nil
+		}
+		s = newUploadStream()
+		if err := b.uploadStreams.Add(tokenStr, s, cache.DefaultExpiration); err != nil {
+			return fmt.Errorf("upload stream was already stored in cache")
+		}
+		req := b.acquireMessage(r.Context())
+		req.SetCode(r.Code())
+		req.SetToken(token)
+		req.ResetOptionsTo(r.Options())
+		req.Remove(message.Block1)
+		req.SetSequence(r.Sequence())
+		setTypeFrom(req, r)
+		req.SetBody(&streamBody{stream: s})
+		resp := b.acquireMessage(r.Context())
+		resp.SetToken(token)
+		go b.serveUploadStream(s, &streamResponseWriter{message: resp, remoteAddr: w.RemoteAddr()}, req, next)
+	} else {
+		s = v.(*uploadStream)
+	}
+	s.Lock()
+	defer s.Unlock()
+
+	respond := func() {
+		b.uploadStreams.Delete(tokenStr)
+		w.SetMessage(s.response)
+	}
+	select {
+	case <-s.done:
+		// the handler responded before it read the whole body
+		respond()
+		return nil
+	default:
+	}
+
+	off := num * szx.Size()
+	if off > s.received {
+		b.uploadStreams.Delete(tokenStr)
+		return fmt.Errorf("(%v) token %v, invalid %v(%v), expected offset %v", w.RemoteAddr(), []byte(token), message.Block1, num, s.received)
+	}
+	if off == s.received {
+		var data []byte
+		if r.Body() != nil {
+			if _, err := r.Body().Seek(0, io.SeekStart); err != nil {
+				b.uploadStreams.Delete(tokenStr)
+				return fmt.Errorf("cannot seek to start of request: %w", err)
+			}
+			data, err = ioutil.ReadAll(r.Body())
+			if err != nil {
+				b.uploadStreams.Delete(tokenStr)
+				return fmt.Errorf("cannot read request: %w", err)
+			}
+		}
+		if len(data) > 0 {
+			select {
+			case s.blocks <- data:
+			case <-s.done:
+				respond()
+				return nil
+			case <-s.aborted:
+				b.uploadStreams.Delete(tokenStr)
+				return fmt.Errorf("cannot pass block to handler of streamed request: %w", ErrStreamAborted)
+			case <-r.Context().Done():
+				b.uploadStreams.Delete(tokenStr)
+				return fmt.Errorf("cannot pass block to handler of streamed request: %w", r.Context().Err())
+			}
+			s.received += int64(len(data))
+		}
+		// the transfer expires when no block arrives within the expiration, not when it takes longer
+		b.uploadStreams.Set(tokenStr, s, cache.DefaultExpiration)
+		if !more {
+			s.complete()
+			select {
+			case <-s.done:
+			case <-r.Context().Done():
+				b.uploadStreams.Delete(tokenStr)
+				return fmt.Errorf("cannot wait for response of streamed request: %w", r.Context().Err())
+			}
+			respond()
+			return nil
+		}
+	}
+	// the block was accepted or it is a duplicate of an accepted one
+	if szx > maxSzx {
+		szx = maxSzx
+	}
+	sendMessage := b.acquireMessage(r.Context())
+	sendMessage.SetToken(token)
+	sendMessage.SetCode(codes.Continue)
+	respBlock, err := EncodeBlockOption(szx, num, more)
+	if err != nil {
+		b.releaseMessage(sendMessage)
+		b.uploadStreams.Delete(tokenStr)
+		return fmt.Errorf("cannot encode block option(%v,%v,%v): %w", szx, num, more, err)
+	}
+	sendMessage.SetOptionUint32(message.Block1, respBlock)
+	w.SetMessage(sendMessage)
+	return nil
+}
@@ -0,0 +1,53 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// broadcastWorkers limits the number of connections written by Broadcast at once.
+const broadcastWorkers = 64
+
+// Broadcast calls write for every connection index from 0 to n-1 by at most 64 goroutines at once, so a broadcast
+// to many connections doesn't start a goroutine for each of them. A slow write, eg. waiting for the acknowledgement
+// of a confirmable message, delays the writes of the next connections. The connections which aren't written
+// before ctx is done fail with the error of ctx. The error reports the number of connections which failed
+// and wraps the error of the first one.
+func Broadcast(ctx context.Context, n int, write func(i int) error) error {
+	workers := broadcastWorkers
+	if n < workers {
+		workers = n
+	}
+	next := int64(-1)
+	var wg sync.WaitGroup
+	var errsLock sync.Mutex
+	var errs []error
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= n {
+					return
+				}
+				err := ctx.Err()
+				if err == nil {
+					err = write(i)
+				}
+				if err != nil {
+					errsLock.Lock()
+					errs = append(errs, err)
+					errsLock.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return fmt.Errorf("cannot broadcast to %v of %v connections: %w", len(errs), n, errs[0])
+	}
+	return nil
+}
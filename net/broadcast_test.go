@@ -0,0 +1,50 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroadcast(t *testing.T) {
+	const n = broadcastWorkers * 4
+	var running, maxRunning int32
+	var lock sync.Mutex
+	written := make(map[int]bool)
+	errWrite := errors.New("write failed")
+	err := Broadcast(context.Background(), n, func(i int) error {
+		r := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if r <= m || atomic.CompareAndSwapInt32(&maxRunning, m, r) {
+				break
+			}
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		written[i] = true
+		if i%2 == 1 {
+			return errWrite
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, errWrite)
+	require.Contains(t, err.Error(), "128 of 256")
+	require.Len(t, written, n)
+	require.LessOrEqual(t, atomic.LoadInt32(&maxRunning), int32(broadcastWorkers))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = Broadcast(ctx, 3, func(i int) error {
+		require.FailNow(t, "connection was written after the context was canceled")
+		return nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+
+	require.NoError(t, Broadcast(context.Background(), 0, nil))
+}
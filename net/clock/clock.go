@@ -0,0 +1,158 @@
+// Package clock abstracts the time used by the timeouts of the connections, so tests can replace it
+// by the fake clock and check eg. the retransmissions without the real sleeps.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock provides the current time and the timers.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer sends the time of the clock to the channel returned by C when it fires, like time.Timer.
+type Timer interface {
+	C() <-chan time.Time
+	// Stop prevents the timer from firing, it returns false when the timer already fired or it was stopped.
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{timer: time.NewTimer(d)}
+}
+
+type realTimer struct {
+	timer *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t realTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+// Real is the clock of the time package.
+var Real Clock = realClock{}
+
+type waiter struct {
+	deadline time.Time
+	c        chan time.Time
+}
+
+// Fake is the clock which time moves only by Advance.
+type Fake struct {
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*waiter
+}
+
+// NewFake creates the fake clock set to now.
+func NewFake(now time.Time) *Fake {
+	c := &Fake{
+		now: now,
+	}
+	c.cond = sync.NewCond(&c.mutex)
+	return c
+}
+
+// Now returns the time of the clock.
+func (c *Fake) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// After returns the channel which receives the time of the clock when it was advanced by d.
+func (c *Fake) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+// NewTimer creates the timer which fires when the clock was advanced by d.
+func (c *Fake) NewTimer(d time.Duration) Timer {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	w := &waiter{deadline: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		w.c <- c.now
+		return &fakeTimer{clock: c, waiter: w}
+	}
+	c.waiters = append(c.waiters, w)
+	c.cond.Broadcast()
+	return &fakeTimer{clock: c, waiter: w}
+}
+
+type fakeTimer struct {
+	clock  *Fake
+	waiter *waiter
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.waiter.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	return t.clock.stop(t.waiter)
+}
+
+func (c *Fake) stop(w *waiter) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for i, v := range c.waiters {
+		if v == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Advance moves the clock by d and fires the expired timers.
+func (c *Fake) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+	waiters := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.deadline.After(c.now) {
+			waiters = append(waiters, w)
+			continue
+		}
+		w.c <- c.now
+	}
+	c.waiters = waiters
+}
+
+// Waiters returns the number of the timers which haven't fired yet, tests use it to find out
+// that the code under the test waits for the clock.
+func (c *Fake) Waiters() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.waiters)
+}
+
+// BlockUntil blocks until at least n timers wait for the clock, so a test can advance the clock
+// exactly when the code under the test waits for it.
+func (c *Fake) BlockUntil(n int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
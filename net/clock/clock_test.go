@@ -0,0 +1,61 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Unix(1000, 0)
+	c := NewFake(start)
+	first := c.After(time.Second)
+	second := c.After(time.Second * 3)
+	require.Equal(t, 2, c.Waiters())
+
+	c.Advance(time.Second * 2)
+	require.Equal(t, start.Add(time.Second*2), <-first)
+	require.Equal(t, 1, c.Waiters())
+	select {
+	case <-second:
+		require.FailNow(t, "timer fired too early")
+	default:
+	}
+
+	c.Advance(time.Second)
+	require.Equal(t, start.Add(time.Second*3), <-second)
+	require.Equal(t, 0, c.Waiters())
+	require.Equal(t, start.Add(time.Second*3), c.Now())
+	require.Equal(t, c.Now(), <-c.After(0))
+}
+
+func TestFakeTimer(t *testing.T) {
+	start := time.Unix(1000, 0)
+	c := NewFake(start)
+	stopped := c.NewTimer(time.Second)
+	fired := c.NewTimer(time.Second)
+	require.True(t, stopped.Stop())
+	require.False(t, stopped.Stop())
+	require.Equal(t, 1, c.Waiters())
+
+	c.Advance(time.Second)
+	require.Equal(t, start.Add(time.Second), <-fired.C())
+	require.False(t, fired.Stop())
+	select {
+	case <-stopped.C():
+		require.FailNow(t, "stopped timer fired")
+	default:
+	}
+}
+
+func TestFakeBlockUntil(t *testing.T) {
+	c := NewFake(time.Unix(1000, 0))
+	done := make(chan time.Time)
+	go func() {
+		done <- <-c.After(time.Second)
+	}()
+	c.BlockUntil(1)
+	c.Advance(time.Second)
+	require.Equal(t, time.Unix(1001, 0), <-done)
+}
@@ -78,7 +78,8 @@ func (c *Conn) Close() error {
 	return c.connection.Close()
 }
 
-// WriteWithContext writes data with context.
+// WriteWithContext writes data with context. The data aren't queued, it blocks until the whole data are
+// accepted by the connection or the context is done.
 func (c *Conn) WriteWithContext(ctx context.Context, data []byte) error {
 	written := 0
 	c.lock.Lock()
@@ -12,8 +12,17 @@ import (
 	"golang.org/x/net/ipv6"
 )
 
+// MaxMulticastHopLimit is maximal hop limit of IPv6 and TTL of IPv4.
+const MaxMulticastHopLimit = 255
+
 // UDPConn is a udp connection provides Read/Write with context.
 //
+// ReadWithContext reads directly from the socket without any internal queue, so the packets which wait
+// for the reader are bounded by the receive buffer of the socket, see WithReadBuffer.
+// Likewise the writes aren't queued: WriteWithContext blocks until the socket accepts the datagram
+// or the context is done, so a producer outpacing the network is throttled by the send buffer, see WithWriteBuffer.
+// The datagrams written by one goroutine are handed to the kernel in the order of the calls.
+//
 // Multiple goroutines may invoke methods on a UDPConn simultaneously.
 type UDPConn struct {
 	heartBeat      time.Duration
@@ -23,21 +32,31 @@ type UDPConn struct {
 	network        string
 	onReadTimeout  func() error
 	onWriteTimeout func() error
+	packetFilter   PacketFilterFunc
+	dualStack      *dualStack
+	readBatch      *readBatch
+
+	controlMessageOnce sync.Once
+	controlMessageErr  error
 
 	lock sync.Mutex
 }
 
 type ControlMessage struct {
 	Src     net.IP // source address, specifying only
+	Dst     net.IP // destination address, receiving only
 	IfIndex int    // interface index, must be 1 <= value when specifying
 }
 
 type packetConn interface {
 	SetWriteDeadline(t time.Time) error
 	WriteTo(b []byte, cm *ControlMessage, dst net.Addr) (n int, err error)
+	ReadFrom(b []byte) (n int, cm *ControlMessage, src net.Addr, err error)
+	SetControlMessage(on bool) error
 	SetMulticastInterface(ifi *net.Interface) error
 	SetMulticastHopLimit(hoplim int) error
 	SetMulticastLoopback(on bool) error
+	SetTrafficClass(tc int) error
 	JoinGroup(ifi *net.Interface, group net.Addr) error
 	LeaveGroup(ifi *net.Interface, group net.Addr) error
 }
@@ -69,6 +88,22 @@ func (p *packetConnIPv4) WriteTo(b []byte, cm *ControlMessage, dst net.Addr) (n
 	return p.packetConnIPv4.WriteTo(b, c, dst)
 }
 
+func (p *packetConnIPv4) ReadFrom(b []byte) (int, *ControlMessage, net.Addr, error) {
+	n, c, src, err := p.packetConnIPv4.ReadFrom(b)
+	var cm *ControlMessage
+	if c != nil {
+		cm = &ControlMessage{
+			Dst:     c.Dst,
+			IfIndex: c.IfIndex,
+		}
+	}
+	return n, cm, src, err
+}
+
+func (p *packetConnIPv4) SetControlMessage(on bool) error {
+	return p.packetConnIPv4.SetControlMessage(ipv4.FlagDst|ipv4.FlagInterface, on)
+}
+
 func (p *packetConnIPv4) SetMulticastHopLimit(hoplim int) error {
 	return p.packetConnIPv4.SetMulticastTTL(hoplim)
 }
@@ -77,6 +112,10 @@ func (p *packetConnIPv4) SetMulticastLoopback(on bool) error {
 	return p.packetConnIPv4.SetMulticastLoopback(on)
 }
 
+func (p *packetConnIPv4) SetTrafficClass(tc int) error {
+	return p.packetConnIPv4.SetTOS(tc)
+}
+
 func (p *packetConnIPv4) JoinGroup(ifi *net.Interface, group net.Addr) error {
 	return p.packetConnIPv4.JoinGroup(ifi, group)
 }
@@ -112,6 +151,18 @@ func (p *packetConnIPv6) WriteTo(b []byte, cm *ControlMessage, dst net.Addr) (n
 	return p.packetConnIPv6.WriteTo(b, c, dst)
 }
 
+func (p *packetConnIPv6) ReadFrom(b []byte) (int, *ControlMessage, net.Addr, error) {
+	n, c, src, err := p.packetConnIPv6.ReadFrom(b)
+	var cm *ControlMessage
+	if c != nil {
+		cm = &ControlMessage{
+			Dst:     c.Dst,
+			IfIndex: c.IfIndex,
+		}
+	}
+	return n, cm, src, err
+}
+
 func (p *packetConnIPv6) SetMulticastHopLimit(hoplim int) error {
 	return p.packetConnIPv6.SetMulticastHopLimit(hoplim)
 }
@@ -120,6 +171,10 @@ func (p *packetConnIPv6) SetMulticastLoopback(on bool) error {
 	return p.packetConnIPv6.SetMulticastLoopback(on)
 }
 
+func (p *packetConnIPv6) SetTrafficClass(tc int) error {
+	return p.packetConnIPv6.SetTrafficClass(tc)
+}
+
 func (p *packetConnIPv6) JoinGroup(ifi *net.Interface, group net.Addr) error {
 	return p.packetConnIPv6.JoinGroup(ifi, group)
 }
@@ -129,7 +184,7 @@ func (p *packetConnIPv6) LeaveGroup(ifi *net.Interface, group net.Addr) error {
 }
 
 func (p *packetConnIPv6) SetControlMessage(on bool) error {
-	return p.packetConnIPv6.SetMulticastLoopback(on)
+	return p.packetConnIPv6.SetControlMessage(ipv6.FlagDst|ipv6.FlagInterface, on)
 }
 
 // IsIPv6 return's true if addr is IPV6.
@@ -152,6 +207,11 @@ type udpConnOptions struct {
 	errors         func(err error)
 	onReadTimeout  func() error
 	onWriteTimeout func() error
+	packetFilter   PacketFilterFunc
+	reusePort      bool
+	readBuffer     int
+	writeBuffer    int
+	readBatchSize  int
 }
 
 func NewListenUDP(network, addr string, opts ...UDPOption) (*UDPConn, error) {
@@ -159,20 +219,62 @@ func NewListenUDP(network, addr string, opts ...UDPOption) (*UDPConn, error) {
 	if err != nil {
 		return nil, err
 	}
-	conn, err := net.ListenUDP(network, listenAddress)
+	cfg := defaultUDPConnOptions
+	for _, o := range opts {
+		o.applyUDP(&cfg)
+	}
+	var conn *net.UDPConn
+	if cfg.reusePort {
+		lc := net.ListenConfig{
+			Control: reusePortControl,
+		}
+		c, err := lc.ListenPacket(context.Background(), network, listenAddress.String())
+		if err != nil {
+			return nil, err
+		}
+		conn = c.(*net.UDPConn)
+	} else {
+		conn, err = net.ListenUDP(network, listenAddress)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = setBuffers(conn, cfg)
 	if err != nil {
+		_ = conn.Close()
 		return nil, err
 	}
-	return NewUDPConn(network, conn, opts...), nil
+	return newUDPConn(network, conn, cfg), nil
 }
 
-// NewUDPConn creates connection over net.UDPConn.
+func setBuffers(c *net.UDPConn, cfg udpConnOptions) error {
+	if cfg.readBuffer > 0 {
+		if err := c.SetReadBuffer(cfg.readBuffer); err != nil {
+			return fmt.Errorf("cannot set read buffer: %w", err)
+		}
+	}
+	if cfg.writeBuffer > 0 {
+		if err := c.SetWriteBuffer(cfg.writeBuffer); err != nil {
+			return fmt.Errorf("cannot set write buffer: %w", err)
+		}
+	}
+	return nil
+}
+
+// NewUDPConn creates connection over net.UDPConn. The failure of setting the socket buffers
+// is reported by the errors function.
 func NewUDPConn(network string, c *net.UDPConn, opts ...UDPOption) *UDPConn {
 	cfg := defaultUDPConnOptions
 	for _, o := range opts {
 		o.applyUDP(&cfg)
 	}
+	if err := setBuffers(c, cfg); err != nil && cfg.errors != nil {
+		cfg.errors(err)
+	}
+	return newUDPConn(network, c, cfg)
+}
 
+func newUDPConn(network string, c *net.UDPConn, cfg udpConnOptions) *UDPConn {
 	var packetConn packetConn
 
 	if IsIPv6(c.LocalAddr().(*net.UDPAddr).IP) {
@@ -181,6 +283,11 @@ func NewUDPConn(network string, c *net.UDPConn, opts ...UDPOption) *UDPConn {
 		packetConn = newPacketConnIPv4(ipv4.NewPacketConn(c))
 	}
 
+	var readBatch *readBatch
+	if cfg.readBatchSize > 1 {
+		readBatch = newReadBatch(c, cfg.readBatchSize)
+	}
+
 	return &UDPConn{
 		network:        network,
 		connection:     c,
@@ -189,6 +296,8 @@ func NewUDPConn(network string, c *net.UDPConn, opts ...UDPOption) *UDPConn {
 		errors:         cfg.errors,
 		onReadTimeout:  cfg.onReadTimeout,
 		onWriteTimeout: cfg.onWriteTimeout,
+		packetFilter:   cfg.packetFilter,
+		readBatch:      readBatch,
 	}
 }
 
@@ -209,10 +318,19 @@ func (c *UDPConn) Network() string {
 
 // Close closes the connection.
 func (c *UDPConn) Close() error {
+	if c.dualStack != nil {
+		if err := c.dualStack.close(); err != nil {
+			_ = c.connection.Close()
+			return err
+		}
+	}
 	return c.connection.Close()
 }
 
-func (c *UDPConn) writeToAddr(deadline time.Time, multicastHopLimit int, iface net.Interface, srcAddr net.Addr, port string, raddr *net.UDPAddr, buffer []byte) error {
+// writeToAddr writes the multicast via conn out of iface. The source address of the packet is srcAddr, an address
+// of iface of the same family as raddr, the addresses of the other family are skipped. The source port is the port of conn.
+// The dst is nil when conn is connected to raddr.
+func (c *UDPConn) writeToAddr(conn *net.UDPConn, deadline time.Time, multicastHopLimit int, iface net.Interface, srcAddr net.Addr, raddr *net.UDPAddr, dst net.Addr, buffer []byte) error {
 	netType := "udp4"
 	if IsIPv6(raddr.IP) {
 		netType = "udp6"
@@ -227,15 +345,17 @@ func (c *UDPConn) writeToAddr(deadline time.Time, multicastHopLimit int, iface n
 	}
 	var p packetConn
 	if netType == "udp4" {
-		p = newPacketConnIPv4(ipv4.NewPacketConn(c.connection))
+		p = newPacketConnIPv4(ipv4.NewPacketConn(conn))
 	} else {
-		p = newPacketConnIPv6(ipv6.NewPacketConn(c.connection))
+		p = newPacketConnIPv6(ipv6.NewPacketConn(conn))
 	}
 
 	if err := p.SetMulticastInterface(&iface); err != nil {
 		return err
 	}
-	p.SetMulticastHopLimit(multicastHopLimit)
+	if err := p.SetMulticastHopLimit(multicastHopLimit); err != nil {
+		return fmt.Errorf("cannot set multicast hop limit: %w", err)
+	}
 	err := p.SetWriteDeadline(deadline)
 	if err != nil {
 		return fmt.Errorf("cannot write multicast with context: cannot set write deadline for connection: %w", err)
@@ -247,18 +367,48 @@ func (c *UDPConn) writeToAddr(deadline time.Time, multicastHopLimit int, iface n
 	_, err = p.WriteTo(buffer, &ControlMessage{
 		Src:     ip,
 		IfIndex: iface.Index,
-	}, raddr)
+	}, dst)
 	return err
 }
 
+// WriteMulticast sends multicast to the raddr via all multicast interfaces. The hopLimit must be in range from 0 to MaxMulticastHopLimit,
+// 0 restricts the packet to the host and 1 to the local network segment. For IPv4 the hopLimit is used as TTL of the packet.
+// A packet is sent for every address of the interface of the raddr family, with the address as the source address
+// and the port of the connection as the source port, so the responders reply to the connection.
 func (c *UDPConn) WriteMulticast(ctx context.Context, raddr *net.UDPAddr, hopLimit int, buffer []byte) error {
+	return c.WriteMulticastFromPort(ctx, 0, raddr, hopLimit, buffer)
+}
+
+// WriteMulticastFromPort sends multicast as WriteMulticast, but the packets originate from srcPort instead of the port
+// of the connection, so the responders reply to srcPort. The srcPort is bound with SO_REUSEPORT only for the time of
+// the write, so the socket which receives the responses must be bound to srcPort with SO_REUSEPORT too,
+// eg. by NewListenUDP with WithReusePort. The srcPort 0 or the port of the connection writes via the connection itself.
+func (c *UDPConn) WriteMulticastFromPort(ctx context.Context, srcPort int, raddr *net.UDPAddr, hopLimit int, buffer []byte) error {
 	if raddr == nil {
 		return fmt.Errorf("cannot write multicast with context: invalid raddr")
 	}
+	if hopLimit < 0 || hopLimit > MaxMulticastHopLimit {
+		return fmt.Errorf("cannot write multicast with context: %w(%v)", ErrInvalidHopLimit, hopLimit)
+	}
+	if c.dualStack != nil && IsIPv6(raddr.IP) {
+		return c.dualStack.ipv6.WriteMulticastFromPort(ctx, srcPort, raddr, hopLimit, buffer)
+	}
 	if _, ok := c.packetConn.(*packetConnIPv4); ok && IsIPv6(raddr.IP) {
 		return fmt.Errorf("cannot write multicast with context: invalid destination address")
 	}
 
+	conn := c.connection
+	var dst net.Addr = raddr
+	if srcPort != 0 && srcPort != c.connection.LocalAddr().(*net.UDPAddr).Port {
+		srcConn, err := dialMulticastFromPort(ctx, srcPort, raddr)
+		if err != nil {
+			return fmt.Errorf("cannot write multicast with context: cannot bind source port %v: %w", srcPort, err)
+		}
+		defer srcConn.Close()
+		conn = srcConn
+		dst = nil
+	}
+
 	ifaces, err := net.Interfaces()
 	if err != nil {
 		return fmt.Errorf("cannot write multicast with context: cannot get interfaces for multicast connection: %w", err)
@@ -283,12 +433,9 @@ LOOP:
 		default:
 		}
 
-		addr := strings.Split(c.connection.LocalAddr().String(), ":")
-		port := addr[len(addr)-1]
-
 		for _, ifaceAddr := range ifaceAddrs {
 			deadline := time.Now().Add(c.heartBeat)
-			err = c.writeToAddr(deadline, hopLimit, iface, ifaceAddr, port, raddr, buffer)
+			err = c.writeToAddr(conn, deadline, hopLimit, iface, ifaceAddr, raddr, dst, buffer)
 			if err != nil {
 				if isTemporary(err, deadline) {
 					if c.onWriteTimeout != nil {
@@ -308,11 +455,32 @@ LOOP:
 	return nil
 }
 
+// dialMulticastFromPort binds srcPort, which is shared with the socket receiving the responses. The socket is connected
+// to the multicast group, so the responses sent to srcPort are not delivered to it.
+func dialMulticastFromPort(ctx context.Context, srcPort int, raddr *net.UDPAddr) (*net.UDPConn, error) {
+	network := "udp4"
+	if IsIPv6(raddr.IP) {
+		network = "udp6"
+	}
+	d := net.Dialer{
+		LocalAddr: &net.UDPAddr{Port: srcPort},
+		Control:   reusePortControl,
+	}
+	conn, err := d.DialContext(ctx, network, raddr.String())
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.UDPConn), nil
+}
+
 // WriteWithContext writes data with context.
 func (c *UDPConn) WriteWithContext(ctx context.Context, raddr *net.UDPAddr, buffer []byte) error {
 	if raddr == nil {
 		return fmt.Errorf("cannot write with context: invalid raddr")
 	}
+	if c.dualStack != nil && IsIPv6(raddr.IP) {
+		return c.dualStack.ipv6.WriteWithContext(ctx, raddr, buffer)
+	}
 
 	written := 0
 	c.lock.Lock()
@@ -347,8 +515,112 @@ func (c *UDPConn) WriteWithContext(ctx context.Context, raddr *net.UDPAddr, buff
 	return nil
 }
 
+// WriteToWithSource writes data with context to the raddr. The src and ifIndex are passed to the socket
+// as control message so the packet leaves via the interface with index ifIndex and carries src as source address.
+// It is intended for unicast replies to requests received via multicast, where src must be the unicast address
+// of the interface which received the request, otherwise the client drops the reply. Nil src or zero ifIndex
+// lets the system choose.
+func (c *UDPConn) WriteToWithSource(ctx context.Context, raddr *net.UDPAddr, src net.IP, ifIndex int, buffer []byte) error {
+	if raddr == nil {
+		return fmt.Errorf("cannot write with source: invalid raddr")
+	}
+	if src != nil && (src.IsMulticast() || src.IsUnspecified()) {
+		return fmt.Errorf("cannot write with source: invalid source address %v", src)
+	}
+	if ifIndex < 0 {
+		return fmt.Errorf("cannot write with source: invalid interface index %v", ifIndex)
+	}
+	if c.dualStack != nil && IsIPv6(raddr.IP) {
+		return c.dualStack.ipv6.WriteToWithSource(ctx, raddr, src, ifIndex, buffer)
+	}
+	cm := &ControlMessage{
+		Src:     src,
+		IfIndex: ifIndex,
+	}
+
+	written := 0
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for written < len(buffer) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		deadline := time.Now().Add(c.heartBeat)
+		err := c.packetConn.SetWriteDeadline(deadline)
+		if err != nil {
+			return fmt.Errorf("cannot set write deadline for udp connection: %w", err)
+		}
+		n, err := c.packetConn.WriteTo(buffer[written:], cm, raddr)
+		if err != nil {
+			if isTemporary(err, deadline) {
+				if c.onWriteTimeout != nil {
+					err := c.onWriteTimeout()
+					if err != nil {
+						return fmt.Errorf("cannot write with source to udp connection: on timeout returns error: %w", err)
+					}
+				}
+				continue
+			}
+			return fmt.Errorf("cannot write with source to udp connection: %w", err)
+		}
+		written += n
+	}
+
+	return nil
+}
+
 // ReadWithContext reads packet with context.
 func (c *UDPConn) ReadWithContext(ctx context.Context, buffer []byte) (int, *net.UDPAddr, error) {
+	if c.dualStack != nil {
+		return c.readDualStack(ctx, buffer)
+	}
+	return c.readWithContext(ctx, buffer)
+}
+
+// ReadMsgWithContext reads packet with context as ReadWithContext and returns the control message
+// with the destination address and the interface index of the packet, eg. to recognize a multicast request.
+func (c *UDPConn) ReadMsgWithContext(ctx context.Context, buffer []byte) (int, *ControlMessage, *net.UDPAddr, error) {
+	if c.dualStack != nil {
+		return c.readMsgDualStack(ctx, buffer)
+	}
+	return c.readMsgWithContext(ctx, buffer)
+}
+
+func (c *UDPConn) enableControlMessage() error {
+	c.controlMessageOnce.Do(func() {
+		if err := c.packetConn.SetControlMessage(true); err != nil {
+			c.controlMessageErr = fmt.Errorf("cannot enable control message: %w", err)
+		}
+	})
+	return c.controlMessageErr
+}
+
+func (c *UDPConn) readMsgWithContext(ctx context.Context, buffer []byte) (int, *ControlMessage, *net.UDPAddr, error) {
+	if err := c.enableControlMessage(); err != nil {
+		return -1, nil, nil, err
+	}
+	var cm *ControlMessage
+	n, raddr, err := c.read(ctx, buffer, func(b []byte) (int, *net.UDPAddr, error) {
+		n, m, src, err := c.packetConn.ReadFrom(b)
+		cm = m
+		if err != nil {
+			return n, nil, err
+		}
+		return n, src.(*net.UDPAddr), nil
+	})
+	return n, cm, raddr, err
+}
+
+func (c *UDPConn) readWithContext(ctx context.Context, buffer []byte) (int, *net.UDPAddr, error) {
+	if c.readBatch != nil {
+		return c.read(ctx, buffer, c.readBatch.readFrom)
+	}
+	return c.read(ctx, buffer, c.connection.ReadFromUDP)
+}
+
+func (c *UDPConn) read(ctx context.Context, buffer []byte, readFrom func(b []byte) (int, *net.UDPAddr, error)) (int, *net.UDPAddr, error) {
 	for {
 		select {
 		case <-ctx.Done():
@@ -360,7 +632,7 @@ func (c *UDPConn) ReadWithContext(ctx context.Context, buffer []byte) (int, *net
 		if err != nil {
 			return -1, nil, fmt.Errorf("cannot set read deadline for udp connection: %w", err)
 		}
-		n, s, err := c.connection.ReadFromUDP(buffer)
+		n, s, err := readFrom(buffer)
 		if err != nil {
 			// check context in regular intervals and then resume listening
 			if isTemporary(err, deadline) {
@@ -374,6 +646,9 @@ func (c *UDPConn) ReadWithContext(ctx context.Context, buffer []byte) (int, *net
 			}
 			return -1, nil, fmt.Errorf("cannot read from udp connection: %w", err)
 		}
+		if c.packetFilter != nil && !c.packetFilter(Packet{Data: buffer[:n], Addr: s}) {
+			continue
+		}
 		return n, s, err
 	}
 }
@@ -381,9 +656,29 @@ func (c *UDPConn) ReadWithContext(ctx context.Context, buffer []byte) (int, *net
 // SetMulticastLoopback sets whether transmitted multicast packets
 // should be copied and send back to the originator.
 func (c *UDPConn) SetMulticastLoopback(on bool) error {
+	if c.dualStack != nil {
+		if err := c.dualStack.ipv6.SetMulticastLoopback(on); err != nil {
+			return err
+		}
+	}
 	return c.packetConn.SetMulticastLoopback(on)
 }
 
+// SetDSCP sets the Differentiated Services Code Point (0-63) of the outgoing packets: the TOS field for IPv4
+// and the traffic class for IPv6, the ECN bits are left zero. https://tools.ietf.org/html/rfc2474
+func (c *UDPConn) SetDSCP(value int) error {
+	if value < 0 || value > 63 {
+		return fmt.Errorf("cannot set DSCP: %w(%v)", ErrInvalidDSCP, value)
+	}
+	tc := value << 2
+	if c.dualStack != nil {
+		if err := c.dualStack.ipv6.SetDSCP(value); err != nil {
+			return err
+		}
+	}
+	return c.packetConn.SetTrafficClass(tc)
+}
+
 // JoinGroup joins the group address group on the interface ifi.
 // By default all sources that can cast data to group are accepted.
 // It's possible to mute and unmute data transmission from a specific
@@ -394,11 +689,17 @@ func (c *UDPConn) SetMulticastLoopback(on bool) error {
 // depends on platforms and sometimes it might require routing
 // configuration.
 func (c *UDPConn) JoinGroup(ifi *net.Interface, group net.Addr) error {
+	if c.dualStack != nil {
+		return c.groupConn(group).packetConn.JoinGroup(ifi, group)
+	}
 	return c.packetConn.JoinGroup(ifi, group)
 }
 
 // LeaveGroup leaves the group address group on the interface ifi
 // regardless of whether the group is any-source group or source-specific group.
 func (c *UDPConn) LeaveGroup(ifi *net.Interface, group net.Addr) error {
+	if c.dualStack != nil {
+		return c.groupConn(group).packetConn.LeaveGroup(ifi, group)
+	}
 	return c.packetConn.LeaveGroup(ifi, group)
 }
@@ -0,0 +1,76 @@
+package net
+
+import (
+	"net"
+	"sync"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// batchReader is implemented by ipv4.PacketConn and ipv6.PacketConn, their messages are the same type.
+type batchReader interface {
+	ReadBatch(ms []ipv4.Message, flags int) (int, error)
+}
+
+// readBatch receives up to len(msgs) datagrams by one syscall (recvmmsg on Linux, a single datagram elsewhere)
+// and hands them out one by one to ReadWithContext.
+type readBatch struct {
+	lock   sync.Mutex
+	reader batchReader
+	msgs   []ipv4.Message
+	next   int
+	count  int
+}
+
+func newReadBatch(c *net.UDPConn, size int) *readBatch {
+	var reader batchReader
+	if IsIPv6(c.LocalAddr().(*net.UDPAddr).IP) {
+		reader = ipv6.NewPacketConn(c)
+	} else {
+		reader = ipv4.NewPacketConn(c)
+	}
+	msgs := make([]ipv4.Message, size)
+	for i := range msgs {
+		msgs[i].Buffers = make([][]byte, 1)
+	}
+	return &readBatch{
+		reader: reader,
+		msgs:   msgs,
+	}
+}
+
+// readFrom returns the next received datagram, it reads the next batch from the socket when all were returned.
+// The datagram is truncated to the length of b as by ReadFromUDP.
+func (r *readBatch) readFrom(b []byte) (int, *net.UDPAddr, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for r.next >= r.count {
+		if err := r.fill(len(b)); err != nil {
+			return 0, nil, err
+		}
+	}
+	m := r.msgs[r.next]
+	r.next++
+	n := copy(b, m.Buffers[0][:m.N])
+	addr, _ := m.Addr.(*net.UDPAddr)
+	return n, addr, nil
+}
+
+func (r *readBatch) fill(bufSize int) error {
+	for i := range r.msgs {
+		if len(r.msgs[i].Buffers[0]) < bufSize {
+			r.msgs[i].Buffers[0] = make([]byte, bufSize)
+		}
+		r.msgs[i].N = 0
+		r.msgs[i].Addr = nil
+	}
+	r.next = 0
+	r.count = 0
+	n, err := r.reader.ReadBatch(r.msgs, 0)
+	if err != nil {
+		return err
+	}
+	r.count = n
+	return nil
+}
@@ -0,0 +1,160 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// dualStackReadBufferSize fits the biggest UDP datagram.
+const dualStackReadBufferSize = 64 * 1024
+
+// dualStackQueueSize bounds the packets read from the sockets which wait for ReadWithContext. When the queue is full
+// the readers stop reading, so further packets wait in the socket buffers instead of growing the memory.
+const dualStackQueueSize = 64
+
+type dualStackPacket struct {
+	data []byte
+	cm   *ControlMessage
+	addr *net.UDPAddr
+	err  error
+}
+
+// dualStack holds the IPv6 socket of the dual stack UDPConn, the UDPConn itself serves IPv4.
+type dualStack struct {
+	ipv6 *UDPConn
+
+	readOnce sync.Once
+	packets  chan dualStackPacket
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// NewListenUDPDualStack listens on addr by an IPv4 and an IPv6 socket which share the port, eg. ":5683".
+// The returned connection reads from both sockets and writes to the socket of the destination family,
+// so one server receives CoAP over IPv4 and IPv6 including multicast joined by JoinGroup.
+func NewListenUDPDualStack(addr string, opts ...UDPOption) (*UDPConn, error) {
+	ipv4Addr, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return nil, err
+	}
+	ipv4Conn, err := net.ListenUDP("udp4", ipv4Addr)
+	if err != nil {
+		return nil, err
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		_ = ipv4Conn.Close()
+		return nil, err
+	}
+	// the port chosen for the IPv4 socket is used by the IPv6 one too
+	port := ipv4Conn.LocalAddr().(*net.UDPAddr).Port
+	ipv6Addr, err := net.ResolveUDPAddr("udp6", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		_ = ipv4Conn.Close()
+		return nil, err
+	}
+	ipv6Conn, err := net.ListenUDP("udp6", ipv6Addr)
+	if err != nil {
+		_ = ipv4Conn.Close()
+		return nil, err
+	}
+	c := NewUDPConn("udp4", ipv4Conn, opts...)
+	ctx, cancel := context.WithCancel(context.Background())
+	c.dualStack = &dualStack{
+		ipv6:    NewUDPConn("udp6", ipv6Conn, opts...),
+		packets: make(chan dualStackPacket, dualStackQueueSize),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	c.network = "udp"
+	return c, nil
+}
+
+// forAddr returns the connection which serves the family of ip.
+func (c *UDPConn) forAddr(ip net.IP) *UDPConn {
+	if c.dualStack != nil && IsIPv6(ip) {
+		return c.dualStack.ipv6
+	}
+	return c
+}
+
+// groupConn returns the connection which serves the family of the multicast group.
+func (c *UDPConn) groupConn(group net.Addr) *UDPConn {
+	if a, ok := group.(*net.UDPAddr); ok {
+		return c.forAddr(a.IP)
+	}
+	if a, ok := group.(*net.IPAddr); ok {
+		return c.forAddr(a.IP)
+	}
+	return c
+}
+
+// readDualStack merges the packets read from both sockets.
+func (c *UDPConn) readDualStack(ctx context.Context, buffer []byte) (int, *net.UDPAddr, error) {
+	n, _, addr, err := c.readMsgDualStack(ctx, buffer)
+	return n, addr, err
+}
+
+func (c *UDPConn) readMsgDualStack(ctx context.Context, buffer []byte) (int, *ControlMessage, *net.UDPAddr, error) {
+	d := c.dualStack
+	d.readOnce.Do(func() {
+		go d.readLoop(c)
+		go d.readLoop(d.ipv6)
+	})
+	select {
+	case <-ctx.Done():
+		return -1, nil, nil, ctx.Err()
+	case p := <-d.packets:
+		if p.err != nil {
+			return -1, nil, nil, p.err
+		}
+		return copy(buffer, p.data), p.cm, p.addr, nil
+	}
+}
+
+func (d *dualStack) readLoop(c *UDPConn) {
+	buf := make([]byte, dualStackReadBufferSize)
+	read := c.readMsgWithContext
+	if err := c.enableControlMessage(); err != nil {
+		// the packets are still read, only without the control messages
+		c.errors(err)
+		read = func(ctx context.Context, buffer []byte) (int, *ControlMessage, *net.UDPAddr, error) {
+			n, addr, err := c.readWithContext(ctx, buffer)
+			return n, nil, addr, err
+		}
+	}
+	for {
+		n, cm, addr, err := read(d.ctx, buf)
+		var p dualStackPacket
+		if err != nil {
+			if d.ctx.Err() != nil {
+				return
+			}
+			p.err = err
+		} else {
+			p.data = append([]byte(nil), buf[:n]...)
+			p.cm = cm
+			p.addr = addr
+		}
+		select {
+		case d.packets <- p:
+		case <-d.ctx.Done():
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (d *dualStack) close() error {
+	d.cancel()
+	err := d.ipv6.Close()
+	if err != nil {
+		return fmt.Errorf("cannot close ipv6 socket: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package net
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func socketBuffer(t *testing.T, c *net.UDPConn, opt int) int {
+	raw, err := c.SyscallConn()
+	require.NoError(t, err)
+	var size int
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		size, sockErr = unix.GetsockoptInt(int(fd), unix.SOL_SOCKET, opt)
+	})
+	require.NoError(t, err)
+	require.NoError(t, sockErr)
+	return size
+}
+
+func TestUDPConn_SocketBuffers(t *testing.T) {
+	small, err := NewListenUDP("udp4", "127.0.0.1:0", WithReadBuffer(4096), WithWriteBuffer(4096))
+	require.NoError(t, err)
+	defer small.Close()
+	// the kernel may limit the size, but the bigger request must not end up with the smaller buffer
+	big, err := NewListenUDP("udp4", "127.0.0.1:0", WithReadBuffer(4*1024*1024), WithWriteBuffer(1024*1024))
+	require.NoError(t, err)
+	defer big.Close()
+
+	require.Greater(t, socketBuffer(t, big.connection, unix.SO_RCVBUF), socketBuffer(t, small.connection, unix.SO_RCVBUF))
+	require.Greater(t, socketBuffer(t, big.connection, unix.SO_SNDBUF), socketBuffer(t, small.connection, unix.SO_SNDBUF))
+
+	c, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	conn := NewUDPConn("udp4", c, WithReadBuffer(4096))
+	defer conn.Close()
+	require.Equal(t, socketBuffer(t, small.connection, unix.SO_RCVBUF), socketBuffer(t, conn.connection, unix.SO_RCVBUF))
+}
@@ -2,6 +2,7 @@ package net
 
 import (
 	"context"
+	"errors"
 	"net"
 	"strconv"
 	"sync"
@@ -10,6 +11,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
 )
 
 func TestUDPConn_WriteWithContext(t *testing.T) {
@@ -183,3 +186,405 @@ func TestUDPConn_writeMulticastWithContext(t *testing.T) {
 		})
 	}
 }
+
+func TestUDPConn_WriteMulticastHopLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		network string
+		group   string
+	}{
+		{name: "IPv4", network: "udp4", group: "224.0.1.187:5683"},
+		{name: "IPv6", network: "udp6", group: "[ff02::fd]:5683"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := net.ListenUDP(tt.network, nil)
+			if err != nil {
+				t.Skipf("%v is not supported: %v", tt.network, err)
+			}
+			c := NewUDPConn(tt.network, l, WithErrors(func(err error) { t.Log(err) }))
+			defer c.Close()
+			raddr, err := net.ResolveUDPAddr(tt.network, tt.group)
+			require.NoError(t, err)
+
+			for _, hopLimit := range []int{-1, MaxMulticastHopLimit + 1, 300} {
+				err = c.WriteMulticast(context.Background(), raddr, hopLimit, []byte("hello"))
+				require.Error(t, err)
+				require.True(t, errors.Is(err, ErrInvalidHopLimit))
+			}
+
+			if !hasMulticastInterface(t, tt.network == "udp6") {
+				t.Skip("there is no multicast interface")
+			}
+			for _, want := range []int{5, 1} {
+				err = c.WriteMulticast(context.Background(), raddr, want, []byte("hello"))
+				require.NoError(t, err)
+				var hopLimit int
+				if tt.network == "udp4" {
+					hopLimit, err = ipv4.NewPacketConn(l).MulticastTTL()
+				} else {
+					hopLimit, err = ipv6.NewPacketConn(l).MulticastHopLimit()
+				}
+				require.NoError(t, err)
+				require.Equal(t, want, hopLimit)
+			}
+		})
+	}
+}
+
+func hasMulticastInterface(t *testing.T, ipv6 bool) bool {
+	ifaces, err := net.Interfaces()
+	require.NoError(t, err)
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && IsIPv6(ipNet.IP) == ipv6 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestUDPConn_WriteToWithSource(t *testing.T) {
+	l1, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	require.NoError(t, err)
+	c1 := NewUDPConn("udp4", l1, WithHeartBeat(time.Millisecond*100), WithErrors(func(err error) { t.Log(err) }))
+	defer c1.Close()
+
+	l2, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	c2 := NewUDPConn("udp4", l2, WithHeartBeat(time.Millisecond*100), WithErrors(func(err error) { t.Log(err) }))
+	defer c2.Close()
+	raddr := l2.LocalAddr().(*net.UDPAddr)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err = c1.WriteToWithSource(ctx, nil, nil, 0, []byte("hello"))
+	require.Error(t, err)
+	err = c1.WriteToWithSource(ctx, raddr, net.IPv4(224, 0, 1, 187), 0, []byte("hello"))
+	require.Error(t, err)
+	err = c1.WriteToWithSource(ctx, raddr, net.IPv4zero, 0, []byte("hello"))
+	require.Error(t, err)
+
+	err = c1.WriteToWithSource(ctx, raddr, net.IPv4(127, 0, 0, 1), 0, []byte("hello"))
+	require.NoError(t, err)
+
+	b := make([]byte, 1024)
+	n, from, err := c2.ReadWithContext(ctx, b)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(b[:n]))
+	require.True(t, from.IP.Equal(net.IPv4(127, 0, 0, 1)))
+	require.Equal(t, l1.LocalAddr().(*net.UDPAddr).Port, from.Port)
+}
+
+func TestUDPConn_SetDSCP(t *testing.T) {
+	l4, err := NewListenUDP("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l4.Close()
+	err = l4.SetDSCP(64)
+	require.True(t, errors.Is(err, ErrInvalidDSCP))
+	err = l4.SetDSCP(-1)
+	require.True(t, errors.Is(err, ErrInvalidDSCP))
+	err = l4.SetDSCP(46)
+	require.NoError(t, err)
+	tos, err := ipv4.NewPacketConn(l4.connection).TOS()
+	require.NoError(t, err)
+	require.Equal(t, 46<<2, tos)
+
+	l6, err := NewListenUDP("udp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 is not available: %v", err)
+	}
+	defer l6.Close()
+	err = l6.SetDSCP(10)
+	require.NoError(t, err)
+	tc, err := ipv6.NewPacketConn(l6.connection).TrafficClass()
+	require.NoError(t, err)
+	require.Equal(t, 10<<2, tc)
+}
+
+func TestUDPConn_ReadMsgWithContext(t *testing.T) {
+	l, err := NewListenUDP("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	c, err := net.DialUDP("udp4", nil, l.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	defer c.Close()
+	_, err = c.Write([]byte("hello"))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	b := make([]byte, 1024)
+	n, cm, from, err := l.ReadMsgWithContext(ctx, b)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(b[:n]))
+	require.Equal(t, c.LocalAddr().(*net.UDPAddr).Port, from.Port)
+	require.NotNil(t, cm)
+	require.True(t, cm.Dst.Equal(net.IPv4(127, 0, 0, 1)))
+	require.False(t, cm.Dst.IsMulticast())
+}
+
+func TestUDPConn_ReusePort(t *testing.T) {
+	l1, err := NewListenUDP("udp4", "127.0.0.1:0", WithReusePort())
+	if errors.Is(err, ErrReusePortNotSupported) {
+		t.Skip(err)
+	}
+	require.NoError(t, err)
+	defer l1.Close()
+	l2, err := NewListenUDP("udp4", l1.LocalAddr().String(), WithReusePort())
+	require.NoError(t, err)
+	defer l2.Close()
+
+	// without the option the address is in use
+	_, err = NewListenUDP("udp4", l1.LocalAddr().String())
+	require.Error(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	received := make([]int, 2)
+	for i, l := range []*UDPConn{l1, l2} {
+		wg.Add(1)
+		go func(i int, l *UDPConn) {
+			defer wg.Done()
+			buf := make([]byte, 16)
+			for {
+				_, _, err := l.ReadWithContext(ctx, buf)
+				if err != nil {
+					return
+				}
+				received[i]++
+			}
+		}(i, l)
+	}
+
+	// the kernel picks the socket by the hash of the source address, so send from many sockets
+	for i := 0; i < 64; i++ {
+		c, err := net.DialUDP("udp4", nil, l1.LocalAddr().(*net.UDPAddr))
+		require.NoError(t, err)
+		_, err = c.Write([]byte{byte(i)})
+		require.NoError(t, err)
+		err = c.Close()
+		require.NoError(t, err)
+	}
+	time.Sleep(time.Millisecond * 300)
+	cancel()
+	wg.Wait()
+	assert.Greater(t, received[0], 0)
+	assert.Greater(t, received[1], 0)
+	assert.Equal(t, 64, received[0]+received[1])
+}
+
+func TestUDPConn_WriteMulticastFromPort(t *testing.T) {
+	if !hasMulticastInterface(t, false) {
+		t.Skip("there is no multicast interface")
+	}
+	group, err := net.ResolveUDPAddr("udp4", "224.0.1.187:5697")
+	require.NoError(t, err)
+
+	// receiver of the responses shares the source port with the sender
+	l, err := NewListenUDP("udp4", ":0", WithReusePort())
+	if errors.Is(err, ErrReusePortNotSupported) {
+		t.Skip(err)
+	}
+	require.NoError(t, err)
+	defer l.Close()
+	srcPort := l.LocalAddr().(*net.UDPAddr).Port
+
+	lr, err := net.ListenUDP("udp4", &net.UDPAddr{Port: group.Port})
+	require.NoError(t, err)
+	responder := NewUDPConn("udp4", lr, WithErrors(func(err error) { t.Log(err) }))
+	defer responder.Close()
+	ifaces, err := net.Interfaces()
+	require.NoError(t, err)
+	for _, iface := range ifaces {
+		ifa := iface
+		if err := responder.JoinGroup(&ifa, group); err != nil {
+			t.Logf("cannot join group %v: %v", ifa.Name, err)
+		}
+	}
+	err = responder.SetMulticastLoopback(true)
+	require.NoError(t, err)
+
+	ls, err := net.ListenUDP("udp4", nil)
+	require.NoError(t, err)
+	sender := NewUDPConn("udp4", ls, WithErrors(func(err error) { t.Log(err) }))
+	defer sender.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		buf := make([]byte, 16)
+		for {
+			n, from, err := responder.ReadWithContext(ctx, buf)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, srcPort, from.Port)
+			err = responder.WriteWithContext(ctx, from, append([]byte("re:"), buf[:n]...))
+			assert.NoError(t, err)
+		}
+	}()
+
+	err = sender.WriteMulticastFromPort(ctx, srcPort, group, 1, []byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 16)
+	n, _, err := l.ReadWithContext(ctx, buf)
+	require.NoError(t, err)
+	require.Equal(t, []byte("re:ping"), buf[:n])
+	cancel()
+}
+
+func TestUDPConn_WriteMulticastSource(t *testing.T) {
+	if !hasMulticastInterface(t, false) {
+		t.Skip("there is no multicast interface")
+	}
+	group, err := net.ResolveUDPAddr("udp4", "224.0.1.187:5698")
+	require.NoError(t, err)
+
+	lr, err := net.ListenUDP("udp4", &net.UDPAddr{Port: group.Port})
+	require.NoError(t, err)
+	receiver := NewUDPConn("udp4", lr, WithErrors(func(err error) { t.Log(err) }))
+	defer receiver.Close()
+	ifaces, err := net.Interfaces()
+	require.NoError(t, err)
+	ifaceIPs := make(map[string]bool)
+	for _, iface := range ifaces {
+		ifa := iface
+		if err := receiver.JoinGroup(&ifa, group); err != nil {
+			t.Logf("cannot join group %v: %v", ifa.Name, err)
+		}
+		if iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		require.NoError(t, err)
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				ifaceIPs[ipNet.IP.String()] = true
+			}
+		}
+	}
+	err = receiver.SetMulticastLoopback(true)
+	require.NoError(t, err)
+
+	ls, err := net.ListenUDP("udp4", nil)
+	require.NoError(t, err)
+	sender := NewUDPConn("udp4", ls, WithErrors(func(err error) { t.Log(err) }))
+	defer sender.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	err = sender.WriteMulticast(ctx, group, 1, []byte("hello"))
+	require.NoError(t, err)
+	buf := make([]byte, 16)
+	n, from, err := receiver.ReadWithContext(ctx, buf)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), buf[:n])
+	// the source is an address of the multicast interface and the port of the connection
+	require.Equal(t, ls.LocalAddr().(*net.UDPAddr).Port, from.Port)
+	require.True(t, ifaceIPs[from.IP.String()], "unexpected source %v", from)
+}
+
+func TestUDPConn_ReadBatch(t *testing.T) {
+	l, err := NewListenUDP("udp4", "127.0.0.1:0", WithReadBatch(8), WithPacketFilter(func(p Packet) bool {
+		return string(p.Data) != "drop"
+	}))
+	require.NoError(t, err)
+	defer l.Close()
+
+	c, err := net.DialUDP("udp4", nil, l.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	defer c.Close()
+	var want []string
+	for i := 0; i < 20; i++ {
+		data := "hello" + strconv.Itoa(i)
+		if i == 5 {
+			_, err = c.Write([]byte("drop"))
+			require.NoError(t, err)
+		}
+		_, err = c.Write([]byte(data))
+		require.NoError(t, err)
+		want = append(want, data)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for _, w := range want {
+		b := make([]byte, 1024)
+		n, from, err := l.ReadWithContext(ctx, b)
+		require.NoError(t, err)
+		require.Equal(t, w, string(b[:n]))
+		require.Equal(t, c.LocalAddr().(*net.UDPAddr).Port, from.Port)
+	}
+
+	// the datagram is truncated to the buffer
+	_, err = c.Write([]byte("hello world"))
+	require.NoError(t, err)
+	b := make([]byte, 5)
+	n, _, err := l.ReadWithContext(ctx, b)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(b[:n]))
+}
+
+func BenchmarkUDPConn_ReadWithContext(b *testing.B) {
+	for _, bench := range []struct {
+		name string
+		opts []UDPOption
+	}{
+		{name: "single"},
+		{name: "batch", opts: []UDPOption{WithReadBatch(32)}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			l, err := NewListenUDP("udp4", "127.0.0.1:0", append(bench.opts, WithReadBuffer(4*1024*1024))...)
+			require.NoError(b, err)
+			defer l.Close()
+			c, err := net.DialUDP("udp4", nil, l.LocalAddr().(*net.UDPAddr))
+			require.NoError(b, err)
+			defer c.Close()
+
+			done := make(chan struct{})
+			var wg sync.WaitGroup
+			defer wg.Wait()
+			defer close(done)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// the sender keeps sending, so the lost datagrams don't stall the reader
+				data := make([]byte, 64)
+				for {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					_, _ = c.Write(data)
+				}
+			}()
+
+			ctx := context.Background()
+			buf := make([]byte, 1500)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, _, err := l.ReadWithContext(ctx, buf)
+				require.NoError(b, err)
+			}
+		})
+	}
+}
@@ -25,8 +25,10 @@ type DTLSListener struct {
 	connCh    chan connData
 	onTimeout func() error
 
-	cancel context.CancelFunc
-	mutex  sync.Mutex
+	// handshakes cancels the pending handshakes on close
+	handshakes  map[uint64]context.CancelFunc
+	handshakeID uint64
+	mutex       sync.Mutex
 
 	closed   uint32
 	deadline atomic.Value
@@ -53,12 +55,16 @@ func (l *DTLSListener) acceptLoop() {
 }
 
 var defaultDTLSListenerOptions = dtlsListenerOptions{
-	heartBeat: time.Millisecond * 200,
+	heartBeat:               time.Millisecond * 200,
+	handshakeTimeout:        30 * time.Second,
+	maxConcurrentHandshakes: 1,
 }
 
 type dtlsListenerOptions struct {
-	heartBeat time.Duration
-	onTimeout func() error
+	heartBeat               time.Duration
+	onTimeout               func() error
+	handshakeTimeout        time.Duration
+	maxConcurrentHandshakes int
 }
 
 // A DTLSListenerOption sets options such as heartBeat parameters, etc.
@@ -78,27 +84,44 @@ func NewDTLSListener(network string, addr string, dtlsCfg *dtls.Config, opts ...
 	if err != nil {
 		return nil, fmt.Errorf("cannot resolve address: %w", err)
 	}
+	if cfg.maxConcurrentHandshakes < 1 {
+		cfg.maxConcurrentHandshakes = 1
+	}
 	l := DTLSListener{
-		heartBeat: cfg.heartBeat,
-		connCh:    make(chan connData),
-		doneCh:    make(chan struct{}),
+		heartBeat:  cfg.heartBeat,
+		connCh:     make(chan connData),
+		doneCh:     make(chan struct{}),
+		handshakes: make(map[uint64]context.CancelFunc),
 	}
 
 	connectContextMaker := dtlsCfg.ConnectContextMaker
 	if connectContextMaker == nil {
 		connectContextMaker = func() (context.Context, func()) {
-			return context.WithTimeout(context.Background(), 30*time.Second)
+			return context.Background(), func() {}
 		}
 	}
 	dtlsCfg.ConnectContextMaker = func() (context.Context, func()) {
-		ctx, cancel := connectContextMaker()
+		ctx, cancelMaker := connectContextMaker()
+		ctx, cancelTimeout := context.WithTimeout(ctx, cfg.handshakeTimeout)
+		cancel := func() {
+			cancelTimeout()
+			cancelMaker()
+		}
 		l.mutex.Lock()
 		defer l.mutex.Unlock()
 		if l.closed > 0 {
 			cancel()
+			return ctx, cancel
+		}
+		id := l.handshakeID
+		l.handshakeID++
+		l.handshakes[id] = cancel
+		return ctx, func() {
+			cancel()
+			l.mutex.Lock()
+			defer l.mutex.Unlock()
+			delete(l.handshakes, id)
 		}
-		l.cancel = cancel
-		return ctx, cancel
 	}
 
 	listener, err := dtls.Listen(network, a, dtlsCfg)
@@ -106,9 +129,11 @@ func NewDTLSListener(network string, addr string, dtlsCfg *dtls.Config, opts ...
 		return nil, fmt.Errorf("cannot create new dtls listener: %w", err)
 	}
 	l.listener = listener
-	l.wg.Add(1)
-
-	go l.acceptLoop()
+	// every accept loop performs one handshake at a time
+	l.wg.Add(cfg.maxConcurrentHandshakes)
+	for i := 0; i < cfg.maxConcurrentHandshakes; i++ {
+		go l.acceptLoop()
+	}
 
 	return &l, nil
 }
@@ -131,6 +156,9 @@ func (l *DTLSListener) AcceptWithContext(ctx context.Context) (net.Conn, error)
 		}
 		rw, err := l.Accept()
 		if err != nil {
+			if atomic.LoadUint32(&l.closed) == 1 {
+				return nil, ErrListenerIsClosed
+			}
 			// check context in regular intervals and then resume listening
 			if isTemporary(err, deadline) {
 				if l.onTimeout != nil {
@@ -168,6 +196,8 @@ func (l *DTLSListener) Accept() (net.Conn, error) {
 				return nil, d.err
 			}
 			return d.conn, nil
+		case <-l.doneCh:
+			return nil, ErrListenerIsClosed
 		}
 	}
 
@@ -177,6 +207,8 @@ func (l *DTLSListener) Accept() (net.Conn, error) {
 			return nil, d.err
 		}
 		return d.conn, nil
+	case <-l.doneCh:
+		return nil, ErrListenerIsClosed
 	case <-time.After(deadline.Sub(time.Now())):
 		return nil, fmt.Errorf(ioTimeout)
 	}
@@ -188,10 +220,11 @@ func (l *DTLSListener) close() (bool, error) {
 	if l.closed > 0 {
 		return false, nil
 	}
+	atomic.StoreUint32(&l.closed, 1)
 	close(l.doneCh)
 	err := l.listener.Close()
-	if l.cancel != nil {
-		l.cancel()
+	for _, cancel := range l.handshakes {
+		cancel()
 	}
 	return true, err
 }
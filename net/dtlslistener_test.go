@@ -0,0 +1,66 @@
+package net
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	dtls "github.com/pion/dtls/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDTLSListener_HandshakeFlood(t *testing.T) {
+	psk := func(hint []byte) ([]byte, error) {
+		return []byte{0xAB, 0xC1, 0x23}, nil
+	}
+	newConfig := func() *dtls.Config {
+		return &dtls.Config{
+			PSK:             psk,
+			PSKIdentityHint: []byte("Pion DTLS Server"),
+			CipherSuites:    []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_CCM_8},
+		}
+	}
+	const handshakeTimeout = time.Millisecond * 500
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	l, err := NewDTLSListener("udp4", "127.0.0.1:0", newConfig(), WithHandshakeTimeout(handshakeTimeout), WithMaxConcurrentHandshakes(2))
+	require.NoError(t, err)
+	defer l.Close()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			c, err := l.AcceptWithContext(context.Background())
+			if err != nil {
+				if err == ErrListenerIsClosed {
+					return
+				}
+				continue
+			}
+			c.Close()
+		}
+	}()
+
+	// the peers start the handshake but they never complete it
+	for i := 0; i < 4; i++ {
+		c, err := net.DialUDP("udp4", nil, l.Addr().(*net.UDPAddr))
+		require.NoError(t, err)
+		defer c.Close()
+		// record of the handshake content type, DTLS 1.2, epoch 0, sequence number 0, with one byte of the fragment
+		_, err = c.Write([]byte{22, 0xfe, 0xfd, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 1})
+		require.NoError(t, err)
+	}
+	time.Sleep(time.Millisecond * 100)
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	c, err := dtls.DialWithContext(ctx, "udp4", l.Addr().(*net.UDPAddr), newConfig())
+	require.NoError(t, err)
+	defer c.Close()
+	// two rounds of the stalled handshakes are abandoned before the handshake of the client starts
+	require.GreaterOrEqual(t, int64(time.Since(start)), int64(handshakeTimeout))
+}
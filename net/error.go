@@ -1,5 +1,45 @@
 package net
 
-import "errors"
+import (
+	"context"
+	"errors"
+)
 
-var ErrListenerIsClosed = errors.New("listen socket was closed")
+var (
+	ErrListenerIsClosed = errors.New("listen socket was closed")
+	ErrInvalidHopLimit  = errors.New("invalid hop limit")
+	// ErrInvalidDSCP is returned by UDPConn.SetDSCP when the value is out of 0-63.
+	ErrInvalidDSCP = errors.New("invalid DSCP")
+	// ErrTimeout is reported when a request isn't answered in time, eg. the retransmissions were exhausted
+	// or the deadline of the request context was exceeded.
+	ErrTimeout = errors.New("timeout")
+	// ErrConnReset is reported when the peer rejected the request by the Reset message or aborted the connection.
+	ErrConnReset = errors.New("connection reset by peer")
+	// ErrReusePortNotSupported is returned by NewListenUDP with WithReusePort on the platforms without SO_REUSEPORT.
+	ErrReusePortNotSupported = errors.New("SO_REUSEPORT is not supported on this platform")
+)
+
+type timeoutError struct {
+	err error
+}
+
+func (e timeoutError) Error() string {
+	return ErrTimeout.Error() + ": " + e.err.Error()
+}
+
+func (e timeoutError) Unwrap() error {
+	return e.err
+}
+
+func (e timeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+// ContextError converts the error of a request context, so an exceeded deadline matches ErrTimeout
+// as well as context.DeadlineExceeded. Other errors are returned as they are.
+func ContextError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, ErrTimeout) {
+		return timeoutError{err: err}
+	}
+	return err
+}
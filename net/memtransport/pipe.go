@@ -0,0 +1,232 @@
+// Package memtransport provides an in-memory datagram transport, which connects a client with a server
+// without the network stack. It's intended for deterministic tests and benchmarks, loss and delay
+// of the datagrams can be injected per direction.
+package memtransport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+)
+
+// ErrClosed is returned by operations of the closed connection.
+var ErrClosed = errors.New("use of closed connection")
+
+// queueSize is number of datagrams which can wait to be read, further datagrams are dropped like by a full socket buffer.
+const queueSize = 256
+
+type addr string
+
+func (a addr) Network() string {
+	return "mem"
+}
+
+func (a addr) String() string {
+	return string(a)
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var lastPipeID uint32
+
+// Conn is one end of the pipe. It implements net.Conn which preserves boundaries of datagrams,
+// every Write is delivered by exactly one Read of the peer.
+type Conn struct {
+	local  addr
+	remote addr
+	in     chan []byte
+	peer   *Conn
+
+	done      chan struct{}
+	closeOnce sync.Once
+
+	lock         sync.Mutex
+	drop         func(datagram []byte) bool
+	delay        time.Duration
+	readDeadline time.Time
+}
+
+// Pipe creates the connected pair of connections, eg. for the client and the server.
+func Pipe() (*Conn, *Conn) {
+	id := atomic.AddUint32(&lastPipeID, 1)
+	a := newConn(addr(fmt.Sprintf("pipe-%v-a", id)), addr(fmt.Sprintf("pipe-%v-b", id)))
+	b := newConn(a.remote, a.local)
+	a.peer = b
+	b.peer = a
+	return a, b
+}
+
+func newConn(local, remote addr) *Conn {
+	return &Conn{
+		local:  local,
+		remote: remote,
+		in:     make(chan []byte, queueSize),
+		done:   make(chan struct{}),
+	}
+}
+
+// SetDrop sets the function which decides whether the datagram written to the connection is lost.
+// It is called for every written datagram, nil disables the loss.
+func (c *Conn) SetDrop(drop func(datagram []byte) bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.drop = drop
+}
+
+// SetDelay delays the delivery of the datagrams written to the connection.
+func (c *Conn) SetDelay(delay time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.delay = delay
+}
+
+// Read reads one datagram, the rest of the datagram which doesn't fit to b is discarded.
+func (c *Conn) Read(b []byte) (int, error) {
+	c.lock.Lock()
+	deadline := c.readDeadline
+	c.lock.Unlock()
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case datagram := <-c.in:
+		return copy(b, datagram), nil
+	case <-c.done:
+		return 0, ErrClosed
+	case <-c.peer.done:
+		return 0, io.EOF
+	case <-timeout:
+		return 0, timeoutError{}
+	}
+}
+
+// Write sends b as one datagram to the peer.
+func (c *Conn) Write(b []byte) (int, error) {
+	select {
+	case <-c.done:
+		return 0, ErrClosed
+	default:
+	}
+	c.lock.Lock()
+	drop := c.drop
+	delay := c.delay
+	c.lock.Unlock()
+	datagram := append([]byte(nil), b...)
+	if drop != nil && drop(datagram) {
+		return len(b), nil
+	}
+	if delay > 0 {
+		time.AfterFunc(delay, func() {
+			c.peer.deliver(datagram)
+		})
+		return len(b), nil
+	}
+	c.peer.deliver(datagram)
+	return len(b), nil
+}
+
+func (c *Conn) deliver(datagram []byte) {
+	select {
+	case c.in <- datagram:
+	default:
+	}
+}
+
+// Close closes the connection, the peer reads io.EOF.
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	return nil
+}
+
+// LocalAddr returns the local address.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.local
+}
+
+// RemoteAddr returns the address of the peer.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// SetDeadline sets the read deadline, writes never block.
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.readDeadline = t
+	return nil
+}
+
+// SetReadDeadline sets the deadline for Read.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.readDeadline = t
+	return nil
+}
+
+// SetWriteDeadline does nothing, writes never block.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// Listener accepts server ends of the pipes created by Dial.
+type Listener struct {
+	conns     chan *Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewListener creates the listener.
+func NewListener() *Listener {
+	return &Listener{
+		conns: make(chan *Conn, queueSize),
+		done:  make(chan struct{}),
+	}
+}
+
+// Dial creates the pipe and returns its client end, the server end is accepted by the listener.
+func (l *Listener) Dial() (*Conn, error) {
+	client, server := Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.done:
+		return nil, coapNet.ErrListenerIsClosed
+	}
+}
+
+// AcceptWithContext waits for the server end of the next pipe.
+func (l *Listener) AcceptWithContext(ctx context.Context) (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, coapNet.ErrListenerIsClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close closes the listener.
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+	})
+	return nil
+}
@@ -0,0 +1,98 @@
+package memtransport_test
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/dtls"
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/net/memtransport"
+	"github.com/plgd-dev/go-coap/v2/udp/client"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipe(t *testing.T) {
+	a, b := memtransport.Pipe()
+	defer a.Close()
+	require.Equal(t, a.LocalAddr(), b.RemoteAddr())
+
+	_, err := a.Write([]byte("first"))
+	require.NoError(t, err)
+	_, err = a.Write([]byte("second"))
+	require.NoError(t, err)
+	buf := make([]byte, 16)
+	n, err := b.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "first", string(buf[:n]))
+	n, err = b.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "second", string(buf[:n]))
+
+	err = b.SetReadDeadline(time.Now().Add(time.Millisecond * 10))
+	require.NoError(t, err)
+	_, err = b.Read(buf)
+	require.Error(t, err)
+	require.True(t, err.(interface{ Timeout() bool }).Timeout())
+
+	a.SetDrop(func([]byte) bool { return true })
+	_, err = a.Write([]byte("lost"))
+	require.NoError(t, err)
+	a.SetDrop(nil)
+	a.SetDelay(time.Millisecond * 20)
+	start := time.Now()
+	_, err = a.Write([]byte("delayed"))
+	require.NoError(t, err)
+	err = b.SetReadDeadline(time.Time{})
+	require.NoError(t, err)
+	n, err = b.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "delayed", string(buf[:n]))
+	require.GreaterOrEqual(t, int64(time.Since(start)), int64(time.Millisecond*20))
+
+	err = a.Close()
+	require.NoError(t, err)
+	_, err = b.Read(buf)
+	require.Equal(t, io.EOF, err)
+}
+
+func TestPipe_Retransmission(t *testing.T) {
+	l := memtransport.NewListener()
+	defer l.Close()
+
+	s := dtls.NewServer(dtls.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, nil)
+		require.NoError(t, err)
+	}))
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	conn, err := l.Dial()
+	require.NoError(t, err)
+	var transmissions int32
+	// the first 2 transmissions of the request are lost
+	conn.SetDrop(func([]byte) bool {
+		return atomic.AddInt32(&transmissions, 1) <= 2
+	})
+	cc := dtls.Client(conn, dtls.WithTransmission(1, time.Millisecond*50, 4))
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	require.Equal(t, int32(3), atomic.LoadInt32(&transmissions))
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"sync/atomic"
 	"time"
+
+	"github.com/plgd-dev/go-coap/v2/net/clock"
 )
 
 type Monitor = interface {
@@ -21,12 +23,15 @@ type ClientConn = interface {
 type inactivityMonitor struct {
 	duration   time.Duration
 	onInactive OnInactiveFunc
+	// periodic starts a new period when onInactive is called
+	periodic bool
+	clock    clock.Clock
 	// lastActivity stores time.Time
 	lastActivity atomic.Value
 }
 
 func (m *inactivityMonitor) Notify() {
-	m.lastActivity.Store(time.Now())
+	m.lastActivity.Store(m.clock.Now())
 }
 
 func (m *inactivityMonitor) LastActivity() time.Time {
@@ -40,10 +45,23 @@ func CloseClientConn(cc ClientConn) {
 	cc.Close()
 }
 
+// NewInactivityMonitor creates monitor which calls onInactive by every check when the connection was inactive for duration.
 func NewInactivityMonitor(duration time.Duration, onInactive OnInactiveFunc) Monitor {
+	return newInactivityMonitor(duration, onInactive, false, clock.Real)
+}
+
+// NewPeriodicInactivityMonitor creates monitor which calls onInactive once per duration of inactivity,
+// the next call follows after another duration without activity.
+func NewPeriodicInactivityMonitor(duration time.Duration, onInactive OnInactiveFunc) Monitor {
+	return newInactivityMonitor(duration, onInactive, true, clock.Real)
+}
+
+func newInactivityMonitor(duration time.Duration, onInactive OnInactiveFunc, periodic bool, c clock.Clock) *inactivityMonitor {
 	m := &inactivityMonitor{
 		duration:   duration,
 		onInactive: onInactive,
+		periodic:   periodic,
+		clock:      c,
 	}
 	m.Notify()
 	return m
@@ -53,8 +71,11 @@ func (m *inactivityMonitor) CheckInactivity(cc ClientConn) {
 	if m.onInactive == nil || m.duration == time.Duration(0) {
 		return
 	}
-	if time.Until(m.LastActivity().Add(m.duration)) <= 0 {
+	if m.clock.Now().Sub(m.LastActivity()) >= m.duration {
 		m.onInactive(cc)
+		if m.periodic {
+			m.Notify()
+		}
 	}
 }
 
@@ -70,3 +91,22 @@ func (m *nilMonitor) Notify() {
 func NewNilMonitor() Monitor {
 	return &nilMonitor{}
 }
+
+type multiMonitor []Monitor
+
+func (m multiMonitor) CheckInactivity(cc ClientConn) {
+	for _, monitor := range m {
+		monitor.CheckInactivity(cc)
+	}
+}
+
+func (m multiMonitor) Notify() {
+	for _, monitor := range m {
+		monitor.Notify()
+	}
+}
+
+// NewMultiMonitor creates monitor which forwards notifications and checks to all monitors.
+func NewMultiMonitor(monitors ...Monitor) Monitor {
+	return multiMonitor(monitors)
+}
@@ -0,0 +1,55 @@
+package inactivity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/net/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInactivityMonitor(t *testing.T) {
+	const duration = time.Second
+	fakeClock := clock.NewFake(time.Now())
+	var calls int
+	m := newInactivityMonitor(duration, func(cc ClientConn) { calls++ }, false, fakeClock)
+	m.CheckInactivity(nil)
+	require.Equal(t, 0, calls)
+
+	// onInactive is called by every check after the duration
+	fakeClock.Advance(duration)
+	m.CheckInactivity(nil)
+	m.CheckInactivity(nil)
+	require.Equal(t, 2, calls)
+
+	m.Notify()
+	m.CheckInactivity(nil)
+	require.Equal(t, 2, calls)
+}
+
+func TestPeriodicInactivityMonitor_KeepAlive(t *testing.T) {
+	const interval = time.Second
+	const maxRetries = 2
+	fakeClock := clock.NewFake(time.Now())
+	var pings int
+	var failed bool
+	keepalive := NewKeepAlive(maxRetries, func(cc ClientConn) {
+		failed = true
+	}, func(cc ClientConn, receivePong func()) (func(), error) {
+		// the dead peer never answers
+		pings++
+		return func() {}, nil
+	})
+	m := newInactivityMonitor(interval, keepalive.OnInactive, true, fakeClock)
+
+	// the heartbeat checks the monitor more often than the interval
+	const heartBeat = interval / 10
+	for elapsed := time.Duration(0); elapsed < interval*(maxRetries+1); elapsed += heartBeat {
+		m.CheckInactivity(nil)
+		require.False(t, failed, "detected too early: %v", elapsed)
+		fakeClock.Advance(heartBeat)
+	}
+	m.CheckInactivity(nil)
+	require.True(t, failed)
+	require.Equal(t, maxRetries, pings)
+}
@@ -0,0 +1,103 @@
+package stats
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+)
+
+// NumCodeClasses is number of code classes, class is 3 most significant bits of code: https://tools.ietf.org/html/rfc7252#section-3
+const NumCodeClasses = 8
+
+// Stats contains counters of a connection.
+type Stats struct {
+	BytesSent     uint64
+	BytesReceived uint64
+	// MessagesSent counts sent messages by code class, eg. MessagesSent[2] counts 2.xx responses.
+	MessagesSent [NumCodeClasses]uint64
+	// MessagesReceived counts received messages by code class, eg. MessagesReceived[4] counts 4.xx responses.
+	MessagesReceived [NumCodeClasses]uint64
+	Retransmissions  uint64
+	// RTT is smoothed round-trip time, zero when it was not measured yet.
+	RTT time.Duration
+	// LastReceived is the time of the last received message, zero when nothing was received yet.
+	LastReceived time.Time
+}
+
+// Counters collects statistics of a connection. It is safe for concurrent use.
+type Counters struct {
+	// These fields need to be the first in the struct to ensure proper word alignment on 32-bit platforms.
+	// See: https://golang.org/pkg/sync/atomic/#pkg-note-BUG
+	bytesSent        uint64
+	bytesReceived    uint64
+	messagesSent     [NumCodeClasses]uint64
+	messagesReceived [NumCodeClasses]uint64
+	retransmissions  uint64
+	rtt              int64
+	lastReceived     int64
+}
+
+// NewCounters creates counters.
+func NewCounters() *Counters {
+	return &Counters{}
+}
+
+func codeClass(code codes.Code) int {
+	return int(code>>5) % NumCodeClasses
+}
+
+// MessageSent counts sent message of size in bytes.
+func (c *Counters) MessageSent(code codes.Code, size int) {
+	atomic.AddUint64(&c.messagesSent[codeClass(code)], 1)
+	atomic.AddUint64(&c.bytesSent, uint64(size))
+}
+
+// MessageReceived counts received message of size in bytes.
+func (c *Counters) MessageReceived(code codes.Code, size int) {
+	atomic.AddUint64(&c.messagesReceived[codeClass(code)], 1)
+	atomic.AddUint64(&c.bytesReceived, uint64(size))
+	atomic.StoreInt64(&c.lastReceived, time.Now().UnixNano())
+}
+
+// Retransmission counts retransmission of a message.
+func (c *Counters) Retransmission() {
+	atomic.AddUint64(&c.retransmissions, 1)
+}
+
+// UpdateRTT updates smoothed round-trip time by measured sample, as SRTT in https://tools.ietf.org/html/rfc6298#section-2.
+func (c *Counters) UpdateRTT(sample time.Duration) {
+	for {
+		old := atomic.LoadInt64(&c.rtt)
+		rtt := int64(sample)
+		if old != 0 {
+			rtt = old - old/8 + int64(sample)/8
+		}
+		if atomic.CompareAndSwapInt64(&c.rtt, old, rtt) {
+			return
+		}
+	}
+}
+
+// RTT returns smoothed round-trip time.
+func (c *Counters) RTT() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.rtt))
+}
+
+// Stats returns snapshot of counters.
+func (c *Counters) Stats() Stats {
+	s := Stats{
+		BytesSent:       atomic.LoadUint64(&c.bytesSent),
+		BytesReceived:   atomic.LoadUint64(&c.bytesReceived),
+		Retransmissions: atomic.LoadUint64(&c.retransmissions),
+		RTT:             c.RTT(),
+	}
+	if lastReceived := atomic.LoadInt64(&c.lastReceived); lastReceived != 0 {
+		s.LastReceived = time.Unix(0, lastReceived)
+	}
+	for i := range s.MessagesSent {
+		s.MessagesSent[i] = atomic.LoadUint64(&c.messagesSent[i])
+		s.MessagesReceived[i] = atomic.LoadUint64(&c.messagesReceived[i])
+	}
+	return s
+}
@@ -0,0 +1,139 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/stretchr/testify/require"
+)
+
+type countedMessage struct {
+	code codes.Code
+	size int
+}
+
+func TestCounters_Messages(t *testing.T) {
+	tests := []struct {
+		name     string
+		sent     []countedMessage
+		received []countedMessage
+		want     Stats
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:     "request and response",
+			sent:     []countedMessage{{codes.GET, 10}},
+			received: []countedMessage{{codes.Content, 25}},
+			want: Stats{
+				BytesSent:        10,
+				BytesReceived:    25,
+				MessagesSent:     [NumCodeClasses]uint64{0: 1},
+				MessagesReceived: [NumCodeClasses]uint64{2: 1},
+			},
+		},
+		{
+			name:     "classes",
+			sent:     []countedMessage{{codes.POST, 100}, {codes.PUT, 50}, {codes.Empty, 4}, {codes.Created, 8}},
+			received: []countedMessage{{codes.NotFound, 6}, {codes.BadRequest, 6}, {codes.InternalServerError, 7}, {codes.Changed, 9}},
+			want: Stats{
+				BytesSent:        162,
+				BytesReceived:    28,
+				MessagesSent:     [NumCodeClasses]uint64{0: 3, 2: 1},
+				MessagesReceived: [NumCodeClasses]uint64{2: 1, 4: 2, 5: 1},
+			},
+		},
+		{
+			name:     "signals",
+			sent:     []countedMessage{{codes.CSM, 2}, {codes.Ping, 1}},
+			received: []countedMessage{{codes.Pong, 1}},
+			want: Stats{
+				BytesSent:        3,
+				BytesReceived:    1,
+				MessagesSent:     [NumCodeClasses]uint64{7: 2},
+				MessagesReceived: [NumCodeClasses]uint64{7: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCounters()
+			for _, m := range tt.sent {
+				c.MessageSent(m.code, m.size)
+			}
+			for _, m := range tt.received {
+				c.MessageReceived(m.code, m.size)
+			}
+			got := c.Stats()
+			require.Equal(t, len(tt.received) > 0, !got.LastReceived.IsZero())
+			got.LastReceived = time.Time{}
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCounters_Retransmissions(t *testing.T) {
+	tests := []struct {
+		name            string
+		retransmissions int
+	}{
+		{name: "none", retransmissions: 0},
+		{name: "one", retransmissions: 1},
+		{name: "many", retransmissions: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCounters()
+			for i := 0; i < tt.retransmissions; i++ {
+				c.Retransmission()
+			}
+			require.Equal(t, uint64(tt.retransmissions), c.Stats().Retransmissions)
+		})
+	}
+}
+
+func TestCounters_UpdateRTT(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []time.Duration
+		want    time.Duration
+	}{
+		{
+			name: "not measured",
+		},
+		{
+			name:    "first sample",
+			samples: []time.Duration{time.Millisecond * 100},
+			want:    time.Millisecond * 100,
+		},
+		{
+			name:    "smoothed",
+			samples: []time.Duration{time.Millisecond * 100, time.Millisecond * 200},
+			// 100ms*7/8 + 200ms/8
+			want: time.Microsecond * 112500,
+		},
+		{
+			name:    "smoothed twice",
+			samples: []time.Duration{time.Millisecond * 100, time.Millisecond * 200, time.Millisecond * 200},
+			// 112.5ms*7/8 + 200ms/8
+			want: time.Nanosecond * 123437500,
+		},
+		{
+			name:    "steady",
+			samples: []time.Duration{time.Millisecond * 40, time.Millisecond * 40, time.Millisecond * 40},
+			want:    time.Millisecond * 40,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCounters()
+			for _, s := range tt.samples {
+				c.UpdateRTT(s)
+			}
+			require.Equal(t, tt.want, c.RTT())
+			require.Equal(t, tt.want, c.Stats().RTT)
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package net
 
-import "time"
+import (
+	"net"
+	"time"
+)
 
 // A UDPOption sets options such as heartBeat, errors parameters, etc.
 type UDPOption interface {
@@ -118,3 +121,123 @@ func (h OnWriteTimeoutOpt) applyConn(o *connOptions) {
 func (h OnWriteTimeoutOpt) applyUDP(o *udpConnOptions) {
 	o.onWriteTimeout = h.onWriteTimeout
 }
+
+// Packet is the datagram received by UDPConn.
+type Packet struct {
+	Data []byte
+	Addr *net.UDPAddr
+}
+
+// PacketFilterFunc returns false to drop the received packet, it may block to delay the packet.
+type PacketFilterFunc = func(p Packet) bool
+
+type PacketFilterOpt struct {
+	packetFilter PacketFilterFunc
+}
+
+func (h PacketFilterOpt) applyUDP(o *udpConnOptions) {
+	o.packetFilter = h.packetFilter
+}
+
+// WithPacketFilter sets the filter of received packets, it's intended for tests which simulate lossy links.
+// The filter is called by ReadWithContext for every packet before it's returned.
+func WithPacketFilter(packetFilter PacketFilterFunc) PacketFilterOpt {
+	return PacketFilterOpt{
+		packetFilter: packetFilter,
+	}
+}
+
+type ReusePortOpt struct{}
+
+func (h ReusePortOpt) applyUDP(o *udpConnOptions) {
+	o.reusePort = true
+}
+
+// WithReusePort sets SO_REUSEPORT on the socket created by NewListenUDP, so multiple sockets can be bound
+// to the same address and the kernel distributes incoming packets across them.
+// NewListenUDP returns ErrReusePortNotSupported on the platforms without SO_REUSEPORT.
+func WithReusePort() ReusePortOpt {
+	return ReusePortOpt{}
+}
+
+type ReadBufferOpt struct {
+	readBuffer int
+}
+
+func (h ReadBufferOpt) applyUDP(o *udpConnOptions) {
+	o.readBuffer = h.readBuffer
+}
+
+// WithReadBuffer sets the size of the receive buffer of the socket (SO_RCVBUF), eg. to survive bursts
+// of multicast traffic. The operating system may limit the size.
+func WithReadBuffer(bytes int) ReadBufferOpt {
+	return ReadBufferOpt{
+		readBuffer: bytes,
+	}
+}
+
+type WriteBufferOpt struct {
+	writeBuffer int
+}
+
+func (h WriteBufferOpt) applyUDP(o *udpConnOptions) {
+	o.writeBuffer = h.writeBuffer
+}
+
+// WithWriteBuffer sets the size of the send buffer of the socket (SO_SNDBUF). The operating system may limit the size.
+func WithWriteBuffer(bytes int) WriteBufferOpt {
+	return WriteBufferOpt{
+		writeBuffer: bytes,
+	}
+}
+
+type ReadBatchOpt struct {
+	size int
+}
+
+func (h ReadBatchOpt) applyUDP(o *udpConnOptions) {
+	o.readBatchSize = h.size
+}
+
+// WithReadBatch makes ReadWithContext receive up to size datagrams by one syscall (recvmmsg) on Linux,
+// so a high packet rate costs less CPU. The other platforms read a single datagram as without the option.
+// ReadMsgWithContext and the dual stack connection always read a single datagram.
+func WithReadBatch(size int) ReadBatchOpt {
+	return ReadBatchOpt{
+		size: size,
+	}
+}
+
+type HandshakeTimeoutOpt struct {
+	handshakeTimeout time.Duration
+}
+
+func (h HandshakeTimeoutOpt) applyDTLSListener(o *dtlsListenerOptions) {
+	o.handshakeTimeout = h.handshakeTimeout
+}
+
+// WithHandshakeTimeout abandons the DTLS handshake which isn't completed within the timeout, the default is 30 seconds.
+// The ConnectContextMaker of the dtls.Config can only shorten it.
+func WithHandshakeTimeout(timeout time.Duration) HandshakeTimeoutOpt {
+	return HandshakeTimeoutOpt{
+		handshakeTimeout: timeout,
+	}
+}
+
+type MaxConcurrentHandshakesOpt struct {
+	maxConcurrentHandshakes int
+}
+
+func (h MaxConcurrentHandshakesOpt) applyDTLSListener(o *dtlsListenerOptions) {
+	o.maxConcurrentHandshakes = h.maxConcurrentHandshakes
+}
+
+// WithMaxConcurrentHandshakes sets how many DTLS handshakes proceed concurrently, the default is 1.
+// The handshakes of the other peers wait in the backlog of the listener (128 peers), the peers over
+// the backlog are dropped. So the peers which never complete the handshake hold up the others
+// at most for the handshake timeout.
+func WithMaxConcurrentHandshakes(n int) MaxConcurrentHandshakesOpt {
+	return MaxConcurrentHandshakesOpt{
+		maxConcurrentHandshakes: n,
+	}
+}
@@ -0,0 +1,107 @@
+// Package ratelimit provides a token bucket rate limiter keyed by the remote address, which is used
+// by the servers to throttle abusive clients.
+package ratelimit
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// Limiter allows perSecond requests with bursts of burst requests for every key.
+// Buckets which were idle long enough to be refilled are evicted, so the memory is bounded by the active keys.
+type Limiter struct {
+	perSecond float64
+	burst     float64
+	idle      time.Duration
+	now       func() time.Time
+
+	lock      sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// New creates a limiter, perSecond and burst must be positive.
+func New(perSecond float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	idle := time.Duration(float64(burst) / perSecond * float64(time.Second))
+	if idle < time.Second {
+		idle = time.Second
+	}
+	return &Limiter{
+		perSecond: perSecond,
+		burst:     float64(burst),
+		idle:      idle,
+		now:       time.Now,
+		buckets:   make(map[string]*bucket),
+	}
+}
+
+// Allow reports whether a request of the key is allowed and takes a token from the bucket of the key.
+func (l *Limiter) Allow(key string) bool {
+	now := l.now()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if now.Sub(l.lastSweep) >= l.idle {
+		l.sweep(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, lastSeen: now}
+		l.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.lastSeen).Seconds() * l.perSecond
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.lastSeen = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// RetryAfter returns how long it takes to refill one token.
+func (l *Limiter) RetryAfter() time.Duration {
+	return time.Duration(float64(time.Second) / l.perSecond)
+}
+
+// sweep evicts buckets which would be full again, they are same as new ones.
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) >= l.idle {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// Len returns the number of tracked buckets.
+func (l *Limiter) Len() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return len(l.buckets)
+}
+
+// AddrKey returns the IP address of addr without the port, so all connections of the host share the bucket.
+func AddrKey(addr net.Addr) string {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP.String()
+	case *net.TCPAddr:
+		return a.IP.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
@@ -0,0 +1,37 @@
+package ratelimit
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := New(2, 3)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		require.True(t, l.Allow("a"))
+	}
+	require.False(t, l.Allow("a"))
+	// other keys are not affected
+	require.True(t, l.Allow("b"))
+
+	now = now.Add(time.Millisecond * 500)
+	require.True(t, l.Allow("a"))
+	require.False(t, l.Allow("a"))
+	require.Equal(t, time.Millisecond*500, l.RetryAfter())
+
+	// idle buckets are evicted
+	now = now.Add(time.Minute)
+	require.True(t, l.Allow("c"))
+	require.Equal(t, 1, l.Len())
+}
+
+func TestAddrKey(t *testing.T) {
+	require.Equal(t, "127.0.0.1", AddrKey(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5683}))
+	require.Equal(t, "::1", AddrKey(&net.TCPAddr{IP: net.IPv6loopback, Port: 5683}))
+}
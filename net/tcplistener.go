@@ -75,6 +75,9 @@ func (l *TCPListener) AcceptWithContext(ctx context.Context) (net.Conn, error) {
 		}
 		rw, err := l.listener.Accept()
 		if err != nil {
+			if atomic.LoadUint32(&l.closed) == 1 {
+				return nil, ErrListenerIsClosed
+			}
 			// check context in regular intervals and then resume listening
 			if isTemporary(err, deadline) {
 				if l.onTimeout != nil {
@@ -69,6 +69,9 @@ func (l *TLSListener) AcceptWithContext(ctx context.Context) (net.Conn, error) {
 		}
 		rw, err := l.listener.Accept()
 		if err != nil {
+			if atomic.LoadUint32(&l.closed) == 1 {
+				return nil, ErrListenerIsClosed
+			}
 			if isTemporary(err, deadline) {
 				if l.onTimeout != nil {
 					err := l.onTimeout()
@@ -0,0 +1,83 @@
+// Package workerpool provides a bounded pool of goroutines which can be used as GoPoolFunc
+// of the servers and clients to limit the number of concurrently handled requests.
+package workerpool
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	ErrQueueFull = errors.New("queue of worker pool is full")
+	ErrClosed    = errors.New("worker pool is closed")
+)
+
+// Pool executes submitted functions by a fixed number of workers.
+type Pool struct {
+	queue    chan func()
+	blocking bool
+	wg       sync.WaitGroup
+
+	lock   sync.RWMutex
+	closed bool
+}
+
+// New creates a pool with workers goroutines and a queue for queueSize waiting functions.
+// When the queue is full, Submit blocks until a worker is free if blocking is set,
+// otherwise it returns ErrQueueFull.
+func New(workers, queueSize int, blocking bool) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	p := &Pool{
+		queue:    make(chan func(), queueSize),
+		blocking: blocking,
+	}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.run()
+	}
+	return p
+}
+
+func (p *Pool) run() {
+	defer p.wg.Done()
+	for f := range p.queue {
+		f()
+	}
+}
+
+// Submit queues f to be executed by a worker. It satisfies GoPoolFunc, so it can be passed to WithGoPool.
+func (p *Pool) Submit(f func()) error {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if p.closed {
+		return ErrClosed
+	}
+	if p.blocking {
+		p.queue <- f
+		return nil
+	}
+	select {
+	case p.queue <- f:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close stops accepting new functions and waits until the queued functions are executed.
+func (p *Pool) Close() {
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.queue)
+	p.lock.Unlock()
+	p.wg.Wait()
+}
@@ -0,0 +1,56 @@
+package workerpool
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolBoundsWorkers(t *testing.T) {
+	const workers = 4
+	p := New(workers, 16, true)
+
+	var running, maxRunning, done int32
+	for i := 0; i < 1000; i++ {
+		err := p.Submit(func() {
+			v := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if v <= m || atomic.CompareAndSwapInt32(&maxRunning, m, v) {
+					break
+				}
+			}
+			atomic.AddInt32(&running, -1)
+			atomic.AddInt32(&done, 1)
+		})
+		require.NoError(t, err)
+	}
+	p.Close()
+	require.Equal(t, int32(1000), atomic.LoadInt32(&done))
+	require.LessOrEqual(t, atomic.LoadInt32(&maxRunning), int32(workers))
+
+	err := p.Submit(func() {})
+	require.Equal(t, ErrClosed, err)
+}
+
+func TestPoolQueueFull(t *testing.T) {
+	p := New(1, 1, false)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	release := make(chan struct{})
+	err := p.Submit(func() {
+		wg.Done()
+		<-release
+	})
+	require.NoError(t, err)
+	// wait until the worker is busy so the next function stays in the queue
+	wg.Wait()
+	err = p.Submit(func() {})
+	require.NoError(t, err)
+	err = p.Submit(func() {})
+	require.Equal(t, ErrQueueFull, err)
+	close(release)
+	p.Close()
+}
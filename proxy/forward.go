@@ -0,0 +1,251 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	"github.com/plgd-dev/go-coap/v2/tcp"
+	"github.com/plgd-dev/go-coap/v2/udp"
+)
+
+var (
+	// ErrUnsupportedScheme is returned when the proxy cannot forward request to the scheme.
+	ErrUnsupportedScheme = errors.New("unsupported scheme")
+	// ErrBodyTooLarge is returned when the body exceeds the limit set by WithMaxBodySize.
+	ErrBodyTooLarge = errors.New("body is too large")
+)
+
+// DialFunc connects to the origin server. Host contains port. The returned client is closed
+// by the proxy after the response was relayed.
+type DialFunc = func(ctx context.Context, scheme, host string) (mux.Client, error)
+
+// DefaultDial connects over udp for coap scheme and over tcp for coap+tcp scheme.
+func DefaultDial(ctx context.Context, scheme, host string) (mux.Client, error) {
+	switch scheme {
+	case "coap":
+		cc, err := udp.Dial(host, udp.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		return cc.Client(), nil
+	case "coap+tcp":
+		cc, err := tcp.Dial(host, tcp.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		return cc.Client(), nil
+	}
+	return nil, fmt.Errorf("%w: %v", ErrUnsupportedScheme, scheme)
+}
+
+func defaultPort(scheme string) string {
+	switch scheme {
+	case "coaps", "coaps+tcp":
+		return "5684"
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+	return "5683"
+}
+
+type target struct {
+	scheme  string
+	host    string
+	options message.Options
+}
+
+// parseTarget resolves the origin server and builds the options of the forwarded request
+// https://tools.ietf.org/html/rfc7252#section-6.4.
+func parseTarget(opts message.Options) (target, error) {
+	opts, err := opts.Clone()
+	if err != nil {
+		return target{}, err
+	}
+	var t target
+	if proxyURI, err := opts.ProxyURI(); err == nil {
+		u, err := url.Parse(proxyURI)
+		if err != nil {
+			return target{}, fmt.Errorf("invalid Proxy-Uri(%v): %w", proxyURI, err)
+		}
+		if u.Scheme == "" || u.Host == "" || u.Fragment != "" {
+			return target{}, fmt.Errorf("invalid Proxy-Uri(%v)", proxyURI)
+		}
+		t.scheme = strings.ToLower(u.Scheme)
+		t.host = u.Host
+		if u.Port() == "" {
+			t.host = net.JoinHostPort(u.Hostname(), defaultPort(t.scheme))
+		}
+		opts = opts.Remove(message.URIPath).Remove(message.URIQuery)
+		escapedPath := u.EscapedPath()
+		buf := make([]byte, len(escapedPath)+len(u.RawQuery))
+		var used int
+		opts, used, err = opts.SetEscapedPath(buf, escapedPath)
+		if err != nil {
+			return target{}, err
+		}
+		buf = buf[used:]
+		if u.RawQuery != "" {
+			for _, rawQuery := range strings.Split(u.RawQuery, "&") {
+				q, err := url.PathUnescape(rawQuery)
+				if err != nil {
+					return target{}, fmt.Errorf("invalid Proxy-Uri query(%v): %w", rawQuery, err)
+				}
+				opts, used, err = opts.AddString(buf, message.URIQuery, q)
+				if err != nil {
+					return target{}, err
+				}
+				buf = buf[used:]
+			}
+		}
+		t.options = opts
+	} else {
+		scheme, err := opts.ProxyScheme()
+		if err != nil {
+			return target{}, err
+		}
+		host, err := opts.GetString(message.URIHost)
+		if err != nil {
+			return target{}, fmt.Errorf("cannot get Uri-Host: %w", err)
+		}
+		t.scheme = strings.ToLower(scheme)
+		port := defaultPort(t.scheme)
+		if p, err := opts.GetUint32(message.URIPort); err == nil {
+			port = strconv.FormatUint(uint64(p), 10)
+		}
+		t.host = net.JoinHostPort(host, port)
+		t.options = opts
+	}
+	t.options = t.options.Remove(message.ProxyURI).Remove(message.ProxyScheme).Remove(message.URIHost).Remove(message.URIPort)
+	return t, nil
+}
+
+// nextHopLimit returns the Hop-Limit of the forwarded request https://tools.ietf.org/html/rfc8768#section-3,
+// false when the request must not be forwarded anymore.
+func nextHopLimit(opts message.Options) (uint8, bool, error) {
+	hopLimit, err := opts.HopLimit()
+	switch {
+	case errors.Is(err, message.ErrOptionNotFound):
+		return message.DefaultHopLimit, true, nil
+	case err != nil:
+		return 0, false, err
+	case hopLimit <= 1:
+		return 0, false, nil
+	}
+	return hopLimit - 1, true, nil
+}
+
+type forwarder struct {
+	next mux.Handler
+	opts forwardOptions
+}
+
+// Forward returns handler which forwards requests with Proxy-Uri or Proxy-Scheme option to the origin
+// server and relays the response with its options back to the client. The Hop-Limit option of the forwarded
+// request is decremented and the request which reaches the limit is answered by 5.08 (Hop Limit Reached), so
+// the Hop-Limit ends the forwarding loops, including the loops through the proxy itself under any of its addresses.
+// Other requests are served by next, when next is nil NotFound is returned.
+func Forward(next mux.Handler, opts ...ForwardOption) mux.Handler {
+	cfg := defaultForwardOptions
+	for _, o := range opts {
+		o.applyForward(&cfg)
+	}
+	return &forwarder{
+		next: next,
+		opts: cfg,
+	}
+}
+
+func (f *forwarder) ServeCOAP(w mux.ResponseWriter, r *mux.Message) {
+	if !r.Options.HasOption(message.ProxyURI) && !r.Options.HasOption(message.ProxyScheme) {
+		if f.next == nil {
+			w.SetResponse(codes.NotFound, message.TextPlain, nil)
+			return
+		}
+		f.next.ServeCOAP(w, r)
+		return
+	}
+	t, err := parseTarget(r.Options)
+	if err != nil {
+		w.SetResponse(codes.BadOption, message.TextPlain, nil)
+		return
+	}
+	if f.opts.localHosts[normalizeHost(t.host)] {
+		// forwarding to itself leads to loop
+		w.SetResponse(codes.BadGateway, message.TextPlain, nil)
+		return
+	}
+	hopLimit, ok, err := nextHopLimit(t.options)
+	if err != nil {
+		w.SetResponse(codes.BadOption, message.TextPlain, nil)
+		return
+	}
+	if !ok {
+		// the request loops between the proxies
+		w.SetResponse(codes.HopLimitReached, message.TextPlain, nil)
+		return
+	}
+	t.options, _, err = t.options.SetHopLimit(make([]byte, 1), hopLimit)
+	if err != nil {
+		w.SetResponse(codes.InternalServerError, message.TextPlain, nil)
+		return
+	}
+	if f.opts.crossProxy != nil && (t.scheme == "http" || t.scheme == "https") {
+		f.opts.crossProxy.ServeCOAP(w, r)
+		return
+	}
+	resp, err := f.forward(r, t)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUnsupportedScheme):
+			w.SetResponse(codes.ProxyingNotSupported, message.TextPlain, nil)
+		case errors.Is(err, context.DeadlineExceeded):
+			w.SetResponse(codes.GatewayTimeout, message.TextPlain, nil)
+		default:
+			w.SetResponse(codes.BadGateway, message.TextPlain, nil)
+		}
+		return
+	}
+	if rw, ok := w.(mux.RawResponseWriter); ok {
+		// the response of the origin is relayed unchanged
+		rw.SetRawResponse(resp.Code, resp.Body, resp.Options...)
+		return
+	}
+	contentFormat, err := resp.Options.ContentFormat()
+	if err != nil && resp.Body != nil {
+		contentFormat = message.AppOctets
+	}
+	w.SetResponse(resp.Code, contentFormat, resp.Body, resp.Options...)
+}
+
+func (f *forwarder) forward(r *mux.Message, t target) (*message.Message, error) {
+	ctx := r.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	cc, err := f.opts.dial(ctx, t.scheme, t.host)
+	if err != nil {
+		return nil, err
+	}
+	defer cc.Close()
+	token, err := message.GetToken()
+	if err != nil {
+		return nil, err
+	}
+	return cc.Do(&message.Message{
+		Context: ctx,
+		Token:   token,
+		Code:    r.Code,
+		Options: t.options,
+		Body:    r.Body,
+	})
+}
@@ -0,0 +1,155 @@
+package proxy_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/proxy"
+	"github.com/plgd-dev/go-coap/v2/udp"
+	"github.com/stretchr/testify/require"
+)
+
+func serveUDP(t *testing.T, wg *sync.WaitGroup, l *coapNet.UDPConn, h mux.Handler) func() {
+	s := udp.NewServer(udp.WithMux(h))
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+	return func() {
+		s.Stop()
+		l.Close()
+	}
+}
+
+func TestForward(t *testing.T) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	origin := mux.NewRouter()
+	origin.HandleFunc("/a", func(w mux.ResponseWriter, r *mux.Message) {
+		q, err := r.Options.Queries()
+		require.NoError(t, err)
+		require.Equal(t, []string{"x=1", "y 2"}, q)
+		require.False(t, r.Options.HasOption(message.ProxyURI))
+		err = w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("origin")), message.Option{ID: message.MaxAge, Value: []byte{30}})
+		require.NoError(t, err)
+	})
+	origin.HandleFunc("/hop", func(w mux.ResponseWriter, r *mux.Message) {
+		hopLimit, err := r.Options.HopLimit()
+		require.NoError(t, err)
+		err = w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte(strconv.Itoa(int(hopLimit)))), message.Option{ID: message.MaxAge, Value: []byte{30}})
+		require.NoError(t, err)
+	})
+	origin.HandleFunc("/raw", func(w mux.ResponseWriter, r *mux.Message) {
+		// the response without Content-Format and ETag
+		err := w.(mux.RawResponseWriter).SetRawResponse(codes.Content, bytes.NewReader([]byte("raw")), message.Option{ID: message.MaxAge, Value: []byte{30}})
+		require.NoError(t, err)
+	})
+	originListener, err := coapNet.NewListenUDP("udp", "127.0.0.1:")
+	require.NoError(t, err)
+	originAddr := originListener.LocalAddr().String()
+	stopOrigin := serveUDP(t, &wg, originListener, origin)
+	defer stopOrigin()
+
+	proxyRouter := mux.NewRouter()
+	proxyRouter.HandleFunc("/local", func(w mux.ResponseWriter, r *mux.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("local")))
+		require.NoError(t, err)
+	})
+	proxyListener, err := coapNet.NewListenUDP("udp", "127.0.0.1:")
+	require.NoError(t, err)
+	proxyAddr := proxyListener.LocalAddr().String()
+	stopProxy := serveUDP(t, &wg, proxyListener, proxy.Forward(proxyRouter, proxy.WithLocalHosts(proxyAddr)))
+	defer stopProxy()
+
+	// the proxy which doesn't know its addresses maps /loop to itself
+	selfListener, err := coapNet.NewListenUDP("udp", "127.0.0.1:")
+	require.NoError(t, err)
+	selfAddr := selfListener.LocalAddr().String()
+	selfRouter := mux.NewRouter()
+	selfForward := proxy.Forward(selfRouter)
+	selfRouter.HandleFunc("/loop", func(w mux.ResponseWriter, r *mux.Message) {
+		r.Options = append(r.Options, message.Option{ID: message.ProxyURI, Value: []byte("coap://" + selfAddr + "/loop")})
+		selfForward.ServeCOAP(w, r)
+	})
+	stopSelf := serveUDP(t, &wg, selfListener, selfForward)
+	defer stopSelf()
+
+	cc, err := udp.Dial(proxyAddr)
+	require.NoError(t, err)
+	defer cc.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		proxyURI string
+		hopLimit uint8
+		wantCode codes.Code
+		wantBody string
+		// wantContentFormat is the Content-Format of the response, -1 when it's missing
+		wantContentFormat int
+	}{
+		{name: "origin", proxyURI: "coap://" + originAddr + "/a?x=1&y%202", wantCode: codes.Content, wantBody: "origin"},
+		{name: "raw", proxyURI: "coap://" + originAddr + "/raw", wantCode: codes.Content, wantBody: "raw", wantContentFormat: -1},
+		{name: "local", path: "/local", wantCode: codes.Content, wantBody: "local"},
+		{name: "loop", proxyURI: "coap://" + proxyAddr + "/local", wantCode: codes.BadGateway},
+		{name: "loopByHopLimit", proxyURI: "coap://" + selfAddr + "/loop", wantCode: codes.HopLimitReached},
+		{name: "unsupportedScheme", proxyURI: "ftp://" + originAddr + "/a", wantCode: codes.ProxyingNotSupported},
+		{name: "hopLimitInserted", proxyURI: "coap://" + originAddr + "/hop", wantCode: codes.Content, wantBody: "16"},
+		{name: "hopLimitDecremented", proxyURI: "coap://" + originAddr + "/hop", hopLimit: 5, wantCode: codes.Content, wantBody: "4"},
+		{name: "hopLimitReached", proxyURI: "coap://" + originAddr + "/hop", hopLimit: 1, wantCode: codes.HopLimitReached},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer cancel()
+			var opts message.Options
+			if tt.proxyURI != "" {
+				opts = append(opts, message.Option{ID: message.ProxyURI, Value: []byte(tt.proxyURI)})
+			}
+			if tt.hopLimit > 0 {
+				opts = append(opts, message.Option{ID: message.HopLimit, Value: []byte{tt.hopLimit}})
+			}
+			resp, err := cc.Get(ctx, tt.path, opts...)
+			require.NoError(t, err)
+			require.Equal(t, tt.wantCode, resp.Code())
+			if tt.wantBody == "" {
+				return
+			}
+			body, err := ioutil.ReadAll(resp.Body())
+			require.NoError(t, err)
+			require.Equal(t, tt.wantBody, string(body))
+			var contentFormats []message.Option
+			for _, o := range resp.Options() {
+				if o.ID == message.ContentFormat {
+					contentFormats = append(contentFormats, o)
+				}
+			}
+			if tt.wantContentFormat < 0 {
+				require.Empty(t, contentFormats)
+				require.False(t, resp.HasOption(message.ETag))
+			} else {
+				require.Len(t, contentFormats, 1)
+				cf, err := resp.ContentFormat()
+				require.NoError(t, err)
+				require.Equal(t, message.MediaType(tt.wantContentFormat), cf)
+			}
+			if tt.proxyURI != "" {
+				maxAge, err := resp.GetOptionUint32(message.MaxAge)
+				require.NoError(t, err)
+				require.Equal(t, uint32(30), maxAge)
+			}
+		})
+	}
+}
@@ -0,0 +1,497 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+)
+
+var contentFormatToContentType = map[message.MediaType]string{
+	message.TextPlain:         "text/plain; charset=utf-8",
+	message.AppLinkFormat:     "application/link-format",
+	message.AppXML:            "application/xml",
+	message.AppOctets:         "application/octet-stream",
+	message.AppExi:            "application/exi",
+	message.AppJSON:           "application/json",
+	message.AppJSONPatch:      "application/json-patch+json",
+	message.AppJSONMergePatch: "application/merge-patch+json",
+	message.AppCBOR:           "application/cbor",
+	message.AppCWT:            "application/cwt",
+	message.AppCoseKey:        "application/cose-key",
+	message.AppCoseKeySet:     "application/cose-key-set",
+	message.AppSenmlJSON:      "application/senml+json",
+	message.AppSenmlCbor:      "application/senml+cbor",
+	message.AppCoapGroup:      "application/coap-group+json",
+	message.AppOcfCbor:        "application/vnd.ocf+cbor",
+	message.AppLwm2mTLV:       "application/vnd.oma.lwm2m+tlv",
+	message.AppLwm2mJSON:      "application/vnd.oma.lwm2m+json",
+}
+
+// ContentType converts CoAP content format to HTTP content type. The names registered by message.RegisterMediaType
+// are used for the vendor and experimental content formats.
+func ContentType(contentFormat message.MediaType) (string, bool) {
+	if v, ok := message.RegisteredMediaType(contentFormat); ok {
+		return v, true
+	}
+	v, ok := contentFormatToContentType[contentFormat]
+	return v, ok
+}
+
+// ContentFormat converts HTTP content type to CoAP content format. Parameters except charset are ignored.
+func ContentFormat(contentType string) (message.MediaType, bool) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return 0, false
+	}
+	if mediaType == "text/plain" {
+		if charset, ok := params["charset"]; ok && !strings.EqualFold(charset, "utf-8") {
+			return 0, false
+		}
+		return message.TextPlain, true
+	}
+	for cf, ct := range contentFormatToContentType {
+		if ct == mediaType {
+			return cf, true
+		}
+	}
+	if cf, err := message.ToMediaType(mediaType); err == nil {
+		return cf, true
+	}
+	return 0, false
+}
+
+var coapToHTTPStatus = map[codes.Code]int{
+	codes.Created:                 http.StatusCreated,
+	codes.Deleted:                 http.StatusOK,
+	codes.Valid:                   http.StatusNotModified,
+	codes.Changed:                 http.StatusOK,
+	codes.Content:                 http.StatusOK,
+	codes.BadRequest:              http.StatusBadRequest,
+	codes.Unauthorized:            http.StatusForbidden,
+	codes.BadOption:               http.StatusBadRequest,
+	codes.Forbidden:               http.StatusForbidden,
+	codes.NotFound:                http.StatusNotFound,
+	codes.MethodNotAllowed:        http.StatusBadRequest,
+	codes.NotAcceptable:           http.StatusNotAcceptable,
+	codes.RequestEntityIncomplete: http.StatusBadRequest,
+	codes.PreconditionFailed:      http.StatusPreconditionFailed,
+	codes.RequestEntityTooLarge:   http.StatusRequestEntityTooLarge,
+	codes.UnsupportedMediaType:    http.StatusUnsupportedMediaType,
+	codes.InternalServerError:     http.StatusInternalServerError,
+	codes.NotImplemented:          http.StatusNotImplemented,
+	codes.BadGateway:              http.StatusBadGateway,
+	codes.ServiceUnavailable:      http.StatusServiceUnavailable,
+	codes.GatewayTimeout:          http.StatusGatewayTimeout,
+	codes.ProxyingNotSupported:    http.StatusBadGateway,
+}
+
+// HTTPStatus maps CoAP response code to HTTP status code as defined in https://tools.ietf.org/html/rfc8075#section-7.
+func HTTPStatus(code codes.Code, hasPayload bool) int {
+	if (code == codes.Deleted || code == codes.Changed) && !hasPayload {
+		return http.StatusNoContent
+	}
+	if v, ok := coapToHTTPStatus[code]; ok {
+		return v
+	}
+	switch {
+	case code >= codes.InternalServerError:
+		return http.StatusInternalServerError
+	case code >= codes.BadRequest:
+		return http.StatusBadRequest
+	}
+	return http.StatusBadGateway
+}
+
+var httpToCoAPStatus = map[int]codes.Code{
+	http.StatusCreated:               codes.Created,
+	http.StatusNotModified:           codes.Valid,
+	http.StatusBadRequest:            codes.BadRequest,
+	http.StatusUnauthorized:          codes.Unauthorized,
+	http.StatusForbidden:             codes.Forbidden,
+	http.StatusNotFound:              codes.NotFound,
+	http.StatusMethodNotAllowed:      codes.MethodNotAllowed,
+	http.StatusNotAcceptable:         codes.NotAcceptable,
+	http.StatusPreconditionFailed:    codes.PreconditionFailed,
+	http.StatusRequestEntityTooLarge: codes.RequestEntityTooLarge,
+	http.StatusUnsupportedMediaType:  codes.UnsupportedMediaType,
+	http.StatusNotImplemented:        codes.NotImplemented,
+	http.StatusBadGateway:            codes.BadGateway,
+	http.StatusServiceUnavailable:    codes.ServiceUnavailable,
+	http.StatusGatewayTimeout:        codes.GatewayTimeout,
+}
+
+// CoAPCode maps HTTP status code of response to the request with CoAP method to CoAP response code
+// as defined in https://tools.ietf.org/html/rfc7252#section-10.1.
+func CoAPCode(method codes.Code, status int) codes.Code {
+	if status == http.StatusOK || status == http.StatusNoContent {
+		switch {
+		case method == codes.DELETE:
+			return codes.Deleted
+		case method == codes.GET && status == http.StatusOK:
+			return codes.Content
+		}
+		return codes.Changed
+	}
+	if v, ok := httpToCoAPStatus[status]; ok {
+		return v
+	}
+	switch {
+	case status >= 500:
+		return codes.InternalServerError
+	case status >= 400:
+		return codes.BadRequest
+	case status >= 200 && status < 300:
+		return codes.Content
+	}
+	return codes.BadGateway
+}
+
+var httpMethodToCode = map[string]codes.Code{
+	http.MethodGet:    codes.GET,
+	http.MethodPost:   codes.POST,
+	http.MethodPut:    codes.PUT,
+	http.MethodDelete: codes.DELETE,
+}
+
+var codeToHTTPMethod = map[codes.Code]string{
+	codes.GET:    http.MethodGet,
+	codes.POST:   http.MethodPost,
+	codes.PUT:    http.MethodPut,
+	codes.DELETE: http.MethodDelete,
+}
+
+// readBody reads whole body, it returns ErrBodyTooLarge when the body is larger than maxBodySize.
+func readBody(r io.Reader, maxBodySize int64) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBodySize {
+		return nil, ErrBodyTooLarge
+	}
+	return data, nil
+}
+
+type httpToCoAP struct {
+	prefix string
+	client mux.Client
+	opts   httpOptions
+}
+
+// HTTPToCoAP returns http handler which maps HTTP requests to CoAP requests of the client as defined
+// in https://tools.ietf.org/html/rfc8075. The prefix is stripped from the URL path and the rest
+// is used as Uri-Path, eg. with prefix /coap the request GET http://gw/coap/temp is mapped to GET /temp.
+// The bodies are limited by DefaultMaxBodySize unless WithMaxBodySize is used.
+func HTTPToCoAP(prefix string, client mux.Client, opts ...HTTPOption) http.Handler {
+	cfg := defaultHTTPOptions
+	for _, o := range opts {
+		o.applyHTTP(&cfg)
+	}
+	return &httpToCoAP{
+		prefix: strings.TrimSuffix(prefix, "/"),
+		client: client,
+		opts:   cfg,
+	}
+}
+
+func (h *httpToCoAP) newRequest(r *http.Request) (*message.Message, int) {
+	code, ok := httpMethodToCode[r.Method]
+	if !ok {
+		return nil, http.StatusNotImplemented
+	}
+	escapedPath := r.URL.EscapedPath()
+	path := strings.TrimPrefix(escapedPath, h.prefix)
+	if len(path) == len(escapedPath) && h.prefix != "" || path != "" && path[0] != '/' {
+		return nil, http.StatusNotFound
+	}
+	token, err := message.GetToken()
+	if err != nil {
+		return nil, http.StatusInternalServerError
+	}
+	var queries []string
+	if r.URL.RawQuery != "" {
+		for _, q := range strings.Split(r.URL.RawQuery, "&") {
+			q, err := url.QueryUnescape(q)
+			if err != nil {
+				return nil, http.StatusBadRequest
+			}
+			queries = append(queries, q)
+		}
+	}
+	buf := make([]byte, len(path)+len(r.URL.RawQuery)+8)
+	opts, used, err := message.Options{}.SetEscapedPath(buf, path)
+	if err != nil {
+		return nil, http.StatusBadRequest
+	}
+	buf = buf[used:]
+	for _, q := range queries {
+		opts, used, err = opts.AddString(buf, message.URIQuery, q)
+		if err != nil {
+			return nil, http.StatusBadRequest
+		}
+		buf = buf[used:]
+	}
+	if accept := r.Header.Get("Accept"); accept != "" && accept != "*/*" {
+		if cf, ok := ContentFormat(strings.Split(accept, ",")[0]); ok {
+			opts, _, err = opts.SetAccept(make([]byte, 4), cf)
+			if err != nil {
+				return nil, http.StatusBadRequest
+			}
+		}
+	}
+	req := message.Message{
+		Context: r.Context(),
+		Token:   token,
+		Code:    code,
+	}
+	if r.Body != nil && (code == codes.POST || code == codes.PUT) {
+		data, err := readBody(r.Body, h.opts.maxBodySize)
+		if errors.Is(err, ErrBodyTooLarge) {
+			return nil, http.StatusRequestEntityTooLarge
+		}
+		if err != nil {
+			return nil, http.StatusBadRequest
+		}
+		cf := message.AppOctets
+		if ct := r.Header.Get("Content-Type"); ct != "" {
+			cf, ok = ContentFormat(ct)
+			if !ok {
+				return nil, http.StatusUnsupportedMediaType
+			}
+		}
+		opts, _, err = opts.SetContentFormat(make([]byte, 4), cf)
+		if err != nil {
+			return nil, http.StatusBadRequest
+		}
+		req.Body = bytes.NewReader(data)
+	}
+	req.Options = opts
+	return &req, 0
+}
+
+func (h *httpToCoAP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req, status := h.newRequest(r)
+	if req == nil {
+		w.WriteHeader(status)
+		return
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			w.WriteHeader(http.StatusGatewayTimeout)
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	var body []byte
+	if resp.Body != nil {
+		body, err = readBody(resp.Body, h.opts.maxBodySize)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+	}
+	if cf, err := resp.Options.ContentFormat(); err == nil && len(body) > 0 {
+		if ct, ok := ContentType(cf); ok {
+			w.Header().Set("Content-Type", ct)
+		}
+	}
+	if maxAge, err := resp.Options.GetUint32(message.MaxAge); err == nil {
+		w.Header().Set("Cache-Control", "max-age="+strconv.FormatUint(uint64(maxAge), 10))
+	}
+	if etag, err := resp.Options.GetBytes(message.ETag); err == nil {
+		w.Header().Set("ETag", strconv.Quote(hex.EncodeToString(etag)))
+	}
+	w.WriteHeader(HTTPStatus(resp.Code, len(body) > 0))
+	if len(body) > 0 {
+		w.Write(body)
+	}
+}
+
+type coapToHTTP struct {
+	client *http.Client
+	opts   httpOptions
+}
+
+// CoAPToHTTP returns handler which maps CoAP requests with http or https Proxy-Uri, or with Proxy-Scheme and Uri-Host,
+// to HTTP requests as defined in https://tools.ietf.org/html/rfc7252#section-10.2. When client is nil, http.DefaultClient is used.
+// The bodies are limited by DefaultMaxBodySize unless WithMaxBodySize is used.
+func CoAPToHTTP(client *http.Client, opts ...HTTPOption) mux.Handler {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	cfg := defaultHTTPOptions
+	for _, o := range opts {
+		o.applyHTTP(&cfg)
+	}
+	return &coapToHTTP{
+		client: client,
+		opts:   cfg,
+	}
+}
+
+// requestURL returns the URL of the request from Proxy-Uri, or from Proxy-Scheme, Uri-Host, Uri-Port, Uri-Path and Uri-Query.
+func requestURL(opts message.Options) (*url.URL, error) {
+	if proxyURI, err := opts.ProxyURI(); err == nil {
+		return url.Parse(proxyURI)
+	}
+	scheme, err := opts.ProxyScheme()
+	if err != nil {
+		return nil, err
+	}
+	host, err := opts.GetString(message.URIHost)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get Uri-Host: %w", err)
+	}
+	if port, err := opts.GetUint32(message.URIPort); err == nil {
+		host = net.JoinHostPort(host, strconv.FormatUint(uint64(port), 10))
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	var path, queries []string
+	for _, o := range opts {
+		switch o.ID {
+		case message.URIPath:
+			path = append(path, url.PathEscape(string(o.Value)))
+		case message.URIQuery:
+			kv := strings.SplitN(string(o.Value), "=", 2)
+			for i := range kv {
+				kv[i] = url.QueryEscape(kv[i])
+			}
+			queries = append(queries, strings.Join(kv, "="))
+		}
+	}
+	rawPath := "/" + strings.Join(path, "/")
+	unescapedPath, err := url.PathUnescape(rawPath)
+	if err != nil {
+		return nil, err
+	}
+	return &url.URL{
+		Scheme:   strings.ToLower(scheme),
+		Host:     host,
+		Path:     unescapedPath,
+		RawPath:  rawPath,
+		RawQuery: strings.Join(queries, "&"),
+	}, nil
+}
+
+func (h *coapToHTTP) newRequest(r *mux.Message) (*http.Request, error) {
+	method, ok := codeToHTTPMethod[r.Code]
+	if !ok {
+		return nil, fmt.Errorf("unsupported method %v", r.Code)
+	}
+	u, err := requestURL(r.Options)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedScheme, u.Scheme)
+	}
+	ctx := r.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var body io.Reader
+	if r.Body != nil {
+		data, err := readBody(r.Body, h.opts.maxBodySize)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if cf, err := r.Options.ContentFormat(); err == nil && body != nil {
+		if ct, ok := ContentType(cf); ok {
+			req.Header.Set("Content-Type", ct)
+		}
+	}
+	if accept, err := r.Options.Accept(); err == nil {
+		if ct, ok := ContentType(accept); ok {
+			req.Header.Set("Accept", ct)
+		}
+	}
+	return req, nil
+}
+
+func maxAge(cacheControl string) (uint32, bool) {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.TrimSpace(directive)
+		if !strings.HasPrefix(directive, "max-age=") {
+			continue
+		}
+		v, err := strconv.ParseUint(strings.TrimPrefix(directive, "max-age="), 10, 32)
+		if err != nil {
+			return 0, false
+		}
+		return uint32(v), true
+	}
+	return 0, false
+}
+
+func (h *coapToHTTP) ServeCOAP(w mux.ResponseWriter, r *mux.Message) {
+	req, err := h.newRequest(r)
+	if err != nil {
+		if errors.Is(err, ErrUnsupportedScheme) {
+			w.SetResponse(codes.ProxyingNotSupported, message.TextPlain, nil)
+			return
+		}
+		if errors.Is(err, ErrBodyTooLarge) {
+			w.SetResponse(codes.RequestEntityTooLarge, message.TextPlain, nil)
+			return
+		}
+		w.SetResponse(codes.BadOption, message.TextPlain, nil)
+		return
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			w.SetResponse(codes.GatewayTimeout, message.TextPlain, nil)
+			return
+		}
+		w.SetResponse(codes.BadGateway, message.TextPlain, nil)
+		return
+	}
+	defer resp.Body.Close()
+	data, err := readBody(resp.Body, h.opts.maxBodySize)
+	if err != nil {
+		w.SetResponse(codes.BadGateway, message.TextPlain, nil)
+		return
+	}
+	var opts message.Options
+	if v, ok := maxAge(resp.Header.Get("Cache-Control")); ok {
+		opts, _, err = opts.SetUint32(make([]byte, 4), message.MaxAge, v)
+		if err != nil {
+			w.SetResponse(codes.InternalServerError, message.TextPlain, nil)
+			return
+		}
+	}
+	code := CoAPCode(r.Code, resp.StatusCode)
+	if len(data) == 0 {
+		w.SetResponse(code, message.TextPlain, nil, opts...)
+		return
+	}
+	cf, ok := ContentFormat(resp.Header.Get("Content-Type"))
+	if !ok {
+		cf = message.AppOctets
+	}
+	w.SetResponse(code, cf, bytes.NewReader(data), opts...)
+}
@@ -0,0 +1,178 @@
+package proxy_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/proxy"
+	"github.com/plgd-dev/go-coap/v2/udp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPToCoAP(t *testing.T) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	origin := mux.NewRouter()
+	origin.HandleFunc("/temp", func(w mux.ResponseWriter, r *mux.Message) {
+		err := w.SetResponse(codes.Content, message.AppJSON, bytes.NewReader([]byte(`{"t":21}`)), message.Option{ID: message.MaxAge, Value: []byte{10}})
+		require.NoError(t, err)
+	})
+	origin.HandleFunc("/large", func(w mux.ResponseWriter, r *mux.Message) {
+		err := w.SetResponse(codes.Content, message.AppOctets, bytes.NewReader(make([]byte, 32)))
+		require.NoError(t, err)
+	})
+	l, err := coapNet.NewListenUDP("udp", "127.0.0.1:")
+	require.NoError(t, err)
+	stop := serveUDP(t, &wg, l, origin)
+	defer stop()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	gw := httptest.NewServer(proxy.HTTPToCoAP("/coap", cc.Client(), proxy.WithMaxBodySize(16)))
+	defer gw.Close()
+
+	resp, err := http.Get(gw.URL + "/coap/temp")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	require.Equal(t, "max-age=10", resp.Header.Get("Cache-Control"))
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, `{"t":21}`, string(body))
+
+	resp, err = http.Get(gw.URL + "/coap/notfound")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodPatch, gw.URL+"/coap/temp", nil)
+	require.NoError(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+
+	resp, err = http.Post(gw.URL+"/coap/temp", "application/octet-stream", bytes.NewReader(make([]byte, 32)))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	resp, err = http.Get(gw.URL + "/coap/large")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+}
+
+func TestCoAPToHTTP(t *testing.T) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/large" {
+			w.Write(make([]byte, 32))
+			return
+		}
+		if r.URL.EscapedPath() == "/a%2Fb" {
+			w.Write([]byte("segment"))
+			return
+		}
+		if r.URL.Path != "/temp" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=20")
+		w.Write([]byte(`{"t":21}`))
+	}))
+	defer origin.Close()
+
+	l, err := coapNet.NewListenUDP("udp", "127.0.0.1:")
+	require.NoError(t, err)
+	stop := serveUDP(t, &wg, l, proxy.Forward(nil, proxy.WithHTTPClient(origin.Client(), proxy.WithMaxBodySize(16))))
+	defer stop()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	resp, err := cc.Get(ctx, "", message.Option{ID: message.ProxyURI, Value: []byte(origin.URL + "/temp")})
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	cf, err := resp.ContentFormat()
+	require.NoError(t, err)
+	require.Equal(t, message.AppJSON, cf)
+	maxAge, err := resp.GetOptionUint32(message.MaxAge)
+	require.NoError(t, err)
+	require.Equal(t, uint32(20), maxAge)
+	body, err := ioutil.ReadAll(resp.Body())
+	require.NoError(t, err)
+	require.Equal(t, `{"t":21}`, string(body))
+
+	resp, err = cc.Get(ctx, "", message.Option{ID: message.ProxyURI, Value: []byte(origin.URL + "/other")})
+	require.NoError(t, err)
+	require.Equal(t, codes.NotFound, resp.Code())
+
+	resp, err = cc.Get(ctx, "", message.Option{ID: message.ProxyURI, Value: []byte(origin.URL + "/a%2Fb")})
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+
+	resp, err = cc.Get(ctx, "", message.Option{ID: message.ProxyURI, Value: []byte(origin.URL + "/large")})
+	require.NoError(t, err)
+	require.Equal(t, codes.BadGateway, resp.Code())
+
+	resp, err = cc.Post(ctx, "", message.AppOctets, bytes.NewReader(make([]byte, 32)), message.Option{ID: message.ProxyURI, Value: []byte(origin.URL + "/temp")})
+	require.NoError(t, err)
+	require.Equal(t, codes.RequestEntityTooLarge, resp.Code())
+
+	// the same resource addressed by Proxy-Scheme and Uri-Host
+	u, err := url.Parse(origin.URL)
+	require.NoError(t, err)
+	port, err := strconv.ParseUint(u.Port(), 10, 32)
+	require.NoError(t, err)
+	portBuf := make([]byte, 4)
+	n, err := message.EncodeUint32(portBuf, uint32(port))
+	require.NoError(t, err)
+	resp, err = cc.Get(ctx, "/temp",
+		message.Option{ID: message.ProxyScheme, Value: []byte("http")},
+		message.Option{ID: message.URIHost, Value: []byte(u.Hostname())},
+		message.Option{ID: message.URIPort, Value: portBuf[:n]})
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	body, err = ioutil.ReadAll(resp.Body())
+	require.NoError(t, err)
+	require.Equal(t, `{"t":21}`, string(body))
+}
+
+func TestContentTypeRegisteredMediaType(t *testing.T) {
+	const acmeCbor = 65000
+	err := message.RegisterMediaType(acmeCbor, "application/vnd.acme+cbor")
+	require.NoError(t, err)
+	defer message.UnregisterMediaType(acmeCbor)
+	ct, ok := proxy.ContentType(acmeCbor)
+	require.True(t, ok)
+	require.Equal(t, "application/vnd.acme+cbor", ct)
+	cf, ok := proxy.ContentFormat("application/vnd.acme+cbor")
+	require.True(t, ok)
+	require.Equal(t, message.MediaType(acmeCbor), cf)
+	cf, ok = proxy.ContentFormat("application/json; charset=utf-8")
+	require.True(t, ok)
+	require.Equal(t, message.AppJSON, cf)
+}
@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/plgd-dev/go-coap/v2/mux"
+)
+
+type forwardOptions struct {
+	dial       DialFunc
+	localHosts map[string]bool
+	crossProxy mux.Handler
+}
+
+var defaultForwardOptions = forwardOptions{
+	dial: DefaultDial,
+}
+
+// A ForwardOption sets options of forward proxy.
+type ForwardOption interface {
+	applyForward(*forwardOptions)
+}
+
+// DialOpt dial function option.
+type DialOpt struct {
+	dial DialFunc
+}
+
+func (o DialOpt) applyForward(opts *forwardOptions) {
+	opts.dial = o.dial
+}
+
+// WithDial set's function which is used to connect to origin server.
+func WithDial(dial DialFunc) DialOpt {
+	return DialOpt{dial: dial}
+}
+
+// LocalHostsOpt local hosts option.
+type LocalHostsOpt struct {
+	hosts []string
+}
+
+func (o LocalHostsOpt) applyForward(opts *forwardOptions) {
+	localHosts := make(map[string]bool, len(opts.localHosts)+len(o.hosts))
+	for h := range opts.localHosts {
+		localHosts[h] = true
+	}
+	for _, h := range o.hosts {
+		localHosts[normalizeHost(h)] = true
+	}
+	opts.localHosts = localHosts
+}
+
+// WithLocalHosts set's host:port addresses under which the proxy is reachable.
+// Requests targeting these addresses are rejected with BadGateway before they are forwarded, the loops
+// through other addresses are ended by Hop-Limit.
+func WithLocalHosts(hosts ...string) LocalHostsOpt {
+	return LocalHostsOpt{hosts: hosts}
+}
+
+func normalizeHost(hostport string) string {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return strings.ToLower(hostport)
+	}
+	return net.JoinHostPort(strings.ToLower(host), port)
+}
+
+// HTTPClientOpt http client option.
+type HTTPClientOpt struct {
+	client *http.Client
+	opts   []HTTPOption
+}
+
+func (o HTTPClientOpt) applyForward(opts *forwardOptions) {
+	opts.crossProxy = CoAPToHTTP(o.client, o.opts...)
+}
+
+// WithHTTPClient enables forwarding of requests with http and https Proxy-Uri or Proxy-Scheme by the client.
+func WithHTTPClient(client *http.Client, opts ...HTTPOption) HTTPClientOpt {
+	return HTTPClientOpt{client: client, opts: opts}
+}
+
+// DefaultMaxBodySize is the default limit of the body relayed between HTTP and CoAP.
+const DefaultMaxBodySize = 64 * 1024
+
+type httpOptions struct {
+	maxBodySize int64
+}
+
+var defaultHTTPOptions = httpOptions{
+	maxBodySize: DefaultMaxBodySize,
+}
+
+// A HTTPOption sets options of HTTPToCoAP and CoAPToHTTP.
+type HTTPOption interface {
+	applyHTTP(*httpOptions)
+}
+
+// MaxBodySizeOpt max body size option.
+type MaxBodySizeOpt struct {
+	maxBodySize int64
+}
+
+func (o MaxBodySizeOpt) applyHTTP(opts *httpOptions) {
+	opts.maxBodySize = o.maxBodySize
+}
+
+// WithMaxBodySize limits the size of the body which is read by the proxy. The request with larger body
+// is rejected by 413 (HTTP) or 4.13 (CoAP), the response with larger body is replaced by 502 (HTTP) or 5.02 (CoAP).
+func WithMaxBodySize(maxBodySize int64) MaxBodySizeOpt {
+	return MaxBodySizeOpt{maxBodySize: maxBodySize}
+}
@@ -0,0 +1,109 @@
+package coap_test
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/mux"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/tcp"
+	"github.com/plgd-dev/go-coap/v2/udp"
+	"github.com/stretchr/testify/require"
+)
+
+// serveFunc starts the server with the handler and the errors and returns the client dialed to it
+// and the function which closes the client and stops the server.
+type serveFunc func(t *testing.T, handler mux.Handler, errors func(error)) (mux.Client, func())
+
+func serveUDP(t *testing.T, handler mux.Handler, errors func(error)) (mux.Client, func()) {
+	l, err := coapNet.NewListenUDP("udp4", "127.0.0.1:")
+	require.NoError(t, err)
+	s := udp.NewServer(udp.WithMux(handler), udp.WithErrors(errors))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	return cc.Client(), func() {
+		_ = cc.Close()
+		s.Stop()
+		wg.Wait()
+		_ = l.Close()
+	}
+}
+
+func serveTCP(t *testing.T, handler mux.Handler, errors func(error)) (mux.Client, func()) {
+	l, err := coapNet.NewTCPListener("tcp", "127.0.0.1:")
+	require.NoError(t, err)
+	s := tcp.NewServer(tcp.WithMux(handler), tcp.WithErrors(errors))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+	cc, err := tcp.Dial(l.Addr().String())
+	require.NoError(t, err)
+	return cc.Client(), func() {
+		_ = cc.Close()
+		s.Stop()
+		wg.Wait()
+		_ = l.Close()
+	}
+}
+
+func TestServer_HandlerPanics(t *testing.T) {
+	tests := []struct {
+		name  string
+		serve serveFunc
+	}{
+		{name: "udp", serve: serveUDP},
+		{name: "tcp", serve: serveTCP},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs []error
+			var errsLock sync.Mutex
+			handler := mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+				path, err := r.Options.Path()
+				require.NoError(t, err)
+				if path == "panic" {
+					panic("handler failure")
+				}
+				err = w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("ok")))
+				require.NoError(t, err)
+			})
+			cc, stop := tt.serve(t, handler, func(err error) {
+				errsLock.Lock()
+				defer errsLock.Unlock()
+				errs = append(errs, err)
+			})
+			defer stop()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			resp, err := cc.Get(ctx, "/panic")
+			require.NoError(t, err)
+			require.Equal(t, codes.InternalServerError, resp.Code)
+
+			resp, err = cc.Get(ctx, "/ok")
+			require.NoError(t, err)
+			require.Equal(t, codes.Content, resp.Code)
+
+			errsLock.Lock()
+			defer errsLock.Unlock()
+			require.Len(t, errs, 1)
+			require.Contains(t, errs[0].Error(), "handler failure")
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package tcp
+
+import (
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
+)
+
+// AuthorizeFunc reports whether the peer authenticated by the identity is allowed to perform the request
+// with the code on the path, the path starts with '/'.
+type AuthorizeFunc = func(identity string, code codes.Code, path string) bool
+
+// NewAuthorizeHandler checks requests by authorize before they reach next. A rejected request is answered
+// by 4.01 (Unauthorized) when the peer has no security identity, otherwise by 4.03 (Forbidden).
+func NewAuthorizeHandler(authorize AuthorizeFunc, next HandlerFunc) HandlerFunc {
+	return func(w *ResponseWriter, r *pool.Message) {
+		if authorizeRequest(authorize, w, r) {
+			next(w, r)
+		}
+	}
+}
+
+// authorizeRequest answers the request rejected by authorize and reports whether the request can be handled.
+func authorizeRequest(authorize AuthorizeFunc, w *ResponseWriter, r *pool.Message) bool {
+	if authorize == nil || !r.Code().IsRequest() {
+		return true
+	}
+	identity := w.ClientConn().SecurityIdentity()
+	path := "/"
+	if p, err := r.Options().Path(); err == nil {
+		path += p
+	}
+	if authorize(identity, r.Code(), path) {
+		return true
+	}
+	code := codes.Forbidden
+	if identity == "" {
+		code = codes.Unauthorized
+	}
+	_ = w.SetResponse(code, message.TextPlain, nil)
+	return false
+}
@@ -0,0 +1,22 @@
+package tcp
+
+import (
+	"context"
+	"fmt"
+
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
+)
+
+// Broadcast writes the message created by buildMsg to every connection concurrently, eg. to push a change
+// to all connected devices. See coapNet.Broadcast for the number of concurrent writes and the error.
+func Broadcast(ctx context.Context, conns []*ClientConn, buildMsg func() *pool.Message) error {
+	return coapNet.Broadcast(ctx, len(conns), func(i int) error {
+		msg := buildMsg()
+		defer pool.ReleaseMessage(msg)
+		if err := conns[i].WriteMessage(msg); err != nil {
+			return fmt.Errorf("%v: %w", conns[i].RemoteAddr(), err)
+		}
+		return nil
+	})
+}
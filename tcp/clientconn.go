@@ -12,6 +12,7 @@ import (
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/net/blockwise"
 	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/net/monitor/stats"
 	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
 
 	"github.com/plgd-dev/go-coap/v2/message/codes"
@@ -42,6 +43,7 @@ var defaultDialOptions = dialOptions{
 	net:                      "tcp",
 	blockwiseSZX:             blockwise.SZX1024,
 	blockwiseEnable:          true,
+	getToken:                 message.GetToken,
 	blockwiseTransferTimeout: time.Second * 3,
 	createInactivityMonitor: func() inactivity.Monitor {
 		return inactivity.NewNilMonitor()
@@ -60,6 +62,9 @@ type dialOptions struct {
 	blockwiseSZX                    blockwise.SZX
 	blockwiseEnable                 bool
 	blockwiseTransferTimeout        time.Duration
+	getToken                        GetTokenFunc
+	onStats                         StatsFunc
+	statsInterval                   time.Duration
 	disablePeerTCPSignalMessageCSMs bool
 	disableTCPSignalMessageCSM      bool
 	tlsCfg                          *tls.Config
@@ -83,6 +88,7 @@ type ClientConn struct {
 	observationTokenHandler *HandlerContainer
 	observationRequests     *kitSync.Map
 	activityMonitor         Notifier
+	getToken                GetTokenFunc
 }
 
 // Dial creates a client connection to the given target.
@@ -188,7 +194,10 @@ func Client(conn net.Conn, opts ...DialOption) *ClientConn {
 		cfg.closeSocket,
 		monitor,
 	)
-	cc = NewClientConn(session, observationTokenHandler, observationRequests)
+	cc = newClientConn(session, observationTokenHandler, observationRequests, cfg.getToken)
+	if cfg.onStats != nil && cfg.statsInterval > 0 {
+		go cc.reportStats(cfg.statsInterval, cfg.onStats)
+	}
 
 	go func() {
 		err := cc.Run()
@@ -202,10 +211,19 @@ func Client(conn net.Conn, opts ...DialOption) *ClientConn {
 
 // NewClientConn creates connection over session and observation.
 func NewClientConn(session *Session, observationTokenHandler *HandlerContainer, observationRequests *kitSync.Map) *ClientConn {
+	return newClientConn(session, observationTokenHandler, observationRequests, nil)
+}
+
+// newClientConn creates connection which generates the tokens of the requests by getToken, the nil means message.GetToken.
+func newClientConn(session *Session, observationTokenHandler *HandlerContainer, observationRequests *kitSync.Map, getToken GetTokenFunc) *ClientConn {
+	if getToken == nil {
+		getToken = message.GetToken
+	}
 	return &ClientConn{
 		session:                 session,
 		observationTokenHandler: observationTokenHandler,
 		observationRequests:     observationRequests,
+		getToken:                getToken,
 	}
 }
 
@@ -214,7 +232,21 @@ func (cc *ClientConn) Session() *Session {
 }
 
 // Close closes connection without wait of ends Run function.
+// Close sends the Release signal to the peer and closes the connection. Sending of the Release signal
+// blocks up to 1 second when the peer doesn't read from the connection.
 func (cc *ClientConn) Close() error {
+	if cc.session.Context().Err() == nil {
+		// the Release signal is best effort, the connection is closed anyway
+		_ = cc.session.sendRelease()
+	}
+	return cc.session.Close()
+}
+
+// Abort sends the Abort signal to the peer and closes the connection immediately.
+func (cc *ClientConn) Abort() error {
+	if cc.session.Context().Err() == nil {
+		_ = cc.session.sendAbort()
+	}
 	return cc.session.Close()
 }
 
@@ -237,13 +269,16 @@ func (cc *ClientConn) do(req *pool.Message) (*pool.Message, error) {
 	defer cc.session.TokenHandler().Pop(token)
 	err = cc.session.WriteMessage(req)
 	if err != nil {
-		return nil, fmt.Errorf("cannot write request: %w", err)
+		return nil, fmt.Errorf("cannot write request: %w", coapNet.ContextError(err))
 	}
 
 	select {
 	case <-req.Context().Done():
-		return nil, req.Context().Err()
+		return nil, coapNet.ContextError(req.Context().Err())
 	case <-cc.session.Context().Done():
+		if cc.session.isAborted() {
+			return nil, fmt.Errorf("connection was closed: %w", coapNet.ErrConnReset)
+		}
 		return nil, fmt.Errorf("connection was closed: %w", cc.Context().Err())
 	case resp := <-respChan:
 		return resp, nil
@@ -253,16 +288,29 @@ func (cc *ClientConn) do(req *pool.Message) (*pool.Message, error) {
 // Do sends an coap message and returns an coap response.
 //
 // An error is returned if by failure to speak COAP (such as a network connectivity problem).
-// Any status code doesn't cause an error.
+// Any status code doesn't cause an error, use pool.CheckResponse to get *pool.ResponseError for a non-success one.
+// A request which isn't answered in time fails with an error matching coapNet.ErrTimeout.
 //
 // Caller is responsible to release request and response.
 func (cc *ClientConn) Do(req *pool.Message) (*pool.Message, error) {
-	if !cc.session.PeerBlockWiseTransferEnabled() || cc.session.blockWise == nil {
+	if err := cc.session.beginExchange(); err != nil {
+		return nil, err
+	}
+	defer cc.session.endExchange()
+	if cc.session.blockWise == nil {
 		return cc.do(req)
 	}
-	bwresp, err := cc.session.blockWise.Do(req, cc.session.blockwiseSZX, cc.session.maxMessageSize, func(bwreq blockwise.Message) (blockwise.Message, error) {
+	doBlock := func(bwreq blockwise.Message) (blockwise.Message, error) {
 		return cc.do(bwreq.(*pool.Message))
-	})
+	}
+	var bwresp blockwise.Message
+	var err error
+	if cc.session.PeerBlockWiseTransferEnabled() {
+		bwresp, err = cc.session.blockWise.Do(req, cc.session.blockwiseSZXToUse(), cc.session.blockwiseMaxMessageSize(), doBlock)
+	} else {
+		// the request isn't split to blocks before CSM of the peer indicates blockwise, but the response can be sent in blocks
+		bwresp, err = cc.session.blockWise.DoWithoutSplit(req, doBlock)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -278,29 +326,65 @@ func (cc *ClientConn) WriteMessage(req *pool.Message) error {
 	if !cc.session.PeerBlockWiseTransferEnabled() || cc.session.blockWise == nil {
 		return cc.writeMessage(req)
 	}
-	return cc.session.blockWise.WriteMessage(cc.RemoteAddr(), req, cc.session.blockwiseSZX, cc.session.maxMessageSize, func(bwreq blockwise.Message) error {
+	return cc.session.blockWise.WriteMessage(cc.RemoteAddr(), req, cc.session.blockwiseSZXToUse(), cc.session.blockwiseMaxMessageSize(), func(bwreq blockwise.Message) error {
 		return cc.writeMessage(bwreq.(*pool.Message))
 	})
 }
 
-func newCommonRequest(ctx context.Context, code codes.Code, path string, opts ...message.Option) (*pool.Message, error) {
-	token, err := message.GetToken()
-	if err != nil {
-		return nil, fmt.Errorf("cannot get token: %w", err)
+// maxGetTokenAttempts limits attempts to generate a token which is not in flight.
+const maxGetTokenAttempts = 16
+
+// generateToken generates token which is not used by a pending request or an observation.
+func (cc *ClientConn) generateToken() (message.Token, error) {
+	for i := 0; i < maxGetTokenAttempts; i++ {
+		token, err := cc.getToken()
+		if err != nil {
+			return nil, fmt.Errorf("cannot get token: %w", err)
+		}
+		if _, err := cc.session.TokenHandler().Get(token); err == nil {
+			continue
+		}
+		if _, err := cc.observationTokenHandler.Get(token.String()); err == nil {
+			continue
+		}
+		return token, nil
 	}
+	return nil, fmt.Errorf("cannot get token: %w", ErrKeyAlreadyExists)
+}
+
+func newCommonRequest(ctx context.Context, token message.Token, code codes.Code, path string, opts ...message.Option) *pool.Message {
 	req := pool.AcquireMessage(ctx)
 	req.SetCode(code)
 	req.SetToken(token)
 	req.ResetOptionsTo(opts)
 	req.SetPath(path)
-	return req, nil
+	if tc, ok := message.TraceContextFromContext(ctx); ok && !req.HasOption(message.TraceParent) {
+		req.SetTraceContext(tc)
+	}
+	return req
+}
+
+// newRequest creates request with the token generated by message.GetToken.
+func newRequest(ctx context.Context, code codes.Code, path string, opts ...message.Option) (*pool.Message, error) {
+	token, err := message.GetToken()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get token: %w", err)
+	}
+	return newCommonRequest(ctx, token, code, path, opts...), nil
+}
+
+func setPayload(req *pool.Message, contentFormat message.MediaType, payload io.ReadSeeker) {
+	if payload != nil {
+		req.SetContentFormat(contentFormat)
+		req.SetBody(payload)
+	}
 }
 
 // NewGetRequest creates get request.
 //
 // Use ctx to set timeout.
 func NewGetRequest(ctx context.Context, path string, opts ...message.Option) (*pool.Message, error) {
-	return newCommonRequest(ctx, codes.GET, path, opts...)
+	return newRequest(ctx, codes.GET, path, opts...)
 }
 
 // Get issues a GET to the specified path.
@@ -310,10 +394,11 @@ func NewGetRequest(ctx context.Context, path string, opts ...message.Option) (*p
 // An error is returned if by failure to speak COAP (such as a network connectivity problem).
 // Any status code doesn't cause an error.
 func (cc *ClientConn) Get(ctx context.Context, path string, opts ...message.Option) (*pool.Message, error) {
-	req, err := NewGetRequest(ctx, path, opts...)
+	token, err := cc.generateToken()
 	if err != nil {
 		return nil, fmt.Errorf("cannot create get request: %w", err)
 	}
+	req := newCommonRequest(ctx, token, codes.GET, path, opts...)
 	defer pool.ReleaseMessage(req)
 	return cc.Do(req)
 }
@@ -327,14 +412,11 @@ func (cc *ClientConn) Get(ctx context.Context, path string, opts ...message.Opti
 //
 // If payload is nil then content format is not used.
 func NewPostRequest(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
-	req, err := newCommonRequest(ctx, codes.POST, path, opts...)
+	req, err := newRequest(ctx, codes.POST, path, opts...)
 	if err != nil {
 		return nil, err
 	}
-	if payload != nil {
-		req.SetContentFormat(contentFormat)
-		req.SetBody(payload)
-	}
+	setPayload(req, contentFormat, payload)
 	return req, nil
 }
 
@@ -347,11 +429,13 @@ func NewPostRequest(ctx context.Context, path string, contentFormat message.Medi
 //
 // If payload is nil then content format is not used.
 func (cc *ClientConn) Post(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
-	req, err := NewPostRequest(ctx, path, contentFormat, payload, opts...)
+	token, err := cc.generateToken()
 	if err != nil {
 		return nil, fmt.Errorf("cannot create post request: %w", err)
 	}
+	req := newCommonRequest(ctx, token, codes.POST, path, opts...)
 	defer pool.ReleaseMessage(req)
+	setPayload(req, contentFormat, payload)
 	return cc.Do(req)
 }
 
@@ -361,14 +445,11 @@ func (cc *ClientConn) Post(ctx context.Context, path string, contentFormat messa
 //
 // If payload is nil then content format is not used.
 func NewPutRequest(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
-	req, err := newCommonRequest(ctx, codes.PUT, path, opts...)
+	req, err := newRequest(ctx, codes.PUT, path, opts...)
 	if err != nil {
 		return nil, err
 	}
-	if payload != nil {
-		req.SetContentFormat(contentFormat)
-		req.SetBody(payload)
-	}
+	setPayload(req, contentFormat, payload)
 	return req, nil
 }
 
@@ -381,11 +462,13 @@ func NewPutRequest(ctx context.Context, path string, contentFormat message.Media
 //
 // If payload is nil then content format is not used.
 func (cc *ClientConn) Put(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
-	req, err := NewPutRequest(ctx, path, contentFormat, payload, opts...)
+	token, err := cc.generateToken()
 	if err != nil {
 		return nil, fmt.Errorf("cannot create put request: %w", err)
 	}
+	req := newCommonRequest(ctx, token, codes.PUT, path, opts...)
 	defer pool.ReleaseMessage(req)
+	setPayload(req, contentFormat, payload)
 	return cc.Do(req)
 }
 
@@ -393,17 +476,18 @@ func (cc *ClientConn) Put(ctx context.Context, path string, contentFormat messag
 //
 // Use ctx to set timeout.
 func NewDeleteRequest(ctx context.Context, path string, opts ...message.Option) (*pool.Message, error) {
-	return newCommonRequest(ctx, codes.DELETE, path, opts...)
+	return newRequest(ctx, codes.DELETE, path, opts...)
 }
 
 // Delete deletes the resource identified by the request path.
 //
 // Use ctx to set timeout.
 func (cc *ClientConn) Delete(ctx context.Context, path string, opts ...message.Option) (*pool.Message, error) {
-	req, err := NewDeleteRequest(ctx, path, opts...)
+	token, err := cc.generateToken()
 	if err != nil {
 		return nil, fmt.Errorf("cannot create delete request: %w", err)
 	}
+	req := newCommonRequest(ctx, token, codes.DELETE, path, opts...)
 	defer pool.ReleaseMessage(req)
 	return cc.Do(req)
 }
@@ -450,8 +534,10 @@ func (cc *ClientConn) AsyncPing(receivedPong func()) (func(), error) {
 	req.SetCode(codes.Ping)
 	defer pool.ReleaseMessage(req)
 
+	sent := time.Now()
 	err = cc.session.TokenHandler().Insert(token, func(w *ResponseWriter, r *pool.Message) {
 		if r.Code() == codes.Pong {
+			cc.session.stats.UpdateRTT(time.Since(sent))
 			receivedPong()
 		}
 	})
@@ -473,6 +559,25 @@ func (cc *ClientConn) Run() (err error) {
 	return cc.session.Run(cc)
 }
 
+// reportStats calls onStats with the statistics of the connection every interval until the connection is closed.
+func (cc *ClientConn) reportStats(interval time.Duration, onStats StatsFunc) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			onStats(cc, cc.Stats())
+		case <-cc.Context().Done():
+			return
+		}
+	}
+}
+
+// Stats returns statistics of the connection.
+func (cc *ClientConn) Stats() stats.Stats {
+	return cc.session.Stats()
+}
+
 // AddOnClose calls function on close connection event.
 func (cc *ClientConn) AddOnClose(f EventFunc) {
 	cc.session.AddOnClose(f)
@@ -483,6 +588,23 @@ func (cc *ClientConn) RemoteAddr() net.Addr {
 	return cc.session.connection.RemoteAddr()
 }
 
+// SecurityIdentity returns the common name of the peer certificate for TCP-TLS connection, when the certificate
+// has no common name its subject is returned. It returns empty string for an unsecured connection.
+func (cc *ClientConn) SecurityIdentity() string {
+	tlsConn, ok := cc.session.connection.Connection().(*tls.Conn)
+	if !ok {
+		return ""
+	}
+	certs := tlsConn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return ""
+	}
+	if certs[0].Subject.CommonName != "" {
+		return certs[0].Subject.CommonName
+	}
+	return certs[0].Subject.String()
+}
+
 // Client get instance which implements mux.Client.
 func (cc *ClientConn) Client() *ClientTCP {
 	return NewClientTCP(cc)
@@ -494,6 +616,8 @@ func (cc *ClientConn) Sequence() uint64 {
 }
 
 // SetContextValue stores the value associated with key to context of connection.
+// The requests handled afterwards carry the value in their context, so a value set by OnNewClientConn,
+// eg. the identity of the peer, is read by the handlers via r.Context().Value(key).
 func (cc *ClientConn) SetContextValue(key interface{}, val interface{}) {
 	cc.session.SetContextValue(key, val)
 }
@@ -12,7 +12,10 @@ import (
 	"time"
 
 	"github.com/plgd-dev/go-coap/v2/mux"
+	"github.com/plgd-dev/go-coap/v2/net/blockwise"
 	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/net/monitor/stats"
+	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
 
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
@@ -482,6 +485,166 @@ func TestClientConn_Ping(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestClientConn_OnStats(t *testing.T) {
+	l, err := coapNet.NewTCPListener("tcp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	reported := make(chan stats.Stats, 1)
+	s := NewServer(WithOnStats(time.Millisecond*10, func(cc *ClientConn, s stats.Stats) {
+		select {
+		case reported <- s:
+		default:
+		}
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := Dial(l.Addr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = cc.Ping(ctx)
+	require.NoError(t, err)
+
+	for {
+		select {
+		case s := <-reported:
+			// CSM and Ping signals
+			if s.MessagesReceived[7] >= 2 {
+				return
+			}
+		case <-ctx.Done():
+			require.FailNow(t, "stats weren't reported")
+		}
+	}
+}
+
+func TestClientConn_PostCreated(t *testing.T) {
+	l, err := coapNet.NewTCPListener("tcp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	s := NewServer(WithHandlerFunc(func(w *ResponseWriter, r *pool.Message) {
+		err := w.Created("/devices/42")
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := Dial(l.Addr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := cc.Post(ctx, "/devices", message.TextPlain, bytes.NewReader([]byte("new")))
+	require.NoError(t, err)
+	defer pool.ReleaseMessage(resp)
+	require.Equal(t, codes.Created, resp.Code())
+	location, err := resp.LocationPath()
+	require.NoError(t, err)
+	require.Equal(t, "devices/42", location)
+}
+
+func TestClientConn_ConditionalPut(t *testing.T) {
+	l, err := coapNet.NewTCPListener("tcp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	currentETag := []byte{1, 2, 3}
+	s := NewServer(WithHandlerFunc(func(w *ResponseWriter, r *pool.Message) {
+		if !r.Options().PreconditionsHold(true, currentETag) {
+			err := w.SetResponse(codes.PreconditionFailed, message.TextPlain, nil)
+			require.NoError(t, err)
+			return
+		}
+		err := w.SetResponse(codes.Changed, message.TextPlain, nil)
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := Dial(l.Addr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for _, tt := range []struct {
+		etag []byte
+		want codes.Code
+	}{
+		{etag: []byte{9}, want: codes.PreconditionFailed},
+		{etag: currentETag, want: codes.Changed},
+	} {
+		req, err := NewPutRequest(ctx, "/a", message.TextPlain, bytes.NewReader([]byte("v")))
+		require.NoError(t, err)
+		req.AddIfMatch(tt.etag)
+		resp, err := cc.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, tt.want, resp.Code())
+		pool.ReleaseMessage(resp)
+		pool.ReleaseMessage(req)
+	}
+}
+
+func TestClientConn_ErrorConnReset(t *testing.T) {
+	l, err := coapNet.NewTCPListener("tcp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	s := NewServer(WithHandlerFunc(func(w *ResponseWriter, r *pool.Message) {
+		err := w.ClientConn().Abort()
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := Dial(l.Addr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = cc.Get(ctx, "/a")
+	require.ErrorIs(t, err, coapNet.ErrConnReset)
+}
+
 func TestClient_InactiveMonitor(t *testing.T) {
 	inactivityDetected := false
 	defer func() {
@@ -601,3 +764,58 @@ func TestClient_KeepAliveMonitor(t *testing.T) {
 	checkCloseWg.Wait()
 	require.True(t, inactivityDetected)
 }
+
+func TestClientConn_BERT(t *testing.T) {
+	ld, err := coapNet.NewTCPListener("tcp4", "")
+	require.NoError(t, err)
+	defer ld.Close()
+
+	payload := make([]byte, 10*1024*1024)
+	for i := range payload {
+		payload[i] = byte(i % 251)
+	}
+	s := NewServer(WithBlockwise(true, blockwise.SZXBERT, time.Second*10), WithHandlerFunc(func(w *ResponseWriter, r *pool.Message) {
+		if r.Code() == codes.PUT {
+			b, err := r.ReadBody()
+			require.NoError(t, err)
+			require.Equal(t, payload, b)
+			err = w.SetResponse(codes.Changed, message.TextPlain, nil)
+			require.NoError(t, err)
+			return
+		}
+		err := w.SetResponse(codes.Content, message.AppOctets, bytes.NewReader(payload))
+		require.NoError(t, err)
+	}))
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	cc, err := Dial(ld.Addr().String(), WithBlockwise(true, blockwise.SZXBERT, time.Second*10))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+	defer cancel()
+	// BERT is used after CSM of the peer was received
+	require.Eventually(t, cc.session.PeerBlockWiseTransferEnabled, time.Second*5, time.Millisecond*10)
+
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	b, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, payload, b)
+	// with 1024 bytes blocks the transfer takes 10240 round trips
+	requests := cc.Stats().MessagesSent[0]
+	require.Less(t, requests, uint64(200))
+
+	resp, err = cc.Put(ctx, "/a", message.AppOctets, bytes.NewReader(payload))
+	require.NoError(t, err)
+	require.Equal(t, codes.Changed, resp.Code())
+	require.Less(t, cc.Stats().MessagesSent[0]-requests, uint64(200))
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
 	"github.com/plgd-dev/go-coap/v2/net/observation"
 	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
 )
@@ -79,7 +80,7 @@ func (o *Observation) Cancel(ctx context.Context) error {
 		return fmt.Errorf("cannot cancel observation request: %w", err)
 	}
 	defer pool.ReleaseMessage(req)
-	req.SetObserve(1)
+	req.SetObserve(message.ObserveDeregister)
 	req.SetToken(o.token)
 	resp, err := o.cc.Do(req)
 	if err != nil {
@@ -87,7 +88,7 @@ func (o *Observation) Cancel(ctx context.Context) error {
 	}
 	defer pool.ReleaseMessage(resp)
 	if resp.Code() != codes.Content {
-		return fmt.Errorf("unexpected return code(%v)", resp.Code())
+		return &pool.ResponseError{Code: resp.Code()}
 	}
 	return nil
 }
@@ -112,13 +113,13 @@ func (o *Observation) wantBeNotified(r *pool.Message) bool {
 
 // Observe subscribes for every change of resource on path.
 func (cc *ClientConn) Observe(ctx context.Context, path string, observeFunc func(req *pool.Message), opts ...message.Option) (*Observation, error) {
-	req, err := NewGetRequest(ctx, path, opts...)
+	token, err := cc.generateToken()
 	if err != nil {
 		return nil, fmt.Errorf("cannot create observe request: %w", err)
 	}
+	req := newCommonRequest(ctx, token, codes.GET, path, opts...)
 	defer pool.ReleaseMessage(req)
-	token := req.Token()
-	req.SetObserve(0)
+	req.SetObserve(message.ObserveRegister)
 
 	respCodeChan := make(chan codes.Code, 1)
 	o := newObservation(token, path, cc, observeFunc, respCodeChan)
@@ -151,14 +152,14 @@ func (cc *ClientConn) Observe(ctx context.Context, path string, observeFunc func
 	}
 	select {
 	case <-req.Context().Done():
-		err = req.Context().Err()
+		err = coapNet.ContextError(req.Context().Err())
 		return nil, err
 	case <-cc.Context().Done():
 		err = fmt.Errorf("connection was closed: %w", cc.Context().Err())
 		return nil, err
 	case respCode := <-respCodeChan:
 		if respCode != codes.Content {
-			err = fmt.Errorf("unexpected return code(%v)", respCode)
+			err = &pool.ResponseError{Code: respCode}
 			return nil, err
 		}
 		return o, nil
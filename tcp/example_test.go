@@ -9,9 +9,10 @@ import (
 
 	"github.com/plgd-dev/go-coap/v2/net"
 	"github.com/plgd-dev/go-coap/v2/tcp"
+	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
 )
 
-func ExampleGet() {
+func ExampleClientConn_Get() {
 	conn, err := tcp.Dial("pluggedin.cloud:5683")
 	if err != nil {
 		log.Fatal(err)
@@ -19,10 +20,12 @@ func ExampleGet() {
 	defer conn.Close()
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
+	// Get blocks until the response arrives, block-wise transfer is handled by the connection.
 	res, err := conn.Get(ctx, "/oic/res")
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer pool.ReleaseMessage(res)
 	data, err := ioutil.ReadAll(res.Body())
 	if err != nil {
 		log.Fatal(err)
@@ -30,7 +33,7 @@ func ExampleGet() {
 	fmt.Printf("%v", data)
 }
 
-func ExampleServe() {
+func ExampleServer_Serve() {
 	l, err := net.NewTCPListener("tcp", "0.0.0.0:5683")
 	if err != nil {
 		log.Fatal(err)
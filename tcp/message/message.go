@@ -2,6 +2,8 @@ package message
 
 import (
 	"encoding/binary"
+	"io"
+	"net"
 
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
@@ -121,6 +123,31 @@ func (m Message) Marshal() ([]byte, error) {
 }
 
 func (m Message) MarshalTo(buf []byte) (int, error) {
+	return m.marshalTo(buf, true)
+}
+
+// WriteTo writes the message to w, it implements io.WriterTo. Only the header and the options are marshaled
+// to a scratch buffer, the payload is written directly from m.Payload, by a single writev call for net.Conn.
+func (m Message) WriteTo(w io.Writer) (int64, error) {
+	var scratch [256]byte
+	head := scratch[:]
+	n, err := m.marshalTo(head, false)
+	if err == message.ErrTooSmall {
+		head = make([]byte, n)
+		n, err = m.marshalTo(head, false)
+	}
+	if err != nil {
+		return 0, err
+	}
+	bufs := net.Buffers{head[:n]}
+	if len(m.Payload) > 0 {
+		bufs = append(bufs, m.Payload)
+	}
+	return bufs.WriteTo(w)
+}
+
+// marshalTo marshals the message, without the payload it marshals only the header, the options and the payload marker.
+func (m Message) marshalTo(buf []byte, withPayload bool) (int, error) {
 	/*
 	   A CoAP Message message lomessage.OKs like:
 
@@ -207,6 +234,9 @@ func (m Message) MarshalTo(buf []byte) (int, error) {
 	}
 
 	bufLen = bufLen + hdrLen
+	if !withPayload {
+		bufLen -= len(m.Payload)
+	}
 	if len(buf) < bufLen {
 		return bufLen, message.ErrTooSmall
 	}
@@ -222,7 +252,9 @@ func (m Message) MarshalTo(buf []byte) (int, error) {
 	}
 	if len(m.Payload) > 0 {
 		copy(buf[hdrLen+optionsLen:], []byte{0xff})
-		copy(buf[hdrLen+optionsLen+1:], m.Payload)
+		if withPayload {
+			copy(buf[hdrLen+optionsLen+1:], m.Payload)
+		}
 	}
 
 	return bufLen, nil
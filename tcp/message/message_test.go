@@ -1,6 +1,7 @@
 package message
 
 import (
+	"bytes"
 	"testing"
 
 	coap "github.com/plgd-dev/go-coap/v2/message"
@@ -50,6 +51,43 @@ func TestMarshalMessage(t *testing.T) {
 	}, buf, []byte{211, 0, 1, 1, 2, 3, 177, 97, 1, 98, 1, 99, 1, 100, 1, 101, 16, 255, 1})
 }
 
+type recordingWriter struct {
+	bytes.Buffer
+	writes []int
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, len(p))
+	return w.Buffer.Write(p)
+}
+
+func TestMessageWriteTo(t *testing.T) {
+	bufOptions := make([]byte, 1024)
+	options, _, err := coap.Options{}.SetPath(bufOptions, "/a/b/c/d/e")
+	require.NoError(t, err)
+	tests := []struct {
+		name string
+		msg  Message
+	}{
+		{name: "empty", msg: Message{}},
+		{name: "options", msg: Message{Code: codes.GET, Token: []byte{0x1, 0x2}, Options: options}},
+		{name: "largePayload", msg: Message{Code: codes.Content, Token: []byte{0x1}, Options: options, Payload: bytes.Repeat([]byte{0xab}, 100000)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := tt.msg.Marshal()
+			require.NoError(t, err)
+			var w recordingWriter
+			n, err := tt.msg.WriteTo(&w)
+			require.NoError(t, err)
+			require.Equal(t, int64(len(want)), n)
+			require.Equal(t, want, w.Bytes())
+			// the payload isn't copied to the scratch buffer of the header
+			require.LessOrEqual(t, w.writes[0], len(want)-len(tt.msg.Payload))
+		})
+	}
+}
+
 func TestUnmarshalMessage(t *testing.T) {
 	testUnmarshalMessage(t, Message{}, []byte{0, 0}, Message{})
 	testUnmarshalMessage(t, Message{}, []byte{0, byte(codes.GET)}, Message{Code: codes.GET})
@@ -3,6 +3,7 @@ package pool
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"sync"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/pool"
+	"github.com/plgd-dev/go-coap/v2/net/blockwise"
 	tcp "github.com/plgd-dev/go-coap/v2/tcp/message"
 )
 
@@ -58,8 +60,10 @@ func (r *Message) Unmarshal(data []byte) (int, error) {
 	}
 	copy(r.rawData, data)
 	r.rawData = r.rawData[:len(data)]
-	m := &tcp.Message{
-		Options: make(message.Options, 0, 16),
+	opts := pool.AcquireOptions()
+	defer pool.ReleaseOptions(opts)
+	m := tcp.Message{
+		Options: *opts,
 	}
 
 	n, err := m.Unmarshal(r.rawData)
@@ -122,6 +126,19 @@ func AcquireMessage(ctx context.Context) *Message {
 	return r
 }
 
+// Clone returns a deep copy of the message acquired via AcquireMessage, it survives release of the original message,
+// eg. when a handler processes the request asynchronously. The clone must be released by ReleaseMessage too.
+func (r *Message) Clone() (*Message, error) {
+	c := AcquireMessage(r.Context())
+	err := r.Message.CopyTo(c.Message)
+	if err != nil {
+		ReleaseMessage(c)
+		return nil, err
+	}
+	c.isModified = r.isModified
+	return c, nil
+}
+
 // ReleaseMessage returns req acquired via AcquireMessage to Message pool.
 //
 // It is forbidden accessing req and/or its' members after returning
@@ -158,10 +175,15 @@ func ConvertTo(m *Message) (*message.Message, error) {
 	var body io.ReadSeeker
 	if m.Body() != nil {
 		payload, err := m.ReadBody()
-		if err != nil {
+		switch {
+		case err == nil:
+			body = bytes.NewReader(payload)
+		case errors.Is(err, blockwise.ErrStreamNotSeekable):
+			// the body of the streamed request is read as the blocks arrive
+			body = m.Body()
+		default:
 			return nil, err
 		}
-		body = bytes.NewReader(payload)
 	}
 	return &message.Message{
 		Context: m.Context(),
@@ -171,3 +193,11 @@ func ConvertTo(m *Message) (*message.Message, error) {
 		Options: opts,
 	}, nil
 }
+
+// ResponseError is reported when the peer answered by an unexpected response code, eg. 4.04.
+type ResponseError = pool.ResponseError
+
+// CheckResponse returns *ResponseError when the code of the response isn't a success (2.xx) one.
+func CheckResponse(resp *Message) error {
+	return pool.CheckResponse(resp.Message)
+}
@@ -3,11 +3,14 @@ package tcp
 import (
 	"context"
 	"crypto/tls"
+	"io"
 	"net"
 	"time"
 
+	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/net/blockwise"
 	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/net/ratelimit"
 )
 
 // HandlerFuncOpt handler function option.
@@ -41,7 +44,8 @@ func (o ContextOpt) applyDial(opts *dialOptions) {
 	opts.ctx = o.ctx
 }
 
-// WithContext set's parent context of server.
+// WithContext set's parent context of server or client connection.
+// Cancelling it stops the server like Stop does, Serve returns after all its connections are closed.
 func WithContext(ctx context.Context) ContextOpt {
 	return ContextOpt{ctx: ctx}
 }
@@ -97,7 +101,8 @@ func (o GoPoolOpt) applyDial(opts *dialOptions) {
 
 // WithGoPool sets function for managing spawning go routines
 // for handling incoming request's.
-// Eg: https://github.com/panjf2000/ants.
+// Eg: https://github.com/panjf2000/ants or Submit of workerpool.Pool, which bounds
+// the number of goroutines and queued requests.
 func WithGoPool(goPool GoPoolFunc) GoPoolOpt {
 	return GoPoolOpt{goPool: goPool}
 }
@@ -107,24 +112,26 @@ type KeepAliveOpt struct {
 	maxRetries uint32
 	timeout    time.Duration
 	onInactive inactivity.OnInactiveFunc
+	// periodic sends the next ping after another period of inactivity instead of by the next heartbeat
+	periodic bool
 }
 
-func (o KeepAliveOpt) apply(opts *serverOptions) {
-	opts.createInactivityMonitor = func() inactivity.Monitor {
-		keepalive := inactivity.NewKeepAlive(o.maxRetries, o.onInactive, func(cc inactivity.ClientConn, receivePong func()) (func(), error) {
-			return cc.(*ClientConn).AsyncPing(receivePong)
-		})
-		return inactivity.NewInactivityMonitor(o.timeout/time.Duration(o.maxRetries+1), keepalive.OnInactive)
+func (o KeepAliveOpt) createInactivityMonitor() inactivity.Monitor {
+	keepalive := inactivity.NewKeepAlive(o.maxRetries, o.onInactive, func(cc inactivity.ClientConn, receivePong func()) (func(), error) {
+		return cc.(*ClientConn).AsyncPing(receivePong)
+	})
+	if o.periodic {
+		return inactivity.NewPeriodicInactivityMonitor(o.timeout/time.Duration(o.maxRetries+1), keepalive.OnInactive)
 	}
+	return inactivity.NewInactivityMonitor(o.timeout/time.Duration(o.maxRetries+1), keepalive.OnInactive)
+}
+
+func (o KeepAliveOpt) apply(opts *serverOptions) {
+	opts.createInactivityMonitor = o.createInactivityMonitor
 }
 
 func (o KeepAliveOpt) applyDial(opts *dialOptions) {
-	opts.createInactivityMonitor = func() inactivity.Monitor {
-		keepalive := inactivity.NewKeepAlive(o.maxRetries, o.onInactive, func(cc inactivity.ClientConn, receivePong func()) (func(), error) {
-			return cc.(*ClientConn).AsyncPing(receivePong)
-		})
-		return inactivity.NewInactivityMonitor(o.timeout/time.Duration(o.maxRetries+1), keepalive.OnInactive)
-	}
+	opts.createInactivityMonitor = o.createInactivityMonitor
 }
 
 // WithKeepAlive monitoring's client connection's.
@@ -136,6 +143,17 @@ func WithKeepAlive(maxRetries uint32, timeout time.Duration, onInactive inactivi
 	}
 }
 
+// WithKeepAliveInterval monitors the connection by pings which are sent after each interval of inactivity.
+// onFailure is called when maxRetries pings in row were not answered, so a dead peer is detected within interval*(maxRetries+1).
+func WithKeepAliveInterval(interval time.Duration, maxRetries uint32, onFailure inactivity.OnInactiveFunc) KeepAliveOpt {
+	return KeepAliveOpt{
+		maxRetries: maxRetries,
+		timeout:    interval * time.Duration(maxRetries+1),
+		onInactive: onFailure,
+		periodic:   true,
+	}
+}
+
 // InactivityMonitorOpt notifies when a connection was inactive for a given duration.
 type InactivityMonitorOpt struct {
 	duration   time.Duration
@@ -213,7 +231,8 @@ func (o BlockwiseOpt) applyDial(opts *dialOptions) {
 	opts.blockwiseTransferTimeout = o.transferTimeout
 }
 
-// WithBlockwise configure's blockwise transfer.
+// WithBlockwise configure's blockwise transfer. The blockwise.SZXBERT enables BERT (RFC 8323), so a block carries
+// multiple of 1024 bytes which fit to max message sizes of both sides.
 func WithBlockwise(enable bool, szx blockwise.SZX, transferTimeout time.Duration) BlockwiseOpt {
 	return BlockwiseOpt{
 		enable:          enable,
@@ -222,6 +241,39 @@ func WithBlockwise(enable bool, szx blockwise.SZX, transferTimeout time.Duration
 	}
 }
 
+// BlockwiseCacheOpt network option.
+type BlockwiseCacheOpt struct {
+	cache *blockwise.BlockCache
+}
+
+func (o BlockwiseCacheOpt) apply(opts *serverOptions) {
+	opts.blockwiseCache = o.cache
+}
+
+// WithBlockwiseCache sets cache of blocks shared by all connections of the server, so blocks of a response
+// with the same ETag are sliced only once for all peers.
+func WithBlockwiseCache(cache *blockwise.BlockCache) BlockwiseCacheOpt {
+	return BlockwiseCacheOpt{
+		cache: cache,
+	}
+}
+
+// BlockwiseUploadStreamingOpt network option.
+type BlockwiseUploadStreamingOpt struct {
+	enable bool
+}
+
+func (o BlockwiseUploadStreamingOpt) apply(opts *serverOptions) {
+	opts.blockwiseUploadStreaming = o.enable
+}
+
+// WithBlockwiseUploadStreaming calls the handler with the first block of an upload transferred by Block1, the body
+// of the request yields the payload as the blocks arrive, so the handler doesn't need to hold the whole upload.
+// See blockwise.WithUploadStreaming.
+func WithBlockwiseUploadStreaming(enable bool) BlockwiseUploadStreamingOpt {
+	return BlockwiseUploadStreamingOpt{enable: enable}
+}
+
 // OnNewClientConnOpt network option.
 type OnNewClientConnOpt struct {
 	onNewClientConn OnNewClientConnFunc
@@ -291,6 +343,43 @@ func WithTLS(cfg *tls.Config) TLSOpt {
 	}
 }
 
+// TokenGeneratorOpt token generator option.
+type TokenGeneratorOpt struct {
+	getToken GetTokenFunc
+}
+
+func (o TokenGeneratorOpt) apply(opts *serverOptions) {
+	opts.getToken = o.getToken
+}
+
+func (o TokenGeneratorOpt) applyDial(opts *dialOptions) {
+	opts.getToken = o.getToken
+}
+
+// WithTokenGenerator allows to set own generator of tokens for requests created by client connections.
+// Tokens which are already in flight are skipped.
+func WithTokenGenerator(getToken GetTokenFunc) TokenGeneratorOpt {
+	return TokenGeneratorOpt{getToken: getToken}
+}
+
+// RandReaderOpt random source option.
+type RandReaderOpt struct {
+	r io.Reader
+}
+
+func (o RandReaderOpt) apply(opts *serverOptions) {
+	opts.getToken = message.NewGetToken(o.r)
+}
+
+func (o RandReaderOpt) applyDial(opts *dialOptions) {
+	opts.getToken = message.NewGetToken(o.r)
+}
+
+// WithRandReader generates the tokens from r instead of crypto/rand, eg. to get predictable tokens in tests.
+func WithRandReader(r io.Reader) RandReaderOpt {
+	return RandReaderOpt{r: r}
+}
+
 // CloseSocketOpt close socket option.
 type CloseSocketOpt struct {
 }
@@ -321,3 +410,57 @@ func WithDialer(dialer *net.Dialer) DialerOpt {
 		dialer: dialer,
 	}
 }
+
+// RateLimitOpt rate limit option.
+type RateLimitOpt struct {
+	perSecond float64
+	burst     int
+}
+
+func (o RateLimitOpt) apply(opts *serverOptions) {
+	opts.rateLimiter = ratelimit.New(o.perSecond, o.burst)
+}
+
+// WithRateLimit limits requests of every remote IP address to perSecond with bursts of burst requests.
+// Throttled requests are answered by 4.29 (Too Many Requests) without reaching the handler.
+func WithRateLimit(perSecond float64, burst int) RateLimitOpt {
+	return RateLimitOpt{perSecond: perSecond, burst: burst}
+}
+
+// AuthorizerOpt authorizer option.
+type AuthorizerOpt struct {
+	authorize AuthorizeFunc
+}
+
+func (o AuthorizerOpt) apply(opts *serverOptions) {
+	opts.authorize = o.authorize
+}
+
+// WithAuthorizer checks every request by authorize with the security identity of the peer, the code and the path
+// of the request. A rejected request is answered by 4.01 (Unauthorized) or 4.03 (Forbidden) without reaching the handler.
+// The request sent in blocks is checked before the blocks are reassembled, so a rejected upload stops at the first block.
+func WithAuthorizer(authorize AuthorizeFunc) AuthorizerOpt {
+	return AuthorizerOpt{authorize: authorize}
+}
+
+// StatsOpt stats option.
+type StatsOpt struct {
+	interval time.Duration
+	onStats  StatsFunc
+}
+
+func (o StatsOpt) apply(opts *serverOptions) {
+	opts.statsInterval = o.interval
+	opts.onStats = o.onStats
+}
+
+func (o StatsOpt) applyDial(opts *dialOptions) {
+	opts.statsInterval = o.interval
+	opts.onStats = o.onStats
+}
+
+// WithOnStats calls onStats with the statistics of the connection every interval until the connection is closed,
+// eg. to export them to Prometheus.
+func WithOnStats(interval time.Duration, onStats StatsFunc) StatsOpt {
+	return StatsOpt{interval: interval, onStats: onStats}
+}
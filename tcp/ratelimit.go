@@ -0,0 +1,24 @@
+package tcp
+
+import (
+	"math"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/net/ratelimit"
+	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
+)
+
+// NewRateLimitHandler throttles requests by the limiter keyed by the remote IP address. A throttled request
+// is answered by 4.29 (Too Many Requests) with MaxAge option telling when to retry.
+func NewRateLimitHandler(limiter *ratelimit.Limiter, next HandlerFunc) HandlerFunc {
+	return func(w *ResponseWriter, r *pool.Message) {
+		if !r.Code().IsRequest() || limiter.Allow(ratelimit.AddrKey(w.ClientConn().RemoteAddr())) {
+			next(w, r)
+			return
+		}
+		var buf [4]byte
+		n, _ := message.EncodeUint32(buf[:], uint32(math.Ceil(limiter.RetryAfter().Seconds())))
+		_ = w.SetResponse(codes.TooManyRequests, message.TextPlain, nil, message.Option{ID: message.MaxAge, Value: buf[:n]})
+	}
+}
@@ -12,6 +12,8 @@ import (
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/net/blockwise"
 	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/net/monitor/stats"
+	"github.com/plgd-dev/go-coap/v2/net/ratelimit"
 	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
 	kitSync "github.com/plgd-dev/kit/sync"
 
@@ -33,6 +35,10 @@ type ErrorFunc = func(error)
 
 type GoPoolFunc = func(func()) error
 
+type GetTokenFunc = func() (message.Token, error)
+
+type StatsFunc = func(cc *ClientConn, s stats.Stats)
+
 type BlockwiseFactoryFunc = func(getSendedRequest func(token message.Token) (blockwise.Message, bool)) *blockwise.BlockWise
 
 // OnNewClientConnFunc is the callback for new connections.
@@ -58,6 +64,7 @@ var defaultServerOptions = serverOptions{
 	},
 	blockwiseEnable:          true,
 	blockwiseSZX:             blockwise.SZX1024,
+	getToken:                 message.GetToken,
 	blockwiseTransferTimeout: time.Second * 3,
 	onNewClientConn:          func(cc *ClientConn, tlscon *tls.Conn) {},
 	heartBeat:                time.Millisecond * 100,
@@ -76,10 +83,17 @@ type serverOptions struct {
 	blockwiseSZX                    blockwise.SZX
 	blockwiseEnable                 bool
 	blockwiseTransferTimeout        time.Duration
+	getToken                        GetTokenFunc
+	onStats                         StatsFunc
+	statsInterval                   time.Duration
+	blockwiseCache                  *blockwise.BlockCache
+	blockwiseUploadStreaming        bool
 	onNewClientConn                 OnNewClientConnFunc
 	heartBeat                       time.Duration
 	disablePeerTCPSignalMessageCSMs bool
 	disableTCPSignalMessageCSM      bool
+	rateLimiter                     *ratelimit.Limiter
+	authorize                       AuthorizeFunc
 }
 
 // Listener defined used by coap
@@ -97,16 +111,25 @@ type Server struct {
 	blockwiseSZX                    blockwise.SZX
 	blockwiseEnable                 bool
 	blockwiseTransferTimeout        time.Duration
+	getToken                        GetTokenFunc
+	onStats                         StatsFunc
+	statsInterval                   time.Duration
+	blockwiseCache                  *blockwise.BlockCache
+	blockwiseUploadStreaming        bool
 	onNewClientConn                 OnNewClientConnFunc
 	heartBeat                       time.Duration
 	disablePeerTCPSignalMessageCSMs bool
 	disableTCPSignalMessageCSM      bool
+	authorize                       AuthorizeFunc
 
 	ctx    context.Context
 	cancel context.CancelFunc
 
 	listen      Listener
 	listenMutex sync.Mutex
+
+	conns      map[*ClientConn]struct{}
+	connsMutex sync.Mutex
 }
 
 func NewServer(opt ...ServerOption) *Server {
@@ -115,6 +138,10 @@ func NewServer(opt ...ServerOption) *Server {
 		o.apply(&opts)
 	}
 
+	if opts.rateLimiter != nil {
+		opts.handler = NewRateLimitHandler(opts.rateLimiter, opts.handler)
+	}
+
 	ctx, cancel := context.WithCancel(opts.ctx)
 
 	if opts.createInactivityMonitor == nil {
@@ -125,6 +152,7 @@ func NewServer(opt ...ServerOption) *Server {
 
 	return &Server{
 		ctx:            ctx,
+		conns:          make(map[*ClientConn]struct{}),
 		cancel:         cancel,
 		handler:        opts.handler,
 		maxMessageSize: opts.maxMessageSize,
@@ -139,11 +167,17 @@ func NewServer(opt ...ServerOption) *Server {
 		blockwiseSZX:                    opts.blockwiseSZX,
 		blockwiseEnable:                 opts.blockwiseEnable,
 		blockwiseTransferTimeout:        opts.blockwiseTransferTimeout,
+		getToken:                        opts.getToken,
+		onStats:                         opts.onStats,
+		statsInterval:                   opts.statsInterval,
+		blockwiseCache:                  opts.blockwiseCache,
+		blockwiseUploadStreaming:        opts.blockwiseUploadStreaming,
 		heartBeat:                       opts.heartBeat,
 		disablePeerTCPSignalMessageCSMs: opts.disablePeerTCPSignalMessageCSMs,
 		disableTCPSignalMessageCSM:      opts.disableTCPSignalMessageCSM,
 		onNewClientConn:                 opts.onNewClientConn,
 		createInactivityMonitor:         opts.createInactivityMonitor,
+		authorize:                       opts.authorize,
 	}
 }
 
@@ -174,6 +208,11 @@ func (s *Server) checkAcceptError(err error) (bool, error) {
 		}
 		return false, nil
 	default:
+		if coapNet.IsFatalAcceptError(err) {
+			s.Stop()
+			return false, err
+		}
+		s.errors(fmt.Errorf("cannot accept connection: %w", err))
 		return true, nil
 	}
 }
@@ -195,6 +234,7 @@ func (s *Server) Serve(l Listener) error {
 	}()
 	var wg sync.WaitGroup
 	defer wg.Wait()
+	var backoff coapNet.AcceptBackoff
 	for {
 		rw, err := l.AcceptWithContext(s.ctx)
 		ok, err := s.checkAcceptError(err)
@@ -204,36 +244,73 @@ func (s *Server) Serve(l Listener) error {
 		if !ok {
 			return nil
 		}
-		if rw != nil {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				var cc *ClientConn
-				monitor := s.createInactivityMonitor()
-				opts := []coapNet.ConnOption{
-					coapNet.WithHeartBeat(s.heartBeat),
-					coapNet.WithOnReadTimeout(func() error {
-						monitor.CheckInactivity(cc)
-						return nil
-					}),
-				}
-				cc = s.createClientConn(coapNet.NewConn(rw, opts...), monitor)
-				if s.onNewClientConn != nil {
-					if tlscon, ok := rw.(*tls.Conn); ok {
-						s.onNewClientConn(cc, tlscon)
-					} else {
-						s.onNewClientConn(cc, nil)
-					}
-				}
-				err := cc.Run()
-				if err != nil {
-					s.errors(fmt.Errorf("%v: %w", cc.RemoteAddr(), err))
-				}
-			}()
+		if rw == nil {
+			if !backoff.Wait(s.ctx) {
+				return nil
+			}
+			continue
 		}
+		backoff.Reset()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var cc *ClientConn
+			monitor := s.createInactivityMonitor()
+			opts := []coapNet.ConnOption{
+				coapNet.WithHeartBeat(s.heartBeat),
+				coapNet.WithOnReadTimeout(func() error {
+					monitor.CheckInactivity(cc)
+					return nil
+				}),
+			}
+			cc = s.createClientConn(coapNet.NewConn(rw, opts...), monitor)
+			if s.onNewClientConn != nil {
+				if tlscon, ok := rw.(*tls.Conn); ok {
+					s.onNewClientConn(cc, tlscon)
+				} else {
+					s.onNewClientConn(cc, nil)
+				}
+			}
+			s.addConn(cc)
+			defer s.removeConn(cc)
+			err := cc.Run()
+			if err != nil {
+				s.errors(fmt.Errorf("%v: %w", cc.RemoteAddr(), err))
+			}
+		}()
 	}
 }
 
+// Connections returns the connections of the server which are alive, eg. to inspect the peers by RemoteAddr
+// and Stats.
+func (s *Server) Connections() []*ClientConn {
+	s.connsMutex.Lock()
+	defer s.connsMutex.Unlock()
+	conns := make([]*ClientConn, 0, len(s.conns))
+	for cc := range s.conns {
+		conns = append(conns, cc)
+	}
+	return conns
+}
+
+func (s *Server) addConn(cc *ClientConn) {
+	s.connsMutex.Lock()
+	defer s.connsMutex.Unlock()
+	s.conns[cc] = struct{}{}
+}
+
+func (s *Server) removeConn(cc *ClientConn) {
+	s.connsMutex.Lock()
+	defer s.connsMutex.Unlock()
+	delete(s.conns, cc)
+}
+
+// Broadcast writes the message created by buildMsg to all connections of the server concurrently,
+// eg. a notification of a configuration change. See tcp.Broadcast.
+func (s *Server) Broadcast(ctx context.Context, buildMsg func() *pool.Message) error {
+	return Broadcast(ctx, s.Connections(), buildMsg)
+}
+
 // Stop stops server without wait of ends Serve function.
 func (s *Server) Stop() {
 	s.cancel()
@@ -251,25 +328,29 @@ func (s *Server) createClientConn(connection *coapNet.Conn, monitor inactivity.M
 			func(token message.Token) (blockwise.Message, bool) {
 				return nil, false
 			},
+			blockwise.WithBlockCache(s.blockwiseCache),
+			blockwise.WithUploadStreaming(s.blockwiseUploadStreaming),
 		)
 	}
 	obsHandler := NewHandlerContainer()
-	cc := NewClientConn(
-		NewSession(
-			s.ctx,
-			connection,
-			NewObservationHandler(obsHandler, s.handler),
-			s.maxMessageSize,
-			s.goPool,
-			s.errors,
-			s.blockwiseSZX,
-			blockWise,
-			s.disablePeerTCPSignalMessageCSMs,
-			s.disableTCPSignalMessageCSM,
-			true,
-			monitor),
-		obsHandler, kitSync.NewMap(),
-	)
+	session := NewSession(
+		s.ctx,
+		connection,
+		NewObservationHandler(obsHandler, s.handler),
+		s.maxMessageSize,
+		s.goPool,
+		s.errors,
+		s.blockwiseSZX,
+		blockWise,
+		s.disablePeerTCPSignalMessageCSMs,
+		s.disableTCPSignalMessageCSM,
+		true,
+		monitor)
+	session.authorize = s.authorize
+	cc := newClientConn(session, obsHandler, kitSync.NewMap(), s.getToken)
+	if s.onStats != nil && s.statsInterval > 0 {
+		go cc.reportStats(s.statsInterval, s.onStats)
+	}
 
 	return cc
 }
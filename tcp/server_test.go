@@ -5,8 +5,11 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"math/big"
+	"net"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -264,3 +267,236 @@ func TestServer_KeepAliveMonitor(t *testing.T) {
 	checkCloseWg.Wait()
 	require.True(t, inactivityDetected)
 }
+
+func TestServer_ReleaseCompletesRunningHandlers(t *testing.T) {
+	ld, err := coapNet.NewTCPListener("tcp", "")
+	require.NoError(t, err)
+	defer ld.Close()
+
+	handling := make(chan struct{})
+	released := make(chan struct{})
+	sd := tcp.NewServer(tcp.WithHandlerFunc(func(w *tcp.ResponseWriter, r *pool.Message) {
+		close(handling)
+		<-released
+		require.Eventually(t, w.ClientConn().Session().IsReleased, time.Second, time.Millisecond*10)
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("done")))
+		require.NoError(t, err)
+	}))
+	var serverWg sync.WaitGroup
+	defer func() {
+		sd.Stop()
+		serverWg.Wait()
+	}()
+	serverWg.Add(1)
+	go func() {
+		defer serverWg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	cc, err := tcp.Dial(ld.Addr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+	type result struct {
+		code codes.Code
+		err  error
+	}
+	pending := make(chan result, 1)
+	go func() {
+		resp, err := cc.Get(ctx, "/slow")
+		if err != nil {
+			pending <- result{err: err}
+			return
+		}
+		pending <- result{code: resp.Code()}
+	}()
+
+	// the server keeps the released connection until the handler responds
+	<-handling
+	release := pool.AcquireMessage(ctx)
+	defer pool.ReleaseMessage(release)
+	release.SetCode(codes.Release)
+	err = cc.Session().WriteMessage(release)
+	require.NoError(t, err)
+	close(released)
+	r := <-pending
+	require.NoError(t, r.err)
+	require.Equal(t, codes.Content, r.code)
+}
+
+func TestServer_ReleaseCompletesPendingRequests(t *testing.T) {
+	ld, err := coapNet.NewTCPListener("tcp", "")
+	require.NoError(t, err)
+	defer ld.Close()
+
+	releaseSent := make(chan struct{})
+	sd := tcp.NewServer(tcp.WithHandlerFunc(func(w *tcp.ResponseWriter, r *pool.Message) {
+		release := pool.AcquireMessage(r.Context())
+		defer pool.ReleaseMessage(release)
+		release.SetCode(codes.Release)
+		err := w.ClientConn().Session().WriteMessage(release)
+		require.NoError(t, err)
+		close(releaseSent)
+		time.Sleep(time.Millisecond * 200)
+		err = w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("done")))
+		require.NoError(t, err)
+	}))
+	var serverWg sync.WaitGroup
+	defer func() {
+		sd.Stop()
+		serverWg.Wait()
+	}()
+	serverWg.Add(1)
+	go func() {
+		defer serverWg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	cc, err := tcp.Dial(ld.Addr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+	pending := make(chan codes.Code, 1)
+	go func() {
+		resp, err := cc.Get(ctx, "/slow")
+		require.NoError(t, err)
+		pending <- resp.Code()
+	}()
+
+	<-releaseSent
+	require.Eventually(t, cc.Session().IsReleased, time.Second, time.Millisecond*10)
+	_, err = cc.Get(ctx, "/other")
+	require.ErrorIs(t, err, tcp.ErrConnectionReleased)
+
+	require.Equal(t, codes.Content, <-pending)
+	select {
+	case <-cc.Context().Done():
+	case <-ctx.Done():
+		require.FailNow(t, "released connection was not closed")
+	}
+}
+
+func TestServer_RateLimit(t *testing.T) {
+	ld, err := coapNet.NewTCPListener("tcp4", "")
+	require.NoError(t, err)
+	defer ld.Close()
+
+	sd := tcp.NewServer(tcp.WithRateLimit(1, 2), tcp.WithHandlerFunc(func(w *tcp.ResponseWriter, r *pool.Message) {
+		_ = w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("ok")))
+	}))
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer sd.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	cc, err := tcp.Dial(ld.Addr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i := 0; i < 2; i++ {
+		resp, err := cc.Get(ctx, "/a")
+		require.NoError(t, err)
+		require.Equal(t, codes.Content, resp.Code())
+	}
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.TooManyRequests, resp.Code())
+	maxAge, err := resp.MaxAge()
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), maxAge)
+	// signaling messages are not limited
+	err = cc.Ping(ctx)
+	require.NoError(t, err)
+}
+
+func TestServer_CancelContext(t *testing.T) {
+	ld, err := coapNet.NewTCPListener("tcp4", "")
+	require.NoError(t, err)
+	defer ld.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sd := tcp.NewServer(tcp.WithContext(ctx))
+
+	served := make(chan error, 1)
+	go func() {
+		served <- sd.Serve(ld)
+	}()
+
+	cc, err := tcp.Dial(ld.Addr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+	reqCtx, reqCancel := context.WithTimeout(context.Background(), time.Second)
+	defer reqCancel()
+	err = cc.Ping(reqCtx)
+	require.NoError(t, err)
+
+	cancel()
+	select {
+	case err := <-served:
+		require.NoError(t, err)
+	case <-time.After(time.Second * 5):
+		require.FailNow(t, "serve wasn't stopped by the context")
+	}
+	select {
+	case <-cc.Context().Done():
+	case <-time.After(time.Second * 5):
+		require.FailNow(t, "connection wasn't closed by the server")
+	}
+}
+
+type brokenListener struct {
+	accepts uint32
+}
+
+func (l *brokenListener) AcceptWithContext(ctx context.Context) (net.Conn, error) {
+	atomic.AddUint32(&l.accepts, 1)
+	return nil, errors.New("broken listener")
+}
+
+func (l *brokenListener) Close() error {
+	return nil
+}
+
+func TestServer_AcceptErrorBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var errs uint32
+	sd := tcp.NewServer(tcp.WithContext(ctx), tcp.WithErrors(func(err error) {
+		atomic.AddUint32(&errs, 1)
+	}))
+
+	l := &brokenListener{}
+	served := make(chan error, 1)
+	go func() {
+		served <- sd.Serve(l)
+	}()
+
+	time.Sleep(time.Millisecond * 300)
+	cancel()
+	select {
+	case err := <-served:
+		require.NoError(t, err)
+	case <-time.After(time.Second * 5):
+		require.FailNow(t, "serve wasn't stopped by the context")
+	}
+	// 5ms, 10ms, 20ms, 40ms, 80ms, 160ms
+	accepts := atomic.LoadUint32(&l.accepts)
+	require.Greater(t, accepts, uint32(1))
+	require.Less(t, accepts, uint32(10))
+	require.Equal(t, accepts, atomic.LoadUint32(&errs))
+}
@@ -3,16 +3,20 @@ package tcp
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"runtime/debug"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
 	coapNet "github.com/plgd-dev/go-coap/v2/net"
 	"github.com/plgd-dev/go-coap/v2/net/blockwise"
 	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/net/monitor/stats"
 	coapTCP "github.com/plgd-dev/go-coap/v2/tcp/message"
 	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
 )
@@ -34,6 +38,7 @@ type Session struct {
 	errors                          ErrorFunc
 	closeSocket                     bool
 	inactivityMonitor               Notifier
+	stats                           *stats.Counters
 
 	tokenHandlerContainer *HandlerContainer
 	midHandlerContainer   *HandlerContainer
@@ -41,6 +46,8 @@ type Session struct {
 
 	blockwiseSZX blockwise.SZX
 	blockWise    *blockwise.BlockWise
+	// authorize checks the requests before blockwise, so a rejected upload stops at the first block.
+	authorize AuthorizeFunc
 
 	mutex   sync.Mutex
 	onClose []EventFunc
@@ -49,8 +56,23 @@ type Session struct {
 	ctx    atomic.Value
 
 	errSendCSM error
+
+	// exchangesLock protects exchanges and released, which implement the graceful shutdown requested by Release signal.
+	// The exchanges count the requests sent by Do and the running handlers of the received messages.
+	exchangesLock sync.Mutex
+	exchanges     int
+	released      bool
+
+	// aborted is set when the peer closed the connection by the Abort signal.
+	aborted uint32
 }
 
+// releaseTimeout bounds sending of the Release signal when the connection is closed.
+const releaseTimeout = time.Second
+
+// ErrConnectionReleased is returned for new requests when the peer asked for the graceful shutdown by the Release signal.
+var ErrConnectionReleased = errors.New("connection was released by peer")
+
 func NewSession(
 	ctx context.Context,
 	connection *coapNet.Conn,
@@ -88,6 +110,7 @@ func NewSession(
 		disableTCPSignalMessageCSM:      disableTCPSignalMessageCSM,
 		closeSocket:                     closeSocket,
 		inactivityMonitor:               inactivityMonitor,
+		stats:                           stats.NewCounters(),
 	}
 	s.ctx.Store(&ctx)
 
@@ -142,6 +165,78 @@ func (s *Session) Close() error {
 	return nil
 }
 
+// beginExchange registers a new exchange initiated by us. It fails when the peer released the connection.
+func (s *Session) beginExchange() error {
+	s.exchangesLock.Lock()
+	defer s.exchangesLock.Unlock()
+	if s.released {
+		return ErrConnectionReleased
+	}
+	s.exchanges++
+	return nil
+}
+
+// addExchange registers the handling of the message received from the peer, it delays the close of the released connection.
+func (s *Session) addExchange() {
+	s.exchangesLock.Lock()
+	defer s.exchangesLock.Unlock()
+	s.exchanges++
+}
+
+// endExchange unregisters the exchange and closes the released connection after its last exchange.
+func (s *Session) endExchange() {
+	s.exchangesLock.Lock()
+	s.exchanges--
+	closeConn := s.released && s.exchanges == 0
+	s.exchangesLock.Unlock()
+	if closeConn {
+		s.Close()
+	}
+}
+
+// release stops initiating of new exchanges and closes the connection when the pending requests sent by Do
+// and the running handlers are done. Observations and pings don't delay the close.
+func (s *Session) release() {
+	s.exchangesLock.Lock()
+	s.released = true
+	closeConn := s.exchanges == 0
+	s.exchangesLock.Unlock()
+	if closeConn {
+		s.Close()
+	}
+}
+
+// IsReleased reports whether the peer asked for the graceful shutdown of the connection by the Release signal.
+func (s *Session) IsReleased() bool {
+	s.exchangesLock.Lock()
+	defer s.exchangesLock.Unlock()
+	return s.released
+}
+
+func (s *Session) isAborted() bool {
+	return atomic.LoadUint32(&s.aborted) == 1
+}
+
+// sendRelease informs the peer about the graceful shutdown of the connection.
+func (s *Session) sendRelease() error {
+	ctx, cancel := context.WithTimeout(s.Context(), releaseTimeout)
+	defer cancel()
+	req := pool.AcquireMessage(ctx)
+	defer pool.ReleaseMessage(req)
+	req.SetCode(codes.Release)
+	return s.WriteMessage(req)
+}
+
+// sendAbort informs the peer about the abrupt shutdown of the connection.
+func (s *Session) sendAbort() error {
+	ctx, cancel := context.WithTimeout(s.Context(), releaseTimeout)
+	defer cancel()
+	req := pool.AcquireMessage(ctx)
+	defer pool.ReleaseMessage(req)
+	req.SetCode(codes.Abort)
+	return s.WriteMessage(req)
+}
+
 func (s *Session) Sequence() uint64 {
 	return atomic.AddUint64(&s.sequence, 1)
 }
@@ -158,15 +253,46 @@ func (s *Session) PeerBlockWiseTransferEnabled() bool {
 	return atomic.LoadUint32(&s.peerBlockWiseTranferEnabled) == 1
 }
 
+// blockwiseSZXToUse returns SZX of blockwise transfers, BERT is used only when the peer indicated the support by CSM.
+func (s *Session) blockwiseSZXToUse() blockwise.SZX {
+	if s.blockwiseSZX == blockwise.SZXBERT && !s.PeerBlockWiseTransferEnabled() {
+		return blockwise.SZX1024
+	}
+	return s.blockwiseSZX
+}
+
+// blockwiseMaxMessageSize returns max message size for blocks, which is the lower one of both sides.
+// It bounds size of BERT blocks.
+func (s *Session) blockwiseMaxMessageSize() int {
+	peerMaxMessageSize := int(s.PeerMaxMessageSize())
+	if peerMaxMessageSize > 0 && (s.maxMessageSize < 0 || peerMaxMessageSize < s.maxMessageSize) {
+		return peerMaxMessageSize
+	}
+	return s.maxMessageSize
+}
+
 func (s *Session) handleBlockwise(w *ResponseWriter, r *pool.Message) {
+	if !authorizeRequest(s.authorize, w, r) {
+		return
+	}
 	if s.blockWise != nil && s.PeerBlockWiseTransferEnabled() {
 		bwr := bwResponseWriter{
 			w: w,
 		}
-		s.blockWise.Handle(&bwr, r, s.blockwiseSZX, s.maxMessageSize, func(bw blockwise.ResponseWriter, br blockwise.Message) {
+		s.blockWise.Handle(&bwr, r, s.blockwiseSZXToUse(), s.blockwiseMaxMessageSize(), func(bw blockwise.ResponseWriter, br blockwise.Message) {
 			h, err := s.tokenHandlerContainer.Pop(r.Token())
-			w := bw.(*bwResponseWriter).w
 			r := br.(*pool.Message)
+			cc := w.ClientConn()
+			var w *ResponseWriter
+			if bwr, ok := bw.(*bwResponseWriter); ok {
+				w = bwr.w
+			} else {
+				// the streamed request is handled out of the exchange of the block
+				w = NewResponseWriter(bw.Message().(*pool.Message), cc, r.Options())
+				defer func() {
+					bw.SetMessage(w.response)
+				}()
+			}
 			if err == nil {
 				h(w, r)
 				return
@@ -206,11 +332,14 @@ func (s *Session) handleSignals(r *pool.Message, cc *ClientConn) bool {
 		if r.HasOption(coapTCP.AlternativeAddress) {
 			//TODO
 		}
+		s.release()
 		return true
 	case codes.Abort:
 		if r.HasOption(coapTCP.BadCSMOption) {
 			//TODO
 		}
+		atomic.StoreUint32(&s.aborted, 1)
+		s.Close()
 		return true
 	case codes.Pong:
 		h, err := s.tokenHandlerContainer.Pop(r.Token())
@@ -247,11 +376,31 @@ func (s *Session) TokenHandler() *HandlerContainer {
 	return s.tokenHandlerContainer
 }
 
+// handleWithRecover calls the handler and turns its panic to the 5.00 Internal Server Error response,
+// so the panic is reported via errors and it doesn't crash the process.
+func (s *Session) handleWithRecover(handler func(w *ResponseWriter, r *pool.Message), w *ResponseWriter, r *pool.Message) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			s.errors(fmt.Errorf("handler panics: %v\n%s", rec, debug.Stack()))
+			w.response.SetCode(codes.InternalServerError)
+			w.response.ResetOptionsTo(nil)
+			w.response.SetBody(nil)
+		}
+	}()
+	handler(w, r)
+}
+
 func (s *Session) processReq(req *pool.Message, cc *ClientConn, handler func(w *ResponseWriter, r *pool.Message)) {
 	origResp := pool.AcquireMessage(s.Context())
 	origResp.SetToken(req.Token())
 	w := NewResponseWriter(origResp, cc, req.Options())
-	handler(w, req)
+	var reqToken [message.MaxTokenSize]byte
+	reqTokenLen := copy(reqToken[:], req.Token())
+	s.handleWithRecover(handler, w, req)
+	if w.response.IsModified() && len(w.response.Token()) == 0 {
+		// the response is correlated with the request by the token, so keep it when the handler dropped it
+		w.response.SetToken(reqToken[:reqTokenLen])
+	}
 	defer pool.ReleaseMessage(w.response)
 	if !req.IsHijacked() {
 		pool.ReleaseMessage(req)
@@ -301,13 +450,21 @@ func (s *Session) processBuffer(buffer *bytes.Buffer, cc *ClientConn) error {
 			}
 		}
 		req.SetSequence(s.Sequence())
+		s.stats.MessageReceived(req.Code(), readed)
 		s.inactivityMonitor.Notify()
 		if s.handleSignals(req, cc) {
 			continue
 		}
-		s.goPool(func() {
+		s.addExchange()
+		err = s.goPool(func() {
+			defer s.endExchange()
 			s.processReq(req, cc, s.Handle)
 		})
+		if err != nil {
+			s.endExchange()
+			pool.ReleaseMessage(req)
+			s.errors(fmt.Errorf("cannot handle request from %v: %w", s.connection.RemoteAddr(), err))
+		}
 	}
 	return nil
 }
@@ -321,9 +478,15 @@ func (s *Session) WriteMessage(req *pool.Message) error {
 	if err != nil {
 		return fmt.Errorf("cannot write to connection: %w", err)
 	}
+	s.stats.MessageSent(req.Code(), len(data))
 	return err
 }
 
+// Stats returns statistics of the connection.
+func (s *Session) Stats() stats.Stats {
+	return s.stats.Stats()
+}
+
 func (s *Session) sendCSM() error {
 	token, err := message.GetToken()
 	if err != nil {
@@ -333,6 +496,13 @@ func (s *Session) sendCSM() error {
 	defer pool.ReleaseMessage(req)
 	req.SetCode(codes.CSM)
 	req.SetToken(token)
+	if s.maxMessageSize >= 0 {
+		req.SetOptionUint32(coapTCP.MaxMessageSize, uint32(s.maxMessageSize))
+	}
+	if s.blockWise != nil {
+		// https://tools.ietf.org/html/rfc8323#section-5.3.2 - indicates support of blockwise transfers including BERT
+		req.SetOptionBytes(coapTCP.BlockWiseTransfer, nil)
+	}
 	return s.WriteMessage(req)
 }
 
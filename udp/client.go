@@ -9,6 +9,7 @@ import (
 
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+	"github.com/plgd-dev/go-coap/v2/net/clock"
 	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
 	kitSync "github.com/plgd-dev/kit/sync"
 
@@ -47,6 +48,7 @@ var defaultDialOptions = dialOptions{
 	transmissionAcknowledgeTimeout: time.Second * 2,
 	transmissionMaxRetransmit:      4,
 	getMID:                         udpMessage.GetMID,
+	getToken:                       message.GetToken,
 	createInactivityMonitor: func() inactivity.Monitor {
 		return inactivity.NewNilMonitor()
 	},
@@ -67,7 +69,14 @@ type dialOptions struct {
 	transmissionNStart             time.Duration
 	transmissionAcknowledgeTimeout time.Duration
 	transmissionMaxRetransmit      int
+	newCongestionControl           client.NewCongestionControlFunc
+	clock                          clock.Clock
+	onSend                         MessageFunc
+	onReceive                      MessageFunc
+	onStats                        StatsFunc
+	statsInterval                  time.Duration
 	getMID                         GetMIDFunc
+	getToken                       GetTokenFunc
 	closeSocket                    bool
 	createInactivityMonitor        func() inactivity.Monitor
 }
@@ -174,16 +183,32 @@ func Client(conn *net.UDPConn, opts ...DialOption) *client.ClientConn {
 		cfg.maxMessageSize,
 		cfg.closeSocket,
 	)
-	cc = client.NewClientConn(session,
-		observationTokenHandler, observatioRequests, cfg.transmissionNStart, cfg.transmissionAcknowledgeTimeout, cfg.transmissionMaxRetransmit,
-		client.NewObservationHandler(observationTokenHandler, cfg.handler),
-		cfg.blockwiseSZX,
-		blockWise,
-		cfg.goPool,
-		cfg.errors,
-		cfg.getMID,
-		monitor,
-	)
+	var congestionControl client.CongestionControl
+	if cfg.newCongestionControl != nil {
+		congestionControl = cfg.newCongestionControl()
+	}
+	cc = client.New(client.ConnConfig{
+		Session:                        session,
+		ObservationTokenHandler:        observationTokenHandler,
+		ObservationRequests:            observatioRequests,
+		TransmissionNStart:             cfg.transmissionNStart,
+		TransmissionAcknowledgeTimeout: cfg.transmissionAcknowledgeTimeout,
+		TransmissionMaxRetransmit:      cfg.transmissionMaxRetransmit,
+		Handler:                        client.NewObservationHandler(observationTokenHandler, client.NewResetUnknownResponseHandler(cfg.handler)),
+		BlockwiseSZX:                   cfg.blockwiseSZX,
+		BlockWise:                      blockWise,
+		GoPool:                         cfg.goPool,
+		Errors:                         cfg.errors,
+		GetMID:                         cfg.getMID,
+		GetToken:                       cfg.getToken,
+		ActivityMonitor:                monitor,
+		CongestionControl:              congestionControl,
+		Clock:                          cfg.clock,
+		OnSend:                         cfg.onSend,
+		OnReceive:                      cfg.onReceive,
+		OnStats:                        cfg.onStats,
+		StatsInterval:                  cfg.statsInterval,
+	})
 
 	go func() {
 		err := cc.Run()
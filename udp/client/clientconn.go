@@ -2,17 +2,24 @@ package client
 
 import (
 	"context"
+	cryptoRand "crypto/rand"
+	"encoding/binary"
 	"fmt"
 	"io"
+	"math/rand"
 	"net"
+	"runtime/debug"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	atomicTypes "go.uber.org/atomic"
 
-	"github.com/patrickmn/go-cache"
 	"github.com/plgd-dev/go-coap/v2/message"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
 	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+	"github.com/plgd-dev/go-coap/v2/net/clock"
+	"github.com/plgd-dev/go-coap/v2/net/monitor/stats"
 
 	"github.com/plgd-dev/go-coap/v2/message/codes"
 	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
@@ -25,14 +32,25 @@ type ErrorFunc = func(error)
 type GoPoolFunc = func(func()) error
 type EventFunc = func()
 type GetMIDFunc = func() uint16
+type GetTokenFunc = func() (message.Token, error)
+type MessageFunc = func(*pool.Message)
+type StatsFunc = func(cc *ClientConn, s stats.Stats)
 
+// Session is the transport of ClientConn, eg. the udp session, dtls.Session or TransportSession.
+// ClientConn only writes the messages to the session, so an implementation which records them
+// tests the retransmissions and blockwise transfers without a socket.
 type Session interface {
+	// Context is canceled when the session is closed.
 	Context() context.Context
+	// Close cancels the context, Run returns then.
 	Close() error
 	MaxMessageSize() int
 	RemoteAddr() net.Addr
+	// WriteMessage sends the message to the peer.
 	WriteMessage(req *pool.Message) error
+	// Run passes the received messages to cc.Process until the session is closed.
 	Run(cc *ClientConn) error
+	// AddOnClose registers f to be called when Run ends.
 	AddOnClose(f EventFunc)
 	SetContextValue(key interface{}, val interface{})
 }
@@ -51,18 +69,34 @@ type ClientConn struct {
 	handler                 HandlerFunc
 	observationTokenHandler *HandlerContainer
 	observationRequests     *kitSync.Map
+	observations            *kitSync.Map
+	lostObservationsMutex   sync.Mutex
+	lostObservations        []*Observation
 	transmission            *Transmission
 	blockwiseSZX            blockwise.SZX
 	blockWise               *blockwise.BlockWise
 	goPool                  GoPoolFunc
 	errors                  ErrorFunc
 	getMID                  GetMIDFunc
-	responseMsgCache        *cache.Cache
+	getToken                GetTokenFunc
+	dedupStore              DedupStore
 	msgIdMutex              *MutexMap
 	activityMonitor         Notifier
+	stats                   *stats.Counters
+	congestionControl       CongestionControl
+	clock                   clock.Clock
+	multicastLeisure        time.Duration
+	separateResponse        bool
+	authorize               AuthorizeFunc
+	onSend                  MessageFunc
+	onReceive               MessageFunc
 
 	tokenHandlerContainer *HandlerContainer
 	midHandlerContainer   *HandlerContainer
+
+	// leisureRand draws the delays of the multicast responses, so the servers started at the same time don't answer together.
+	leisureRand      *rand.Rand
+	leisureRandMutex sync.Mutex
 }
 
 // Transmission is a threadsafe container for transmission related parameters
@@ -88,7 +122,143 @@ func (cc *ClientConn) Transmission() *Transmission {
 	return cc.transmission
 }
 
+// ConnConfig configures the connection created by New. The zero values of Errors, GetMID and GetToken
+// are replaced by the defaults, the nil ObservationTokenHandler and ObservationRequests by the empty ones.
+type ConnConfig struct {
+	Session                 Session
+	ObservationTokenHandler *HandlerContainer
+	ObservationRequests     *kitSync.Map
+
+	TransmissionNStart             time.Duration
+	TransmissionAcknowledgeTimeout time.Duration
+	TransmissionMaxRetransmit      int
+
+	Handler      HandlerFunc
+	BlockwiseSZX blockwise.SZX
+	BlockWise    *blockwise.BlockWise
+
+	GoPool            GoPoolFunc
+	Errors            ErrorFunc
+	GetMID            GetMIDFunc
+	GetToken          GetTokenFunc
+	ActivityMonitor   Notifier
+	CongestionControl CongestionControl
+	// Clock drives the retransmissions and the lifetime of the remembered responses, the nil means clock.Real.
+	Clock clock.Clock
+	// MulticastLeisure bounds the random delay of the responses to the requests handled by ProcessMulticast.
+	MulticastLeisure time.Duration
+	// OnSend is called with every outgoing message right before it's marshalled, including retransmissions,
+	// so it should set options instead of adding them.
+	OnSend MessageFunc
+	// OnReceive is called with every incoming message right after it's unmarshalled, before it's handled.
+	OnReceive MessageFunc
+	// OnStats is called with the statistics of the connection every StatsInterval until the connection is closed.
+	OnStats       StatsFunc
+	StatsInterval time.Duration
+	// DedupStore remembers the responses for the deduplication, the nil means a store of the connection.
+	DedupStore DedupStore
+	// SeparateResponse acknowledges a confirmable request by an empty ACK when the handler doesn't respond
+	// within the half of TransmissionAcknowledgeTimeout, the response is then sent as a separate confirmable message.
+	SeparateResponse bool
+	// Authorize checks every request before it's handled, a request sent in blocks is checked with each block,
+	// so a rejected upload stops at the first block.
+	Authorize AuthorizeFunc
+}
+
+// New creates connection over the session of cfg.
+func New(cfg ConnConfig) *ClientConn {
+	if cfg.Errors == nil {
+		cfg.Errors = func(error) {}
+	}
+	if cfg.GetMID == nil {
+		cfg.GetMID = udpMessage.GetMID
+	}
+	if cfg.GetToken == nil {
+		cfg.GetToken = message.GetToken
+	}
+	if cfg.ObservationTokenHandler == nil {
+		cfg.ObservationTokenHandler = NewHandlerContainer()
+	}
+	if cfg.ObservationRequests == nil {
+		cfg.ObservationRequests = kitSync.NewMap()
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = clock.Real
+	}
+	if cfg.DedupStore == nil {
+		cfg.DedupStore = newMemoryDedupStore(cfg.Clock)
+	}
+
+	cc := &ClientConn{
+		session:                 cfg.Session,
+		observationTokenHandler: cfg.ObservationTokenHandler,
+		observationRequests:     cfg.ObservationRequests,
+		observations:            kitSync.NewMap(),
+		transmission: &Transmission{
+			atomicTypes.NewDuration(cfg.TransmissionNStart),
+			atomicTypes.NewDuration(cfg.TransmissionAcknowledgeTimeout),
+			atomicTypes.NewInt32(int32(cfg.TransmissionMaxRetransmit)),
+		},
+		handler:      cfg.Handler,
+		blockwiseSZX: cfg.BlockwiseSZX,
+		blockWise:    cfg.BlockWise,
+
+		tokenHandlerContainer: NewHandlerContainer(),
+		midHandlerContainer:   NewHandlerContainer(),
+		goPool:                cfg.GoPool,
+		errors:                cfg.Errors,
+		getMID:                cfg.GetMID,
+		getToken:              cfg.GetToken,
+		dedupStore:            cfg.DedupStore,
+		msgIdMutex:            NewMutexMap(),
+		activityMonitor:       cfg.ActivityMonitor,
+		stats:                 stats.NewCounters(),
+		congestionControl:     cfg.CongestionControl,
+		clock:                 cfg.Clock,
+		multicastLeisure:      cfg.MulticastLeisure,
+		separateResponse:      cfg.SeparateResponse,
+		authorize:             cfg.Authorize,
+		onSend:                cfg.OnSend,
+		onReceive:             cfg.OnReceive,
+	}
+	if cfg.MulticastLeisure > 0 {
+		cc.leisureRand = newLeisureRand()
+	}
+	if cfg.Session != nil {
+		cfg.Session.AddOnClose(cc.closeObservations)
+		if cfg.OnStats != nil && cfg.StatsInterval > 0 {
+			go cc.reportStats(cfg.StatsInterval, cfg.OnStats)
+		}
+	}
+	return cc
+}
+
+// reportStats calls onStats with the statistics of the connection every interval until the connection is closed.
+func (cc *ClientConn) reportStats(interval time.Duration, onStats StatsFunc) {
+	for {
+		t := cc.clock.NewTimer(interval)
+		select {
+		case <-t.C():
+			onStats(cc, cc.Stats())
+		case <-cc.Context().Done():
+			t.Stop()
+			return
+		}
+	}
+}
+
+// newLeisureRand creates the source of the multicast leisure seeded from crypto/rand.
+func newLeisureRand() *rand.Rand {
+	var seed [8]byte
+	if _, err := io.ReadFull(cryptoRand.Reader, seed[:]); err != nil {
+		return rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(seed[:]))))
+}
+
 // NewClientConn creates connection over session and observation.
+//
+// Deprecated: use New, the named fields of ConnConfig can't be mixed up.
 func NewClientConn(
 	session Session,
 	observationTokenHandler *HandlerContainer,
@@ -104,42 +274,47 @@ func NewClientConn(
 	getMID GetMIDFunc,
 	activityMonitor Notifier,
 ) *ClientConn {
-	if errors == nil {
-		errors = func(error) {}
-	}
-	if getMID == nil {
-		getMID = udpMessage.GetMID
-	}
-
-	return &ClientConn{
-		session:                 session,
-		observationTokenHandler: observationTokenHandler,
-		observationRequests:     observationRequests,
-		transmission: &Transmission{
-			atomicTypes.NewDuration(transmissionNStart),
-			atomicTypes.NewDuration(transmissionAcknowledgeTimeout),
-			atomicTypes.NewInt32(int32(transmissionMaxRetransmit)),
-		},
-		handler:      handler,
-		blockwiseSZX: blockwiseSZX,
-		blockWise:    blockWise,
-
-		tokenHandlerContainer: NewHandlerContainer(),
-		midHandlerContainer:   NewHandlerContainer(),
-		goPool:                goPool,
-		errors:                errors,
-		getMID:                getMID,
-		// EXCHANGE_LIFETIME = 247
-		responseMsgCache: cache.New(247*time.Second, 60*time.Second),
-		msgIdMutex:       NewMutexMap(),
-		activityMonitor:  activityMonitor,
-	}
+	return New(ConnConfig{
+		Session:                        session,
+		ObservationTokenHandler:        observationTokenHandler,
+		ObservationRequests:            observationRequests,
+		TransmissionNStart:             transmissionNStart,
+		TransmissionAcknowledgeTimeout: transmissionAcknowledgeTimeout,
+		TransmissionMaxRetransmit:      transmissionMaxRetransmit,
+		Handler:                        handler,
+		BlockwiseSZX:                   blockwiseSZX,
+		BlockWise:                      blockWise,
+		GoPool:                         goPool,
+		Errors:                         errors,
+		GetMID:                         getMID,
+		ActivityMonitor:                activityMonitor,
+	})
 }
 
 func (cc *ClientConn) Session() Session {
 	return cc.session
 }
 
+// Stats returns statistics of the connection.
+func (cc *ClientConn) Stats() stats.Stats {
+	return cc.stats.Stats()
+}
+
+func (cc *ClientConn) writeToSession(req *pool.Message) error {
+	if cc.onSend != nil {
+		cc.onSend(req)
+	}
+	err := cc.session.WriteMessage(req)
+	if err != nil {
+		return err
+	}
+	size, err := req.Size()
+	if err == nil {
+		cc.stats.MessageSent(req.Code(), size)
+	}
+	return nil
+}
+
 // Close closes connection without wait of ends Run function.
 func (cc *ClientConn) Close() error {
 	return cc.session.Close()
@@ -165,11 +340,11 @@ func (cc *ClientConn) do(req *pool.Message) (*pool.Message, error) {
 	defer cc.tokenHandlerContainer.Pop(token)
 	err = cc.writeMessage(req)
 	if err != nil {
-		return nil, fmt.Errorf("cannot write request: %w", err)
+		return nil, fmt.Errorf("cannot write request: %w", coapNet.ContextError(err))
 	}
 	select {
 	case <-req.Context().Done():
-		return nil, req.Context().Err()
+		return nil, coapNet.ContextError(req.Context().Err())
 	case <-cc.session.Context().Done():
 		return nil, fmt.Errorf("connection was closed: %w", cc.session.Context().Err())
 	case resp := <-respChan:
@@ -180,7 +355,8 @@ func (cc *ClientConn) do(req *pool.Message) (*pool.Message, error) {
 // Do sends an coap message and returns an coap response.
 //
 // An error is returned if by failure to speak COAP (such as a network connectivity problem).
-// Any status code doesn't cause an error.
+// Any status code doesn't cause an error, use pool.CheckResponse to get *pool.ResponseError for a non-success one.
+// A request which isn't answered in time fails with an error matching coapNet.ErrTimeout.
 //
 // Caller is responsible to release request and response.
 func (cc *ClientConn) Do(req *pool.Message) (*pool.Message, error) {
@@ -199,10 +375,12 @@ func (cc *ClientConn) Do(req *pool.Message) (*pool.Message, error) {
 func (cc *ClientConn) writeMessage(req *pool.Message) error {
 	req.SetMessageID(cc.getMID())
 	respChan := make(chan struct{})
+	var reset bool
 
 	// Only confirmable messages ever match an message ID
 	if req.Type() == udpMessage.Confirmable {
 		err := cc.midHandlerContainer.Insert(req.MessageID(), func(w *ResponseWriter, r *pool.Message) {
+			reset = r.Type() == udpMessage.Reset
 			close(respChan)
 			if r.IsSeparate() {
 				// separate message - just accept
@@ -216,43 +394,72 @@ func (cc *ClientConn) writeMessage(req *pool.Message) error {
 		defer cc.midHandlerContainer.Pop(req.MessageID())
 	}
 
-	err := cc.session.WriteMessage(req)
+	sent := cc.clock.Now()
+	retransmissions := 0
+	ackTimeout := cc.transmission.acknowledgeTimeout.Load()
+	if cc.congestionControl != nil {
+		ackTimeout = cc.congestionControl.RTO()
+	}
+	err := cc.writeToSession(req)
 	if err != nil {
 		return fmt.Errorf("cannot write request: %w", err)
 	}
 	if req.Type() != udpMessage.Confirmable {
-		// If the request is not confirmable, we do not need to wait for a response
+		// If the request is not confirmable, we do not need to wait for an acknowledgement
 		// and skip retransmissions
-		close(respChan)
+		return nil
 	}
 
 	maxRetransmit := cc.transmission.maxRetransmit.Load()
 	for i := int32(0); i < maxRetransmit; i++ {
+		ackTimer := cc.clock.NewTimer(ackTimeout)
 		select {
 		case <-respChan:
+			ackTimer.Stop()
+			if reset {
+				return coapNet.ErrConnReset
+			}
+			if retransmissions == 0 {
+				// RTT of retransmitted message is ambiguous: https://tools.ietf.org/html/rfc6298#section-3
+				cc.stats.UpdateRTT(cc.clock.Now().Sub(sent))
+			}
+			if cc.congestionControl != nil {
+				cc.congestionControl.OnRTTSample(cc.clock.Now().Sub(sent), retransmissions)
+			}
 			return nil
 		case <-req.Context().Done():
-			return req.Context().Err()
+			ackTimer.Stop()
+			return coapNet.ContextError(req.Context().Err())
 		case <-cc.Context().Done():
+			ackTimer.Stop()
 			return fmt.Errorf("connection was closed: %w", cc.Context().Err())
-		case <-time.After(cc.transmission.acknowledgeTimeout.Load()):
+		case <-ackTimer.C():
+			nStartTimer := cc.clock.NewTimer(cc.transmission.nStart.Load())
 			select {
 			case <-req.Context().Done():
-				return req.Context().Err()
+				nStartTimer.Stop()
+				return coapNet.ContextError(req.Context().Err())
 			case <-cc.session.Context().Done():
+				nStartTimer.Stop()
 				return fmt.Errorf("connection was closed: %w", cc.Context().Err())
-			case <-time.After(cc.transmission.nStart.Load()):
-				err = cc.session.WriteMessage(req)
+			case <-nStartTimer.C():
+				err = cc.writeToSession(req)
 				if err != nil {
 					return fmt.Errorf("cannot write request: %w", err)
 				}
+				retransmissions++
+				cc.stats.Retransmission()
+				if cc.congestionControl != nil {
+					ackTimeout = cc.congestionControl.BackOff(ackTimeout)
+				}
 			}
 		}
 	}
-	return fmt.Errorf("timeout: retransmission(%v) was exhausted", cc.transmission.maxRetransmit.Load())
+	return fmt.Errorf("%w: retransmission(%v) was exhausted", coapNet.ErrTimeout, cc.transmission.maxRetransmit.Load())
 }
 
-// WriteMessage sends an coap message.
+// WriteMessage sends an coap message. A Confirmable message is retransmitted until it's acknowledged,
+// a NonConfirmable one (req.SetType(udpMessage.NonConfirmable)) is sent exactly once, eg. for telemetry.
 func (cc *ClientConn) WriteMessage(req *pool.Message) error {
 	if cc.blockWise == nil {
 		return cc.writeMessage(req)
@@ -275,14 +482,14 @@ func (cc *ClientConn) doWithMID(req *pool.Message) (*pool.Message, error) {
 		return nil, fmt.Errorf("cannot insert mid handler: %w", err)
 	}
 	defer cc.midHandlerContainer.Pop(req.MessageID())
-	err = cc.session.WriteMessage(req)
+	err = cc.writeToSession(req)
 	if err != nil {
 		return nil, fmt.Errorf("cannot write request: %w", err)
 	}
 
 	select {
 	case <-req.Context().Done():
-		return nil, req.Context().Err()
+		return nil, coapNet.ContextError(req.Context().Err())
 	case <-cc.session.Context().Done():
 		return nil, fmt.Errorf("connection was closed: %w", cc.session.Context().Err())
 	case resp := <-respChan:
@@ -290,25 +497,61 @@ func (cc *ClientConn) doWithMID(req *pool.Message) (*pool.Message, error) {
 	}
 }
 
-func newCommonRequest(ctx context.Context, code codes.Code, path string, opts ...message.Option) (*pool.Message, error) {
-	token, err := message.GetToken()
-	if err != nil {
-		return nil, fmt.Errorf("cannot get token: %w", err)
+// maxGetTokenAttempts limits attempts to generate a token which is not in flight.
+const maxGetTokenAttempts = 16
+
+// generateToken generates token which is not used by a pending request or an observation.
+func (cc *ClientConn) generateToken() (message.Token, error) {
+	for i := 0; i < maxGetTokenAttempts; i++ {
+		token, err := cc.getToken()
+		if err != nil {
+			return nil, fmt.Errorf("cannot get token: %w", err)
+		}
+		if _, err := cc.tokenHandlerContainer.Get(token); err == nil {
+			continue
+		}
+		if _, err := cc.observationTokenHandler.Get(token.String()); err == nil {
+			continue
+		}
+		return token, nil
 	}
+	return nil, fmt.Errorf("cannot get token: %w", ErrKeyAlreadyExists)
+}
+
+func newCommonRequest(ctx context.Context, token message.Token, code codes.Code, path string, opts ...message.Option) *pool.Message {
 	req := pool.AcquireMessage(ctx)
 	req.SetCode(code)
 	req.SetToken(token)
 	req.ResetOptionsTo(opts)
 	req.SetPath(path)
+	if tc, ok := message.TraceContextFromContext(ctx); ok && !req.HasOption(message.TraceParent) {
+		req.SetTraceContext(tc)
+	}
 	req.SetType(udpMessage.Confirmable)
-	return req, nil
+	return req
+}
+
+// newRequest creates request with the token generated by message.GetToken.
+func newRequest(ctx context.Context, code codes.Code, path string, opts ...message.Option) (*pool.Message, error) {
+	token, err := message.GetToken()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get token: %w", err)
+	}
+	return newCommonRequest(ctx, token, code, path, opts...), nil
+}
+
+func setPayload(req *pool.Message, contentFormat message.MediaType, payload io.ReadSeeker) {
+	if payload != nil {
+		req.SetContentFormat(contentFormat)
+		req.SetBody(payload)
+	}
 }
 
 // NewGetRequest creates get request.
 //
 // Use ctx to set timeout.
 func NewGetRequest(ctx context.Context, path string, opts ...message.Option) (*pool.Message, error) {
-	return newCommonRequest(ctx, codes.GET, path, opts...)
+	return newRequest(ctx, codes.GET, path, opts...)
 }
 
 // Get issues a GET to the specified path.
@@ -318,10 +561,11 @@ func NewGetRequest(ctx context.Context, path string, opts ...message.Option) (*p
 // An error is returned if by failure to speak COAP (such as a network connectivity problem).
 // Any status code doesn't cause an error.
 func (cc *ClientConn) Get(ctx context.Context, path string, opts ...message.Option) (*pool.Message, error) {
-	req, err := NewGetRequest(ctx, path, opts...)
+	token, err := cc.generateToken()
 	if err != nil {
 		return nil, fmt.Errorf("cannot create get request: %w", err)
 	}
+	req := newCommonRequest(ctx, token, codes.GET, path, opts...)
 	defer pool.ReleaseMessage(req)
 	return cc.Do(req)
 }
@@ -335,14 +579,11 @@ func (cc *ClientConn) Get(ctx context.Context, path string, opts ...message.Opti
 //
 // If payload is nil then content format is not used.
 func NewPostRequest(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
-	req, err := newCommonRequest(ctx, codes.POST, path, opts...)
+	req, err := newRequest(ctx, codes.POST, path, opts...)
 	if err != nil {
 		return nil, err
 	}
-	if payload != nil {
-		req.SetContentFormat(contentFormat)
-		req.SetBody(payload)
-	}
+	setPayload(req, contentFormat, payload)
 	return req, nil
 }
 
@@ -355,11 +596,13 @@ func NewPostRequest(ctx context.Context, path string, contentFormat message.Medi
 //
 // If payload is nil then content format is not used.
 func (cc *ClientConn) Post(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
-	req, err := NewPostRequest(ctx, path, contentFormat, payload, opts...)
+	token, err := cc.generateToken()
 	if err != nil {
 		return nil, fmt.Errorf("cannot create post request: %w", err)
 	}
+	req := newCommonRequest(ctx, token, codes.POST, path, opts...)
 	defer pool.ReleaseMessage(req)
+	setPayload(req, contentFormat, payload)
 	return cc.Do(req)
 }
 
@@ -369,14 +612,11 @@ func (cc *ClientConn) Post(ctx context.Context, path string, contentFormat messa
 //
 // If payload is nil then content format is not used.
 func NewPutRequest(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
-	req, err := newCommonRequest(ctx, codes.PUT, path, opts...)
+	req, err := newRequest(ctx, codes.PUT, path, opts...)
 	if err != nil {
 		return nil, err
 	}
-	if payload != nil {
-		req.SetContentFormat(contentFormat)
-		req.SetBody(payload)
-	}
+	setPayload(req, contentFormat, payload)
 	return req, nil
 }
 
@@ -389,11 +629,13 @@ func NewPutRequest(ctx context.Context, path string, contentFormat message.Media
 //
 // If payload is nil then content format is not used.
 func (cc *ClientConn) Put(ctx context.Context, path string, contentFormat message.MediaType, payload io.ReadSeeker, opts ...message.Option) (*pool.Message, error) {
-	req, err := NewPutRequest(ctx, path, contentFormat, payload, opts...)
+	token, err := cc.generateToken()
 	if err != nil {
 		return nil, fmt.Errorf("cannot create put request: %w", err)
 	}
+	req := newCommonRequest(ctx, token, codes.PUT, path, opts...)
 	defer pool.ReleaseMessage(req)
+	setPayload(req, contentFormat, payload)
 	return cc.Do(req)
 }
 
@@ -401,17 +643,18 @@ func (cc *ClientConn) Put(ctx context.Context, path string, contentFormat messag
 //
 // Use ctx to set timeout.
 func NewDeleteRequest(ctx context.Context, path string, opts ...message.Option) (*pool.Message, error) {
-	return newCommonRequest(ctx, codes.DELETE, path, opts...)
+	return newRequest(ctx, codes.DELETE, path, opts...)
 }
 
 // Delete deletes the resource identified by the request path.
 //
 // Use ctx to set timeout.
 func (cc *ClientConn) Delete(ctx context.Context, path string, opts ...message.Option) (*pool.Message, error) {
-	req, err := NewDeleteRequest(ctx, path, opts...)
+	token, err := cc.generateToken()
 	if err != nil {
 		return nil, fmt.Errorf("cannot create delete request: %w", err)
 	}
+	req := newCommonRequest(ctx, token, codes.DELETE, path, opts...)
 	defer pool.ReleaseMessage(req)
 	return cc.Do(req)
 }
@@ -455,15 +698,17 @@ func (cc *ClientConn) AsyncPing(receivedPong func()) (func(), error) {
 	req.SetCode(codes.Empty)
 	mid := cc.getMID()
 	req.SetMessageID(mid)
+	sent := cc.clock.Now()
 	err := cc.midHandlerContainer.Insert(mid, func(w *ResponseWriter, r *pool.Message) {
 		if r.Type() == udpMessage.Reset || r.Type() == udpMessage.Acknowledgement {
+			cc.stats.UpdateRTT(cc.clock.Now().Sub(sent))
 			receivedPong()
 		}
 	})
 	if err != nil {
 		return nil, fmt.Errorf("cannot insert mid handler: %w", err)
 	}
-	err = cc.session.WriteMessage(req)
+	err = cc.writeToSession(req)
 	if err != nil {
 		cc.midHandlerContainer.Pop(mid)
 		return nil, fmt.Errorf("cannot write request: %w", err)
@@ -487,8 +732,25 @@ func (cc *ClientConn) RemoteAddr() net.Addr {
 	return cc.session.RemoteAddr()
 }
 
+// sendPong answers CoAP ping by Reset message: https://tools.ietf.org/html/rfc7252#section-4.3
 func (cc *ClientConn) sendPong(w *ResponseWriter, r *pool.Message) {
-	w.SetResponse(codes.Empty, message.TextPlain, nil)
+	w.SendReset()
+}
+
+// NewResetUnknownResponseHandler rejects a confirmable or non-confirmable response which doesn't match any
+// request by Reset message: https://tools.ietf.org/html/rfc7252#section-4.2. A handler for the responses of known
+// tokens, eg. observations or multicast requests, must run before it. An unmatched acknowledgement is ignored
+// as the rfc requires. Other messages are passed to next.
+func NewResetUnknownResponseHandler(next HandlerFunc) HandlerFunc {
+	return func(w *ResponseWriter, r *pool.Message) {
+		if r.Code().IsResponse() {
+			if r.Type() == udpMessage.Confirmable || r.Type() == udpMessage.NonConfirmable {
+				w.SendReset()
+			}
+			return
+		}
+		next(w, r)
+	}
 }
 
 type bwResponseWriter struct {
@@ -509,14 +771,26 @@ func (b *bwResponseWriter) RemoteAddr() net.Addr {
 }
 
 func (cc *ClientConn) handleBW(w *ResponseWriter, r *pool.Message) {
+	if !authorizeRequest(cc.authorize, w, r) {
+		return
+	}
 	if cc.blockWise != nil {
 		bwr := bwResponseWriter{
 			w: w,
 		}
 		cc.blockWise.Handle(&bwr, r, cc.blockwiseSZX, cc.session.MaxMessageSize(), func(bw blockwise.ResponseWriter, br blockwise.Message) {
 			h, err := cc.tokenHandlerContainer.Pop(r.Token())
-			w := bw.(*bwResponseWriter).w
 			r := br.(*pool.Message)
+			var w *ResponseWriter
+			if bwr, ok := bw.(*bwResponseWriter); ok {
+				w = bwr.w
+			} else {
+				// the streamed request is handled out of the exchange of the block
+				w = NewResponseWriter(bw.Message().(*pool.Message), cc, r.Options())
+				defer func() {
+					bw.SetMessage(w.response)
+				}()
+			}
 			if err == nil {
 				h(w, r)
 				return
@@ -534,7 +808,7 @@ func (cc *ClientConn) handleBW(w *ResponseWriter, r *pool.Message) {
 }
 
 func (cc *ClientConn) handle(w *ResponseWriter, r *pool.Message) {
-	if r.Code() == codes.Empty && r.Type() == udpMessage.Confirmable && len(r.Token()) == 0 && len(r.Options()) == 0 && r.Body() == nil {
+	if r.IsPing() {
 		cc.sendPong(w, r)
 		return
 	}
@@ -550,37 +824,176 @@ func (cc *ClientConn) handle(w *ResponseWriter, r *pool.Message) {
 	cc.handleBW(w, r)
 }
 
+// handleWithRecover handles the request and turns a panic of the handler to the 5.00 Internal Server Error response,
+// so the panic is reported via errors and it doesn't crash the process.
+func (cc *ClientConn) handleWithRecover(w *ResponseWriter, r *pool.Message, reqType udpMessage.Type) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			cc.errors(fmt.Errorf("handler panics: %v\n%s", rec, debug.Stack()))
+			w.response.SetType(reqType)
+			w.response.SetCode(codes.InternalServerError)
+			w.response.ResetOptionsTo(nil)
+			w.response.SetBody(nil)
+		}
+	}()
+	cc.handle(w, r)
+}
+
+// separateAck is the empty ACK of the request sent when the handler is slow.
+type separateAck struct {
+	lock sync.Mutex
+	done chan struct{}
+	sent bool
+}
+
+// stop cancels the empty ACK which wasn't sent yet, it returns true when it was sent.
+func (a *separateAck) stop() bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	close(a.done)
+	return a.sent
+}
+
+// acknowledgeSlowHandler sends the empty ACK of the confirmable request when the handler doesn't respond
+// within the half of the acknowledge timeout, so the peer doesn't retransmit the request:
+// https://tools.ietf.org/html/rfc7252#section-5.2.2
+func (cc *ClientConn) acknowledgeSlowHandler(mid uint16) *separateAck {
+	ack := &separateAck{
+		done: make(chan struct{}),
+	}
+	timer := cc.clock.NewTimer(cc.transmission.acknowledgeTimeout.Load() / 2)
+	go func() {
+		select {
+		case <-ack.done:
+			timer.Stop()
+			return
+		case <-cc.Context().Done():
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+		ack.lock.Lock()
+		defer ack.lock.Unlock()
+		select {
+		case <-ack.done:
+			return
+		default:
+		}
+		resp := pool.AcquireMessage(cc.Context())
+		defer pool.ReleaseMessage(resp)
+		resp.SetCode(codes.Empty)
+		resp.SetType(udpMessage.Acknowledgement)
+		resp.SetMessageID(mid)
+		if err := cc.writeToSession(resp); err != nil {
+			cc.errors(fmt.Errorf("cannot write ack reponse: %w", err))
+			return
+		}
+		ack.sent = true
+		// the duplicates of the request are answered by the empty ACK
+		if err := cc.addResponseToCache(mid, resp); err != nil {
+			cc.errors(fmt.Errorf("cannot cache response: %w", err))
+		}
+	}()
+	return ack
+}
+
 // Sequence acquires sequence number.
 func (cc *ClientConn) Sequence() uint64 {
 	return atomic.AddUint64(&cc.sequence, 1)
 }
 
-func (cc *ClientConn) addResponseToCache(resp *pool.Message) error {
+// dedupKey identifies the message of the peer in the dedup store, which can be shared by connections of many peers.
+func (cc *ClientConn) dedupKey(mid uint16) string {
+	return fmt.Sprintf("%v#%d", cc.RemoteAddr(), mid)
+}
+
+func (cc *ClientConn) addResponseToCache(mid uint16, resp *pool.Message) error {
 	marshaledResp, err := resp.Marshal()
 	if err != nil {
 		return err
 	}
 	cacheMsg := make([]byte, len(marshaledResp))
 	copy(cacheMsg, marshaledResp)
-	cc.responseMsgCache.SetDefault(fmt.Sprintf("%d", resp.MessageID()), cacheMsg)
+	cc.dedupStore.Remember(cc.dedupKey(mid), cacheMsg, ExchangeLifetime)
 	return nil
 }
 
-func (cc *ClientConn) getResponseFromCache(mid uint16, resp *pool.Message) (bool, error) {
-	cachedResp, _ := cc.responseMsgCache.Get(fmt.Sprintf("%d", mid))
-	if rawMsg, ok := cachedResp.([]byte); ok {
-		_, err := resp.Unmarshal(rawMsg)
-		if err != nil {
-			return false, err
-		}
-		return true, nil
+// addNoResponseToCache remembers the message which was handled without a response, eg. a non-confirmable request,
+// so its duplicates are dropped instead of being handled again.
+func (cc *ClientConn) addNoResponseToCache(mid uint16) {
+	cc.dedupStore.Remember(cc.dedupKey(mid), []byte{}, ExchangeLifetime)
+}
+
+// getResponseFromCache reports whether the message was already handled and whether resp is set to its response.
+func (cc *ClientConn) getResponseFromCache(mid uint16, resp *pool.Message) (bool, bool, error) {
+	rawMsg, ok := cc.dedupStore.Seen(cc.dedupKey(mid))
+	if !ok {
+		return false, false, nil
+	}
+	if len(rawMsg) == 0 {
+		return true, false, nil
+	}
+	_, err := resp.Unmarshal(rawMsg)
+	if err != nil {
+		return false, false, err
+	}
+	return true, true, nil
+}
+
+// rejectTooLarge answers a confirmable request which exceeds the max message size by 4.13 with the Size1 option,
+// only the header of the datagram is decoded.
+func (cc *ClientConn) rejectTooLarge(datagram []byte) {
+	var hdr udpMessage.Header
+	if _, err := hdr.Unmarshal(datagram); err != nil {
+		return
+	}
+	if hdr.Type != udpMessage.Confirmable || !hdr.Code.IsRequest() {
+		return
+	}
+	resp := pool.AcquireMessage(cc.Context())
+	defer pool.ReleaseMessage(resp)
+	resp.SetType(udpMessage.Acknowledgement)
+	resp.SetMessageID(hdr.MessageID)
+	resp.SetToken(hdr.Token)
+	resp.SetCode(codes.RequestEntityTooLarge)
+	resp.SetOptionUint32(message.Size1, uint32(cc.session.MaxMessageSize()))
+	if err := cc.writeToSession(resp); err != nil {
+		cc.errors(fmt.Errorf("cannot write response: %w", err))
 	}
-	return false, nil
 }
 
 func (cc *ClientConn) Process(datagram []byte) error {
+	return cc.process(datagram, false)
+}
+
+// ProcessMulticast handles the datagram received via multicast like Process, but as defined
+// in https://tools.ietf.org/html/rfc7252#section-8.2 the request is never acknowledged and the response
+// is sent as non-confirmable message after a random delay within the multicast leisure.
+func (cc *ClientConn) ProcessMulticast(datagram []byte) error {
+	return cc.process(datagram, true)
+}
+
+// waitMulticastLeisure spreads the responses of the servers which received the same multicast request.
+func (cc *ClientConn) waitMulticastLeisure() {
+	if cc.multicastLeisure <= 0 {
+		return
+	}
+	cc.leisureRandMutex.Lock()
+	leisure := time.Duration(cc.leisureRand.Int63n(int64(cc.multicastLeisure)))
+	cc.leisureRandMutex.Unlock()
+	timer := cc.clock.NewTimer(leisure)
+	select {
+	case <-timer.C():
+	case <-cc.Context().Done():
+		timer.Stop()
+	}
+}
+
+func (cc *ClientConn) process(datagram []byte, multicast bool) error {
 	if cc.session.MaxMessageSize() >= 0 && len(datagram) > cc.session.MaxMessageSize() {
-		return fmt.Errorf("max message size(%v) was exceeded %v", cc.session.MaxMessageSize(), len(datagram))
+		cc.rejectTooLarge(datagram)
+		cc.errors(fmt.Errorf("max message size(%v) was exceeded %v", cc.session.MaxMessageSize(), len(datagram)))
+		return nil
 	}
 	req := pool.AcquireMessage(cc.Context())
 	_, err := req.Unmarshal(datagram)
@@ -589,8 +1002,12 @@ func (cc *ClientConn) Process(datagram []byte) error {
 		return err
 	}
 	req.SetSequence(cc.Sequence())
+	cc.stats.MessageReceived(req.Code(), len(datagram))
+	if cc.onReceive != nil {
+		cc.onReceive(req)
+	}
 	cc.activityMonitor.Notify()
-	cc.goPool(func() {
+	errPool := cc.goPool(func() {
 		defer cc.activityMonitor.Notify()
 		reqMid := req.MessageID()
 
@@ -601,38 +1018,69 @@ func (cc *ClientConn) Process(datagram []byte) error {
 
 		origResp := pool.AcquireMessage(cc.Context())
 		origResp.SetToken(req.Token())
+		reqType := req.Type()
+		if multicast {
+			reqType = udpMessage.NonConfirmable
+		}
 		// If a request is sent in a Non-confirmable message, then the response
 		// is sent using a new Non-confirmable message, although the server may
 		// instead send a Confirmable message.
-		origResp.SetType(req.Type())
+		origResp.SetType(reqType)
 		w := NewResponseWriter(origResp, cc, req.Options())
 
-		if ok, err := cc.getResponseFromCache(req.MessageID(), w.response); ok {
-			defer pool.ReleaseMessage(w.response)
-			if !req.IsHijacked() {
-				pool.ReleaseMessage(req)
-			}
-			err = cc.session.WriteMessage(w.response)
-			if err != nil {
+		// acknowledgements and resets carry the message IDs of our messages, so only the messages of the peer are deduplicated
+		dedup := req.Type() == udpMessage.Confirmable || req.Type() == udpMessage.NonConfirmable
+		if dedup {
+			if seen, hasResponse, err := cc.getResponseFromCache(reqMid, w.response); seen {
+				defer pool.ReleaseMessage(w.response)
+				if !req.IsHijacked() {
+					pool.ReleaseMessage(req)
+				}
+				if !hasResponse {
+					return
+				}
+				err = cc.writeToSession(w.response)
+				if err != nil {
+					cc.Close()
+					cc.errors(fmt.Errorf("cannot write response: %w", err))
+					return
+				}
+				return
+			} else if err != nil {
 				cc.Close()
-				cc.errors(fmt.Errorf("cannot write response: %w", err))
+				cc.errors(fmt.Errorf("cannot unmarshal response from cache: %w", err))
 				return
 			}
-			return
-		} else if err != nil {
-			cc.Close()
-			cc.errors(fmt.Errorf("cannot unmarshal response from cache: %w", err))
-			return
 		}
 
-		reqType := req.Type()
+		var reqToken [message.MaxTokenSize]byte
+		reqTokenLen := copy(reqToken[:], req.Token())
 		origResp.SetModified(false)
-		cc.handle(w, req)
+		var ack *separateAck
+		if reqType == udpMessage.Confirmable && cc.separateResponse {
+			ack = cc.acknowledgeSlowHandler(reqMid)
+		}
+		cc.handleWithRecover(w, req, reqType)
+		separate := ack != nil && ack.stop()
+		if w.response.IsModified() && w.response.Type() != udpMessage.Reset && len(w.response.Token()) == 0 {
+			// the response is correlated with the request by the token, so keep it when the handler dropped it
+			w.response.SetToken(reqToken[:reqTokenLen])
+		}
 
 		defer pool.ReleaseMessage(w.response)
 		if !req.IsHijacked() {
 			pool.ReleaseMessage(req)
 		}
+		if separate {
+			// the request was acknowledged, so the response is a new exchange correlated by the token
+			if w.response.IsModified() && w.response.Type() != udpMessage.Reset {
+				w.response.SetType(udpMessage.Confirmable)
+				if err := cc.writeMessage(w.response); err != nil {
+					cc.errors(fmt.Errorf("cannot write separate response: %w", err))
+				}
+			}
+			return
+		}
 		if w.response.IsModified() {
 			switch {
 			case w.response.Type() == udpMessage.Reset:
@@ -644,7 +1092,10 @@ func (cc *ClientConn) Process(datagram []byte) error {
 				w.response.SetType(udpMessage.NonConfirmable)
 				w.response.SetMessageID(cc.getMID())
 			}
-			err := cc.session.WriteMessage(w.response)
+			if multicast {
+				cc.waitMulticastLeisure()
+			}
+			err := cc.writeToSession(w.response)
 			if err != nil {
 				cc.Close()
 				cc.errors(fmt.Errorf("cannot write response: %w", err))
@@ -655,21 +1106,35 @@ func (cc *ClientConn) Process(datagram []byte) error {
 			w.response.SetCode(codes.Empty)
 			w.response.SetType(udpMessage.Acknowledgement)
 			w.response.SetMessageID(reqMid)
-			err := cc.session.WriteMessage(w.response)
+			err := cc.writeToSession(w.response)
 			if err != nil {
 				cc.Close()
 				cc.errors(fmt.Errorf("cannot write ack reponse: %w", err))
 				return
 			}
+		} else {
+			// nothing was sent, so a duplicate is just dropped
+			if dedup {
+				cc.addNoResponseToCache(reqMid)
+			}
+			return
+		}
+		if !dedup {
+			return
 		}
 
-		err = cc.addResponseToCache(w.response)
+		err = cc.addResponseToCache(reqMid, w.response)
 		if err != nil {
 			cc.Close()
 			cc.errors(fmt.Errorf("cannot cache response: %w", err))
 			return
 		}
 	})
+	if errPool != nil {
+		// the request is dropped, a confirmable request is retransmitted by the peer
+		pool.ReleaseMessage(req)
+		cc.errors(fmt.Errorf("cannot handle request: %w", errPool))
+	}
 	return nil
 }
 
@@ -677,7 +1142,18 @@ func (cc *ClientConn) Client() *Client {
 	return NewClient(cc)
 }
 
+// SecurityIdentity returns identity of the peer authenticated by the secure transport, eg. PSK identity
+// or common name of the peer certificate for DTLS. It returns empty string for an unsecured connection.
+func (cc *ClientConn) SecurityIdentity() string {
+	if s, ok := cc.session.(interface{ SecurityIdentity() string }); ok {
+		return s.SecurityIdentity()
+	}
+	return ""
+}
+
 // SetContextValue stores the value associated with key to context of connection.
+// The requests handled afterwards carry the value in their context, so a value set by OnNewClientConn,
+// eg. the identity of the peer, is read by the handlers via r.Context().Value(key).
 func (cc *ClientConn) SetContextValue(key interface{}, val interface{}) {
 	cc.session.SetContextValue(key, val)
 }
@@ -8,6 +8,7 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -19,6 +20,8 @@ import (
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
 	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+	"github.com/plgd-dev/go-coap/v2/net/clock"
 	"github.com/plgd-dev/go-coap/v2/udp/client"
 	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
 	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
@@ -728,3 +731,403 @@ func TestClientConn_Ping(t *testing.T) {
 	err = cc.Ping(ctx)
 	require.NoError(t, err)
 }
+
+func TestClientConn_Errors(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	m := mux.NewRouter()
+	err = m.Handle("/hang", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {}))
+	require.NoError(t, err)
+	s := udp.NewServer(udp.WithMux(m))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/notFound")
+	require.NoError(t, err)
+	defer pool.ReleaseMessage(resp)
+	err = pool.CheckResponse(resp)
+	var respErr *pool.ResponseError
+	require.True(t, errors.As(err, &respErr))
+	require.Equal(t, codes.NotFound, respErr.Code)
+
+	_, err = cc.Observe(ctx, "/notFound", func(req *pool.Message) {})
+	require.True(t, errors.As(err, &respErr))
+	require.Equal(t, codes.NotFound, respErr.Code)
+
+	ctxTimeout, cancelTimeout := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancelTimeout()
+	_, err = cc.Get(ctxTimeout, "/hang")
+	require.True(t, errors.Is(err, coapNet.ErrTimeout))
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestClientConn_ErrorConnReset(t *testing.T) {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		buf := make([]byte, 1024)
+		n, addr, err := l.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		req := udpMessage.Message{
+			Options: make(message.Options, 0, 16),
+		}
+		_, err = req.Unmarshal(buf[:n])
+		require.NoError(t, err)
+		rst := udpMessage.Message{
+			Code:      codes.Empty,
+			Type:      udpMessage.Reset,
+			MessageID: req.MessageID,
+		}
+		data, err := rst.Marshal()
+		require.NoError(t, err)
+		_, err = l.WriteTo(data, addr)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = cc.Get(ctx, "/a")
+	require.True(t, errors.Is(err, coapNet.ErrConnReset))
+}
+
+func TestClientConn_PutBlockwise(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	image := make([]byte, 1024*1024)
+	for i := range image {
+		image[i] = byte(i % 251)
+	}
+	received := make(chan []byte, 1)
+	// the server downshifts blocks of the client from 1024 to 512 bytes
+	s := udp.NewServer(udp.WithBlockwise(true, blockwise.SZX512, time.Second*5), udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		b, err := r.ReadBody()
+		require.NoError(t, err)
+		received <- b
+		err = w.SetResponse(codes.Changed, message.TextPlain, nil)
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	var calls, last int
+	err = cc.PutBlockwise(ctx, "/firmware", bytes.NewReader(image), func(sent, total int) {
+		require.Equal(t, len(image), total)
+		require.Greater(t, sent, last)
+		last = sent
+		calls++
+	})
+	require.NoError(t, err)
+	require.Equal(t, len(image), last)
+	// the first block has 1024 bytes, others 512 bytes
+	require.Equal(t, 1+(len(image)-1024)/512, calls)
+	require.Equal(t, image, <-received)
+}
+
+func TestClientConn_PutBlockwiseRestart(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var incomplete uint32
+	s := udp.NewServer(udp.WithBlockwise(false, blockwise.SZX1024, time.Second), udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		block, err := r.Options().Block1()
+		require.NoError(t, err)
+		if block.Num == 1 && atomic.CompareAndSwapUint32(&incomplete, 0, 1) {
+			// the server lost the first block
+			err = w.SetResponse(codes.RequestEntityIncomplete, message.TextPlain, nil)
+			require.NoError(t, err)
+			return
+		}
+		code := codes.Changed
+		if block.More {
+			code = codes.Continue
+		}
+		v, err := message.Block{Num: block.Num, SZX: block.SZX}.Encode()
+		require.NoError(t, err)
+		buf := make([]byte, 3)
+		n, err := message.EncodeUint32(buf, v)
+		require.NoError(t, err)
+		err = w.SetResponse(code, message.TextPlain, nil, message.Option{ID: message.Block1, Value: buf[:n]})
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	err = cc.PutBlockwise(ctx, "/firmware", bytes.NewReader(make([]byte, 3000)), nil)
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), atomic.LoadUint32(&incomplete))
+}
+
+func TestClientConn_RetransmissionFakeClock(t *testing.T) {
+	// the peer never answers, so the request is retransmitted until the retransmissions are exhausted
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	received := make(chan struct{}, 8)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		buf := make([]byte, 1024)
+		for {
+			_, _, err := l.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			received <- struct{}{}
+		}
+	}()
+
+	const nStart = time.Second
+	const ackTimeout = time.Second * 2
+	const maxRetransmit = 4
+	start := time.Now()
+	fakeClock := clock.NewFake(start)
+	cc, err := udp.Dial(l.LocalAddr().String(), udp.WithClock(fakeClock), udp.WithTransmission(nStart, ackTimeout, maxRetransmit))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := cc.Get(context.Background(), "/a")
+		errs <- err
+	}()
+	<-received
+	for i := 0; i < maxRetransmit; i++ {
+		// the retransmission is sent after the acknowledge timeout and nStart
+		fakeClock.BlockUntil(1)
+		fakeClock.Advance(ackTimeout)
+		fakeClock.BlockUntil(1)
+		fakeClock.Advance(nStart)
+		<-received
+	}
+	require.ErrorIs(t, <-errs, coapNet.ErrTimeout)
+	require.Equal(t, start.Add(maxRetransmit*(ackTimeout+nStart)), fakeClock.Now())
+	require.Equal(t, 0, fakeClock.Waiters())
+	require.Len(t, received, 0)
+}
+
+func TestClientConn_NonConfirmable(t *testing.T) {
+	const numMessages = 1000
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	var datagrams uint32
+	var confirmable uint32
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		buf := make([]byte, 1024)
+		for {
+			n, _, err := l.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var hdr udpMessage.Header
+			if _, err = hdr.Unmarshal(buf[:n]); err != nil {
+				continue
+			}
+			if hdr.Type == udpMessage.Confirmable {
+				atomic.AddUint32(&confirmable, 1)
+			}
+			atomic.AddUint32(&datagrams, 1)
+		}
+	}()
+
+	// no retransmissions are allowed, so nothing may wait for the acknowledgement
+	cc, err := udp.Dial(l.LocalAddr().String(), udp.WithTransmission(time.Second, time.Second, 0))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	for i := 0; i < numMessages; i++ {
+		req, err := client.NewPostRequest(context.Background(), "/telemetry", message.TextPlain, bytes.NewReader([]byte{byte(i)}))
+		require.NoError(t, err)
+		req.SetType(udpMessage.NonConfirmable)
+		err = cc.WriteMessage(req)
+		pool.ReleaseMessage(req)
+		require.NoError(t, err)
+		// send in batches, so the loopback socket buffer doesn't drop the datagrams
+		if (i+1)%100 == 0 {
+			sent := uint32(i + 1)
+			require.Eventually(t, func() bool {
+				return atomic.LoadUint32(&datagrams) >= sent
+			}, time.Second*5, time.Millisecond)
+		}
+	}
+	// a retransmission would be sent after the acknowledge timeout
+	time.Sleep(time.Second * 2)
+	require.Equal(t, uint32(numMessages), atomic.LoadUint32(&datagrams))
+	require.Equal(t, uint32(0), atomic.LoadUint32(&confirmable))
+	require.Equal(t, uint64(0), cc.Stats().Retransmissions)
+}
+
+func TestClientConn_OnSendOnReceive(t *testing.T) {
+	const correlationOption = message.OptionID(65000)
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var received uint32
+	s := udp.NewServer(udp.WithOnReceive(func(r *pool.Message) {
+		if r.Code().IsRequest() {
+			atomic.AddUint32(&received, 1)
+		}
+	}), udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		v, err := r.GetOptionBytes(correlationOption)
+		if err != nil {
+			w.SetResponse(codes.BadRequest, message.TextPlain, nil)
+			return
+		}
+		w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader(v))
+	}))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	var responses uint32
+	cc, err := udp.Dial(l.LocalAddr().String(), udp.WithOnSend(func(r *pool.Message) {
+		if r.Code().IsRequest() {
+			r.SetOptionBytes(correlationOption, []byte("trace-1"))
+		}
+	}), udp.WithOnReceive(func(r *pool.Message) {
+		if r.Code().IsResponse() {
+			atomic.AddUint32(&responses, 1)
+		}
+	}))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	for _, path := range []string{"/a", "/b"} {
+		resp, err := cc.Get(ctx, path)
+		require.NoError(t, err)
+		require.Equal(t, codes.Content, resp.Code())
+		body, err := resp.ReadBody()
+		require.NoError(t, err)
+		require.Equal(t, "trace-1", string(body))
+	}
+	resp, err := cc.Post(ctx, "/c", message.TextPlain, bytes.NewReader([]byte("c")))
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	require.Equal(t, uint32(3), atomic.LoadUint32(&received))
+	require.Equal(t, uint32(3), atomic.LoadUint32(&responses))
+}
+
+func TestClientConn_TraceContext(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	m := mux.NewRouter()
+	m.Use(mux.TraceContextMiddleware)
+	m.Handle("/a", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		tc, ok := message.TraceContextFromContext(r.Context)
+		if !ok {
+			err := w.SetResponse(codes.BadRequest, message.TextPlain, nil)
+			require.NoError(t, err)
+			return
+		}
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte(tc.String())))
+		require.NoError(t, err)
+	}))
+	s := udp.NewServer(udp.WithMux(m))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.BadRequest, resp.Code())
+
+	tc := message.TraceContext{
+		TraceID: [16]byte{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:  [8]byte{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		Flags:   1,
+	}
+	resp, err = cc.Get(message.ContextWithTraceContext(ctx, tc), "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, resp.Code())
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, tc.String(), string(body))
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
 	"github.com/plgd-dev/go-coap/v2/net/observation"
 	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
 )
@@ -33,6 +34,7 @@ func NewObservationHandler(obsertionTokenHandler *HandlerContainer, next Handler
 type Observation struct {
 	token        message.Token
 	path         string
+	opts         message.Options
 	cc           *ClientConn
 	observeFunc  func(req *pool.Message)
 	respCodeChan chan codes.Code
@@ -43,12 +45,17 @@ type Observation struct {
 	mutex       sync.Mutex
 
 	waitForReponse uint32
+
+	closeMutex sync.Mutex
+	closed     bool
+	onClose    []EventFunc
 }
 
-func newObservation(token message.Token, path string, cc *ClientConn, observeFunc func(req *pool.Message), respCodeChan chan codes.Code) *Observation {
+func newObservation(token message.Token, path string, opts message.Options, cc *ClientConn, observeFunc func(req *pool.Message), respCodeChan chan codes.Code) *Observation {
 	return &Observation{
 		token:          token,
 		path:           path,
+		opts:           opts,
 		obsSequence:    0,
 		cc:             cc,
 		waitForReponse: 1,
@@ -63,6 +70,80 @@ func (o *Observation) cleanUp() {
 	if ok {
 		pool.ReleaseMessage(registeredRequest.(*pool.Message))
 	}
+	o.cc.observations.Delete(o.token.String())
+	for _, f := range o.popOnClose() {
+		f()
+	}
+}
+
+func (o *Observation) popOnClose() []EventFunc {
+	o.closeMutex.Lock()
+	defer o.closeMutex.Unlock()
+	o.closed = true
+	tmp := o.onClose
+	o.onClose = nil
+	return tmp
+}
+
+// AddOnClose calls function when the observation is cancelled or its connection is closed.
+// The function is called immediately when the observation was already closed.
+func (o *Observation) AddOnClose(f EventFunc) {
+	o.closeMutex.Lock()
+	if !o.closed {
+		o.onClose = append(o.onClose, f)
+		o.closeMutex.Unlock()
+		return
+	}
+	o.closeMutex.Unlock()
+	f()
+}
+
+// closeObservations cleans up all observations of the closed connection, so their handlers don't leak.
+// The established ones are kept for OnConnectionRestored.
+func (cc *ClientConn) closeObservations() {
+	lost := make([]*Observation, 0, 4)
+	for _, v := range cc.observations.PullOutAll() {
+		o := v.(*Observation)
+		o.cleanUp()
+		if atomic.LoadUint32(&o.waitForReponse) == 0 {
+			lost = append(lost, o)
+		}
+	}
+	cc.lostObservationsMutex.Lock()
+	defer cc.lostObservationsMutex.Unlock()
+	cc.lostObservations = append(cc.lostObservations, lost...)
+}
+
+// OnConnectionRestored re-registers the observations lost by closing cc over newCC, eg. the connection
+// created after the reconnect, because the server forgets them with the old connection. Notifications
+// are delivered to the same observe functions. It returns the new observations and the first error,
+// the observations which failed aren't restored again.
+//
+// The observations are collected when cc is closed, so call it after the functions added by cc.AddOnClose were called.
+func (cc *ClientConn) OnConnectionRestored(ctx context.Context, newCC *ClientConn) ([]*Observation, error) {
+	cc.lostObservationsMutex.Lock()
+	lost := cc.lostObservations
+	cc.lostObservations = nil
+	cc.lostObservationsMutex.Unlock()
+
+	var errs error
+	restored := make([]*Observation, 0, len(lost))
+	for _, o := range lost {
+		obs, err := newCC.Observe(ctx, o.path, o.observeFunc, o.opts...)
+		if err != nil {
+			if errs == nil {
+				errs = fmt.Errorf("cannot restore observation of %v: %w", o.path, err)
+			}
+			continue
+		}
+		restored = append(restored, obs)
+	}
+	return restored, errs
+}
+
+// NumObservations returns the number of active observations of the connection.
+func (cc *ClientConn) NumObservations() int {
+	return cc.observationTokenHandler.Len()
 }
 
 func (o *Observation) handler(w *ResponseWriter, r *pool.Message) {
@@ -87,7 +168,7 @@ func (o *Observation) Cancel(ctx context.Context) error {
 		return fmt.Errorf("cannot cancel observation request: %w", err)
 	}
 	defer pool.ReleaseMessage(req)
-	req.SetObserve(1)
+	req.SetObserve(message.ObserveDeregister)
 	req.SetToken(o.token)
 	resp, err := o.cc.Do(req)
 	if err != nil {
@@ -95,7 +176,7 @@ func (o *Observation) Cancel(ctx context.Context) error {
 	}
 	defer pool.ReleaseMessage(resp)
 	if resp.Code() != codes.Content {
-		return fmt.Errorf("unexpected return code(%v)", resp.Code())
+		return &pool.ResponseError{Code: resp.Code()}
 	}
 	return err
 }
@@ -105,7 +186,7 @@ func (o *Observation) wantBeNotified(r *pool.Message) bool {
 	if err != nil {
 		return true
 	}
-	now := time.Now()
+	now := o.cc.clock.Now()
 
 	o.mutex.Lock()
 	defer o.mutex.Unlock()
@@ -121,16 +202,17 @@ func (o *Observation) wantBeNotified(r *pool.Message) bool {
 
 // Observe subscribes for every change of resource on path.
 func (cc *ClientConn) Observe(ctx context.Context, path string, observeFunc func(req *pool.Message), opts ...message.Option) (*Observation, error) {
-	req, err := NewGetRequest(ctx, path, opts...)
+	token, err := cc.generateToken()
 	if err != nil {
 		return nil, fmt.Errorf("cannot create observe request: %w", err)
 	}
-	token := req.Token()
-	req.SetObserve(0)
+	req := newCommonRequest(ctx, token, codes.GET, path, opts...)
+	req.SetObserve(message.ObserveRegister)
 	respCodeChan := make(chan codes.Code, 1)
-	o := newObservation(token, path, cc, observeFunc, respCodeChan)
+	o := newObservation(token, path, opts, cc, observeFunc, respCodeChan)
 
 	cc.observationRequests.Store(token.String(), req)
+	cc.observations.Store(token.String(), o)
 	err = o.cc.observationTokenHandler.Insert(token.String(), o.handler)
 	defer func(err *error) {
 		if *err != nil {
@@ -147,14 +229,14 @@ func (cc *ClientConn) Observe(ctx context.Context, path string, observeFunc func
 	}
 	select {
 	case <-req.Context().Done():
-		err = req.Context().Err()
+		err = coapNet.ContextError(req.Context().Err())
 		return nil, err
 	case <-cc.Context().Done():
 		err = fmt.Errorf("connection was closed: %w", cc.Context().Err())
 		return nil, err
 	case respCode := <-respCodeChan:
 		if respCode != codes.Content {
-			err = fmt.Errorf("unexpected return code(%v)", respCode)
+			err = &pool.ResponseError{Code: respCode}
 			return nil, err
 		}
 		return o, nil
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -177,3 +178,121 @@ func (o *observer) observe(req *pool.Message) {
 		}
 	}
 }
+
+func TestClientConn_ObserveCloseConnection(t *testing.T) {
+	const numObservations = 100
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		if r.Code() != codes.GET {
+			return
+		}
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("state")), message.Option{ID: message.Observe, Value: []byte{2}})
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+
+	var closed sync.WaitGroup
+	for i := 0; i < numObservations; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+		obs, err := cc.Observe(ctx, "/state", func(req *pool.Message) {})
+		cancel()
+		require.NoError(t, err)
+		closed.Add(1)
+		obs.AddOnClose(closed.Done)
+	}
+	require.Equal(t, numObservations, cc.NumObservations())
+
+	err = cc.Close()
+	require.NoError(t, err)
+	done := make(chan struct{})
+	go func() {
+		closed.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		require.FailNow(t, "observations weren't closed with the connection")
+	}
+	require.Equal(t, 0, cc.NumObservations())
+}
+
+func TestClientConn_ObserveConnectionRestored(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var registrations uint32
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		obs, err := r.Observe()
+		if r.Code() != codes.GET || err != nil || obs != 0 {
+			return
+		}
+		n := atomic.AddUint32(&registrations, 1)
+		err = w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte{byte(n)}), message.Option{ID: message.Observe, Value: []byte{2}})
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	notifications := make(chan []byte, 4)
+	observeFunc := func(req *pool.Message) {
+		body, err := req.ReadBody()
+		require.NoError(t, err)
+		notifications <- body
+	}
+
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	_, err = cc.Observe(ctx, "/state", observeFunc)
+	require.NoError(t, err)
+	require.Equal(t, []byte{1}, <-notifications)
+
+	// the connection drops, so the server forgets the observation
+	closed := make(chan struct{})
+	cc.AddOnClose(func() {
+		close(closed)
+	})
+	err = cc.Close()
+	require.NoError(t, err)
+	<-closed
+
+	newCC, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer newCC.Close()
+	restored, err := cc.OnConnectionRestored(ctx, newCC)
+	require.NoError(t, err)
+	require.Len(t, restored, 1)
+	require.Equal(t, []byte{2}, <-notifications)
+	require.Equal(t, 1, newCC.NumObservations())
+
+	// the observations are restored only once
+	restored, err = cc.OnConnectionRestored(ctx, newCC)
+	require.NoError(t, err)
+	require.Empty(t, restored)
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+// CongestionControl computes retransmission timeout of Confirmable messages from measured round-trip times.
+type CongestionControl interface {
+	// RTO returns initial retransmission timeout for a new Confirmable message.
+	RTO() time.Duration
+	// BackOff returns retransmission timeout for the next retransmission.
+	BackOff(rto time.Duration) time.Duration
+	// OnRTTSample is called when the message was acknowledged. rtt is measured from the first transmission.
+	OnRTTSample(rtt time.Duration, retransmissions int)
+}
+
+// NewCongestionControlFunc creates congestion control for a connection.
+type NewCongestionControlFunc = func() CongestionControl
+
+const (
+	cocoaInitialRTO = time.Second * 2
+	cocoaMaxRTO     = time.Second * 60
+)
+
+type rtoEstimator struct {
+	k      int64
+	srtt   time.Duration
+	rttvar time.Duration
+	rto    time.Duration
+}
+
+// update updates estimator by sample as in https://tools.ietf.org/html/rfc6298#section-2.
+func (e *rtoEstimator) update(sample time.Duration) time.Duration {
+	if e.srtt == 0 {
+		e.srtt = sample
+		e.rttvar = sample / 2
+	} else {
+		diff := e.srtt - sample
+		if diff < 0 {
+			diff = -diff
+		}
+		e.rttvar = e.rttvar*3/4 + diff/4
+		e.srtt = e.srtt*7/8 + sample/8
+	}
+	e.rto = e.srtt + time.Duration(e.k)*e.rttvar
+	return e.rto
+}
+
+// CoCoA is congestion control with strong and weak RTO estimators: https://tools.ietf.org/html/draft-ietf-core-cocoa.
+type CoCoA struct {
+	mutex      sync.Mutex
+	strong     rtoEstimator
+	weak       rtoEstimator
+	rto        time.Duration
+	lastUpdate time.Time
+	now        func() time.Time
+}
+
+// NewCoCoA creates CoCoA congestion control.
+func NewCoCoA() CongestionControl {
+	return &CoCoA{
+		strong: rtoEstimator{k: 4},
+		weak:   rtoEstimator{k: 1},
+		rto:    cocoaInitialRTO,
+		now:    time.Now,
+	}
+}
+
+// RTO returns overall RTO, it ages towards 1s when there are no new samples.
+func (c *CoCoA) RTO() time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.lastUpdate.IsZero() {
+		return c.rto
+	}
+	idle := c.now().Sub(c.lastUpdate)
+	switch {
+	case c.rto < time.Second && idle > 16*c.rto:
+		c.rto *= 2
+		if c.rto > time.Second {
+			c.rto = time.Second
+		}
+		c.lastUpdate = c.now()
+	case c.rto > 3*time.Second && idle > 4*c.rto:
+		c.rto = (time.Second + c.rto) / 2
+		c.lastUpdate = c.now()
+	}
+	return c.rto
+}
+
+// BackOff multiplies rto by variable back-off factor.
+func (c *CoCoA) BackOff(rto time.Duration) time.Duration {
+	switch {
+	case rto < time.Second:
+		rto *= 3
+	case rto > 3*time.Second:
+		rto = rto * 3 / 2
+	default:
+		rto *= 2
+	}
+	if rto > cocoaMaxRTO {
+		return cocoaMaxRTO
+	}
+	return rto
+}
+
+// OnRTTSample updates strong estimator by samples without retransmissions and weak estimator by samples with 1 or 2 retransmissions.
+func (c *CoCoA) OnRTTSample(rtt time.Duration, retransmissions int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	switch {
+	case retransmissions == 0:
+		c.rto = c.rto/2 + c.strong.update(rtt)/2
+	case retransmissions <= 2:
+		c.rto = c.rto*3/4 + c.weak.update(rtt)/4
+	default:
+		return
+	}
+	if c.rto > cocoaMaxRTO {
+		c.rto = cocoaMaxRTO
+	}
+	c.lastUpdate = c.now()
+}
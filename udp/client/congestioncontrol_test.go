@@ -0,0 +1,52 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoCoA_HighRTT(t *testing.T) {
+	c := NewCoCoA()
+	require.Equal(t, cocoaInitialRTO, c.RTO())
+
+	const rtt = time.Millisecond * 800
+	for i := 0; i < 20; i++ {
+		c.OnRTTSample(rtt, 0)
+		require.True(t, c.RTO() > rtt, "RTO %v fires before response on RTT %v", c.RTO(), rtt)
+	}
+	// stable RTT converges to RTT with small variance
+	require.True(t, c.RTO() < 2*rtt, "RTO %v", c.RTO())
+}
+
+func TestCoCoA_WeakEstimator(t *testing.T) {
+	c := NewCoCoA()
+	c.OnRTTSample(time.Second*10, 1)
+	require.Equal(t, cocoaInitialRTO*3/4+(time.Second*10+time.Second*5)/4, c.RTO())
+	rto := c.RTO()
+	// samples with more than 2 retransmissions are ignored
+	c.OnRTTSample(time.Second*50, 3)
+	require.Equal(t, rto, c.RTO())
+}
+
+func TestCoCoA_BackOff(t *testing.T) {
+	c := NewCoCoA()
+	require.Equal(t, time.Millisecond*1500, c.BackOff(time.Millisecond*500))
+	require.Equal(t, time.Second*4, c.BackOff(time.Second*2))
+	require.Equal(t, time.Second*6, c.BackOff(time.Second*4))
+	require.Equal(t, cocoaMaxRTO, c.BackOff(time.Second*50))
+}
+
+func TestCoCoA_Aging(t *testing.T) {
+	now := time.Now()
+	c := NewCoCoA().(*CoCoA)
+	c.now = func() time.Time { return now }
+	for i := 0; i < 10; i++ {
+		c.OnRTTSample(time.Millisecond*10, 0)
+	}
+	rto := c.RTO()
+	require.True(t, rto < time.Second)
+	now = now.Add(17 * rto)
+	require.Equal(t, 2*rto, c.RTO())
+}
@@ -1,12 +1,16 @@
 package client
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 
 	"github.com/plgd-dev/go-coap/v2/message"
 )
 
+// ErrKeyAlreadyExists is returned when a handler is already registered for the key, eg. the token is in flight.
+var ErrKeyAlreadyExists = errors.New("key already exist")
+
 // HandlerContainer for regirstration handlers by key
 type HandlerContainer struct {
 	datas map[interface{}]HandlerFunc
@@ -28,7 +32,7 @@ func (s *HandlerContainer) Insert(key interface{}, handler HandlerFunc) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	if s.datas[key] != nil {
-		return fmt.Errorf("key already exist")
+		return ErrKeyAlreadyExists
 	}
 	s.datas[key] = handler
 	return nil
@@ -62,3 +66,10 @@ func (s *HandlerContainer) Pop(key interface{}) (HandlerFunc, error) {
 	delete(s.datas, key)
 	return v, nil
 }
+
+// Len returns the number of registered handlers.
+func (s *HandlerContainer) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.datas)
+}
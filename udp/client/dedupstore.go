@@ -0,0 +1,68 @@
+package client
+
+import (
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/plgd-dev/go-coap/v2/net/clock"
+)
+
+// ExchangeLifetime is the time from sending a confirmable message to the time when its duplicates
+// can't arrive anymore: https://tools.ietf.org/html/rfc7252#section-4.8.2
+const ExchangeLifetime = 247 * time.Second
+
+// DedupStore remembers the responses to the received messages, so a duplicate of the message is answered
+// by the remembered response instead of handling it again: https://tools.ietf.org/html/rfc7252#section-4.5.
+// The key identifies the peer and the message ID of the message. The empty response marks a message which was
+// handled without a response, eg. a non-confirmable request, its duplicates are dropped.
+//
+// A store shared by multiple servers, eg. behind SO_REUSEPORT or a load balancer, dedups the retransmissions
+// which land on another server than the original message. Such store, eg. backed by Redis, only implements the interface.
+type DedupStore interface {
+	// Seen returns the response remembered under key, false when the key is unknown or it has expired.
+	Seen(key string) ([]byte, bool)
+	// Remember stores the response under key for ttl.
+	Remember(key string, response []byte, ttl time.Duration)
+}
+
+// MemoryDedupStore is the in-memory DedupStore, it's used by a connection when no store is set.
+type MemoryDedupStore struct {
+	cache *cache.Cache
+	clock clock.Clock
+}
+
+type dedupEntry struct {
+	response []byte
+	expires  time.Time
+}
+
+// NewMemoryDedupStore creates the in-memory DedupStore, it can be shared by servers of one process.
+func NewMemoryDedupStore() *MemoryDedupStore {
+	return newMemoryDedupStore(clock.Real)
+}
+
+// newMemoryDedupStore creates the store which expires the responses by c, the cache only drops the expired entries.
+func newMemoryDedupStore(c clock.Clock) *MemoryDedupStore {
+	return &MemoryDedupStore{
+		cache: cache.New(ExchangeLifetime, time.Minute),
+		clock: c,
+	}
+}
+
+// Seen returns the response remembered under key.
+func (s *MemoryDedupStore) Seen(key string) ([]byte, bool) {
+	v, ok := s.cache.Get(key)
+	if !ok {
+		return nil, false
+	}
+	e := v.(dedupEntry)
+	if !s.clock.Now().Before(e.expires) {
+		return nil, false
+	}
+	return e.response, true
+}
+
+// Remember stores the response under key for ttl.
+func (s *MemoryDedupStore) Remember(key string, response []byte, ttl time.Duration) {
+	s.cache.Set(key, dedupEntry{response: response, expires: s.clock.Now().Add(ttl)}, ttl)
+}
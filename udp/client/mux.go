@@ -36,6 +36,10 @@ func (w *muxResponseWriter) SetResponse(code codes.Code, contentFormat message.M
 	return w.w.SetResponse(code, contentFormat, d, opts...)
 }
 
+func (w *muxResponseWriter) SetRawResponse(code codes.Code, d io.ReadSeeker, opts ...message.Option) error {
+	return w.w.SetRawResponse(code, d, opts...)
+}
+
 func (w *muxResponseWriter) Client() mux.Client {
 	return w.w.ClientConn().Client()
 }
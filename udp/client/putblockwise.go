@@ -0,0 +1,105 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// maxBlockwiseRestarts bounds restarts of the upload asked by 4.08 (Request Entity Incomplete).
+const maxBlockwiseRestarts = 3
+
+// PutBlockwise uploads body to the path by Block1 blocks (RFC 7959), eg. the firmware image.
+// Every block must be confirmed by 2.31 (Continue). The block size is decreased when the server asks
+// for smaller blocks and the upload is restarted when the server answers 4.08 (Request Entity Incomplete).
+// onProgress is called with the number of confirmed bytes after every block, it can be nil.
+//
+// Use ctx to set timeout of the whole upload. A failure code of the server is returned as *pool.ResponseError.
+func (cc *ClientConn) PutBlockwise(ctx context.Context, path string, body io.Reader, onProgress func(sent, total int)) error {
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("cannot read body: %w", err)
+	}
+	token, err := cc.generateToken()
+	if err != nil {
+		return fmt.Errorf("cannot create put request: %w", err)
+	}
+	szx := uint8(cc.blockwiseSZX)
+	if szx > message.MaxBlockSZX {
+		szx = message.MaxBlockSZX
+	}
+	var offset, restarts int
+	for {
+		block := message.Block{SZX: szx}
+		block.Num = uint32(offset / block.Size())
+		end := offset + block.Size()
+		if end > len(data) {
+			end = len(data)
+		}
+		block.More = end < len(data)
+		code, respBlock, err := cc.putBlock(ctx, path, token, block, len(data), data[offset:end])
+		if err != nil {
+			return fmt.Errorf("cannot upload block %v: %w", block.Num, err)
+		}
+		switch {
+		case code == codes.Continue && block.More:
+			offset = end
+		case code.IsSuccess() && !block.More:
+			if onProgress != nil {
+				onProgress(end, len(data))
+			}
+			return nil
+		case code == codes.RequestEntityIncomplete && restarts < maxBlockwiseRestarts:
+			restarts++
+			offset = 0
+			continue
+		case code == codes.RequestEntityTooLarge && respBlock != nil && respBlock.SZX < szx && offset == 0:
+			// https://tools.ietf.org/html/rfc7959#section-2.9.3 - the server prefers smaller blocks
+			szx = respBlock.SZX
+			continue
+		default:
+			return &pool.ResponseError{Code: code}
+		}
+		if respBlock != nil && respBlock.SZX < szx {
+			// the server received whole block, so next blocks continue at the same offset
+			szx = respBlock.SZX
+		}
+		if onProgress != nil {
+			onProgress(offset, len(data))
+		}
+	}
+}
+
+// putBlock sends one block of the upload and returns the code and Block1 option of the response.
+func (cc *ClientConn) putBlock(ctx context.Context, path string, token message.Token, block message.Block, total int, payload []byte) (codes.Code, *message.Block, error) {
+	v, err := block.Encode()
+	if err != nil {
+		return codes.Empty, nil, err
+	}
+	req, err := NewPutRequest(ctx, path, message.AppOctets, bytes.NewReader(payload))
+	if err != nil {
+		return codes.Empty, nil, err
+	}
+	defer pool.ReleaseMessage(req)
+	req.SetToken(token)
+	req.SetOptionUint32(message.Block1, v)
+	if block.Num == 0 {
+		req.SetOptionUint32(message.Size1, uint32(total))
+	}
+	resp, err := cc.do(req)
+	if err != nil {
+		return codes.Empty, nil, err
+	}
+	defer pool.ReleaseMessage(resp)
+	respBlock, err := resp.Options().Block1()
+	if err != nil {
+		return resp.Code(), nil, nil
+	}
+	return resp.Code(), &respBlock, nil
+}
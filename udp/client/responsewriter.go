@@ -31,6 +31,8 @@ func NewResponseWriter(response *pool.Message, cc *ClientConn, requestOptions me
 	}
 }
 
+// SetResponse sets the code, content format, body and options of the response.
+// The response carries the token of the request and the message ID of a confirmable request, so handlers don't need to set them.
 func (r *ResponseWriter) SetResponse(code codes.Code, contentFormat message.MediaType, d io.ReadSeeker, opts ...message.Option) error {
 	if r.noResponseValue != nil {
 		err := noresponse.IsNoResponseCode(code, *r.noResponseValue)
@@ -55,6 +57,33 @@ func (r *ResponseWriter) SetResponse(code codes.Code, contentFormat message.Medi
 	return nil
 }
 
+// SetRawResponse sets the code, body and options of the response as they are, unlike SetResponse it doesn't set
+// Content-Format and ETag, eg. to relay the response of the origin server.
+func (r *ResponseWriter) SetRawResponse(code codes.Code, d io.ReadSeeker, opts ...message.Option) error {
+	if r.noResponseValue != nil {
+		err := noresponse.IsNoResponseCode(code, *r.noResponseValue)
+		if err != nil {
+			return err
+		}
+	}
+
+	r.response.SetCode(code)
+	r.response.ResetOptionsTo(opts)
+	if d != nil {
+		r.response.SetBody(d)
+	}
+	return nil
+}
+
+// Created sets the 2.01 Created response with LocationPath options, so the client learns the path of the created resource.
+func (r *ResponseWriter) Created(path string) error {
+	if err := r.SetResponse(codes.Created, message.TextPlain, nil); err != nil {
+		return err
+	}
+	r.response.SetLocationPath(path)
+	return nil
+}
+
 func (r *ResponseWriter) ClientConn() *ClientConn {
 	return r.cc
 }
@@ -0,0 +1,177 @@
+package client_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/net/clock"
+	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/udp/client"
+	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+	"github.com/stretchr/testify/require"
+)
+
+type sentMessage struct {
+	typ       udpMessage.Type
+	messageID uint16
+	token     message.Token
+}
+
+// fakeSession records the written messages instead of sending them, the test delivers the responses by cc.Process.
+type fakeSession struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	sent   chan sentMessage
+
+	mutex   sync.Mutex
+	onClose []client.EventFunc
+}
+
+var _ client.Session = (*fakeSession)(nil)
+
+func newFakeSession() *fakeSession {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &fakeSession{
+		ctx:    ctx,
+		cancel: cancel,
+		sent:   make(chan sentMessage, 16),
+	}
+}
+
+func (s *fakeSession) Context() context.Context {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.ctx
+}
+
+func (s *fakeSession) Close() error {
+	s.cancel()
+	return nil
+}
+
+func (s *fakeSession) MaxMessageSize() int {
+	return 1152
+}
+
+func (s *fakeSession) RemoteAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5683}
+}
+
+func (s *fakeSession) WriteMessage(req *pool.Message) error {
+	s.sent <- sentMessage{
+		typ:       req.Type(),
+		messageID: req.MessageID(),
+		token:     append(message.Token(nil), req.Token()...),
+	}
+	return nil
+}
+
+func (s *fakeSession) Run(cc *client.ClientConn) error {
+	<-s.Context().Done()
+	s.mutex.Lock()
+	onClose := s.onClose
+	s.onClose = nil
+	s.mutex.Unlock()
+	for _, f := range onClose {
+		f()
+	}
+	return nil
+}
+
+func (s *fakeSession) AddOnClose(f client.EventFunc) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.onClose = append(s.onClose, f)
+}
+
+func (s *fakeSession) SetContextValue(key interface{}, val interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.ctx = context.WithValue(s.ctx, key, val)
+}
+
+func TestClientConn_FakeSession(t *testing.T) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	session := newFakeSession()
+	fakeClock := clock.NewFake(time.Now())
+	cc := client.New(client.ConnConfig{
+		Session:                        session,
+		TransmissionNStart:             time.Second,
+		TransmissionAcknowledgeTimeout: time.Second * 2,
+		TransmissionMaxRetransmit:      4,
+		Handler:                        func(w *client.ResponseWriter, r *pool.Message) {},
+		GoPool: func(f func()) error {
+			go f()
+			return nil
+		},
+		ActivityMonitor: inactivity.NewNilMonitor(),
+		Clock:           fakeClock,
+	})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_ = cc.Run()
+	}()
+	defer cc.Close()
+
+	type result struct {
+		resp *pool.Message
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		resp, err := cc.Get(ctx, "/a")
+		done <- result{resp: resp, err: err}
+	}()
+
+	// nextSent advances the clock through the acknowledge timeout and NStart until the message is retransmitted
+	nextSent := func() sentMessage {
+		for {
+			select {
+			case m := <-session.sent:
+				return m
+			case <-time.After(time.Millisecond):
+			}
+			if fakeClock.Waiters() > 0 {
+				fakeClock.Advance(time.Second)
+			}
+		}
+	}
+
+	// the request is retransmitted with the same message ID
+	first := <-session.sent
+	require.Equal(t, udpMessage.Confirmable, first.typ)
+	for i := 0; i < 2; i++ {
+		require.Equal(t, first, nextSent())
+	}
+
+	ack := pool.AcquireMessage(context.Background())
+	defer pool.ReleaseMessage(ack)
+	ack.SetType(udpMessage.Acknowledgement)
+	ack.SetMessageID(first.messageID)
+	ack.SetToken(first.token)
+	ack.SetCode(codes.Content)
+	data, err := ack.Marshal()
+	require.NoError(t, err)
+	err = cc.Process(data)
+	require.NoError(t, err)
+
+	r := <-done
+	require.NoError(t, r.err)
+	defer pool.ReleaseMessage(r.resp)
+	require.Equal(t, codes.Content, r.resp.Code())
+	select {
+	case m := <-session.sent:
+		require.FailNow(t, "unexpected retransmission", "%+v", m)
+	default:
+	}
+}
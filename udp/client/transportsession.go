@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+)
+
+// Transport is a connection which preserves the boundaries of the messages, eg. *coapNet.Conn over DTLS.
+// A new transport, eg. CoAP over QUIC datagrams, only reads, writes and closes the connection
+// and NewTransportSession turns it to the Session of ClientConn.
+type Transport interface {
+	// ReadWithContext reads one message.
+	ReadWithContext(ctx context.Context, buffer []byte) (int, error)
+	// WriteWithContext writes one message.
+	WriteWithContext(ctx context.Context, data []byte) error
+	RemoteAddr() net.Addr
+	Close() error
+}
+
+// TransportSession is the Session of ClientConn over the Transport.
+type TransportSession struct {
+	transport      Transport
+	maxMessageSize int
+	closeSocket    bool
+
+	mutex   sync.Mutex
+	onClose []EventFunc
+
+	cancel context.CancelFunc
+	ctx    atomic.Value
+}
+
+// NewTransportSession creates the session over the transport, closeSocket closes the transport when the session ends.
+func NewTransportSession(
+	ctx context.Context,
+	transport Transport,
+	maxMessageSize int,
+	closeSocket bool,
+) *TransportSession {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &TransportSession{
+		cancel:         cancel,
+		transport:      transport,
+		maxMessageSize: maxMessageSize,
+		closeSocket:    closeSocket,
+	}
+	s.ctx.Store(&ctx)
+	return s
+}
+
+func (s *TransportSession) Done() <-chan struct{} {
+	return s.Context().Done()
+}
+
+func (s *TransportSession) AddOnClose(f EventFunc) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.onClose = append(s.onClose, f)
+}
+
+func (s *TransportSession) popOnClose() []EventFunc {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	tmp := s.onClose
+	s.onClose = nil
+	return tmp
+}
+
+func (s *TransportSession) close() error {
+	for _, f := range s.popOnClose() {
+		f()
+	}
+	if s.closeSocket {
+		return s.transport.Close()
+	}
+	return nil
+}
+
+func (s *TransportSession) Close() error {
+	s.cancel()
+	return nil
+}
+
+func (s *TransportSession) Context() context.Context {
+	return *s.ctx.Load().(*context.Context)
+}
+
+// SetContextValue stores the value associated with key to context of connection.
+func (s *TransportSession) SetContextValue(key interface{}, val interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	ctx := context.WithValue(s.Context(), key, val)
+	s.ctx.Store(&ctx)
+}
+
+func (s *TransportSession) WriteMessage(req *pool.Message) error {
+	data, err := req.Marshal()
+	if err != nil {
+		return fmt.Errorf("cannot marshal: %w", err)
+	}
+	err = s.transport.WriteWithContext(req.Context(), data)
+	if err != nil {
+		return fmt.Errorf("cannot write to connection: %w", err)
+	}
+	return err
+}
+
+func (s *TransportSession) MaxMessageSize() int {
+	return s.maxMessageSize
+}
+
+func (s *TransportSession) RemoteAddr() net.Addr {
+	return s.transport.RemoteAddr()
+}
+
+// Run reads and process requests from a connection, until the connection is not closed.
+func (s *TransportSession) Run(cc *ClientConn) (err error) {
+	defer func() {
+		err1 := s.Close()
+		if err == nil {
+			err = err1
+		}
+		err1 = s.close()
+		if err == nil {
+			err = err1
+		}
+	}()
+	// one extra byte detects messages exceeding the max message size, which would be truncated otherwise
+	m := make([]byte, s.maxMessageSize+1)
+	for {
+		readBuf := m
+		readLen, err := s.transport.ReadWithContext(s.Context(), readBuf)
+		if err != nil {
+			return fmt.Errorf("cannot read from connection: %w", err)
+		}
+		readBuf = readBuf[:readLen]
+		err = cc.Process(readBuf)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/net/memtransport"
+	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/udp/client"
+	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
+	"github.com/stretchr/testify/require"
+)
+
+func newTransportClientConn(conn *memtransport.Conn, handler client.HandlerFunc) *client.ClientConn {
+	return client.New(client.ConnConfig{
+		Session:                        client.NewTransportSession(context.Background(), coapNet.NewConn(conn), 1152, true),
+		TransmissionNStart:             time.Second,
+		TransmissionAcknowledgeTimeout: time.Second * 2,
+		TransmissionMaxRetransmit:      4,
+		Handler:                        handler,
+		GoPool: func(f func()) error {
+			go f()
+			return nil
+		},
+		ActivityMonitor: inactivity.NewNilMonitor(),
+	})
+}
+
+func TestTransportSession(t *testing.T) {
+	a, b := memtransport.Pipe()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var closed sync.WaitGroup
+	closed.Add(1)
+	server := newTransportClientConn(b, func(w *client.ResponseWriter, r *pool.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")))
+		require.NoError(t, err)
+	})
+	server.AddOnClose(closed.Done)
+	cc := newTransportClientConn(a, func(w *client.ResponseWriter, r *pool.Message) {})
+	for _, c := range []*client.ClientConn{server, cc} {
+		wg.Add(1)
+		go func(c *client.ClientConn) {
+			defer wg.Done()
+			_ = c.Run()
+		}(c)
+	}
+	defer server.Close()
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	defer pool.ReleaseMessage(resp)
+	require.Equal(t, codes.Content, resp.Code())
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(body))
+
+	// the closed transport ends the session of the peer
+	err = cc.Close()
+	require.NoError(t, err)
+	closed.Wait()
+}
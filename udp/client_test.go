@@ -3,21 +3,27 @@ package udp
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/plgd-dev/go-coap/v2/mux"
+	"github.com/plgd-dev/go-coap/v2/net/clock"
 	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/net/monitor/stats"
 
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
 	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/net/blockwise"
 	"github.com/plgd-dev/go-coap/v2/udp/client"
 	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
 	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
@@ -366,6 +372,62 @@ func TestClientConn_Post(t *testing.T) {
 	}
 }
 
+func TestClientConn_PostStreaming(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	payload := make([]byte, 1024*1024)
+	for i := range payload {
+		payload[i] = byte(i % 251)
+	}
+	var sent uint32
+	var sentOnHandle uint32
+	m := mux.NewRouter()
+	m.Handle("/upload", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		atomic.StoreUint32(&sentOnHandle, atomic.LoadUint32(&sent))
+		// the body is not buffered, so it can't be measured
+		_, err := r.Body.Seek(0, io.SeekEnd)
+		assert.True(t, errors.Is(err, blockwise.ErrStreamNotSeekable))
+		h := sha256.New()
+		n, err := io.Copy(h, r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(payload)), n)
+		err = w.SetResponse(codes.Changed, message.AppOctets, bytes.NewReader(h.Sum(nil)))
+		require.NoError(t, err)
+	}))
+
+	s := NewServer(WithMux(m), WithBlockwiseUploadStreaming(true))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := Dial(l.LocalAddr().String(), WithOnSend(func(*pool.Message) {
+		atomic.AddUint32(&sent, 1)
+	}))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
+	defer cancel()
+	got, err := cc.Post(ctx, "/upload", message.AppOctets, bytes.NewReader(payload))
+	require.NoError(t, err)
+	require.Equal(t, codes.Changed, got.Code())
+	body, err := ioutil.ReadAll(got.Body())
+	require.NoError(t, err)
+	sum := sha256.Sum256(payload)
+	require.Equal(t, sum[:], body)
+	// the handler was called with the first block instead of the reassembled request
+	require.Equal(t, uint32(1), atomic.LoadUint32(&sentOnHandle))
+	require.Greater(t, atomic.LoadUint32(&sent), uint32(1000))
+}
+
 func TestClientConn_Put(t *testing.T) {
 	type args struct {
 		path          string
@@ -614,6 +676,216 @@ func TestClientConn_Ping(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestClientConn_Stats(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	s := NewServer(WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")))
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	pool.ReleaseMessage(resp)
+
+	stats := cc.Stats()
+	require.Equal(t, uint64(1), stats.MessagesSent[0])
+	require.Equal(t, uint64(1), stats.MessagesReceived[2])
+	require.True(t, stats.BytesSent > 0)
+	require.True(t, stats.BytesReceived > uint64(len("hello")))
+	require.Equal(t, uint64(0), stats.Retransmissions)
+	require.True(t, stats.RTT > 0)
+}
+
+func TestClientConn_OnStats(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	s := NewServer(WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("hello")))
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	fakeClock := clock.NewFake(time.Now())
+	reported := make(chan stats.Stats, 1)
+	cc, err := Dial(l.LocalAddr().String(), WithClock(fakeClock), WithOnStats(time.Minute, func(cc *client.ClientConn, s stats.Stats) {
+		select {
+		case reported <- s:
+		default:
+		}
+	}))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	pool.ReleaseMessage(resp)
+
+	for {
+		fakeClock.Advance(time.Minute)
+		select {
+		case s := <-reported:
+			require.Equal(t, uint64(1), s.MessagesSent[0])
+			require.Equal(t, uint64(1), s.MessagesReceived[2])
+			return
+		case <-ctx.Done():
+			require.FailNow(t, "stats weren't reported")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+}
+
+func TestClientConn_TokenGenerator(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	slowReceived := make(chan struct{})
+	releaseSlow := make(chan struct{})
+	m := mux.NewRouter()
+	err = m.Handle("/slow", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		close(slowReceived)
+		<-releaseSlow
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("slow")))
+		require.NoError(t, err)
+	}))
+	require.NoError(t, err)
+	err = m.Handle("/fast", mux.HandlerFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("fast")))
+		require.NoError(t, err)
+	}))
+	require.NoError(t, err)
+
+	s := NewServer(WithMux(m))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	// generator returns the in-flight token again before a new one
+	tokens := []message.Token{{1}, {1}, {2}}
+	var tokensLock sync.Mutex
+	cc, err := Dial(l.LocalAddr().String(), WithTokenGenerator(func() (message.Token, error) {
+		tokensLock.Lock()
+		defer tokensLock.Unlock()
+		if len(tokens) == 0 {
+			return nil, fmt.Errorf("no token")
+		}
+		token := tokens[0]
+		tokens = tokens[1:]
+		return token, nil
+	}))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*4)
+	defer cancel()
+	slowResp := make(chan []byte, 1)
+	go func() {
+		resp, err := cc.Get(ctx, "/slow")
+		require.NoError(t, err)
+		defer pool.ReleaseMessage(resp)
+		body, err := resp.ReadBody()
+		require.NoError(t, err)
+		slowResp <- body
+	}()
+	<-slowReceived
+
+	resp, err := cc.Get(ctx, "/fast")
+	require.NoError(t, err)
+	require.Equal(t, message.Token{2}, resp.Token())
+	body, err := resp.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, []byte("fast"), body)
+	pool.ReleaseMessage(resp)
+
+	close(releaseSlow)
+	require.Equal(t, []byte("slow"), <-slowResp)
+}
+
+func TestClientConn_RandReader(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp", "")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	s := NewServer(WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, nil)
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	// the token of the request is generated before the initial message ID 0x1000 is read
+	r := bytes.NewReader([]byte{1, 2, 3, 4, 5, 6, 7, 8, 0, 0, 0x10, 0})
+	type sent struct {
+		mid   uint16
+		token message.Token
+	}
+	sentCh := make(chan sent, 1)
+	cc, err := Dial(l.LocalAddr().String(), WithRandReader(r), WithOnSend(func(m *pool.Message) {
+		select {
+		case sentCh <- sent{mid: m.MessageID(), token: append(message.Token(nil), m.Token()...)}:
+		default:
+		}
+	}))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	pool.ReleaseMessage(resp)
+	got := <-sentCh
+	require.Equal(t, uint16(0x1001), got.mid)
+	require.Equal(t, message.Token{1, 2, 3, 4, 5, 6, 7, 8}, got.token)
+}
+
 func TestClient_InactiveMonitor(t *testing.T) {
 	inactivityDetected := false
 	defer func() {
@@ -23,7 +23,24 @@ type MulticastOption interface {
 	apply(*multicastOptions)
 }
 
+// HopLimitOpt hop limit option.
+type HopLimitOpt struct {
+	hopLimit int
+}
+
+func (o HopLimitOpt) apply(opts *multicastOptions) {
+	opts.hopLimit = o.hopLimit
+}
+
+// WithHopLimit sets hop limit of multicast request, it must be in range from 0 to 255. For IPv4 it is used as TTL.
+// The default is 2, use 1 to keep the request on the local network segment.
+func WithHopLimit(hopLimit int) HopLimitOpt {
+	return HopLimitOpt{hopLimit: hopLimit}
+}
+
 // Discover sends GET to multicast or unicast address and waits for responses until context timeouts or server shutdown.
+// The token stays registered for the whole time, so receiverFunc is called for every response which carries it,
+// eg. once for each server which answered the multicast request.
 // For unicast there is a difference against the Dial. The Dial is connection-oriented and it means that, if you send a request to an address, the peer must send the response from the same
 // address where was request sent. For Discover it allows the client to send a response from another address where was request send.
 func (s *Server) Discover(ctx context.Context, address, path string, receiverFunc func(cc *client.ClientConn, resp *pool.Message), opts ...MulticastOption) error {
@@ -38,6 +55,7 @@ func (s *Server) Discover(ctx context.Context, address, path string, receiverFun
 }
 
 // DiscoveryRequest sends request to multicast/unicast address and wait for responses until request timeouts or server shutdown.
+// As for Discover, receiverFunc is called for every response with the token of the request.
 // For unicast there is a difference against the Dial. The Dial is connection-oriented and it means that, if you send a request to an address, the peer must send the response from the same
 // address where was request sent. For Discover it allows the client to send a response from another address where was request send.
 func (s *Server) DiscoveryRequest(req *pool.Message, address string, receiverFunc func(cc *client.ClientConn, resp *pool.Message), opts ...MulticastOption) error {
@@ -14,7 +14,7 @@ import (
 	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
 )
 
-func ExampleGet() {
+func ExampleDial() {
 	conn, err := udp.Dial("pluggedin.cloud:5683")
 	if err != nil {
 		log.Fatal(err)
@@ -22,10 +22,12 @@ func ExampleGet() {
 	defer conn.Close()
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
+	// Get blocks until the response arrives, retransmissions and block-wise transfer are handled by the connection.
 	res, err := conn.Get(ctx, "/oic/res")
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer pool.ReleaseMessage(res)
 	data, err := ioutil.ReadAll(res.Body())
 	if err != nil {
 		log.Fatal(err)
@@ -33,7 +35,7 @@ func ExampleGet() {
 	fmt.Printf("%v", data)
 }
 
-func ExampleServe() {
+func ExampleServer_Serve() {
 	l, err := net.NewListenUDP("udp", "0.0.0.0:5683")
 	if err != nil {
 		log.Fatal(err)
@@ -44,7 +46,7 @@ func ExampleServe() {
 	log.Fatal(s.Serve(l))
 }
 
-func ExampleDiscovery() {
+func ExampleServer_Discover() {
 	l, err := net.NewListenUDP("udp", "")
 	if err != nil {
 		log.Fatal(err)
@@ -3,6 +3,10 @@ package message
 import "errors"
 
 var (
-	ErrMessageTruncated      = errors.New("message is truncated")
-	ErrMessageInvalidVersion = errors.New("message has invalid version")
+	ErrMessageTruncated              = errors.New("message is truncated")
+	ErrMessageInvalidVersion         = errors.New("message has invalid version")
+	ErrMessageInvalidCodeClass       = errors.New("message has reserved code class")
+	ErrMessageInvalidEmpty           = errors.New("empty message contains token, options or payload")
+	ErrMessageInvalidReset           = errors.New("reset message is not empty")
+	ErrMessageInvalidAcknowledgement = errors.New("acknowledgement message carries request")
 )
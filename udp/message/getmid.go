@@ -3,6 +3,9 @@ package message
 import (
 	"crypto/rand"
 	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
 	"sync/atomic"
 )
 
@@ -13,8 +16,37 @@ func GetMID() uint16 {
 	return uint16(atomic.AddUint32(&msgID, 1))
 }
 
+// RandMID returns the message ID read from crypto/rand, it panics when crypto/rand fails.
 func RandMID() uint16 {
+	mid, err := randMID(rand.Reader)
+	if err != nil {
+		panic(fmt.Errorf("cannot read random message ID: %w", err))
+	}
+	return mid
+}
+
+func randMID(r io.Reader) (uint16, error) {
 	b := make([]byte, 4)
-	rand.Read(b)
-	return uint16(binary.BigEndian.Uint32(b))
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, err
+	}
+	return uint16(binary.BigEndian.Uint32(b)), nil
+}
+
+// NewGetMID creates the generator of message IDs which increments the initial ID read from r
+// instead of crypto/rand, eg. from a deterministic reader in tests. The initial ID is read by the first call,
+// the ID from crypto/rand is used when reading from r fails.
+func NewGetMID(r io.Reader) func() uint16 {
+	var id uint32
+	var once sync.Once
+	return func() uint16 {
+		once.Do(func() {
+			mid, err := randMID(r)
+			if err != nil {
+				mid = RandMID()
+			}
+			atomic.StoreUint32(&id, uint32(mid))
+		})
+		return uint16(atomic.AddUint32(&id, 1))
+	}
 }
@@ -1,7 +1,9 @@
 package message
 
 import (
+	"bytes"
 	"encoding/binary"
+	"fmt"
 
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
@@ -14,6 +16,10 @@ const (
 	MESSAGE_MAX_LEN    = 0x7fff0000 // Large number that works in 32-bit builds.
 )
 
+// Version is the version of the message format in the first two bits of the header, other versions
+// are rejected by ErrMessageInvalidVersion: https://tools.ietf.org/html/rfc7252#section-3.
+const Version = 1
+
 // TcpMessage is a CoAP MessageBase that can encode itself for Message
 // transport.
 type Message struct {
@@ -28,6 +34,30 @@ type Message struct {
 	Options message.Options //Options must be sorted by ID
 }
 
+// String returns human readable representation of the message, eg. `Confirmable MID=12345 GET Token=a1b2 URIPath=/temp`.
+func (m Message) String() string {
+	msg := message.Message{
+		Code:    m.Code,
+		Token:   m.Token,
+		Options: m.Options,
+	}
+	if len(m.Payload) > 0 {
+		msg.Body = bytes.NewReader(m.Payload)
+	}
+	return fmt.Sprintf("%v MID=%v %s", m.Type, m.MessageID, msg.String())
+}
+
+// IsEmpty reports whether the message is the empty message of https://tools.ietf.org/html/rfc7252#section-4.1,
+// it has the code 0.00 without token, options and payload.
+func (m Message) IsEmpty() bool {
+	return m.Code == codes.Empty && len(m.Token) == 0 && len(m.Options) == 0 && len(m.Payload) == 0
+}
+
+// IsPing reports whether the message is CoAP ping, the empty confirmable message.
+func (m Message) IsPing() bool {
+	return m.Type == Confirmable && m.IsEmpty()
+}
+
 func (m Message) Size() (int, error) {
 	if len(m.Token) > message.MaxTokenSize {
 		return -1, message.ErrInvalidTokenLen
@@ -81,7 +111,7 @@ func (m Message) MarshalTo(buf []byte) (int, error) {
 	tmpbuf := []byte{0, 0}
 	binary.BigEndian.PutUint16(tmpbuf, m.MessageID)
 
-	buf[0] = (1 << 6) | byte(m.Type)<<4 | byte(0xf&len(m.Token))
+	buf[0] = (Version << 6) | byte(m.Type)<<4 | byte(0xf&len(m.Token))
 	buf[1] = byte(m.Code)
 	buf[2] = tmpbuf[0]
 	buf[3] = tmpbuf[1]
@@ -111,36 +141,108 @@ func (m Message) MarshalTo(buf []byte) (int, error) {
 	return size, nil
 }
 
+// Unmarshal parses message from data. Malformed options are skipped as defined in https://tools.ietf.org/html/rfc7252#section-5.4.
+// It returns error for malformed input, it never panics. The empty message with token, options or payload
+// is rejected by ErrMessageInvalidEmpty as defined in https://tools.ietf.org/html/rfc7252#section-4.1.
+//
+// Token, Payload and values of Options are copied to storage owned by the message, so data can be reused.
 func (m *Message) Unmarshal(data []byte) (int, error) {
-	size := len(data)
-	if size < 4 {
+	return m.unmarshal(append([]byte(nil), data...), false)
+}
+
+// UnmarshalBorrow parses message from data as Unmarshal without copying: Token, Payload and values of Options
+// alias data, so the caller must not modify or recycle data while the message is used.
+func (m *Message) UnmarshalBorrow(data []byte) (int, error) {
+	return m.unmarshal(data, false)
+}
+
+// UnmarshalStrict parses message from data as Unmarshal, but it returns error for every message format error defined
+// in https://tools.ietf.org/html/rfc7252#section-3 instead of best-effort parsing: reserved code class,
+// payload marker without payload and empty, reset or acknowledgement message with invalid content.
+// The decoded values are copied as by Unmarshal.
+func (m *Message) UnmarshalStrict(data []byte) (int, error) {
+	return m.unmarshal(append([]byte(nil), data...), true)
+}
+
+func validateCode(typ Type, code codes.Code, tokenLen int, data []byte) error {
+	switch class := code >> 5; class {
+	case 0, 2, 4, 5:
+	default:
+		return fmt.Errorf("%w(%v)", ErrMessageInvalidCodeClass, class)
+	}
+	if code == codes.Empty {
+		if tokenLen > 0 || len(data) > 0 {
+			return ErrMessageInvalidEmpty
+		}
+		return nil
+	}
+	switch {
+	case typ == Reset:
+		return fmt.Errorf("%w: code %v", ErrMessageInvalidReset, code)
+	case typ == Acknowledgement && code>>5 == 0:
+		return fmt.Errorf("%w: code %v", ErrMessageInvalidAcknowledgement, code)
+	}
+	return nil
+}
+
+// Header is the fixed part of the message with the token, it can be decoded without the options and the payload.
+type Header struct {
+	Token     message.Token
+	Code      codes.Code
+	MessageID uint16
+	Type      Type
+}
+
+// Unmarshal decodes the header and returns the number of consumed bytes.
+func (h *Header) Unmarshal(data []byte) (int, error) {
+	if len(data) < 4 {
 		return -1, ErrMessageTruncated
 	}
 
-	if data[0]>>6 != 1 {
-		return -1, ErrMessageInvalidVersion
+	if version := data[0] >> 6; version != Version {
+		return -1, fmt.Errorf("%w(%v)", ErrMessageInvalidVersion, version)
 	}
 
-	typ := Type((data[0] >> 4) & 0x3)
 	tokenLen := int(data[0] & 0xf)
 	if tokenLen > 8 {
 		return -1, message.ErrInvalidTokenLen
 	}
-
-	code := codes.Code(data[1])
-	messageID := binary.BigEndian.Uint16(data[2:4])
-	data = data[4:]
-	if len(data) < tokenLen {
+	if len(data) < 4+tokenLen {
 		return -1, ErrMessageTruncated
 	}
-	token := data[:tokenLen]
-	if len(token) == 0 {
-		token = nil
+	h.Type = Type((data[0] >> 4) & 0x3)
+	h.Code = codes.Code(data[1])
+	h.MessageID = binary.BigEndian.Uint16(data[2:4])
+	h.Token = data[4 : 4+tokenLen]
+	if tokenLen == 0 {
+		h.Token = nil
+	}
+	return 4 + tokenLen, nil
+}
+
+func (m *Message) unmarshal(data []byte, strict bool) (int, error) {
+	size := len(data)
+	var hdr Header
+	hdrLen, err := hdr.Unmarshal(data)
+	if err != nil {
+		return -1, err
 	}
-	data = data[tokenLen:]
+	data = data[hdrLen:]
 
 	optionDefs := message.CoapOptionDefs
-	proc, err := m.Options.Unmarshal(data, optionDefs)
+	var proc int
+	if strict {
+		if err = validateCode(hdr.Type, hdr.Code, len(hdr.Token), data); err != nil {
+			return -1, err
+		}
+		proc, err = m.Options.UnmarshalStrict(data, optionDefs)
+	} else {
+		if hdr.Code == codes.Empty && (len(hdr.Token) > 0 || len(data) > 0) {
+			// https://tools.ietf.org/html/rfc7252#section-4.1 - the bytes after an empty header are format error
+			return -1, ErrMessageInvalidEmpty
+		}
+		proc, err = m.Options.Unmarshal(data, optionDefs)
+	}
 	if err != nil {
 		return -1, err
 	}
@@ -150,10 +252,10 @@ func (m *Message) Unmarshal(data []byte) (int, error) {
 	}
 
 	m.Payload = data
-	m.Code = code
-	m.Token = token
-	m.Type = typ
-	m.MessageID = messageID
+	m.Code = hdr.Code
+	m.Token = hdr.Token
+	m.Type = hdr.Type
+	m.MessageID = hdr.MessageID
 
 	return size, nil
 }
@@ -0,0 +1,27 @@
+//go:build go1.18
+// +build go1.18
+
+package message
+
+import (
+	"testing"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+)
+
+func FuzzUnmarshal(f *testing.F) {
+	f.Add([]byte{0x41, 0x01, 0, 1, 0x1, 0xb1, 'a', 0xff, 0x1})
+	f.Add([]byte{0x40, 0, 0, 1})
+	f.Add([]byte{0x48, 0x45, 0x12, 0x34, 1, 2, 3, 4, 5, 6, 7, 8, 0xd1, 0x0b, 'b', 0xe0, 0x05, 0xf1, 0xff, 1, 2})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, strict := range []bool{false, true} {
+			msg := Message{Options: make(message.Options, 0, 16)}
+			if _, err := msg.unmarshal(data, strict); err != nil {
+				continue
+			}
+			if _, err := msg.Marshal(); err != nil {
+				t.Fatalf("cannot marshal unmarshaled message %v: %v", data, err)
+			}
+		}
+	})
+}
@@ -1,6 +1,9 @@
 package message
 
 import (
+	"bytes"
+	"errors"
+	"math/rand"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -208,6 +211,74 @@ func BenchmarkMarshalMessage(b *testing.B) {
 	}
 }
 
+// newManyOptionsMessage creates the request with 15 options, eg. a blockwise observation of a resource with queries.
+func newManyOptionsMessage(b *testing.B) Message {
+	options := make(message.Options, 0, 32)
+	buf := make([]byte, 1024)
+	var enc int
+	var err error
+	options, enc, err = options.SetURIHost(buf, "sensors.example.com")
+	require.NoError(b, err)
+	buf = buf[enc:]
+	options, enc, err = options.SetObserve(buf, 0)
+	require.NoError(b, err)
+	buf = buf[enc:]
+	options, enc, err = options.SetPath(buf, "/api/v1/buildings/42/floors/3/temperature")
+	require.NoError(b, err)
+	buf = buf[enc:]
+	options, enc, err = options.SetContentFormat(buf, message.AppCBOR)
+	require.NoError(b, err)
+	buf = buf[enc:]
+	for _, q := range []string{"unit=celsius", "since=1609459200"} {
+		options, enc, err = options.AddString(buf, message.URIQuery, q)
+		require.NoError(b, err)
+		buf = buf[enc:]
+	}
+	options, enc, err = options.SetAccept(buf, message.AppCBOR)
+	require.NoError(b, err)
+	buf = buf[enc:]
+	options, enc, err = options.SetBlock2(buf, message.Block{SZX: 6})
+	require.NoError(b, err)
+	buf = buf[enc:]
+	options, _, err = options.SetUint32(buf, message.Size2, 0)
+	require.NoError(b, err)
+	require.Len(b, options, 15)
+	return Message{
+		Code:      codes.GET,
+		Token:     []byte{0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0x8},
+		MessageID: 1,
+		Type:      Confirmable,
+		Options:   options,
+	}
+}
+
+func BenchmarkMarshalMessageManyOptions(b *testing.B) {
+	msg := newManyOptionsMessage(b)
+	buffer := make([]byte, 1024)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := msg.MarshalTo(buffer)
+		if err != nil {
+			b.Fatalf("cannot marshal: %v", err)
+		}
+	}
+}
+
+func BenchmarkSizeMessageManyOptions(b *testing.B) {
+	msg := newManyOptionsMessage(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := msg.Size()
+		if err != nil {
+			b.Fatalf("cannot get size: %v", err)
+		}
+	}
+}
+
 func BenchmarkUnmarshalMessage(b *testing.B) {
 	buffer := []byte{
 		0x40, 0x1, 0x30, 0x39, 0x46, 0x77,
@@ -228,3 +299,208 @@ func BenchmarkUnmarshalMessage(b *testing.B) {
 		}
 	}
 }
+
+func TestMarshalUnmarshalObserveSequence(t *testing.T) {
+	var options message.Options
+	options, _, err := options.SetObserve(make([]byte, 4), 16000000)
+	require.NoError(t, err)
+	msg := Message{Code: codes.Content, Token: []byte{0x1}, MessageID: 1, Type: Confirmable, Options: options}
+	buf := make([]byte, 64)
+	n, err := msg.MarshalTo(buf)
+	require.NoError(t, err)
+	buf = buf[:n]
+
+	got := Message{Options: make(message.Options, 0, 4)}
+	_, err = got.Unmarshal(buf)
+	require.NoError(t, err)
+	obs, err := got.Options.Observe()
+	require.NoError(t, err)
+	require.Equal(t, uint32(16000000), obs)
+
+	buf2 := make([]byte, 64)
+	n, err = got.MarshalTo(buf2)
+	require.NoError(t, err)
+	require.Equal(t, buf, buf2[:n])
+}
+
+func TestMarshalUnmarshalType(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want Message
+	}{
+		{name: "confirmable", data: []byte{0x41, byte(codes.GET), 0, 1, 0x1}, want: Message{Type: Confirmable, Code: codes.GET, MessageID: 1, Token: []byte{0x1}}},
+		{name: "nonConfirmable", data: []byte{0x51, byte(codes.POST), 0, 2, 0x2}, want: Message{Type: NonConfirmable, Code: codes.POST, MessageID: 2, Token: []byte{0x2}}},
+		{name: "acknowledgement", data: []byte{0x61, byte(codes.Content), 0, 3, 0x3}, want: Message{Type: Acknowledgement, Code: codes.Content, MessageID: 3, Token: []byte{0x3}}},
+		{name: "reset", data: []byte{0x70, 0, 0x12, 0x34}, want: Message{Type: Reset, Code: codes.Empty, MessageID: 0x1234}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := Message{Options: make(message.Options, 0, 8)}
+			_, err := msg.UnmarshalStrict(tt.data)
+			require.NoError(t, err)
+			require.Equal(t, tt.want.Type, msg.Type)
+			require.Equal(t, tt.want.Code, msg.Code)
+			require.Equal(t, tt.want.MessageID, msg.MessageID)
+			require.Equal(t, tt.want.Token, msg.Token)
+
+			data, err := msg.Marshal()
+			require.NoError(t, err)
+			require.Equal(t, tt.data, data)
+		})
+	}
+}
+
+func TestUnmarshalVersion(t *testing.T) {
+	data, err := Message{Type: Confirmable, Code: codes.GET, MessageID: 1}.Marshal()
+	require.NoError(t, err)
+	require.Equal(t, byte(Version), data[0]>>6)
+	for _, version := range []byte{0, 2, 3} {
+		data[0] = version<<6 | data[0]&0x3f
+		msg := Message{Options: make(message.Options, 0, 8)}
+		_, err = msg.Unmarshal(data)
+		require.ErrorIs(t, err, ErrMessageInvalidVersion)
+	}
+}
+
+func TestUnmarshalEmpty(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		wantErr  error
+		wantPing bool
+	}{
+		{name: "ping", data: []byte{0x40, 0, 0, 1}, wantPing: true},
+		{name: "acknowledgement", data: []byte{0x60, 0, 0, 1}},
+		{name: "reset", data: []byte{0x70, 0, 0, 1}},
+		{name: "withToken", data: []byte{0x41, 0, 0, 1, 1}, wantErr: ErrMessageInvalidEmpty},
+		{name: "withOption", data: []byte{0x40, 0, 0, 1, 0xb1, 'a'}, wantErr: ErrMessageInvalidEmpty},
+		{name: "withPayload", data: []byte{0x60, 0, 0, 1, 0xff, 1}, wantErr: ErrMessageInvalidEmpty},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := Message{Options: make(message.Options, 0, 8)}
+			_, err := msg.Unmarshal(tt.data)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, msg.IsEmpty())
+			require.Equal(t, tt.wantPing, msg.IsPing())
+		})
+	}
+	require.False(t, Message{Code: codes.GET}.IsEmpty())
+	require.False(t, Message{Token: []byte{1}}.IsPing())
+}
+
+func TestUnmarshalStrict(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{name: "valid", data: []byte{0x41, byte(codes.GET), 0, 1, 0x1, 0xb1, 'a', 0xff, 0x1}},
+		{name: "ping", data: []byte{0x40, 0, 0, 1}},
+		{name: "truncated", data: []byte{0x40, 0, 0}, wantErr: ErrMessageTruncated},
+		{name: "version", data: []byte{0x80, byte(codes.GET), 0, 1}, wantErr: ErrMessageInvalidVersion},
+		{name: "tokenLength9", data: []byte{0x49, byte(codes.GET), 0, 1, 1, 2, 3, 4, 5, 6, 7, 8, 9}, wantErr: message.ErrInvalidTokenLen},
+		{name: "tokenLength15", data: []byte{0x4f, byte(codes.GET), 0, 1}, wantErr: message.ErrInvalidTokenLen},
+		{name: "tokenTruncated", data: []byte{0x42, byte(codes.GET), 0, 1, 1}, wantErr: ErrMessageTruncated},
+		{name: "payloadMarkerWithoutPayload", data: []byte{0x40, byte(codes.GET), 0, 1, 0xff}, wantErr: message.ErrInvalidPayloadMarker},
+		{name: "optionTruncated", data: []byte{0x40, byte(codes.GET), 0, 1, 0xb5, 'a'}, wantErr: message.ErrOptionTruncated},
+		{name: "reservedOptionNibble", data: []byte{0x40, byte(codes.GET), 0, 1, 0xf1, 'a'}, wantErr: message.ErrOptionUnexpectedExtendMarker},
+		{name: "reservedCodeClass1", data: []byte{0x40, 1 << 5, 0, 1}, wantErr: ErrMessageInvalidCodeClass},
+		{name: "signalingCodeClass7", data: []byte{0x40, byte(codes.Ping), 0, 1}, wantErr: ErrMessageInvalidCodeClass},
+		{name: "emptyWithToken", data: []byte{0x41, 0, 0, 1, 1}, wantErr: ErrMessageInvalidEmpty},
+		{name: "emptyWithPayload", data: []byte{0x40, 0, 0, 1, 0xff, 1}, wantErr: ErrMessageInvalidEmpty},
+		{name: "resetWithResponse", data: []byte{0x70, byte(codes.Content), 0, 1}, wantErr: ErrMessageInvalidReset},
+		{name: "acknowledgementWithRequest", data: []byte{0x60, byte(codes.GET), 0, 1}, wantErr: ErrMessageInvalidAcknowledgement},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := Message{Options: make(message.Options, 0, 8)}
+			_, err := msg.UnmarshalStrict(tt.data)
+			if tt.wantErr != nil {
+				require.Error(t, err)
+				require.True(t, errors.Is(err, tt.wantErr), "unexpected error %v", err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestUnmarshalStrictGarbage(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	buf := make([]byte, 64)
+	for i := 0; i < 100000; i++ {
+		data := buf[:r.Intn(len(buf))]
+		r.Read(data)
+		if len(data) > 0 {
+			// most of garbage has valid version so parsing goes deeper
+			data[0] = 0x40 | data[0]&0x3f
+		}
+		msg := Message{Options: make(message.Options, 0, 8)}
+		_, err := msg.UnmarshalStrict(data)
+		if err != nil {
+			continue
+		}
+		// accepted message must be valid to marshal
+		_, err = msg.Marshal()
+		require.NoError(t, err, "data %v", data)
+	}
+}
+
+func TestMessageString(t *testing.T) {
+	msg := Message{
+		Code:      codes.GET,
+		Token:     []byte{0xa1, 0xb2},
+		MessageID: 12345,
+		Type:      Confirmable,
+		Options:   message.Options{{ID: message.URIPath, Value: []byte("temp")}},
+	}
+	require.Equal(t, "Confirmable MID=12345 GET Token=a1b2 URIPath=/temp", msg.String())
+	msg.Payload = []byte("21")
+	msg.Options = append(msg.Options, message.Option{ID: message.ContentFormat, Value: []byte{}})
+	require.Equal(t, `Confirmable MID=12345 GET Token=a1b2 URIPath=/temp ContentFormat=text/plain;charset=utf-8 Payload(2)="21"`, msg.String())
+}
+
+func TestUnmarshalOwnership(t *testing.T) {
+	buf := make([]byte, 256)
+	options, _, err := message.Options{}.SetPath(buf, "/a/b")
+	require.NoError(t, err)
+	msg := Message{Code: codes.POST, Token: []byte{0x1, 0x2}, MessageID: 1, Type: Confirmable, Options: options, Payload: []byte("payload")}
+	data, err := msg.Marshal()
+	require.NoError(t, err)
+
+	owned := Message{Options: make(message.Options, 0, 4)}
+	_, err = owned.Unmarshal(data)
+	require.NoError(t, err)
+	borrowed := Message{Options: make(message.Options, 0, 4)}
+	_, err = borrowed.UnmarshalBorrow(data)
+	require.NoError(t, err)
+	require.Equal(t, owned, borrowed)
+
+	// recycle the input buffer
+	for i := range data {
+		data[i] = 0
+	}
+	require.Equal(t, msg, owned)
+	require.NotEqual(t, msg.Token, borrowed.Token)
+	require.NotEqual(t, msg.Payload, borrowed.Payload)
+	require.NotEqual(t, msg.Options, borrowed.Options)
+}
+
+func TestNewGetMID(t *testing.T) {
+	getMID := NewGetMID(bytes.NewReader([]byte{0, 0, 0x10, 0}))
+	require.Equal(t, uint16(0x1001), getMID())
+	require.Equal(t, uint16(0x1002), getMID())
+
+	_, err := randMID(bytes.NewReader([]byte{1, 2}))
+	require.Error(t, err)
+	// the failing reader falls back to crypto/rand
+	getMID = NewGetMID(bytes.NewReader(nil))
+	mid := getMID()
+	require.Equal(t, mid+1, getMID())
+}
@@ -3,6 +3,7 @@ package pool
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"sync"
@@ -11,6 +12,7 @@ import (
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
 	"github.com/plgd-dev/go-coap/v2/message/pool"
+	"github.com/plgd-dev/go-coap/v2/net/blockwise"
 	udp "github.com/plgd-dev/go-coap/v2/udp/message"
 )
 
@@ -86,11 +88,14 @@ func (r *Message) Unmarshal(data []byte) (int, error) {
 	}
 	copy(r.rawData, data)
 	r.rawData = r.rawData[:len(data)]
-	m := &udp.Message{
-		Options: make(message.Options, 0, 16),
+	opts := pool.AcquireOptions()
+	defer pool.ReleaseOptions(opts)
+	m := udp.Message{
+		Options: *opts,
 	}
 
-	n, err := m.Unmarshal(r.rawData)
+	// rawData is owned by the message, so the decoded values can alias it
+	n, err := m.UnmarshalBorrow(r.rawData)
 	if err != nil {
 		return n, err
 	}
@@ -133,12 +138,46 @@ func (r *Message) Marshal() ([]byte, error) {
 	return r.rawMarshalData, nil
 }
 
+// Size returns size of marshaled message.
+func (r *Message) Size() (int, error) {
+	m := udp.Message{
+		Code:      r.Code(),
+		Token:     r.Message.Token(),
+		Options:   r.Message.Options(),
+		MessageID: r.messageID,
+		Type:      r.typ,
+	}
+	size, err := m.Size()
+	if err != nil {
+		return -1, err
+	}
+	bodySize, err := r.BodySize()
+	if err != nil {
+		return -1, err
+	}
+	if bodySize > 0 {
+		//for separator 0xff
+		size += int(bodySize) + 1
+	}
+	return size, nil
+}
+
+// IsEmpty reports whether the message has the code 0.00 without token, options and body.
+func (r *Message) IsEmpty() bool {
+	return r.Code() == codes.Empty && len(r.Token()) == 0 && len(r.Options()) == 0 && r.Body() == nil
+}
+
+// IsPing reports whether the message is CoAP ping, the empty confirmable message.
+func (r *Message) IsPing() bool {
+	return r.Type() == udp.Confirmable && r.IsEmpty()
+}
+
 func (r *Message) IsSeparate() bool {
 	return r.Code() == codes.Empty && r.Token() == nil && r.Type() == udp.Acknowledgement && len(r.Options()) == 0 && r.Body() == nil
 }
 
 func (r *Message) String() string {
-	return fmt.Sprintf("Type: %v, MID: %v, %s", r.Type(), r.MessageID(), r.Message.String())
+	return fmt.Sprintf("%v MID=%v %s", r.Type(), r.MessageID(), r.Message.String())
 }
 
 // AcquireMessage returns an empty Message instance from Message pool.
@@ -162,6 +201,21 @@ func AcquireMessage(ctx context.Context) *Message {
 	return r
 }
 
+// Clone returns a deep copy of the message acquired via AcquireMessage, it survives release of the original message,
+// eg. when a handler processes the request asynchronously. The clone must be released by ReleaseMessage too.
+func (r *Message) Clone() (*Message, error) {
+	c := AcquireMessage(r.Context())
+	err := r.Message.CopyTo(c.Message)
+	if err != nil {
+		ReleaseMessage(c)
+		return nil, err
+	}
+	c.messageID = r.messageID
+	c.typ = r.typ
+	c.isModified = r.isModified
+	return c, nil
+}
+
 // ReleaseMessage returns req acquired via AcquireMessage to Message pool.
 //
 // It is forbidden accessing req and/or its' members after returning
@@ -198,10 +252,15 @@ func ConvertTo(m *Message) (*message.Message, error) {
 	var body io.ReadSeeker
 	if m.Body() != nil {
 		payload, err := m.ReadBody()
-		if err != nil {
+		switch {
+		case err == nil:
+			body = bytes.NewReader(payload)
+		case errors.Is(err, blockwise.ErrStreamNotSeekable):
+			// the body of the streamed request is read as the blocks arrive
+			body = m.Body()
+		default:
 			return nil, err
 		}
-		body = bytes.NewReader(payload)
 	}
 	return &message.Message{
 		Context: m.Context(),
@@ -211,3 +270,11 @@ func ConvertTo(m *Message) (*message.Message, error) {
 		Options: opts,
 	}, nil
 }
+
+// ResponseError is reported when the peer answered by an unexpected response code, eg. 4.04.
+type ResponseError = pool.ResponseError
+
+// CheckResponse returns *ResponseError when the code of the response isn't a success (2.xx) one.
+func CheckResponse(resp *Message) error {
+	return pool.CheckResponse(resp.Message)
+}
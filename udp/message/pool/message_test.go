@@ -1,12 +1,15 @@
 package pool_test
 
 import (
+	"bytes"
 	"context"
 	"io/ioutil"
 	"sync"
 	"testing"
 
+	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
+	udp "github.com/plgd-dev/go-coap/v2/udp/message"
 	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -32,3 +35,107 @@ func Test_ConvertTo(t *testing.T) {
 	require.NoError(t, err)
 	wg.Wait()
 }
+
+func TestMessage_Clone(t *testing.T) {
+	msg := pool.AcquireMessage(context.Background())
+	msg.SetCode(codes.POST)
+	msg.SetToken([]byte{0x1, 0x2})
+	msg.SetMessageID(123)
+	msg.SetType(udp.Confirmable)
+	msg.SetPath("/a/b")
+	msg.SetBody(bytes.NewReader([]byte("payload")))
+
+	c, err := msg.Clone()
+	require.NoError(t, err)
+	defer pool.ReleaseMessage(c)
+	// the original is recycled and reused by other request
+	pool.ReleaseMessage(msg)
+	other := pool.AcquireMessage(context.Background())
+	defer pool.ReleaseMessage(other)
+	other.SetPath("/c/d")
+	other.SetToken([]byte{0x3, 0x4})
+
+	require.Equal(t, codes.POST, c.Code())
+	require.Equal(t, []byte{0x1, 0x2}, []byte(c.Token()))
+	require.Equal(t, uint16(123), c.MessageID())
+	require.Equal(t, udp.Confirmable, c.Type())
+	path, err := c.Options().Path()
+	require.NoError(t, err)
+	require.Equal(t, "a/b", path)
+	body, err := c.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, []byte("payload"), body)
+}
+
+func BenchmarkMessage_Unmarshal(b *testing.B) {
+	buffer := []byte{
+		0x40, 0x1, 0x30, 0x39, 0xb1, 'a', 0x1, 'b', 0x1, 'c',
+		0x46, 0x77, 0x65, 0x65, 0x74, 0x61, 0x67,
+		0xff, 'h', 'i',
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		msg := pool.AcquireMessage(context.Background())
+		_, err := msg.Unmarshal(buffer)
+		if err != nil {
+			b.Fatalf("cannot unmarshal: %v", err)
+		}
+		pool.ReleaseMessage(msg)
+	}
+}
+
+func BenchmarkMessage_Marshal(b *testing.B) {
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		msg := pool.AcquireMessage(context.Background())
+		msg.SetCode(codes.GET)
+		msg.SetToken([]byte{0x1, 0x2, 0x3})
+		msg.SetPath("/a/b/c/d/e")
+		msg.SetContentFormat(message.TextPlain)
+		_, err := msg.Marshal()
+		if err != nil {
+			b.Fatalf("cannot marshal: %v", err)
+		}
+		pool.ReleaseMessage(msg)
+	}
+}
+
+func TestMessage_RangeOptions(t *testing.T) {
+	req := pool.AcquireMessage(context.Background())
+	defer pool.ReleaseMessage(req)
+	req.SetCode(codes.GET)
+	req.SetPath("/a/bc/d")
+	req.AddQuery("x=1")
+	datagram, err := req.Marshal()
+	require.NoError(t, err)
+	datagram = append([]byte(nil), datagram...)
+
+	msg := pool.AcquireMessage(context.Background())
+	defer pool.ReleaseMessage(msg)
+	// the handler reads only Uri-Path, it stops at the first option after the path
+	var path [8][]byte
+	var segments int
+	readPath := func(id message.OptionID, value []byte) bool {
+		if id > message.URIPath {
+			return false
+		}
+		if id == message.URIPath && segments < len(path) {
+			path[segments] = value
+			segments++
+		}
+		return true
+	}
+	_, err = msg.Unmarshal(datagram)
+	require.NoError(t, err)
+	msg.RangeOptions(readPath)
+	require.Equal(t, [][]byte{[]byte("a"), []byte("bc"), []byte("d")}, path[:segments])
+
+	allocs := testing.AllocsPerRun(100, func() {
+		segments = 0
+		_, _ = msg.Unmarshal(datagram)
+		msg.RangeOptions(readPath)
+	})
+	require.Equal(t, float64(0), allocs)
+}
@@ -24,7 +24,7 @@ var typeToString = map[Type]string{
 	Confirmable:     "Confirmable",
 	NonConfirmable:  "NonConfirmable",
 	Acknowledgement: "Acknowledgement",
-	Reset:           "reset",
+	Reset:           "Reset",
 }
 
 func (t Type) String() string {
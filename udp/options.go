@@ -2,12 +2,17 @@ package udp
 
 import (
 	"context"
+	"io"
 	"net"
 	"time"
 
+	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+	"github.com/plgd-dev/go-coap/v2/net/clock"
 	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/net/ratelimit"
 	"github.com/plgd-dev/go-coap/v2/udp/client"
+	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
 )
 
 // HandlerFuncOpt handler function option.
@@ -41,7 +46,8 @@ func (o ContextOpt) applyDial(opts *dialOptions) {
 	opts.ctx = o.ctx
 }
 
-// WithContext set's parent context of server.
+// WithContext set's parent context of server or client connection.
+// Cancelling it stops the server like Stop does, Serve returns after all its connections are closed.
 func WithContext(ctx context.Context) ContextOpt {
 	return ContextOpt{ctx: ctx}
 }
@@ -60,6 +66,8 @@ func (o MaxMessageSizeOpt) applyDial(opts *dialOptions) {
 }
 
 // WithMaxMessageSize limit size of processed message.
+// Inbound messages exceeding the limit are dropped without decoding, confirmable requests are answered
+// by 4.13 (Request Entity Too Large) with the Size1 option carrying the limit.
 func WithMaxMessageSize(maxMessageSize int) MaxMessageSizeOpt {
 	return MaxMessageSizeOpt{maxMessageSize: maxMessageSize}
 }
@@ -97,7 +105,8 @@ func (o GoPoolOpt) applyDial(opts *dialOptions) {
 
 // WithGoPool sets function for managing spawning go routines
 // for handling incoming request's.
-// Eg: https://github.com/panjf2000/ants.
+// Eg: https://github.com/panjf2000/ants or Submit of workerpool.Pool, which bounds
+// the number of goroutines and queued requests.
 func WithGoPool(goPool GoPoolFunc) GoPoolOpt {
 	return GoPoolOpt{goPool: goPool}
 }
@@ -107,24 +116,26 @@ type KeepAliveOpt struct {
 	maxRetries uint32
 	timeout    time.Duration
 	onInactive inactivity.OnInactiveFunc
+	// periodic sends the next ping after another period of inactivity instead of by the next heartbeat
+	periodic bool
 }
 
-func (o KeepAliveOpt) apply(opts *serverOptions) {
-	opts.createInactivityMonitor = func() inactivity.Monitor {
-		keepalive := inactivity.NewKeepAlive(o.maxRetries, o.onInactive, func(cc inactivity.ClientConn, receivePong func()) (func(), error) {
-			return cc.(*client.ClientConn).AsyncPing(receivePong)
-		})
-		return inactivity.NewInactivityMonitor(o.timeout/time.Duration(o.maxRetries+1), keepalive.OnInactive)
+func (o KeepAliveOpt) createInactivityMonitor() inactivity.Monitor {
+	keepalive := inactivity.NewKeepAlive(o.maxRetries, o.onInactive, func(cc inactivity.ClientConn, receivePong func()) (func(), error) {
+		return cc.(*client.ClientConn).AsyncPing(receivePong)
+	})
+	if o.periodic {
+		return inactivity.NewPeriodicInactivityMonitor(o.timeout/time.Duration(o.maxRetries+1), keepalive.OnInactive)
 	}
+	return inactivity.NewInactivityMonitor(o.timeout/time.Duration(o.maxRetries+1), keepalive.OnInactive)
+}
+
+func (o KeepAliveOpt) apply(opts *serverOptions) {
+	opts.createInactivityMonitor = o.createInactivityMonitor
 }
 
 func (o KeepAliveOpt) applyDial(opts *dialOptions) {
-	opts.createInactivityMonitor = func() inactivity.Monitor {
-		keepalive := inactivity.NewKeepAlive(o.maxRetries, o.onInactive, func(cc inactivity.ClientConn, receivePong func()) (func(), error) {
-			return cc.(*client.ClientConn).AsyncPing(receivePong)
-		})
-		return inactivity.NewInactivityMonitor(o.timeout/time.Duration(o.maxRetries+1), keepalive.OnInactive)
-	}
+	opts.createInactivityMonitor = o.createInactivityMonitor
 }
 
 // WithKeepAlive monitoring's client connection's.
@@ -136,6 +147,17 @@ func WithKeepAlive(maxRetries uint32, timeout time.Duration, onInactive inactivi
 	}
 }
 
+// WithKeepAliveInterval monitors the connection by pings which are sent after each interval of inactivity.
+// onFailure is called when maxRetries pings in row were not answered, so a dead peer is detected within interval*(maxRetries+1).
+func WithKeepAliveInterval(interval time.Duration, maxRetries uint32, onFailure inactivity.OnInactiveFunc) KeepAliveOpt {
+	return KeepAliveOpt{
+		maxRetries: maxRetries,
+		timeout:    interval * time.Duration(maxRetries+1),
+		onInactive: onFailure,
+		periodic:   true,
+	}
+}
+
 // InactivityMonitorOpt notifies when a connection was inactive for a given duration.
 type InactivityMonitorOpt struct {
 	duration   time.Duration
@@ -218,6 +240,55 @@ func WithBlockwise(enable bool, szx blockwise.SZX, transferTimeout time.Duration
 	}
 }
 
+// BlockwiseCacheOpt network option.
+type BlockwiseCacheOpt struct {
+	cache *blockwise.BlockCache
+}
+
+func (o BlockwiseCacheOpt) apply(opts *serverOptions) {
+	opts.blockwiseCache = o.cache
+}
+
+// WithBlockwiseCache sets cache of blocks shared by all connections of the server, so blocks of a response
+// with the same ETag are sliced only once for all peers.
+func WithBlockwiseCache(cache *blockwise.BlockCache) BlockwiseCacheOpt {
+	return BlockwiseCacheOpt{
+		cache: cache,
+	}
+}
+
+// BlockwiseUploadStreamingOpt network option.
+type BlockwiseUploadStreamingOpt struct {
+	enable bool
+}
+
+func (o BlockwiseUploadStreamingOpt) apply(opts *serverOptions) {
+	opts.blockwiseUploadStreaming = o.enable
+}
+
+// WithBlockwiseUploadStreaming calls the handler with the first block of an upload transferred by Block1, the body
+// of the request yields the payload as the blocks arrive, so the handler doesn't need to hold the whole upload.
+// See blockwise.WithUploadStreaming.
+func WithBlockwiseUploadStreaming(enable bool) BlockwiseUploadStreamingOpt {
+	return BlockwiseUploadStreamingOpt{enable: enable}
+}
+
+// SeparateResponseOpt network option.
+type SeparateResponseOpt struct {
+	enable bool
+}
+
+func (o SeparateResponseOpt) apply(opts *serverOptions) {
+	opts.separateResponse = o.enable
+}
+
+// WithSeparateResponse acknowledges a confirmable request by an empty ACK when the handler doesn't respond
+// within the half of the acknowledge timeout, the response is then sent separately as a confirmable message
+// with the token of the request: https://tools.ietf.org/html/rfc7252#section-5.2.2
+func WithSeparateResponse(enable bool) SeparateResponseOpt {
+	return SeparateResponseOpt{enable: enable}
+}
+
 // OnNewClientConnOpt network option.
 type OnNewClientConnOpt struct {
 	onNewClientConn OnNewClientConnFunc
@@ -264,6 +335,49 @@ func WithTransmission(transmissionNStart time.Duration,
 	}
 }
 
+// CongestionControlOpt congestion control option.
+type CongestionControlOpt struct {
+	newCongestionControl client.NewCongestionControlFunc
+}
+
+func (o CongestionControlOpt) apply(opts *serverOptions) {
+	opts.newCongestionControl = o.newCongestionControl
+}
+
+func (o CongestionControlOpt) applyDial(opts *dialOptions) {
+	opts.newCongestionControl = o.newCongestionControl
+}
+
+// WithCongestionControl computes retransmission timeout of Confirmable messages by congestion control
+// created for each connection, eg. client.NewCoCoA. It replaces the fixed acknowledge timeout of WithTransmission.
+func WithCongestionControl(newCongestionControl client.NewCongestionControlFunc) CongestionControlOpt {
+	return CongestionControlOpt{
+		newCongestionControl: newCongestionControl,
+	}
+}
+
+// ClockOpt clock option.
+type ClockOpt struct {
+	clock clock.Clock
+}
+
+func (o ClockOpt) apply(opts *serverOptions) {
+	opts.clock = o.clock
+}
+
+func (o ClockOpt) applyDial(opts *dialOptions) {
+	opts.clock = o.clock
+}
+
+// WithClock sets the clock which drives the retransmissions of Confirmable messages, the lifetime of the responses
+// remembered for the deduplication, the Max-Age of the cached blocks and the heartbeat of the server checking
+// the inactivity monitors, eg. clock.NewFake in tests. The read deadlines of the socket use the real time.
+func WithClock(c clock.Clock) ClockOpt {
+	return ClockOpt{
+		clock: c,
+	}
+}
+
 // GetMIDOpt get message ID option.
 type GetMIDOpt struct {
 	getMID GetMIDFunc
@@ -282,6 +396,49 @@ func WithGetMID(getMID GetMIDFunc) GetMIDOpt {
 	return GetMIDOpt{getMID: getMID}
 }
 
+// TokenGeneratorOpt token generator option.
+type TokenGeneratorOpt struct {
+	getToken GetTokenFunc
+}
+
+func (o TokenGeneratorOpt) apply(opts *serverOptions) {
+	opts.getToken = o.getToken
+}
+
+func (o TokenGeneratorOpt) applyDial(opts *dialOptions) {
+	opts.getToken = o.getToken
+}
+
+// WithTokenGenerator allows to set own generator of tokens for requests created by client connections.
+// Tokens which are already in flight are skipped.
+func WithTokenGenerator(getToken GetTokenFunc) TokenGeneratorOpt {
+	return TokenGeneratorOpt{getToken: getToken}
+}
+
+// RandReaderOpt random source option.
+type RandReaderOpt struct {
+	r io.Reader
+}
+
+func (o RandReaderOpt) apply(opts *serverOptions) {
+	r := message.NewLockedReader(o.r)
+	opts.getMID = udpMessage.NewGetMID(r)
+	opts.getToken = message.NewGetToken(r)
+}
+
+func (o RandReaderOpt) applyDial(opts *dialOptions) {
+	r := message.NewLockedReader(o.r)
+	opts.getMID = udpMessage.NewGetMID(r)
+	opts.getToken = message.NewGetToken(r)
+}
+
+// WithRandReader seeds the message IDs and generates the tokens from r instead of crypto/rand,
+// eg. to get predictable message IDs and tokens in tests. The reads of both generators are serialized,
+// so r doesn't have to be safe for concurrent use.
+func WithRandReader(r io.Reader) RandReaderOpt {
+	return RandReaderOpt{r: r}
+}
+
 // CloseSocketOpt close socket option.
 type CloseSocketOpt struct {
 }
@@ -312,3 +469,127 @@ func WithDialer(dialer *net.Dialer) DialerOpt {
 		dialer: dialer,
 	}
 }
+
+// RateLimitOpt rate limit option.
+type RateLimitOpt struct {
+	perSecond float64
+	burst     int
+}
+
+func (o RateLimitOpt) apply(opts *serverOptions) {
+	opts.rateLimiter = ratelimit.New(o.perSecond, o.burst)
+}
+
+// WithRateLimit limits requests of every remote IP address to perSecond with bursts of burst requests.
+// Throttled requests are answered by 4.29 (Too Many Requests) without reaching the handler.
+func WithRateLimit(perSecond float64, burst int) RateLimitOpt {
+	return RateLimitOpt{perSecond: perSecond, burst: burst}
+}
+
+// AuthorizerOpt authorizer option.
+type AuthorizerOpt struct {
+	authorize client.AuthorizeFunc
+}
+
+func (o AuthorizerOpt) apply(opts *serverOptions) {
+	opts.authorize = o.authorize
+}
+
+// WithAuthorizer checks every request by authorize with the security identity of the peer, the code and the path
+// of the request. A rejected request is answered by 4.01 (Unauthorized) or 4.03 (Forbidden) without reaching the handler.
+// The request sent in blocks is checked before the blocks are reassembled, so a rejected upload stops at the first block.
+func WithAuthorizer(authorize client.AuthorizeFunc) AuthorizerOpt {
+	return AuthorizerOpt{authorize: authorize}
+}
+
+// MulticastLeisureOpt multicast leisure option.
+type MulticastLeisureOpt struct {
+	leisure time.Duration
+}
+
+func (o MulticastLeisureOpt) apply(opts *serverOptions) {
+	opts.multicastLeisure = o.leisure
+}
+
+// WithMulticastLeisure delays the responses to the requests received via multicast by a random time within leisure,
+// so the servers which received the same request don't answer all at once: https://tools.ietf.org/html/rfc7252#section-8.2.
+// The responses are sent as non-confirmable messages.
+func WithMulticastLeisure(leisure time.Duration) MulticastLeisureOpt {
+	return MulticastLeisureOpt{leisure: leisure}
+}
+
+// DedupStoreOpt dedup store option.
+type DedupStoreOpt struct {
+	store client.DedupStore
+}
+
+func (o DedupStoreOpt) apply(opts *serverOptions) {
+	opts.dedupStore = o.store
+}
+
+// WithDedupStore remembers the responses for the deduplication of the received messages in store, which can be
+// shared by more servers, so a retransmission landed on another server is answered by the original response.
+// The handler is not called again for a duplicate after its response is remembered. By default every connection
+// has its own in-memory store.
+func WithDedupStore(store client.DedupStore) DedupStoreOpt {
+	return DedupStoreOpt{store: store}
+}
+
+// OnSendOpt on send option.
+type OnSendOpt struct {
+	onSend MessageFunc
+}
+
+func (o OnSendOpt) apply(opts *serverOptions) {
+	opts.onSend = o.onSend
+}
+
+func (o OnSendOpt) applyDial(opts *dialOptions) {
+	opts.onSend = o.onSend
+}
+
+// WithOnSend calls onSend with every outgoing message of the connection right before it's marshalled,
+// eg. to set an option to all requests. It's called for retransmissions too, so it should set options instead of adding them.
+func WithOnSend(onSend MessageFunc) OnSendOpt {
+	return OnSendOpt{onSend: onSend}
+}
+
+// OnReceiveOpt on receive option.
+type OnReceiveOpt struct {
+	onReceive MessageFunc
+}
+
+func (o OnReceiveOpt) apply(opts *serverOptions) {
+	opts.onReceive = o.onReceive
+}
+
+func (o OnReceiveOpt) applyDial(opts *dialOptions) {
+	opts.onReceive = o.onReceive
+}
+
+// WithOnReceive calls onReceive with every incoming message of the connection before it's handled.
+func WithOnReceive(onReceive MessageFunc) OnReceiveOpt {
+	return OnReceiveOpt{onReceive: onReceive}
+}
+
+// StatsOpt stats option.
+type StatsOpt struct {
+	interval time.Duration
+	onStats  StatsFunc
+}
+
+func (o StatsOpt) apply(opts *serverOptions) {
+	opts.statsInterval = o.interval
+	opts.onStats = o.onStats
+}
+
+func (o StatsOpt) applyDial(opts *dialOptions) {
+	opts.statsInterval = o.interval
+	opts.onStats = o.onStats
+}
+
+// WithOnStats calls onStats with the statistics of the connection every interval until the connection is closed,
+// eg. to export them to Prometheus. The interval is measured by the clock of WithClock.
+func WithOnStats(interval time.Duration, onStats StatsFunc) StatsOpt {
+	return StatsOpt{interval: interval, onStats: onStats}
+}
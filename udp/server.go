@@ -12,7 +12,9 @@ import (
 	"github.com/plgd-dev/go-coap/v2/message/codes"
 	coapNet "github.com/plgd-dev/go-coap/v2/net"
 	"github.com/plgd-dev/go-coap/v2/net/blockwise"
+	"github.com/plgd-dev/go-coap/v2/net/clock"
 	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
+	"github.com/plgd-dev/go-coap/v2/net/ratelimit"
 	"github.com/plgd-dev/go-coap/v2/udp/client"
 	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
 	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
@@ -37,6 +39,10 @@ type BlockwiseFactoryFunc = func(getSendedRequest func(token message.Token) (blo
 type OnNewClientConnFunc = func(cc *client.ClientConn)
 
 type GetMIDFunc = func() uint16
+type GetTokenFunc = func() (message.Token, error)
+
+type MessageFunc = func(*pool.Message)
+type StatsFunc = client.StatsFunc
 
 var defaultServerOptions = serverOptions{
 	ctx:            context.Background(),
@@ -64,6 +70,7 @@ var defaultServerOptions = serverOptions{
 	transmissionAcknowledgeTimeout: time.Second * 2,
 	transmissionMaxRetransmit:      4,
 	getMID:                         udpMessage.GetMID,
+	getToken:                       message.GetToken,
 }
 
 type serverOptions struct {
@@ -77,11 +84,25 @@ type serverOptions struct {
 	blockwiseSZX                   blockwise.SZX
 	blockwiseEnable                bool
 	blockwiseTransferTimeout       time.Duration
+	blockwiseCache                 *blockwise.BlockCache
+	blockwiseUploadStreaming       bool
+	separateResponse               bool
 	onNewClientConn                OnNewClientConnFunc
 	transmissionNStart             time.Duration
 	transmissionAcknowledgeTimeout time.Duration
 	transmissionMaxRetransmit      int
+	newCongestionControl           client.NewCongestionControlFunc
+	clock                          clock.Clock
+	onSend                         MessageFunc
+	onReceive                      MessageFunc
+	onStats                        StatsFunc
+	statsInterval                  time.Duration
 	getMID                         GetMIDFunc
+	getToken                       GetTokenFunc
+	rateLimiter                    *ratelimit.Limiter
+	authorize                      client.AuthorizeFunc
+	multicastLeisure               time.Duration
+	dedupStore                     client.DedupStore
 }
 
 type Server struct {
@@ -93,11 +114,24 @@ type Server struct {
 	blockwiseSZX                   blockwise.SZX
 	blockwiseEnable                bool
 	blockwiseTransferTimeout       time.Duration
+	blockwiseCache                 *blockwise.BlockCache
+	blockwiseUploadStreaming       bool
+	separateResponse               bool
 	onNewClientConn                OnNewClientConnFunc
 	transmissionNStart             time.Duration
 	transmissionAcknowledgeTimeout time.Duration
 	transmissionMaxRetransmit      int
+	newCongestionControl           client.NewCongestionControlFunc
+	clock                          clock.Clock
+	onSend                         MessageFunc
+	onReceive                      MessageFunc
+	onStats                        StatsFunc
+	statsInterval                  time.Duration
 	getMID                         GetMIDFunc
+	getToken                       GetTokenFunc
+	multicastLeisure               time.Duration
+	dedupStore                     client.DedupStore
+	authorize                      client.AuthorizeFunc
 
 	conns             map[string]*client.ClientConn
 	connsMutex        sync.Mutex
@@ -126,12 +160,24 @@ func NewServer(opt ...ServerOption) *Server {
 		opts.getMID = udpMessage.GetMID
 	}
 
+	if opts.getToken == nil {
+		opts.getToken = message.GetToken
+	}
+
 	if opts.createInactivityMonitor == nil {
 		opts.createInactivityMonitor = func() inactivity.Monitor {
 			return inactivity.NewNilMonitor()
 		}
 	}
 
+	if opts.clock == nil {
+		opts.clock = clock.Real
+	}
+
+	if opts.rateLimiter != nil {
+		opts.handler = client.NewRateLimitHandler(opts.rateLimiter, opts.handler)
+	}
+
 	ctx, cancel := context.WithCancel(opts.ctx)
 	serverStartedChan := make(chan struct{})
 
@@ -152,6 +198,9 @@ func NewServer(opt ...ServerOption) *Server {
 		blockwiseSZX:                   opts.blockwiseSZX,
 		blockwiseEnable:                opts.blockwiseEnable,
 		blockwiseTransferTimeout:       opts.blockwiseTransferTimeout,
+		blockwiseCache:                 opts.blockwiseCache,
+		blockwiseUploadStreaming:       opts.blockwiseUploadStreaming,
+		separateResponse:               opts.separateResponse,
 		multicastHandler:               client.NewHandlerContainer(),
 		multicastRequests:              kitSync.NewMap(),
 		serverStartedChan:              serverStartedChan,
@@ -159,7 +208,17 @@ func NewServer(opt ...ServerOption) *Server {
 		transmissionNStart:             opts.transmissionNStart,
 		transmissionAcknowledgeTimeout: opts.transmissionAcknowledgeTimeout,
 		transmissionMaxRetransmit:      opts.transmissionMaxRetransmit,
+		newCongestionControl:           opts.newCongestionControl,
+		clock:                          opts.clock,
+		onSend:                         opts.onSend,
+		onReceive:                      opts.onReceive,
+		onStats:                        opts.onStats,
+		statsInterval:                  opts.statsInterval,
 		getMID:                         opts.getMID,
+		getToken:                       opts.getToken,
+		multicastLeisure:               opts.multicastLeisure,
+		dedupStore:                     opts.dedupStore,
+		authorize:                      opts.authorize,
 
 		conns: make(map[string]*client.ClientConn),
 	}
@@ -194,7 +253,8 @@ func (s *Server) Serve(l *coapNet.UDPConn) error {
 		s.serverStartedChan = make(chan struct{}, 1)
 	}()
 
-	m := make([]byte, s.maxMessageSize)
+	// one extra byte detects datagrams exceeding the max message size, which would be truncated otherwise
+	m := make([]byte, s.maxMessageSize+1)
 	var wg sync.WaitGroup
 
 	wg.Add(1)
@@ -205,7 +265,7 @@ func (s *Server) Serve(l *coapNet.UDPConn) error {
 
 	for {
 		buf := m
-		n, raddr, err := l.ReadWithContext(s.ctx, buf)
+		n, cm, raddr, err := s.read(l, buf)
 		if err != nil {
 			wg.Wait()
 
@@ -223,7 +283,11 @@ func (s *Server) Serve(l *coapNet.UDPConn) error {
 				s.onNewClientConn(cc)
 			}
 		}
-		err = cc.Process(buf)
+		if cm != nil && cm.Dst.IsMulticast() {
+			err = cc.ProcessMulticast(buf)
+		} else {
+			err = cc.Process(buf)
+		}
 		if err != nil {
 			cc.Close()
 			s.errors(fmt.Errorf("%v: %w", cc.RemoteAddr(), err))
@@ -231,6 +295,21 @@ func (s *Server) Serve(l *coapNet.UDPConn) error {
 	}
 }
 
+// read reads the datagram, the destination address is needed only to delay the responses to multicast requests.
+func (s *Server) read(l *coapNet.UDPConn, buf []byte) (int, *coapNet.ControlMessage, *net.UDPAddr, error) {
+	if s.multicastLeisure > 0 {
+		return l.ReadMsgWithContext(s.ctx, buf)
+	}
+	n, raddr, err := l.ReadWithContext(s.ctx, buf)
+	return n, nil, raddr, err
+}
+
+// Broadcast writes the message created by buildMsg to all connections of the server concurrently,
+// eg. a non-confirmable notification of a configuration change. See client.Broadcast.
+func (s *Server) Broadcast(ctx context.Context, buildMsg func() *pool.Message) error {
+	return client.Broadcast(ctx, s.Connections(), buildMsg)
+}
+
 // Stop stops server without wait of ends Serve function.
 func (s *Server) Stop() {
 	s.cancel()
@@ -267,6 +346,12 @@ func (s *Server) conn() *coapNet.UDPConn {
 const inactivityMonitorKey = "gocoapInactivityMonitor"
 const closeKey = "gocoapCloseConnection"
 
+// Connections returns the connections of the peers which are alive, eg. to inspect the peers by RemoteAddr
+// and Stats.
+func (s *Server) Connections() []*client.ClientConn {
+	return s.getClientConns()
+}
+
 func (s *Server) getClientConns() []*client.ClientConn {
 	s.connsMutex.Lock()
 	defer s.connsMutex.Unlock()
@@ -278,12 +363,10 @@ func (s *Server) getClientConns() []*client.ClientConn {
 }
 
 func (s *Server) handleInactivityMonitors() {
-	ticker := time.NewTicker(time.Second)
-	defer ticker.Stop()
-
 	for {
+		timer := s.clock.NewTimer(time.Second)
 		select {
-		case <-ticker.C:
+		case <-timer.C():
 			for _, cc := range s.getClientConns() {
 				select {
 				case <-cc.Context().Done():
@@ -298,6 +381,7 @@ func (s *Server) handleInactivityMonitors() {
 				}
 			}
 		case <-s.ctx.Done():
+			timer.Stop()
 			return
 		}
 	}
@@ -335,6 +419,9 @@ func (s *Server) getOrCreateClientConn(UDPConn *coapNet.UDPConn, raddr *net.UDPA
 				s.errors,
 				false,
 				bwCreateHandlerFunc(s.multicastRequests),
+				blockwise.WithBlockCache(s.blockwiseCache),
+				blockwise.WithUploadStreaming(s.blockwiseUploadStreaming),
+				blockwise.WithClock(s.clock),
 			)
 		}
 		obsHandler := client.NewHandlerContainer()
@@ -346,28 +433,43 @@ func (s *Server) getOrCreateClientConn(UDPConn *coapNet.UDPConn, raddr *net.UDPA
 			false,
 		)
 		monitor := s.createInactivityMonitor()
-		cc = client.NewClientConn(
-			session,
-			obsHandler,
-			s.multicastRequests,
-			s.transmissionNStart,
-			s.transmissionAcknowledgeTimeout,
-			s.transmissionMaxRetransmit,
-			client.NewObservationHandler(obsHandler, func(w *client.ResponseWriter, r *pool.Message) {
+		var congestionControl client.CongestionControl
+		if s.newCongestionControl != nil {
+			congestionControl = s.newCongestionControl()
+		}
+		cc = client.New(client.ConnConfig{
+			Session:                        session,
+			ObservationTokenHandler:        obsHandler,
+			ObservationRequests:            s.multicastRequests,
+			TransmissionNStart:             s.transmissionNStart,
+			TransmissionAcknowledgeTimeout: s.transmissionAcknowledgeTimeout,
+			TransmissionMaxRetransmit:      s.transmissionMaxRetransmit,
+			Handler: client.NewObservationHandler(obsHandler, func(w *client.ResponseWriter, r *pool.Message) {
 				h, err := s.multicastHandler.Get(r.Token())
 				if err == nil {
 					h(w, r)
 					return
 				}
-				s.handler(w, r)
+				client.NewResetUnknownResponseHandler(s.handler)(w, r)
 			}),
-			s.blockwiseSZX,
-			blockWise,
-			s.goPool,
-			s.errors,
-			s.getMID,
-			monitor,
-		)
+			BlockwiseSZX:      s.blockwiseSZX,
+			BlockWise:         blockWise,
+			GoPool:            s.goPool,
+			Errors:            s.errors,
+			GetMID:            s.getMID,
+			GetToken:          s.getToken,
+			ActivityMonitor:   monitor,
+			CongestionControl: congestionControl,
+			Clock:             s.clock,
+			OnSend:            s.onSend,
+			OnReceive:         s.onReceive,
+			OnStats:           s.onStats,
+			StatsInterval:     s.statsInterval,
+			MulticastLeisure:  s.multicastLeisure,
+			DedupStore:        s.dedupStore,
+			SeparateResponse:  s.separateResponse,
+			Authorize:         s.authorize,
+		})
 		cc.SetContextValue(inactivityMonitorKey, monitor)
 		cc.SetContextValue(closeKey, func() {
 			session.close()
@@ -3,17 +3,24 @@ package udp_test
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
 	"net"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
 	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/net/clock"
 	"github.com/plgd-dev/go-coap/v2/net/monitor/inactivity"
 	"github.com/plgd-dev/go-coap/v2/udp"
 	"github.com/plgd-dev/go-coap/v2/udp/client"
+	udpMessage "github.com/plgd-dev/go-coap/v2/udp/message"
 	"github.com/plgd-dev/go-coap/v2/udp/message/pool"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -139,6 +146,155 @@ func TestServer_Discover(t *testing.T) {
 	assert.Equal(t, codes.BadRequest, got[0].Code())
 }
 
+func TestServer_DiscoverMultipleServers(t *testing.T) {
+	const numServers = 5
+	multicastAddr := "224.0.1.187:5685"
+	a, err := net.ResolveUDPAddr("udp4", multicastAddr)
+	require.NoError(t, err)
+	ifaces, err := net.Interfaces()
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for i := 0; i < numServers; i++ {
+		// the servers share the multicast port, every one of them receives the request
+		l, err := coapNet.NewListenUDP("udp4", multicastAddr, coapNet.WithReusePort())
+		if errors.Is(err, coapNet.ErrReusePortNotSupported) {
+			t.Skip(err)
+		}
+		require.NoError(t, err)
+		defer l.Close()
+		for _, iface := range ifaces {
+			iface := iface
+			if err := l.JoinGroup(&iface, a); err != nil {
+				t.Logf("cannot JoinGroup(%v, %v): %v", iface, a, err)
+			}
+		}
+		err = l.SetMulticastLoopback(true)
+		require.NoError(t, err)
+
+		id := []byte(fmt.Sprintf("server%v", i))
+		s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+			err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader(id))
+			require.NoError(t, err)
+		}))
+		defer s.Stop()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.Serve(l)
+			require.NoError(t, err)
+		}()
+	}
+
+	ld, err := coapNet.NewListenUDP("udp4", "")
+	require.NoError(t, err)
+	defer ld.Close()
+	sd := udp.NewServer()
+	defer sd.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*500)
+	defer cancel()
+	recv := &mcastreceiver{}
+	err = sd.Discover(ctx, multicastAddr, "/oic/res", recv.process)
+	require.NoError(t, err)
+	got := make(map[string]bool)
+	for _, r := range recv.pop() {
+		require.Equal(t, codes.Content, r.Code())
+		body, err := r.ReadBody()
+		require.NoError(t, err)
+		got[string(body)] = true
+	}
+	require.Len(t, got, numServers)
+}
+
+func TestServer_MulticastLeisure(t *testing.T) {
+	const numServers = 50
+	leisure := time.Millisecond * 500
+	multicastAddr := "224.0.1.187:5686"
+	a, err := net.ResolveUDPAddr("udp4", multicastAddr)
+	require.NoError(t, err)
+	ifaces, err := net.Interfaces()
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for i := 0; i < numServers; i++ {
+		l, err := coapNet.NewListenUDP("udp4", multicastAddr, coapNet.WithReusePort())
+		if errors.Is(err, coapNet.ErrReusePortNotSupported) {
+			t.Skip(err)
+		}
+		require.NoError(t, err)
+		defer l.Close()
+		for _, iface := range ifaces {
+			iface := iface
+			_ = l.JoinGroup(&iface, a)
+		}
+		err = l.SetMulticastLoopback(true)
+		require.NoError(t, err)
+
+		id := []byte(fmt.Sprintf("server%v", i))
+		s := udp.NewServer(udp.WithMulticastLeisure(leisure), udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+			err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader(id))
+			require.NoError(t, err)
+		}))
+		defer s.Stop()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.Serve(l)
+			require.NoError(t, err)
+		}()
+	}
+
+	ld, err := coapNet.NewListenUDP("udp4", "")
+	require.NoError(t, err)
+	defer ld.Close()
+	sd := udp.NewServer()
+	defer sd.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	var lock sync.Mutex
+	got := make(map[string]time.Duration)
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), leisure+time.Millisecond*500)
+	defer cancel()
+	err = sd.Discover(ctx, multicastAddr, "/oic/res", func(cc *client.ClientConn, r *pool.Message) {
+		require.Equal(t, udpMessage.NonConfirmable, r.Type())
+		body, err := r.ReadBody()
+		require.NoError(t, err)
+		lock.Lock()
+		defer lock.Unlock()
+		got[string(body)] = time.Since(start)
+	})
+	require.NoError(t, err)
+	lock.Lock()
+	defer lock.Unlock()
+	require.Len(t, got, numServers)
+	first, last := time.Duration(math.MaxInt64), time.Duration(0)
+	for _, d := range got {
+		if d < first {
+			first = d
+		}
+		if d > last {
+			last = d
+		}
+	}
+	// the responses are spread over the leisure instead of arriving at once
+	require.Greater(t, int64(last-first), int64(leisure/2))
+}
+
 func TestServer_CleanUpConns(t *testing.T) {
 	ld, err := coapNet.NewListenUDP("udp4", "")
 	require.NoError(t, err)
@@ -293,3 +449,630 @@ func TestServer_KeepAliveMonitor(t *testing.T) {
 	checkCloseWg.Wait()
 	require.True(t, inactivityDetected)
 }
+
+func TestServer_PingIsAnsweredByReset(t *testing.T) {
+	ld, err := coapNet.NewListenUDP("udp4", "")
+	require.NoError(t, err)
+	defer ld.Close()
+
+	sd := udp.NewServer()
+	var serverWg sync.WaitGroup
+	defer func() {
+		sd.Stop()
+		serverWg.Wait()
+	}()
+	serverWg.Add(1)
+	go func() {
+		defer serverWg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	c, err := net.Dial("udp4", ld.LocalAddr().String())
+	require.NoError(t, err)
+	defer c.Close()
+	// empty Confirmable message with message ID 0x1234
+	_, err = c.Write([]byte{0x40, 0x00, 0x12, 0x34})
+	require.NoError(t, err)
+	err = c.SetReadDeadline(time.Now().Add(time.Second))
+	require.NoError(t, err)
+	buf := make([]byte, 64)
+	n, err := c.Read(buf)
+	require.NoError(t, err)
+	resp := pool.AcquireMessage(context.Background())
+	defer pool.ReleaseMessage(resp)
+	_, err = resp.Unmarshal(buf[:n])
+	require.NoError(t, err)
+	require.Equal(t, udpMessage.Reset, resp.Type())
+	require.Equal(t, codes.Empty, resp.Code())
+	require.Equal(t, uint16(0x1234), resp.MessageID())
+}
+
+func TestServer_UnknownResponseIsAnsweredByReset(t *testing.T) {
+	ld, err := coapNet.NewListenUDP("udp4", "")
+	require.NoError(t, err)
+	defer ld.Close()
+
+	var handled uint32
+	sd := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		atomic.AddUint32(&handled, 1)
+	}))
+	var serverWg sync.WaitGroup
+	defer func() {
+		sd.Stop()
+		serverWg.Wait()
+	}()
+	serverWg.Add(1)
+	go func() {
+		defer serverWg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	c, err := net.Dial("udp4", ld.LocalAddr().String())
+	require.NoError(t, err)
+	defer c.Close()
+	buf := make([]byte, 64)
+	for _, typ := range []udpMessage.Type{udpMessage.Confirmable, udpMessage.NonConfirmable} {
+		// 2.05 Content with the token 0xab which doesn't belong to any request
+		mid := uint16(0x4321) + uint16(typ)
+		_, err = c.Write([]byte{0x41 | byte(typ)<<4, byte(codes.Content), byte(mid >> 8), byte(mid), 0xab})
+		require.NoError(t, err)
+		err = c.SetReadDeadline(time.Now().Add(time.Second))
+		require.NoError(t, err)
+		n, err := c.Read(buf)
+		require.NoError(t, err)
+		resp := pool.AcquireMessage(context.Background())
+		_, err = resp.Unmarshal(buf[:n])
+		require.NoError(t, err)
+		require.Equal(t, udpMessage.Reset, resp.Type())
+		require.Equal(t, codes.Empty, resp.Code())
+		require.Equal(t, mid, resp.MessageID())
+		pool.ReleaseMessage(resp)
+	}
+
+	// an unmatched acknowledgement is silently ignored
+	_, err = c.Write([]byte{0x61, byte(codes.Content), 0x43, 0x30, 0xab})
+	require.NoError(t, err)
+	err = c.SetReadDeadline(time.Now().Add(time.Millisecond * 200))
+	require.NoError(t, err)
+	_, err = c.Read(buf)
+	require.Error(t, err)
+	require.Equal(t, uint32(0), atomic.LoadUint32(&handled))
+}
+
+func TestServer_SharedDedupStore(t *testing.T) {
+	store := client.NewMemoryDedupStore()
+	var handled uint32
+	var serverWg sync.WaitGroup
+	defer serverWg.Wait()
+	addrs := make([]*net.UDPAddr, 0, 2)
+	for i := 0; i < 2; i++ {
+		l, err := coapNet.NewListenUDP("udp4", "127.0.0.1:")
+		require.NoError(t, err)
+		defer l.Close()
+		s := udp.NewServer(udp.WithDedupStore(store), udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+			n := atomic.AddUint32(&handled, 1)
+			err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte(fmt.Sprintf("%v", n))))
+			require.NoError(t, err)
+		}))
+		defer s.Stop()
+		serverWg.Add(1)
+		go func() {
+			defer serverWg.Done()
+			err := s.Serve(l)
+			require.NoError(t, err)
+		}()
+		addrs = append(addrs, l.LocalAddr().(*net.UDPAddr))
+	}
+
+	c, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer c.Close()
+	// CON GET with the message ID 0x1234 and the token 0xab, the retransmission lands on the second server
+	req := []byte{0x41, byte(codes.GET), 0x12, 0x34, 0xab}
+	var resps [][]byte
+	for _, addr := range addrs {
+		_, err = c.WriteTo(req, addr)
+		require.NoError(t, err)
+		err = c.SetReadDeadline(time.Now().Add(time.Second))
+		require.NoError(t, err)
+		buf := make([]byte, 64)
+		n, err := c.Read(buf)
+		require.NoError(t, err)
+		resps = append(resps, buf[:n])
+	}
+	require.Equal(t, resps[0], resps[1])
+	require.Equal(t, uint32(1), atomic.LoadUint32(&handled))
+	resp := pool.AcquireMessage(context.Background())
+	defer pool.ReleaseMessage(resp)
+	_, err = resp.Unmarshal(resps[0])
+	require.NoError(t, err)
+	require.Equal(t, udpMessage.Acknowledgement, resp.Type())
+	require.Equal(t, uint16(0x1234), resp.MessageID())
+	require.Equal(t, codes.Content, resp.Code())
+}
+
+func TestServer_DedupNonConfirmableWithoutResponse(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp4", "127.0.0.1:")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	handled := make(chan struct{}, 2)
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		handled <- struct{}{}
+	}))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	c, err := net.DialUDP("udp4", nil, l.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	defer c.Close()
+	// NON POST with the message ID 0x1234 and the token 0xab, sent twice
+	req := []byte{0x51, byte(codes.POST), 0x12, 0x34, 0xab}
+	_, err = c.Write(req)
+	require.NoError(t, err)
+	select {
+	case <-handled:
+	case <-time.After(time.Second):
+		require.FailNow(t, "request was not handled")
+	}
+	_, err = c.Write(req)
+	require.NoError(t, err)
+	select {
+	case <-handled:
+		require.FailNow(t, "duplicate was handled")
+	case <-time.After(time.Millisecond * 200):
+	}
+}
+
+func TestServer_DedupLifetimeFakeClock(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp4", "127.0.0.1:")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	fakeClock := clock.NewFake(time.Now())
+	var handled uint32
+	s := udp.NewServer(udp.WithClock(fakeClock), udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		atomic.AddUint32(&handled, 1)
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("a")))
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	c, err := net.DialUDP("udp4", nil, l.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	defer c.Close()
+	// CON GET with the message ID 0x1234 and the token 0xab
+	req := []byte{0x41, byte(codes.GET), 0x12, 0x34, 0xab}
+	exchange := func() {
+		_, err := c.Write(req)
+		require.NoError(t, err)
+		err = c.SetReadDeadline(time.Now().Add(time.Second))
+		require.NoError(t, err)
+		_, err = c.Read(make([]byte, 64))
+		require.NoError(t, err)
+	}
+	exchange()
+	fakeClock.Advance(client.ExchangeLifetime - time.Nanosecond)
+	exchange()
+	require.Equal(t, uint32(1), atomic.LoadUint32(&handled))
+
+	// the same message ID is a new message after the exchange lifetime
+	fakeClock.Advance(time.Nanosecond)
+	exchange()
+	require.Equal(t, uint32(2), atomic.LoadUint32(&handled))
+}
+
+func TestServer_SeparateResponse(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp4", "127.0.0.1:")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	s := udp.NewServer(udp.WithSeparateResponse(true), udp.WithTransmission(time.Second, time.Millisecond*400, 4),
+		udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+			time.Sleep(time.Millisecond * 600)
+			err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("slow")))
+			require.NoError(t, err)
+		}))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	c, err := net.DialUDP("udp4", nil, l.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	defer c.Close()
+	// CON GET with the message ID 0x1234 and the token 0xab
+	start := time.Now()
+	_, err = c.Write([]byte{0x41, byte(codes.GET), 0x12, 0x34, 0xab})
+	require.NoError(t, err)
+	read := func() *pool.Message {
+		err := c.SetReadDeadline(time.Now().Add(time.Second))
+		require.NoError(t, err)
+		buf := make([]byte, 64)
+		n, err := c.Read(buf)
+		require.NoError(t, err)
+		msg := pool.AcquireMessage(context.Background())
+		_, err = msg.Unmarshal(buf[:n])
+		require.NoError(t, err)
+		return msg
+	}
+
+	ack := read()
+	defer pool.ReleaseMessage(ack)
+	require.Less(t, int64(time.Since(start)), int64(time.Millisecond*600))
+	require.Equal(t, udpMessage.Acknowledgement, ack.Type())
+	require.Equal(t, codes.Empty, ack.Code())
+	require.Equal(t, uint16(0x1234), ack.MessageID())
+
+	resp := read()
+	defer pool.ReleaseMessage(resp)
+	require.Equal(t, udpMessage.Confirmable, resp.Type())
+	require.Equal(t, codes.Content, resp.Code())
+	require.Equal(t, message.Token{0xab}, resp.Token())
+	_, err = c.Write([]byte{0x60, byte(codes.Empty), byte(resp.MessageID() >> 8), byte(resp.MessageID())})
+	require.NoError(t, err)
+
+	// the client correlates the separate response by the token
+	cc, err := udp.Dial(l.LocalAddr().String())
+	require.NoError(t, err)
+	defer cc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+	got, err := cc.Get(ctx, "/a")
+	require.NoError(t, err)
+	require.Equal(t, codes.Content, got.Code())
+	body, err := got.ReadBody()
+	require.NoError(t, err)
+	require.Equal(t, "slow", string(body))
+}
+
+func TestServer_Broadcast(t *testing.T) {
+	l, err := coapNet.NewListenUDP("udp4", "127.0.0.1:")
+	require.NoError(t, err)
+	defer l.Close()
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, nil)
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	const numPeers = 100
+	peers := make([]*net.UDPConn, 0, numPeers)
+	for i := 0; i < numPeers; i++ {
+		c, err := net.DialUDP("udp4", nil, l.LocalAddr().(*net.UDPAddr))
+		require.NoError(t, err)
+		defer c.Close()
+		// NON GET creates the connection of the peer
+		_, err = c.Write([]byte{0x50, byte(codes.GET), 0, byte(i)})
+		require.NoError(t, err)
+		err = c.SetReadDeadline(time.Now().Add(time.Second))
+		require.NoError(t, err)
+		buf := make([]byte, 64)
+		_, err = c.Read(buf)
+		require.NoError(t, err)
+		peers = append(peers, c)
+	}
+	require.Len(t, s.Connections(), numPeers)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = s.Broadcast(ctx, func() *pool.Message {
+		msg := pool.AcquireMessage(ctx)
+		msg.SetType(udpMessage.NonConfirmable)
+		msg.SetCode(codes.POST)
+		msg.SetToken(message.Token{0xab})
+		msg.SetPath("/config")
+		return msg
+	})
+	require.NoError(t, err)
+
+	for _, c := range peers {
+		err = c.SetReadDeadline(time.Now().Add(time.Second))
+		require.NoError(t, err)
+		buf := make([]byte, 64)
+		n, err := c.Read(buf)
+		require.NoError(t, err)
+		msg := pool.AcquireMessage(ctx)
+		_, err = msg.Unmarshal(buf[:n])
+		require.NoError(t, err)
+		require.Equal(t, udpMessage.NonConfirmable, msg.Type())
+		require.Equal(t, codes.POST, msg.Code())
+		path, err := msg.Options().Path()
+		require.NoError(t, err)
+		require.Equal(t, "config", path)
+		pool.ReleaseMessage(msg)
+	}
+}
+
+func TestServer_ResponseEchoesToken(t *testing.T) {
+	ld, err := coapNet.NewListenUDP("udp4", "")
+	require.NoError(t, err)
+	defer ld.Close()
+
+	sd := udp.NewServer()
+	var serverWg sync.WaitGroup
+	defer func() {
+		sd.Stop()
+		serverWg.Wait()
+	}()
+	serverWg.Add(1)
+	go func() {
+		defer serverWg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	c, err := net.Dial("udp4", ld.LocalAddr().String())
+	require.NoError(t, err)
+	defer c.Close()
+
+	tests := []struct {
+		name     string
+		typ      udpMessage.Type
+		wantType udpMessage.Type
+	}{
+		{name: "confirmable", typ: udpMessage.Confirmable, wantType: udpMessage.Acknowledgement},
+		{name: "nonConfirmable", typ: udpMessage.NonConfirmable, wantType: udpMessage.NonConfirmable},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mid := uint16(0x1234 + i)
+			req := udpMessage.Message{
+				Code:      codes.GET,
+				Token:     []byte{0xab, 0xcd, byte(i)},
+				MessageID: mid,
+				Type:      tt.typ,
+				Options:   message.Options{{ID: message.URIPath, Value: []byte("unknown")}},
+			}
+			data, err := req.Marshal()
+			require.NoError(t, err)
+			_, err = c.Write(data)
+			require.NoError(t, err)
+			err = c.SetReadDeadline(time.Now().Add(time.Second))
+			require.NoError(t, err)
+			buf := make([]byte, 64)
+			n, err := c.Read(buf)
+			require.NoError(t, err)
+			var resp udpMessage.Message
+			_, err = resp.Unmarshal(buf[:n])
+			require.NoError(t, err)
+			require.Equal(t, codes.NotFound, resp.Code)
+			require.Equal(t, tt.wantType, resp.Type)
+			require.Equal(t, req.Token, resp.Token)
+			if tt.typ == udpMessage.Confirmable {
+				require.Equal(t, mid, resp.MessageID)
+			}
+		})
+	}
+}
+
+func TestServer_RejectsTooLargeRequest(t *testing.T) {
+	ld, err := coapNet.NewListenUDP("udp4", "")
+	require.NoError(t, err)
+	defer ld.Close()
+
+	sd := udp.NewServer(udp.WithMaxMessageSize(1024))
+	var serverWg sync.WaitGroup
+	defer func() {
+		sd.Stop()
+		serverWg.Wait()
+	}()
+	serverWg.Add(1)
+	go func() {
+		defer serverWg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	c, err := net.Dial("udp4", ld.LocalAddr().String())
+	require.NoError(t, err)
+	defer c.Close()
+
+	exchange := func(req udpMessage.Message) udpMessage.Message {
+		data, err := req.Marshal()
+		require.NoError(t, err)
+		_, err = c.Write(data)
+		require.NoError(t, err)
+		err = c.SetReadDeadline(time.Now().Add(time.Second))
+		require.NoError(t, err)
+		buf := make([]byte, 64)
+		n, err := c.Read(buf)
+		require.NoError(t, err)
+		resp := udpMessage.Message{
+			Options: make(message.Options, 0, 16),
+		}
+		_, err = resp.Unmarshal(buf[:n])
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := exchange(udpMessage.Message{
+		Code:      codes.POST,
+		Token:     []byte{0x1},
+		MessageID: 1,
+		Type:      udpMessage.Confirmable,
+		Payload:   make([]byte, 2048),
+	})
+	require.Equal(t, codes.RequestEntityTooLarge, resp.Code)
+	require.Equal(t, udpMessage.Acknowledgement, resp.Type)
+	require.Equal(t, uint16(1), resp.MessageID)
+	require.Equal(t, message.Token{0x1}, resp.Token)
+	size1, err := resp.Options.GetUint32(message.Size1)
+	require.NoError(t, err)
+	require.Equal(t, uint32(1024), size1)
+
+	// the connection is kept, so the peer can retry by a smaller request
+	resp = exchange(udpMessage.Message{
+		Code:      codes.GET,
+		Token:     []byte{0x2},
+		MessageID: 2,
+		Type:      udpMessage.Confirmable,
+	})
+	require.Equal(t, codes.NotFound, resp.Code)
+	require.Equal(t, message.Token{0x2}, resp.Token)
+}
+
+func TestServer_LossyLink(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	var dropped, delayed int
+	// 30% of received packets is lost, 10% is delayed over the acknowledge timeout to cause duplicates
+	l, err := coapNet.NewListenUDP("udp4", "", coapNet.WithPacketFilter(func(p coapNet.Packet) bool {
+		v := random.Intn(10)
+		switch {
+		case v < 3:
+			dropped++
+			return false
+		case v == 3:
+			delayed++
+			time.Sleep(time.Millisecond * 100)
+		}
+		return true
+	}))
+	require.NoError(t, err)
+	defer l.Close()
+
+	var lock sync.Mutex
+	handled := make(map[string]int)
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		path, err := r.Options().Path()
+		require.NoError(t, err)
+		lock.Lock()
+		handled[path]++
+		lock.Unlock()
+		err = w.SetResponse(codes.Content, message.TextPlain, nil)
+		require.NoError(t, err)
+	}))
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer s.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	cc, err := udp.Dial(l.LocalAddr().String(), udp.WithTransmission(1, time.Millisecond*50, 10))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	const requests = 30
+	for i := 0; i < requests; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*20)
+		resp, err := cc.Get(ctx, fmt.Sprintf("/%v", i))
+		cancel()
+		require.NoError(t, err)
+		require.Equal(t, codes.Content, resp.Code())
+	}
+
+	s.Stop()
+	wg.Wait()
+	require.Greater(t, dropped, 0)
+	require.Greater(t, delayed, 0)
+	require.Len(t, handled, requests)
+	for path, n := range handled {
+		// duplicates are answered from the cache of responses
+		require.Equal(t, 1, n, path)
+	}
+}
+
+func TestServer_DualStack(t *testing.T) {
+	l, err := coapNet.NewListenUDPDualStack(":0")
+	require.NoError(t, err)
+	defer l.Close()
+	port := l.LocalAddr().(*net.UDPAddr).Port
+
+	ifaces, err := net.Interfaces()
+	require.NoError(t, err)
+	groups := []string{"224.0.1.187", "ff02::fd"}
+	for _, group := range groups {
+		a := &net.UDPAddr{IP: net.ParseIP(group), Port: port}
+		for _, iface := range ifaces {
+			iface := iface
+			err := l.JoinGroup(&iface, a)
+			if err != nil {
+				t.Logf("cannot JoinGroup(%v, %v): %v", iface.Name, a, err)
+			}
+		}
+	}
+	err = l.SetMulticastLoopback(true)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	s := udp.NewServer(udp.WithHandlerFunc(func(w *client.ResponseWriter, r *pool.Message) {
+		err := w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte("ok")))
+		require.NoError(t, err)
+	}))
+	defer s.Stop()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := s.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	for _, addr := range []string{"127.0.0.1", "::1"} {
+		cc, err := udp.Dial(net.JoinHostPort(addr, fmt.Sprint(port)))
+		require.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		resp, err := cc.Get(ctx, "/a")
+		cancel()
+		require.NoError(t, err)
+		require.Equal(t, codes.Content, resp.Code())
+		err = cc.Close()
+		require.NoError(t, err)
+	}
+
+	ld, err := coapNet.NewListenUDPDualStack(":0")
+	require.NoError(t, err)
+	defer ld.Close()
+	sd := udp.NewServer()
+	defer sd.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := sd.Serve(ld)
+		require.NoError(t, err)
+	}()
+
+	for _, group := range groups {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*500)
+		recv := &mcastreceiver{}
+		err = sd.Discover(ctx, net.JoinHostPort(group, fmt.Sprint(port)), "/oic/res", recv.process)
+		cancel()
+		require.NoError(t, err)
+		got := recv.pop()
+		require.NotEmpty(t, got, group)
+		assert.Equal(t, codes.Content, got[0].Code())
+	}
+}
@@ -110,7 +110,8 @@ func (s *Session) Run(cc *client.ClientConn) (err error) {
 			err = err1
 		}
 	}()
-	m := make([]byte, s.maxMessageSize)
+	// one extra byte detects datagrams exceeding the max message size, which would be truncated otherwise
+	m := make([]byte, s.maxMessageSize+1)
 	for {
 		buf := m
 		n, _, err := s.connection.ReadWithContext(s.Context(), buf)
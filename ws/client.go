@@ -0,0 +1,40 @@
+// Package ws implements CoAP over WebSockets (RFC 8323) on top of the CoAP over TCP client connection.
+package ws
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/url"
+
+	"github.com/plgd-dev/go-coap/v2/tcp"
+	"golang.org/x/net/websocket"
+)
+
+// Dial creates a client connection to the CoAP over WebSocket endpoint, eg. wss://host/.well-known/coap.
+// The tlsCfg is used for the wss scheme, nil means the default configuration.
+func Dial(target string, tlsCfg *tls.Config, opts ...tcp.DialOption) (*tcp.ClientConn, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse target: %w", err)
+	}
+	origin := url.URL{Scheme: "http", Host: u.Host}
+	switch u.Scheme {
+	case "ws":
+	case "wss":
+		origin.Scheme = "https"
+	default:
+		return nil, fmt.Errorf("unsupported scheme %v", u.Scheme)
+	}
+	cfg, err := websocket.NewConfig(target, origin.String())
+	if err != nil {
+		return nil, err
+	}
+	cfg.Protocol = []string{Subprotocol}
+	cfg.TlsConfig = tlsCfg
+	ws, err := websocket.DialConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, tcp.WithCloseSocket())
+	return tcp.Client(newConn(ws, nil), opts...), nil
+}
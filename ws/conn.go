@@ -0,0 +1,150 @@
+package ws
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	coapTCP "github.com/plgd-dev/go-coap/v2/tcp/message"
+	"golang.org/x/net/websocket"
+)
+
+// conn adapts a WebSocket connection to the stream of CoAP over TCP messages processed by tcp.ClientConn.
+// Each CoAP message is carried by one binary frame which has the Len nibble set to zero and no extended
+// length, because the length is given by the frame (RFC 8323 section 4.4).
+type conn struct {
+	*websocket.Conn
+	remoteAddr net.Addr
+
+	readLock sync.Mutex
+	readBuf  []byte
+
+	writeLock sync.Mutex
+	writeBuf  []byte
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func newConn(ws *websocket.Conn, remoteAddr net.Addr) *conn {
+	if remoteAddr == nil {
+		remoteAddr = ws.RemoteAddr()
+	}
+	ws.PayloadType = websocket.BinaryFrame
+	return &conn{
+		Conn:       ws,
+		remoteAddr: remoteAddr,
+		done:       make(chan struct{}),
+	}
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// Read reads the messages received by frames in the CoAP over TCP framing.
+func (c *conn) Read(b []byte) (int, error) {
+	c.readLock.Lock()
+	defer c.readLock.Unlock()
+	for len(c.readBuf) == 0 {
+		var frame []byte
+		err := websocket.Message.Receive(c.Conn, &frame)
+		if err != nil {
+			return 0, err
+		}
+		c.readBuf, err = frameToStream(frame)
+		if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, c.readBuf)
+	c.readBuf = c.readBuf[n:]
+	return n, nil
+}
+
+// Write sends each complete message of the CoAP over TCP framing by a frame.
+func (c *conn) Write(b []byte) (int, error) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	c.writeBuf = append(c.writeBuf, b...)
+	for len(c.writeBuf) > 0 {
+		var hdr coapTCP.MessageHeader
+		err := hdr.Unmarshal(c.writeBuf)
+		if err == message.ErrShortRead || (err == nil && len(c.writeBuf) < hdr.TotalLen) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		err = websocket.Message.Send(c.Conn, streamToFrame(c.writeBuf[:hdr.TotalLen]))
+		if err != nil {
+			return 0, err
+		}
+		c.writeBuf = c.writeBuf[hdr.TotalLen:]
+	}
+	if len(c.writeBuf) == 0 {
+		c.writeBuf = nil
+	}
+	return len(b), nil
+}
+
+func (c *conn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		err = c.Conn.Close()
+		close(c.done)
+	})
+	return err
+}
+
+// extendedLengthSize returns number of bytes of the extended length for the Len nibble.
+func extendedLengthSize(lenNib byte) int {
+	switch lenNib {
+	case 13:
+		return 1
+	case 14:
+		return 2
+	case 15:
+		return 4
+	}
+	return 0
+}
+
+// streamToFrame converts the message in the CoAP over TCP framing to the frame payload.
+func streamToFrame(data []byte) []byte {
+	ext := extendedLengthSize(data[0] >> 4)
+	frame := make([]byte, 0, len(data)-ext)
+	frame = append(frame, data[0]&0x0f)
+	return append(frame, data[1+ext:]...)
+}
+
+// frameToStream converts the frame payload to the message in the CoAP over TCP framing.
+func frameToStream(frame []byte) ([]byte, error) {
+	if len(frame) < 2 {
+		return nil, message.ErrShortRead
+	}
+	if frame[0]>>4 != 0 {
+		return nil, fmt.Errorf("invalid length of message in frame: %v", frame[0]>>4)
+	}
+	tkl := int(frame[0] & 0x0f)
+	optsLen := len(frame) - 2 - tkl
+	if optsLen < 0 {
+		return nil, message.ErrShortRead
+	}
+	data := make([]byte, 0, len(frame)+4)
+	switch {
+	case optsLen < coapTCP.MESSAGE_LEN13_BASE:
+		data = append(data, byte(optsLen<<4)|byte(tkl))
+	case optsLen < coapTCP.MESSAGE_LEN14_BASE:
+		data = append(data, 13<<4|byte(tkl), byte(optsLen-coapTCP.MESSAGE_LEN13_BASE))
+	case optsLen < coapTCP.MESSAGE_LEN15_BASE:
+		data = append(data, 14<<4|byte(tkl), 0, 0)
+		binary.BigEndian.PutUint16(data[1:], uint16(optsLen-coapTCP.MESSAGE_LEN14_BASE))
+	default:
+		data = append(data, 15<<4|byte(tkl), 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(data[1:], uint32(optsLen-coapTCP.MESSAGE_LEN15_BASE))
+	}
+	return append(data, frame[1:]...), nil
+}
@@ -0,0 +1,38 @@
+package ws
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	coapTCP "github.com/plgd-dev/go-coap/v2/tcp/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFraming(t *testing.T) {
+	for _, size := range []int{0, 1, 12, 13, 268, 269, 65804, 65805, 70000} {
+		msg := coapTCP.Message{
+			Code:    codes.Content,
+			Token:   []byte{1, 2, 3},
+			Options: message.Options{{ID: message.ContentFormat, Value: []byte{}}},
+			Payload: bytes.Repeat([]byte{'a'}, size),
+		}
+		if size == 0 {
+			msg.Payload = nil
+		}
+		data, err := msg.Marshal()
+		require.NoError(t, err)
+		frame := streamToFrame(data)
+		require.Equal(t, byte(len(msg.Token)), frame[0])
+		require.Equal(t, byte(codes.Content), frame[1])
+		stream, err := frameToStream(frame)
+		require.NoError(t, err)
+		require.Equal(t, data, stream)
+	}
+
+	_, err := frameToStream([]byte{0x10, byte(codes.GET)})
+	require.Error(t, err)
+	_, err = frameToStream([]byte{0x02, byte(codes.GET), 1})
+	require.Error(t, err)
+}
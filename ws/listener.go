@@ -0,0 +1,94 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"golang.org/x/net/websocket"
+)
+
+// Subprotocol is the WebSocket subprotocol of CoAP.
+const Subprotocol = "coap"
+
+// WellKnownPath is the path of the CoAP over WebSocket endpoint.
+const WellKnownPath = "/.well-known/coap"
+
+// Listener accepts CoAP over WebSocket connections upgraded by ServeHTTP. It is registered to a http server,
+// usually at WellKnownPath, and it is served by tcp.Server like a TCP listener.
+type Listener struct {
+	server websocket.Server
+	conns  chan *conn
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// NewListener creates a listener of CoAP over WebSocket connections.
+func NewListener() *Listener {
+	l := &Listener{
+		conns:  make(chan *conn),
+		closed: make(chan struct{}),
+	}
+	l.server = websocket.Server{
+		Handshake: handshake,
+		Handler:   l.handle,
+	}
+	return l
+}
+
+func handshake(cfg *websocket.Config, r *http.Request) error {
+	for _, p := range cfg.Protocol {
+		if p == Subprotocol {
+			cfg.Protocol = []string{Subprotocol}
+			return nil
+		}
+	}
+	return fmt.Errorf("missing websocket subprotocol %v", Subprotocol)
+}
+
+// ServeHTTP upgrades the request to the WebSocket connection and passes it to AcceptWithContext.
+func (l *Listener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.server.ServeHTTP(w, r)
+}
+
+func (l *Listener) handle(ws *websocket.Conn) {
+	var remoteAddr net.Addr
+	if addr, err := net.ResolveTCPAddr("tcp", ws.Request().RemoteAddr); err == nil {
+		remoteAddr = addr
+	}
+	c := newConn(ws, remoteAddr)
+	select {
+	case l.conns <- c:
+	case <-l.closed:
+		return
+	}
+	// the connection is closed by the websocket server when the handler returns
+	select {
+	case <-c.done:
+	case <-l.closed:
+	}
+}
+
+// AcceptWithContext waits for the next connection.
+func (l *Listener) AcceptWithContext(ctx context.Context) (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-l.closed:
+		return nil, coapNet.ErrListenerIsClosed
+	}
+}
+
+// Close stops accepting of connections and closes the accepted ones.
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+	})
+	return nil
+}
@@ -0,0 +1,106 @@
+package ws_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/plgd-dev/go-coap/v2/message"
+	"github.com/plgd-dev/go-coap/v2/message/codes"
+	"github.com/plgd-dev/go-coap/v2/tcp"
+	"github.com/plgd-dev/go-coap/v2/tcp/message/pool"
+	"github.com/plgd-dev/go-coap/v2/ws"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDial(t *testing.T) {
+	for _, secure := range []bool{false, true} {
+		name := "ws"
+		if secure {
+			name = "wss"
+		}
+		t.Run(name, func(t *testing.T) {
+			testDial(t, secure)
+		})
+	}
+}
+
+func testDial(t *testing.T, secure bool) {
+	l := ws.NewListener()
+	defer l.Close()
+	mux := http.NewServeMux()
+	mux.Handle(ws.WellKnownPath, l)
+	var httpSrv *httptest.Server
+	var tlsCfg *tls.Config
+	if secure {
+		httpSrv = httptest.NewTLSServer(mux)
+		tlsCfg = httpSrv.Client().Transport.(*http.Transport).TLSClientConfig
+	} else {
+		httpSrv = httptest.NewServer(mux)
+	}
+	defer httpSrv.Close()
+
+	largeBody := strings.Repeat("a", 20000)
+	sd := tcp.NewServer(tcp.WithHandlerFunc(func(w *tcp.ResponseWriter, r *pool.Message) {
+		path, err := r.Options().Path()
+		require.NoError(t, err)
+		body := "hello"
+		if path == "large" {
+			body = largeBody
+		}
+		err = w.SetResponse(codes.Content, message.TextPlain, bytes.NewReader([]byte(body)))
+		require.NoError(t, err)
+	}))
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer sd.Stop()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := sd.Serve(l)
+		require.NoError(t, err)
+	}()
+
+	target := "ws" + strings.TrimPrefix(httpSrv.URL, "http") + ws.WellKnownPath
+	cc, err := ws.Dial(target, tlsCfg)
+	require.NoError(t, err)
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	err = cc.Ping(ctx)
+	require.NoError(t, err)
+
+	for path, want := range map[string]string{"/a": "hello", "/large": largeBody} {
+		resp, err := cc.Get(ctx, path)
+		require.NoError(t, err)
+		require.Equal(t, codes.Content, resp.Code())
+		body, err := resp.ReadBody()
+		require.NoError(t, err)
+		require.Equal(t, want, string(body))
+	}
+}
+
+func TestDialWithoutSubprotocol(t *testing.T) {
+	l := ws.NewListener()
+	defer l.Close()
+	httpSrv := httptest.NewServer(l)
+	defer httpSrv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, httpSrv.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+}